@@ -1,15 +1,26 @@
 #!/usr/bin/env python3
+import bisect
+import copy
+import hmac
 import json
 import logging
+import multiprocessing
 import os
+import re
+import secrets
+import shutil
+import socket
 import sqlite3
 import struct
+import subprocess
 import sys
 import threading
 import time
 import uuid
-from contextlib import contextmanager
-from datetime import datetime, timezone
+from collections import Counter, defaultdict
+from contextlib import contextmanager, nullcontext
+from datetime import datetime, timedelta, timezone
+from email.utils import formatdate, parsedate_to_datetime
 from pathlib import Path
 import numpy as np
 import psutil
@@ -18,14 +29,16 @@ import serial.tools.list_ports
 
 # Environment setup
 from dotenv import load_dotenv
-from flask import Flask, jsonify, request
+from flask import Flask, g, has_request_context, jsonify, request
 from google.auth.transport import requests as google_requests
 from google.oauth2 import id_token
+from werkzeug.exceptions import HTTPException
+from werkzeug.middleware.proxy_fix import ProxyFix
 
 env_path = Path(__file__).parent.parent / ".env"
 load_dotenv(env_path)
 app = Flask(__name__)
-app.config["MAX_CONTENT_LENGTH"] = 16 * 1024 * 1024  # 16 MB max file size
+app.config["MAX_CONTENT_LENGTH"] = int(os.getenv("MAX_CONTENT_LENGTH", 16 * 1024 * 1024))  # 16 MB max file size
 logging.basicConfig(
     level=logging.INFO,
     format="%(asctime)s [%(levelname)s] %(message)s",
@@ -36,6 +49,16 @@ BASE_DIR = Path(__file__).parent.parent
 DATA_DIR = BASE_DIR / "data"
 DB_PATH = DATA_DIR / "database" / "dacroq.db"
 LDPC_DATA_DIR = DATA_DIR / "ldpc"
+SAT_PRESETS_DIR = DATA_DIR / "sat" / "presets"
+PRESET_LOCKS_DIR = DATA_DIR / "sat" / "locks"
+PRESET_SNAPSHOTS_DIR = DATA_DIR / "sat" / "snapshots"
+MODELS_DIR = DATA_DIR / "models"
+CHECKPOINT_DIR = DATA_DIR / "checkpoints"
+ARTIFACTS_DIR = DATA_DIR / "artifacts"
+PUBLIC_DATASETS_DIR = DATA_DIR / "public"
+FIRMWARE_DIR = DATA_DIR / "firmware"
+# Staging directories start with this, so the retention sweeper can find any a crash left behind
+TEMP_PREFIX = ".tmp-"
 
 # CORS configuration
 ALLOWED_ORIGINS = set(
@@ -46,6 +69,19 @@ ALLOWED_ORIGINS = set(
     ).split(",")
 )
 
+# Request limits and optional API key; both are disabled when unset
+RATE_LIMIT_PER_MINUTE = int(os.getenv("RATE_LIMIT_PER_MINUTE", 0))
+# Buckets refilled to full are dropped this often, so one-off clients don't accumulate
+RATE_LIMIT_SWEEP_SECONDS = 60
+API_KEY = os.getenv("DACROQ_API_KEY")
+# Separate key for /admin/*; the admin routes are disabled without it
+ADMIN_API_KEY = os.getenv("DACROQ_ADMIN_KEY")
+ADMIN_PREFIX = "/admin/"
+# Reverse proxies in front of the API whose X-Forwarded-For is trusted; 0 uses the socket address
+TRUSTED_PROXY_HOPS = int(os.getenv("TRUSTED_PROXY_HOPS", 0))
+PUBLIC_PATHS = {"/", "/health", "/capabilities", "/v1/capabilities", "/openapi.json"}
+PUBLIC_PREFIXES = ("/public/",)
+
 # Helper function to get current UTC time
 def utc_now():
     return datetime.now(timezone.utc).isoformat()
@@ -73,7 +109,9 @@ class HardwareDeviceManager:
                 "identification_keywords": ["DAEDALUS", "3-SAT"]
             }
         }
-        self.lock = threading.Lock()
+        self.lock = threading.RLock()  # get_available_ports_for_device re-enters via is_port_available
+        self.devices = {}  # device_id -> registry entry
+        self.device_identities = {}  # port -> last STATUS response
     
     def discover_all_devices(self):
         """Auto-discover all connected Teensy devices and identify them"""
@@ -81,6 +119,7 @@ class HardwareDeviceManager:
         
         logger.info("🔍 Starting device auto-discovery...")
         discovered = {}
+        devices = {}
         
         # Find all potential Teensy devices
         for port in serial.tools.list_ports.comports():
@@ -92,13 +131,43 @@ class HardwareDeviceManager:
                     logger.info(f"✅ Discovered {device_type} device at {port.device}")
                     # Auto-register the discovered device
                     self.register_port(port.device, device_type)
+                    entry = self._registry_entry(port, device_type)
+                    entry["firmware_version"] = self._firmware_version(port.device)
+                    entry["firmware_supported"] = firmware_supported(device_type, entry["firmware_version"])
+                    if entry["firmware_supported"] is False:
+                        logger.warning(
+                            f"⚠️ {entry['id']} runs firmware {entry['firmware_version']}, "
+                            f"below the supported minimum {MIN_FIRMWARE_VERSIONS.get(device_type)}"
+                        )
+                    devices[entry["id"]] = entry
         
         with self.lock:
             self.discovered_devices = discovered
+            self.devices = devices
         
         logger.info(f"🎯 Discovery complete: {list(discovered.keys())}")
         return discovered
     
+    def rediscover_device(self, device):
+        """Probe one board again after it rebooted, leaving every other port alone"""
+        import serial.tools.list_ports
+
+        port = next((
+            p for p in serial.tools.list_ports.comports()
+            if (p.serial_number == device["serial_number"] if device.get("serial_number") else p.device == device["port"])
+        ), None)
+        if not port or self._identify_device(port.device) != device["device_type"]:
+            return None
+        entry = self._registry_entry(port, device["device_type"])
+        entry["firmware_version"] = self._firmware_version(port.device)
+        entry["firmware_supported"] = firmware_supported(device["device_type"], entry["firmware_version"])
+        with self.lock:
+            if port.device != device["port"]:
+                self.unregister_port(device["port"])
+                self.register_port(port.device, device["device_type"])
+            self.devices[entry["id"]] = entry
+        return dict(entry)
+    
     def _identify_device(self, port_name):
         """Identify what type of device is connected to a specific port"""
         try:
@@ -124,6 +193,7 @@ class HardwareDeviceManager:
             
             test_serial.close()
             response = " ".join(response_lines)
+            self.device_identities[port_name] = response
             
             logger.debug(f"Device at {port_name} responded: {response}")
             
@@ -154,6 +224,52 @@ class HardwareDeviceManager:
             logger.debug(f"Failed to identify device at {port_name}: {e}")
             return None
     
+    def _firmware_version(self, port_name):
+        """Ask the board for its firmware version (HEALTH_CHECK reports VERSION:x.y)"""
+        try:
+            test_serial = serial.Serial(port_name, 2_000_000, timeout=2)
+            test_serial.reset_input_buffer()
+            test_serial.write(b"HEALTH_CHECK\n")
+            test_serial.flush()
+            time.sleep(0.5)
+            version = None
+            while test_serial.in_waiting:
+                line = test_serial.readline().decode('utf-8', errors='ignore').strip()
+                if line.startswith("VERSION:"):
+                    version = line[len("VERSION:"):]
+            test_serial.close()
+            return version
+        except Exception as e:
+            logger.debug(f"Failed to read firmware version at {port_name}: {e}")
+            return None
+
+    def device_at_port(self, port):
+        with self.lock:
+            return next((dict(d) for d in self.devices.values() if d["port"] == port), None)
+
+    def _registry_entry(self, port, device_type):
+        """Describe a discovered device; the USB serial number keeps its ID stable across ports"""
+        config = self.device_configs[device_type]
+        return {
+            "id": f"{device_type}-{port.serial_number or Path(port.device).name}",
+            "device_type": device_type,
+            "chip": config["device_type"],
+            "port": port.device,
+            "serial_number": port.serial_number,
+            "description": port.description,
+            "identity": self.device_identities.get(port.device),
+            "discovered_at": utc_now(),
+        }
+
+    def list_devices(self):
+        with self.lock:
+            return [dict(device) for device in self.devices.values()]
+
+    def get_device(self, device_id):
+        with self.lock:
+            device = self.devices.get(device_id)
+            return dict(device) if device else None
+
     def get_device_port(self, device_type):
         """Get the current port for a specific device type"""
         with self.lock:
@@ -215,6 +331,30 @@ class HardwareDeviceManager:
                 "total_devices": len(self.active_ports)
             }
 
+# Oldest bridge firmware each board type is known to work with
+MIN_FIRMWARE_VERSIONS = {
+    "sat": os.getenv("SAT_MIN_FIRMWARE_VERSION", "1.0"),
+    "ldpc": os.getenv("LDPC_MIN_FIRMWARE_VERSION", "1.0"),
+}
+
+def parse_firmware_version(version):
+    return tuple(int(part) for part in re.findall(r"\d+", version or ""))
+
+def firmware_supported(device_type, version):
+    """True/False against the minimum version, None when the board didn't report one"""
+    if not version:
+        return None
+    return parse_firmware_version(version) >= parse_firmware_version(MIN_FIRMWARE_VERSIONS.get(device_type))
+
+def require_supported_firmware(port):
+    """Refuse to benchmark on a registered board whose firmware is known to be unsupported"""
+    device = hardware_manager.device_at_port(port)
+    if device and device.get("firmware_supported") is False:
+        raise RuntimeError(
+            f"Unsupported firmware {device['firmware_version']} on {device['id']} "
+            f"(requires {MIN_FIRMWARE_VERSIONS.get(device['device_type'])}+)"
+        )
+
 # Global hardware device manager
 hardware_manager = HardwareDeviceManager()
 
@@ -299,18 +439,160 @@ def init_db():
                 active BOOLEAN DEFAULT 1
             );
 
+            CREATE TABLE IF NOT EXISTS sat_references (
+                id TEXT PRIMARY KEY,
+                preset TEXT NOT NULL,
+                solver TEXT NOT NULL,
+                success_rate REAL NOT NULL,
+                tts_mean_ms REAL NOT NULL,
+                tts_p95_ms REAL,
+                total_runs INTEGER,
+                source_test_id TEXT,
+                created TEXT NOT NULL,
+                UNIQUE (preset, solver)
+            );
+
+            CREATE TABLE IF NOT EXISTS sat_known_answers (
+                instance_hash TEXT PRIMARY KEY,
+                status TEXT NOT NULL,
+                source TEXT NOT NULL,
+                label TEXT,
+                imported TEXT NOT NULL
+            );
+
+            CREATE TABLE IF NOT EXISTS hardware_reservations (
+                id TEXT PRIMARY KEY,
+                user TEXT NOT NULL,
+                device_id TEXT,
+                start_time TEXT NOT NULL,
+                end_time TEXT NOT NULL,
+                note TEXT,
+                created TEXT NOT NULL
+            );
+
+            CREATE TABLE IF NOT EXISTS tenant_usage (
+                tenant TEXT NOT NULL,
+                day TEXT NOT NULL,
+                solve_seconds REAL NOT NULL DEFAULT 0,
+                PRIMARY KEY (tenant, day)
+            );
+
+            CREATE TABLE IF NOT EXISTS hardware_calibrations (
+                id TEXT PRIMARY KEY,
+                device_id TEXT NOT NULL,
+                status TEXT NOT NULL,
+                profile TEXT NOT NULL,
+                created TEXT NOT NULL
+            );
+
             -- Indexes
             CREATE INDEX IF NOT EXISTS idx_users_google_sub ON users(google_sub);
             CREATE INDEX IF NOT EXISTS idx_tests_created ON tests(created);
             CREATE INDEX IF NOT EXISTS idx_ldpc_jobs_created ON ldpc_jobs(created);
+            CREATE INDEX IF NOT EXISTS idx_hardware_calibrations_device ON hardware_calibrations(device_id, created);
         """
         )
         conn.commit()
 
+# --- Capabilities & Deprecations ------------------------------------------------
+API_VERSION = "1"
+# Optional behaviour clients can test for instead of probing routes; sent as X-Dacroq-Features
+API_FEATURES = (
+    "solver-config", "oscillator-simulator", "simulator-profile", "deterministic-simulation",
+    "hardware-registry", "hardware-queues", "hardware-reservations", "multi-board-batches",
+    "firmware-updates", "hardware-calibration", "fault-injection", "ising-annealer", "power-monitor",
+    "test-artifacts", "test-events", "jobs", "batch-resume", "summary-recompute", "known-answers",
+    "anomaly-detection", "instance-weights", "sim-correlation", "result-export", "public-datasets",
+    "preset-snapshots", "openapi", "result-cache", "response-compression",
+    "conditional-requests", "admin", "solve-one", "solve-by-url",
+    "tenants", "versioned-paths", "tls", "unix-socket", "streamed-uploads", "resumable-uploads",
+    "error-envelope", "results-store", "run-query",
+    "leaderboard", "object-storage", "retention", "instance-identity", "results-archive",
+    "measured-host-energy", "cactus-plot", "paired-comparison",
+)
+# Legacy routes (by URL rule) and request fields, with the date they may be removed
+DEPRECATED_ROUTES = {
+    "/hardware/status": {"sunset": "2027-04-01", "successor": "/hardware",
+                         "note": "Use /hardware for devices and /hardware/queues for board usage"},
+    "/sat/test-summaries": {"sunset": "2027-04-01", "successor": "/sat/tests",
+                            "note": "Reads fields that SAT tests no longer store"},
+    "/v1/capabilities": {"sunset": "2027-10-01", "successor": "/capabilities",
+                         "note": "The version now comes from the /api/v1 prefix"},
+}
+DEPRECATED_FIELDS = {
+    "enable_hardware": {"sunset": "2027-04-01", "successor": "enable_daedalus"},
+}
+# Every route is served under API_PREFIX; the unprefixed paths remain as deprecated aliases
+API_PREFIX = f"/api/v{API_VERSION}"
+LEGACY_PATHS_SUNSET = "2027-10-01"
+# Probes and the root listing stay unprefixed without a deprecation notice
+UNVERSIONED_PATHS = {"/", "/health"}
+
+class ApiPrefixMiddleware:
+    """Strip API_PREFIX before routing, so /api/v1/<path> and /<path> reach the same view"""
+
+    def __init__(self, wsgi_app, prefix):
+        self.wsgi_app = wsgi_app
+        self.prefix = prefix
+
+    def __call__(self, environ, start_response):
+        path = environ.get("PATH_INFO", "")
+        if path == self.prefix or path.startswith(self.prefix + "/"):
+            environ["PATH_INFO"] = path[len(self.prefix):] or "/"
+            environ["SCRIPT_NAME"] = environ.get("SCRIPT_NAME", "") + self.prefix
+            environ["dacroq.versioned"] = True
+        return self.wsgi_app(environ, start_response)
+
+app.wsgi_app = ApiPrefixMiddleware(app.wsgi_app, API_PREFIX)
+if TRUSTED_PROXY_HOPS:
+    # Only the hops we were told about may set the client address
+    app.wsgi_app = ProxyFix(app.wsgi_app, x_for=TRUSTED_PROXY_HOPS, x_proto=TRUSTED_PROXY_HOPS)
+
+def api_path(path):
+    """A path in the same URL scheme the client used for this request"""
+    versioned = has_request_context() and request.environ.get("dacroq.versioned")
+    return f"{API_PREFIX}{path}" if versioned else path
+
+def http_date(iso_date):
+    return datetime.fromisoformat(iso_date).replace(tzinfo=timezone.utc).strftime("%a, %d %b %Y %H:%M:%S GMT")
+
+def note_deprecated_field(field):
+    """Record that the current request used a legacy field; reported in response headers"""
+    deprecated = g.get("deprecated_fields") or []
+    deprecated.append(field)
+    g.deprecated_fields = deprecated
+
+def add_capability_headers(response):
+    response.headers["X-Dacroq-API-Version"] = API_VERSION
+    response.headers["X-Dacroq-Features"] = ",".join(API_FEATURES)
+
+    rule = request.url_rule.rule if request.url_rule else None
+    deprecation = DEPRECATED_ROUTES.get(rule)
+    if deprecation:
+        # RFC 9745 / RFC 8594 headers so generic HTTP tooling notices too
+        response.headers["Deprecation"] = "true"
+        response.headers["Sunset"] = http_date(deprecation["sunset"])
+        response.headers["Link"] = f'<{api_path(deprecation["successor"])}>; rel="successor-version"'
+        response.headers["Warning"] = f'299 - "Deprecated: {deprecation["note"]}"'
+    elif not request.environ.get("dacroq.versioned") and request.path not in UNVERSIONED_PATHS:
+        response.headers["Deprecation"] = "true"
+        response.headers["Sunset"] = http_date(LEGACY_PATHS_SUNSET)
+        response.headers["Link"] = f'<{API_PREFIX}{request.path}>; rel="successor-version"'
+        response.headers["Warning"] = f'299 - "Deprecated: unprefixed paths; use {API_PREFIX}{request.path}"'
+
+    fields = g.get("deprecated_fields")
+    if fields:
+        response.headers["X-Dacroq-Deprecated-Fields"] = ",".join(
+            f'{field};successor={DEPRECATED_FIELDS[field]["successor"]};sunset={DEPRECATED_FIELDS[field]["sunset"]}'
+            for field in fields
+        )
+    return response
+
 # --- Middleware ---------------------------------------------------------------
 @app.before_request
 def start_timer():
     request.start_time = time.time()
+    g.request_id = request.headers.get("X-Request-ID") or generate_id()
 
 @app.after_request
 def after_request(response):
@@ -318,30 +600,451 @@ def after_request(response):
     origin = request.headers.get("Origin")
     if origin in ALLOWED_ORIGINS:
         response.headers["Access-Control-Allow-Origin"] = origin
-        response.headers["Access-Control-Allow-Headers"] = "Content-Type,Authorization"
-        response.headers["Access-Control-Allow-Methods"] = "GET,PUT,POST,DELETE,OPTIONS"
+        response.headers["Access-Control-Allow-Headers"] = "Content-Type,Authorization,Upload-Offset"
+        response.headers["Access-Control-Allow-Methods"] = "GET,HEAD,PUT,PATCH,POST,DELETE,OPTIONS"
         response.headers["Access-Control-Allow-Credentials"] = "true"
+        response.headers["Access-Control-Expose-Headers"] = (
+            "X-Request-ID,X-Dacroq-API-Version,X-Dacroq-Features,X-Dacroq-Deprecated-Fields,Deprecation,Sunset,Link,"
+            "X-Job-ID,Location,Upload-Offset,Upload-Length"
+        )
+
+    request_id = g.get("request_id")
+    if request_id:
+        response.headers["X-Request-ID"] = request_id
+    add_capability_headers(response)
 
     if hasattr(request, "start_time"):
         duration = time.time() - request.start_time
+        logger.debug(
+            f"[{request_id}] {request.method} {request.path} -> {response.status_code} ({duration * 1000:.1f}ms)"
+        )
         if duration > 1.0:
             logger.warning(
                 f"Slow request: {request.method} {request.path} took {duration:.2f}s"
             )
     return response
 
+import gzip
+import zlib
+
+# Batch results carry per-iteration arrays and can reach tens of megabytes; compress them when the client accepts it
+COMPRESS_MIN_BYTES = int(os.getenv("COMPRESS_MIN_BYTES", 1024))
+COMPRESS_LEVEL = int(os.getenv("COMPRESS_LEVEL", 6))
+COMPRESSIBLE_MIMETYPES = {"application/json", "text/plain", "text/csv"}
+RESPONSE_ENCODINGS = {
+    "gzip": lambda data: gzip.compress(data, COMPRESS_LEVEL),
+    "deflate": lambda data: zlib.compress(data, COMPRESS_LEVEL),
+}
+
+def negotiate_encoding(accept_encoding):
+    """Pick the client's highest-weighted encoding we support; gzip wins ties"""
+    weights = {}
+    for part in accept_encoding.split(","):
+        name, _, params = part.strip().partition(";")
+        name = name.strip().lower()
+        q = 1.0
+        if params.strip().startswith("q="):
+            try:
+                q = float(params.strip()[2:])
+            except ValueError:
+                q = 0.0
+        weights[name] = q
+    candidates = [(weights.get(name, weights.get("*", 0.0)), -i, name) for i, name in enumerate(RESPONSE_ENCODINGS)]
+    q, _, name = max(candidates)
+    return name if q > 0 else None
+
+@app.after_request
+def compress_response(response):
+    """Content-negotiated gzip/deflate for large buffered JSON and text bodies"""
+    if (response.direct_passthrough or response.is_streamed or "Content-Encoding" in response.headers
+            or response.mimetype not in COMPRESSIBLE_MIMETYPES or not 200 <= response.status_code < 300):
+        return response
+    data = response.get_data()
+    if len(data) < COMPRESS_MIN_BYTES:
+        return response
+    # Add to, rather than replace, any Vary another handler has set
+    response.vary.add("Accept-Encoding")
+    encoding = negotiate_encoding(request.headers.get("Accept-Encoding", ""))
+    if not encoding:
+        return response
+    response.set_data(RESPONSE_ENCODINGS[encoding](data))
+    response.headers["Content-Encoding"] = encoding
+    return response
+
+@app.after_request
+def add_api_version(response):
+    """Put api_version into every JSON object body; runs before compress_response"""
+    if (response.direct_passthrough or response.is_streamed or "Content-Encoding" in response.headers
+            or response.mimetype != "application/json"):
+        return response
+    data = response.get_data()
+    stripped = data.lstrip()
+    if not stripped.startswith(b"{"):
+        return response
+    # Splice rather than re-encode: batch results can be tens of megabytes
+    rest = stripped[1:].lstrip()
+    field = b'"api_version": ' + json.dumps(API_VERSION).encode()
+    response.set_data(b"{" + field + (b"}" + rest[1:] if rest.startswith(b"}") else b", " + rest))
+    return response
+
 @app.before_request
 def handle_preflight():
     if request.method == "OPTIONS":
         return "", 200
 
+def provided_api_key():
+    provided = request.headers.get("X-API-Key")
+    if not provided:
+        auth_header = request.headers.get("Authorization", "")
+        if auth_header.startswith("Bearer "):
+            provided = auth_header[len("Bearer "):]
+    return provided
+
+def client_address():
+    # ProxyFix has already replaced remote_addr when TRUSTED_PROXY_HOPS is set
+    return request.remote_addr or "unknown"
+
+def key_matches(provided, expected):
+    """Constant-time key comparison"""
+    return bool(provided and expected) and hmac.compare_digest(provided.encode(), expected.encode())
+
+@app.before_request
+def check_api_key():
+    """Require the configured API key or a tenant key on every non-public route"""
+    if request.path in PUBLIC_PATHS or request.path.startswith(PUBLIC_PREFIXES + (ADMIN_PREFIX,)):
+        return None
+    provided = provided_api_key()
+    g.tenant = tenant_registry.for_key(provided)
+    if g.tenant:
+        g.identity = f"tenant:{g.tenant['name']}"
+        return None
+    if not (API_KEY or tenant_registry.configured()):
+        return None
+    if not key_matches(provided, API_KEY):
+        return error_response("Unauthorized", 401)
+    g.identity = "operator"
+    return None
+
+@app.before_request
+def check_admin_key():
+    """Admin routes take the admin key in place of the API key"""
+    if not request.path.startswith(ADMIN_PREFIX):
+        return None
+    if not ADMIN_API_KEY:
+        return error_response("Admin endpoints are disabled; set DACROQ_ADMIN_KEY", 403)
+    if not key_matches(provided_api_key(), ADMIN_API_KEY):
+        return error_response("Unauthorized", 401)
+    g.identity = "admin"
+    return None
+
+# Changes to shared hardware and caches need the operator key; tenant keys may only read them
+OPERATOR_ONLY_PREFIXES = ("/hardware",)
+# ...except reservations, which tenants book and cancel in their own name
+TENANT_WRITABLE_PREFIXES = ("/hardware/reservations",)
+OPERATOR_ONLY_ROUTES = {("DELETE", "/sat/result-cache")}
+
+def tenant_owns(table, row_id, tenant):
+    """Whether a test or job belongs to the tenant; unknown IDs pass so routes report their own 404"""
+    with get_db() as conn:
+        row = conn.execute(f"SELECT json_extract(config, '$.tenant') AS tenant FROM {table} WHERE id = ?",
+                           (row_id,)).fetchone()
+    return row is None or row["tenant"] == tenant["name"]
+
+def tenant_scope_sql(column="config"):
+    """SQL condition limiting a tests or jobs query to the caller's own rows, with its parameters"""
+    tenant = current_tenant()
+    return (f"json_extract({column}, '$.tenant') = ?", [tenant["name"]]) if tenant else ("1 = 1", [])
+
+@app.before_request
+def enforce_tenant_scope():
+    """Keep tenant keys inside their own namespace"""
+    tenant = current_tenant()
+    if not tenant or request.url_rule is None:
+        return None
+    rule = request.url_rule.rule
+    if request.method not in ("GET", "HEAD") and (
+        rule.startswith(OPERATOR_ONLY_PREFIXES) and not rule.startswith(TENANT_WRITABLE_PREFIXES)
+        or (request.method, rule) in OPERATOR_ONLY_ROUTES
+    ):
+        return error_response("This change needs the operator key", 403)
+
+    args = request.view_args or {}
+    row_id = args.get("test_id") or args.get("job_id")
+    table = "ldpc_jobs" if rule.startswith("/ldpc/") else "tests"
+    if row_id and not tenant_owns(table, row_id, tenant):
+        # Other tenants' work is reported as missing rather than forbidden
+        return error_response("Test not found" if "test_id" in args else "Job not found", 404)
+    return None
+
+class TokenBucketLimiter:
+    """Per-client token buckets holding up to `burst` requests, refilled at `per_minute`"""
+
+    def __init__(self, per_minute, burst):
+        self.per_minute = per_minute
+        self.burst = burst
+        self.buckets = {}  # client -> (tokens, last refill)
+        self.allowed = defaultdict(int)
+        self.limited = defaultdict(int)
+        self.total_allowed = 0
+        self.total_limited = 0
+        self.swept = time.monotonic()
+        self.lock = threading.Lock()
+
+    def _refilled(self, client, now):
+        tokens, updated = self.buckets[client]
+        return min(self.burst, tokens + (now - updated) * self.per_minute / 60)
+
+    def _sweep(self, now):
+        """Forget clients whose bucket is full again; a new bucket would start the same"""
+        for client in [c for c in self.buckets if self._refilled(c, now) >= self.burst]:
+            del self.buckets[client]
+            self.allowed.pop(client, None)
+            self.limited.pop(client, None)
+        self.swept = now
+
+    def take(self, client):
+        """Spend a token; returns 0, or the seconds until a token is available"""
+        now = time.monotonic()
+        with self.lock:
+            if now - self.swept > RATE_LIMIT_SWEEP_SECONDS:
+                self._sweep(now)
+            tokens = self._refilled(client, now) if client in self.buckets else self.burst
+            if tokens >= 1:
+                self.buckets[client] = (tokens - 1, now)
+                self.allowed[client] += 1
+                self.total_allowed += 1
+                return 0
+            self.buckets[client] = (tokens, now)
+            self.limited[client] += 1
+            self.total_limited += 1
+            return (1 - tokens) * 60 / self.per_minute
+
+    def stats(self):
+        with self.lock:
+            clients = set(self.allowed) | set(self.limited)
+            return {
+                "per_minute": self.per_minute,
+                "burst": self.burst,
+                "allowed": self.total_allowed,
+                "limited": self.total_limited,
+                "clients": {
+                    client: {
+                        "tokens": self.buckets[client][0] if client in self.buckets else self.burst,
+                        "allowed": self.allowed[client],
+                        "limited": self.limited[client],
+                    }
+                    for client in sorted(clients)
+                },
+            }
+
+# Token buckets for endpoints that tie up the CPU or hardware, plus "default" for every non-public
+# route; each is disabled while its per_minute is 0
+ROUTE_RATE_LIMITS = {
+    "default": TokenBucketLimiter(RATE_LIMIT_PER_MINUTE, max(RATE_LIMIT_PER_MINUTE, 1)),
+    "solve": TokenBucketLimiter(
+        float(os.getenv("SOLVE_RATE_LIMIT_PER_MINUTE", 0)), int(os.getenv("SOLVE_RATE_LIMIT_BURST", 5))
+    ),
+    "upload": TokenBucketLimiter(
+        float(os.getenv("UPLOAD_RATE_LIMIT_PER_MINUTE", 0)), int(os.getenv("UPLOAD_RATE_LIMIT_BURST", 2))
+    ),
+}
+# (method, URL rule) -> limiter name
+RATE_LIMITED_ROUTES = {
+    ("POST", "/sat/solve"): "solve",
+    ("POST", "/jobs"): "solve",
+    ("POST", "/solve-one"): "solve",
+    ("POST", "/sat/tests/<test_id>/resume"): "solve",
+    ("POST", "/ldpc/jobs"): "solve",
+    ("POST", "/hardware/<device_id>/calibrate"): "solve",
+    ("POST", "/admin/hardware/<device_id>/firmware"): "upload",
+    ("POST", "/ldpc/deploy"): "upload",
+    ("POST", "/sat/generate"): "upload",
+    ("POST", "/uploads"): "upload",
+    ("POST", "/uploads/resumable"): "upload",
+    ("POST", "/runs/import"): "upload",
+    ("POST", "/analysis/compare"): "solve",
+}
+
+def rate_limit_client():
+    """Authenticated callers share a bucket per identity; everyone else gets one per address
+
+    Unvalidated headers never pick the bucket, or a client could mint a fresh one per request.
+    """
+    identity = g.get("identity")
+    return identity if identity else "ip:" + client_address()
+
+@app.before_request
+def enforce_route_rate_limits():
+    """Token bucket per client: the default limit on every non-public route, then solve and upload endpoints"""
+    rule = request.url_rule.rule if request.url_rule else None
+    names = [] if request.path in PUBLIC_PATHS else ["default"]
+    if RATE_LIMITED_ROUTES.get((request.method, rule)):
+        names.append(RATE_LIMITED_ROUTES[(request.method, rule)])
+    client = rate_limit_client()
+    for name in names:
+        limiter = ROUTE_RATE_LIMITS[name]
+        if not limiter.per_minute:
+            continue
+        wait = limiter.take(client)
+        if not wait:
+            continue
+        response, status = error_response(
+            "Rate limit exceeded", 429, "rate_limited",
+            {"limit": name, "per_minute": limiter.per_minute, "burst": limiter.burst},
+        )
+        response.headers["Retry-After"] = str(math.ceil(wait))
+        return response, status
+    return None
+
+@app.errorhandler(Exception)
+def handle_exception(e):
+    """Return structured JSON errors instead of HTML pages or dropped connections"""
+    if isinstance(e, (HTTPException, DimacsParseError, HardwareUnavailableError, HardwareHangError, TimeoutError)):
+        return exception_response(e)
+
+    logger.exception(f"[{g.get('request_id')}] Unhandled error on {request.method} {request.path}: {e}")
+    return error_response("Internal server error", 500)
+
 # --- Utilities ----------------------------------------------------------------
 def generate_id() -> str:
     return str(uuid.uuid4())
 
+ERROR_CODES = {
+    400: "bad_request",
+    401: "unauthorized",
+    403: "forbidden",
+    404: "not_found",
+    405: "method_not_allowed",
+    409: "conflict",
+    413: "payload_too_large",
+    415: "unsupported_media_type",
+    429: "rate_limited",
+    431: "headers_too_large",
+    500: "internal_error",
+    502: "bad_gateway",
+    503: "unavailable",
+    504: "gateway_timeout",
+}
+
+# Every code an error response can carry; clients branch on these rather than on the message
+ERROR_CODE_TABLE = {
+    "bad_request": "The request was malformed or a field failed validation",
+    "missing_field": "A required field was absent; details.field names it",
+    "parse_error": "An instance could not be parsed; details.line is the 1-based line when known",
+    "checksum_mismatch": "Received bytes did not match the checksum the client supplied",
+    "insufficient_data": "Not enough results to compute what was asked",
+    "unauthorized": "Missing or invalid API key or token",
+    "forbidden": "The caller may not perform this action",
+    "host_not_allowed": "A URL pointed at a host the server will not fetch from",
+    "not_found": "The resource does not exist",
+    "preset_not_found": "No SAT preset (or preset file) by that name is visible to the caller",
+    "method_not_allowed": "The route does not accept this method",
+    "conflict": "The resource is not in a state that allows this request",
+    "preset_exists": "A preset by that name already exists",
+    "reservation_conflict": "The slot overlaps an existing hardware reservation",
+    "unsupported_firmware": "The board's firmware is older than the API requires",
+    "job_not_finished": "The job has not completed yet",
+    "no_checkpoint": "The test left no checkpoint to resume from",
+    "no_results": "The test has no results yet",
+    "upload_in_progress": "Another request is writing to this upload",
+    "offset_mismatch": "Upload-Offset did not match the bytes received; details.offset is the server's",
+    "payload_too_large": "The body exceeded a size limit",
+    "quota_exceeded": "A tenant quota was used up",
+    "unsupported_media_type": "The body's Content-Type is not accepted here",
+    "file_type_not_allowed": "An uploaded file's type is not accepted",
+    "rate_limited": "Too many requests; honour Retry-After",
+    "headers_too_large": "Request headers exceeded the server's limit",
+    "internal_error": "An unexpected server error; quote request_id when reporting it",
+    "bad_gateway": "An upstream server returned an error",
+    "instance_fetch_failed": "Downloading a dimacs_url failed",
+    "unavailable": "The server cannot take the request right now",
+    "hardware_unavailable": "The hardware the request needs is not connected or stopped responding",
+    "draining": "The server is draining and not accepting new work",
+    "shutting_down": "The server is shutting down",
+    "gateway_timeout": "An upstream server did not answer in time",
+    "timeout": "The operation did not finish in time, e.g. waiting for a busy board",
+}
+
+def error_response(message, status, code=None, details=None):
+    """Error envelope: machine-readable code, human message, details object and the request ID"""
+    message = str(message)
+    return jsonify({
+        "code": code or ERROR_CODES.get(status, "internal_error"),
+        "message": message,
+        "details": details or {},
+        "request_id": g.get("request_id"),
+        # Same as message, for clients written before the envelope had one
+        "error": message,
+    }), status
+
+def dimacs_error_response(e):
+    """parse_error envelope for an instance that failed to parse, with the line when the parser knew it"""
+    line = getattr(e, "line", None)
+    return error_response(f"Invalid DIMACS: {e}", 400, "parse_error", {"line": line} if line else None)
+
+class HardwareUnavailableError(RuntimeError):
+    """The board a request needs is not connected; retrying once it is may succeed"""
+
+def exception_response(e):
+    """Error envelope for an exception caught in a route, with a specific code when its type tells us one"""
+    if isinstance(e, DimacsParseError):
+        return dimacs_error_response(e)
+    if isinstance(e, (HardwareUnavailableError, HardwareHangError)):
+        return error_response(str(e), 503, "hardware_unavailable")
+    if isinstance(e, TimeoutError):
+        return error_response(str(e), 504, "timeout")
+    if isinstance(e, HTTPException):
+        return error_response(e.description, e.code)
+    # The route has already logged it; anything else is an internal_error
+    return error_response(str(e), 500)
+
 def dict_from_row(row):
     return {key: row[key] for key in row.keys()} if row else None
 
+def ensure_data_dirs():
+    """Create the data directories a fresh deployment needs"""
+    for directory in (DB_PATH.parent, LDPC_DATA_DIR, SAT_PRESETS_DIR, PRESET_LOCKS_DIR, PRESET_SNAPSHOTS_DIR,
+                      MODELS_DIR, CHECKPOINT_DIR, ARTIFACTS_DIR, UPLOADS_DIR):
+        directory.mkdir(parents=True, exist_ok=True)
+
+def preset_diagnostics():
+    """Summarize the installed SAT presets for startup checks and /health"""
+    presets = {}
+    if SAT_PRESETS_DIR.is_dir():
+        for preset_dir in sorted(SAT_PRESETS_DIR.iterdir()):
+            if preset_dir.is_dir():
+                presets[preset_dir.name] = sum(1 for _ in preset_dir.glob("*.cnf"))
+
+    diagnostics = {
+        "directory": str(SAT_PRESETS_DIR),
+        "exists": SAT_PRESETS_DIR.is_dir(),
+        "presets": presets,
+        "total_files": sum(presets.values()),
+    }
+    if not diagnostics["total_files"]:
+        diagnostics["bootstrap_hint"] = (
+            f"No SAT preset CNF files found. Copy SATLIB benchmark folders "
+            f"(e.g. uf20-91/*.cnf) into {SAT_PRESETS_DIR} to enable preset listings."
+        )
+    return diagnostics
+
+def validate_startup():
+    """Create missing directories and log what a fresh deployment is missing"""
+    ensure_data_dirs()
+    diagnostics = preset_diagnostics()
+    if diagnostics["total_files"]:
+        logger.info(f"SAT presets: {diagnostics['total_files']} files in {len(diagnostics['presets'])} presets")
+    else:
+        logger.warning(diagnostics["bootstrap_hint"])
+    for preset in diagnostics["presets"]:
+        drift = preset_drift(preset)
+        if drift and drift["drifted"]:
+            logger.warning(
+                f"Locked preset {preset} has changed since it was locked: "
+                f"{len(drift['modified'])} modified, {len(drift['added'])} added, {len(drift['removed'])} removed"
+            )
+    return diagnostics
+
 def collect_system_metrics():
     try:
         cpu = psutil.cpu_percent(interval=1)
@@ -374,6 +1077,209 @@ def collect_system_metrics():
     except Exception as e:
         logger.error(f"Metric collection error: {e}")
 
+# ------------------------------ Test Events ----------------------------------
+from collections import deque
+
+class TestEventBus:
+    """Buffered per-test progress events shared by polling and streaming clients"""
+
+    def __init__(self, max_events=500, retention_seconds=3600):
+        self.max_events = max_events
+        self.retention_seconds = retention_seconds
+        self.buffers = {}
+        self.condition = threading.Condition()
+
+    def publish(self, test_id, event_type, data=None):
+        """Append an event to a test's buffer and wake any waiting readers"""
+        with self.condition:
+            self._prune()
+            buffer = self.buffers.setdefault(
+                test_id, {"events": deque(maxlen=self.max_events), "next_seq": 1, "updated": time.time()}
+            )
+            event = {
+                "seq": buffer["next_seq"],
+                "type": event_type,
+                "timestamp": utc_now(),
+                "data": data or {},
+            }
+            buffer["events"].append(event)
+            buffer["next_seq"] += 1
+            buffer["updated"] = time.time()
+            self.condition.notify_all()
+            return event
+
+    def events_since(self, test_id, cursor=0, timeout=0):
+        """Events after cursor, waiting up to timeout seconds for new ones"""
+        deadline = time.time() + timeout
+        with self.condition:
+            while True:
+                buffer = self.buffers.get(test_id)
+                events = [e for e in buffer["events"] if e["seq"] > cursor] if buffer else []
+                remaining = deadline - time.time()
+                if events or remaining <= 0:
+                    break
+                self.condition.wait(remaining)
+
+            truncated = bool(buffer and buffer["events"] and buffer["events"][0]["seq"] > cursor + 1)
+            next_cursor = events[-1]["seq"] if events else cursor
+            return events, next_cursor, truncated
+
+    def _prune(self):
+        cutoff = time.time() - self.retention_seconds
+        for test_id in [t for t, b in self.buffers.items() if b["updated"] < cutoff]:
+            del self.buffers[test_id]
+
+# Global event bus for test progress
+test_events = TestEventBus()
+
+# ------------------------------ Tenants --------------------------------------
+# name -> {"api_key_sha256": ..., quota overrides}; each tenant key owns a preset tree and quotas
+TENANTS_FILE = Path(os.getenv("DACROQ_TENANTS_FILE", DATA_DIR / "tenants.json"))
+TENANTS_DIR = DATA_DIR / "tenants"
+# Per-tenant quotas: field -> (type, min, max, default)
+TENANT_QUOTA_FIELDS = {
+    "upload_max_bytes": (int, 0, 2**40, int(os.getenv("TENANT_UPLOAD_MAX_BYTES", 100 * 1024 * 1024))),
+    "upload_max_files": (int, 0, 10_000_000, int(os.getenv("TENANT_UPLOAD_MAX_FILES", 1000))),
+    "daily_solve_seconds": (float, 0.0, 86400.0 * 365, float(os.getenv("TENANT_DAILY_SOLVE_SECONDS", 3600))),
+}
+
+class TenantRegistry:
+    """Tenants from TENANTS_FILE, re-read whenever the file changes"""
+
+    def __init__(self, path):
+        self.path = path
+        self.tenants = {}
+        self.by_key_hash = {}
+        self.mtime = None
+        self.lock = threading.Lock()
+
+    def reload_if_changed(self):
+        mtime = self.path.stat().st_mtime_ns if self.path.is_file() else None
+        with self.lock:
+            if mtime == self.mtime:
+                return
+            self.mtime = mtime
+            self.tenants, self.by_key_hash = self._load() if mtime else ({}, {})
+
+    def _load(self):
+        try:
+            raw = json.loads(self.path.read_text())
+        except (OSError, ValueError) as e:
+            logger.error(f"Ignoring unreadable {self.path}: {e}")
+            return {}, {}
+        tenants, by_key_hash = {}, {}
+        for name, entry in (raw.items() if isinstance(raw, dict) else []):
+            key_hash = entry.get("api_key_sha256", "").lower() if isinstance(entry, dict) else ""
+            if not valid_preset_name(name) or not re.fullmatch(r"[0-9a-f]{64}", key_hash):
+                logger.error(f"{self.path}: skipping tenant {name!r}; it needs a valid name and api_key_sha256")
+                continue
+            quota = {field: spec[3] for field, spec in TENANT_QUOTA_FIELDS.items()}
+            errors = apply_config_overrides(
+                TENANT_QUOTA_FIELDS, quota, {k: v for k, v in entry.items() if k in TENANT_QUOTA_FIELDS}
+            )
+            if errors:
+                logger.error(f"{self.path}: tenant {name}: {'; '.join(errors)}")
+            tenants[name] = {"name": name, "quota": quota}
+            by_key_hash[key_hash] = name
+        logger.info(f"Loaded {len(tenants)} tenants from {self.path}")
+        return tenants, by_key_hash
+
+    def configured(self):
+        self.reload_if_changed()
+        return bool(self.tenants)
+
+    def for_key(self, key):
+        self.reload_if_changed()
+        if not key:
+            return None
+        with self.lock:
+            name = self.by_key_hash.get(hashlib.sha256(key.encode()).hexdigest())
+            return self.tenants.get(name)
+
+    def get(self, name):
+        self.reload_if_changed()
+        with self.lock:
+            return self.tenants.get(name)
+
+tenant_registry = TenantRegistry(TENANTS_FILE)
+
+def current_tenant():
+    """The tenant making this request; None for the operator key, open deployments and background work"""
+    return g.get("tenant") if has_request_context() else None
+
+def tenant_presets_dir(tenant):
+    return TENANTS_DIR / tenant["name"] / "presets"
+
+def tenant_upload_usage(tenant):
+    """Bytes and files stored in a tenant's presets and uploads"""
+    usage = directory_usage(TENANTS_DIR / tenant["name"])
+    if not isinstance(object_storage, LocalStorage):
+        # Presets are mirrored locally, but upload objects only exist in the bucket
+        stored = object_storage.list(storage_key(upload_object_path(uploads_root(tenant), "")))
+        usage["bytes"] += sum(info["size_bytes"] for info in stored.values())
+        usage["files"] += len(stored)
+    return {"bytes": usage["bytes"], "files": usage["files"]}
+
+def check_upload_quota(tenant, new_bytes, new_files):
+    """Error response if storing this much more would exceed the tenant's upload quota, else None"""
+    quota, usage = tenant["quota"], tenant_upload_usage(tenant)
+    if usage["bytes"] + new_bytes > quota["upload_max_bytes"] or usage["files"] + new_files > quota["upload_max_files"]:
+        return error_response("Upload quota exceeded", 413, "quota_exceeded", {
+            "usage": usage, "requested": {"bytes": new_bytes, "files": new_files},
+            "limits": {"bytes": quota["upload_max_bytes"], "files": quota["upload_max_files"]},
+        })
+    return None
+
+def utc_day():
+    return datetime.now(timezone.utc).date().isoformat()
+
+def tenant_solve_seconds(tenant_name, day=None):
+    with get_db() as conn:
+        row = conn.execute(
+            "SELECT solve_seconds FROM tenant_usage WHERE tenant = ? AND day = ?", (tenant_name, day or utc_day())
+        ).fetchone()
+    return row["solve_seconds"] if row else 0.0
+
+def charge_solve_seconds(tenant_name, seconds):
+    """Add wall-clock solve time to today's usage"""
+    with get_db() as conn:
+        conn.execute(
+            """
+            INSERT INTO tenant_usage (tenant, day, solve_seconds) VALUES (?, ?, ?)
+            ON CONFLICT (tenant, day) DO UPDATE SET solve_seconds = solve_seconds + excluded.solve_seconds
+        """,
+            (tenant_name, utc_day(), seconds),
+        )
+        conn.commit()
+
+def solve_seconds_left(tenant_name):
+    """Seconds left in today's budget; a tenant removed from the registry has none"""
+    tenant = tenant_registry.get(tenant_name)
+    return tenant["quota"]["daily_solve_seconds"] - tenant_solve_seconds(tenant_name) if tenant else 0.0
+
+def check_solve_budget(tenant):
+    """Error response once the tenant has used today's solve-seconds budget, else None"""
+    used, budget = tenant_solve_seconds(tenant["name"]), tenant["quota"]["daily_solve_seconds"]
+    if used < budget:
+        return None
+    tomorrow = datetime.combine(datetime.now(timezone.utc).date() + timedelta(days=1), datetime.min.time(), timezone.utc)
+    response, status = error_response("Daily solve-seconds budget used up", 429, "quota_exceeded",
+                                      {"used_seconds": used, "budget_seconds": budget})
+    response.headers["Retry-After"] = str(math.ceil((tomorrow - datetime.now(timezone.utc)).total_seconds()))
+    return response, status
+
+@app.route("/quota", methods=["GET"])
+def tenant_quota():
+    """The calling tenant's limits and current usage"""
+    tenant = current_tenant()
+    if not tenant:
+        return jsonify({"tenant": None, "message": "Not a tenant key; no quotas apply"})
+    return jsonify({
+        "tenant": tenant["name"],
+        "limits": tenant["quota"],
+        "usage": dict(tenant_upload_usage(tenant), solve_seconds_today=tenant_solve_seconds(tenant["name"])),
+    })
+
 # ------------------------------ Authentication -------------------------------
 @app.route("/auth/google", methods=["POST"])
 def google_auth():
@@ -382,11 +1288,11 @@ def google_auth():
         data = request.get_json()
         token = data.get("credential") or data.get("token")
         if not token:
-            return jsonify({"error": "No credential provided"}), 400
+            return error_response("No credential provided", 400)
 
         google_client_id = os.getenv("GOOGLE_CLIENT_ID")
         if not google_client_id:
-            return jsonify({"error": "Server configuration error"}), 500
+            return error_response("Server configuration error", 500)
 
         try:
             idinfo = id_token.verify_oauth2_token(
@@ -406,7 +1312,7 @@ def google_auth():
                 name = decoded.get("name", "")
                 logger.warning("Using unverified token (dev mode)")
             except (binascii.Error, json.JSONDecodeError):
-                return jsonify({"error": "Invalid token"}), 401
+                return error_response("Invalid token", 401)
 
         with get_db() as conn:
             cur = conn.cursor()
@@ -447,7 +1353,7 @@ def google_auth():
         return jsonify({"success": True, "user": user_data})
     except Exception as e:
         logger.error(f"Authentication error: {e}")
-        return jsonify({"error": "Authentication failed"}), 500
+        return error_response("Authentication failed", 500)
 
 # ------------------------------ Root / Health --------------------------------
 @app.route("/")
@@ -456,14 +1362,56 @@ def index():
         {
             "name": "Dacroq API",
             "version": "2.0",
+            "api_prefix": API_PREFIX,
             "status": "operational",
             "endpoints": {
                 "/health": "System health check",
+                "/metrics": "Rate limit counters and result cache statistics",
+                "/quota": "The calling tenant's quotas and usage",
+                "/admin/status": "Live jobs, process, hardware, storage and cache state (admin key)",
+                "/admin/drain": "Stop (POST) or resume (DELETE) taking new work (admin key)",
+                "/admin/retention": "Cleanup policies and what is due (GET), or sweep now (POST) (admin key)",
+                "/openapi.json": "OpenAPI 3 specification",
+                "/capabilities": "Supported features and deprecated routes",
+                "/jobs": "Submit solve jobs; /jobs/<id> for progress, /events (SSE), /results, /runs and /download",
+                "/runs": "Stored solver runs with filters, sorting, pagination and aggregates; /runs/<id> for one",
+                "/runs/export": "Matching runs and their jobs as a gzipped archive; POST /runs/import loads one",
+                "/leaderboard": "Solvers and board configurations ranked on a preset (PAR-2, median TTS, energy)",
+                "/analysis/cactus": "Instances solved against time budget per solver, from stored runs",
+                "/analysis/compare": "Paired statistics for two solver configurations on the same presets (POST)",
+                "/instances/<hash>": "Preset files, uploads and runs sharing one canonical instance; /instances/duplicates",
+                "/hardware": "Registered hardware devices",
+                "/hardware/<id>/config": "Simulated accelerator profile (GET/PATCH)",
+                "/hardware/reservations": "Hardware time slot reservations",
+                "/hardware/<id>/firmware": "Board firmware version; POST /admin/hardware/<id>/firmware flashes (admin key)",
+                "/hardware/<id>/calibrate": "Run the calibration sequence (POST)",
+                "/hardware/<id>/calibration": "Current calibration profile and history",
                 "/tests": "Test management",
+                "/tests/<id>/artifacts": "Files produced by a test",
+                "/uploads": "Streamed multipart uploads of instance and measurement files",
+                "/uploads/resumable": "Resumable uploads of large archives",
                 "/ldpc/jobs": "LDPC job management",
                 "/sat/solve": "SAT solver",
+                "/solve-one": "Solve a raw DIMACS body synchronously with one software solver",
                 "/sat/tests": "SAT test management", 
                 "/sat/test-summaries": "SAT test summaries",
+                "/sat/export": "Export SAT results, optionally anonymized",
+                "/sat/cnf-files": "Preset CNF files with instance features, filterable and paginated",
+                "/sat/cnf-files/<preset>/<file>/content": "Raw DIMACS of a preset CNF file",
+                "/sat/presets": "Preset locks and immutable snapshots",
+                "/sat/generate": "Generate random k-SAT instances, optionally as a new preset",
+                "/sat/cnf-features": "Structural features of a CNF instance",
+                "/sat/simplify": "Preprocess a CNF instance",
+                "/sat/ising": "Ising form of a CNF instance for external annealers",
+                "/sat/difficulty-model": "Instance difficulty model",
+                "/sat/offload-model": "Hardware offload predictor",
+                "/sat/sim-correlation": "Simulation-vs-silicon calibration report",
+                "/sat/result-cache": "Cached software results; DELETE to clear",
+                "/sat/weighted-summary": "Instance-weighted solver comparison across batch tests",
+                "/sat/publications": "Publish anonymized results as a public dataset",
+                "/public/datasets": "Published datasets (no API key required)",
+                "/sat/references": "Per-preset reference results for regression checks",
+                "/sat/known-answers": "Known SAT/UNSAT status of instances",
                 "/sat/command": "DAEDALUS hardware commands",
                 "/sat/serial-history": "DAEDALUS serial monitor",
                 "/users": "User management",
@@ -474,20 +1422,522 @@ def index():
         }
     )
 
+# Below this much free space under DATA_DIR, uploads and artifacts are at risk and /health reports degraded
+HEALTH_MIN_FREE_DISK_MB = float(os.getenv("HEALTH_MIN_FREE_DISK_MB", 500))
+
+def check_results_store():
+    with get_db() as conn:
+        test_count = conn.execute("SELECT COUNT(*) FROM tests").fetchone()[0]
+    return {"status": "ok", "path": str(DB_PATH), "tests": test_count}
+
+def check_presets():
+    presets = preset_diagnostics()
+    check = {"status": "ok", "total_files": presets["total_files"], "presets": presets["presets"]}
+    if not presets["exists"] or not os.access(SAT_PRESETS_DIR, os.R_OK | os.X_OK):
+        check.update(status="down", error=f"{SAT_PRESETS_DIR} is missing or unreadable")
+    elif not presets["total_files"]:
+        check.update(status="degraded", error=presets["bootstrap_hint"])
+    return check
+
+def check_disk_space():
+    usage = shutil.disk_usage(DATA_DIR)
+    free_mb = usage.free / (1024 * 1024)
+    return {
+        "status": "ok" if free_mb >= HEALTH_MIN_FREE_DISK_MB else "degraded",
+        "path": str(DATA_DIR),
+        "free_mb": round(free_mb, 1),
+        "min_free_mb": HEALTH_MIN_FREE_DISK_MB,
+    }
+
+def check_hardware():
+    """Each registered board must still be enumerated on its serial port"""
+    present_ports = {port.device for port in serial.tools.list_ports.comports()}
+    devices = {}
+    for device in hardware_manager.list_devices():
+        available = device.get("port") in present_ports
+        devices[device["id"]] = {
+            "status": "ok" if available else "down",
+            "device_type": device["device_type"],
+            "port": device.get("port"),
+            "connected": device_connected(device),
+        }
+    down = [device_id for device_id, check in devices.items() if check["status"] != "ok"]
+    # Solves fall back to the simulator, so a missing board degrades the service rather than taking it down
+    return {"status": "degraded" if down else "ok", "devices": devices}
+
+HEALTH_CHECKS = {
+    "results_store": check_results_store,
+    "presets": check_presets,
+    "disk": check_disk_space,
+    "hardware": check_hardware,
+}
+
+def run_health_checks():
+    checks = {}
+    for name, check in HEALTH_CHECKS.items():
+        try:
+            checks[name] = check()
+        except Exception as e:
+            checks[name] = {"status": "down", "error": str(e)}
+    return checks
+
 @app.route("/health")
 def health():
+    """Overall verdict plus the status of each dependency (results store, presets, disk, hardware)"""
+    checks = run_health_checks()
+    # Without the results store nothing can be recorded; every other failure leaves the API usable
+    if checks["results_store"]["status"] != "ok":
+        status, code = "unhealthy", 503
+    elif any(check["status"] != "ok" for check in checks.values()):
+        status, code = "degraded", 200
+    else:
+        status, code = "healthy", 200
+
+    response = {
+        "status": status,
+        "timestamp": utc_now(),
+        "uptime": time.time() - app.start_time,
+        "checks": checks,
+        "preload": preload_status,
+    }
+    if checks["presets"].get("error"):
+        response["bootstrap_hint"] = checks["presets"]["error"]
+    return jsonify(response), code
+
+@app.route("/metrics", methods=["GET"])
+def metrics():
+    """Runtime counters: per-client rate limit buckets and result cache hit rates"""
+    return jsonify({
+        "timestamp": utc_now(),
+        "rate_limits": {name: limiter.stats() for name, limiter in ROUTE_RATE_LIMITS.items()},
+        "result_cache": result_cache.stats(),
+    })
+
+def device_connected(device):
+    if device["device_type"] == "ldpc":
+        connection = teensy_pool.connection
+    else:
+        connection = sat_pool.connection_for(device["port"])
+    return bool(connection and connection.connected and connection.port == device["port"])
+
+@app.route("/capabilities", methods=["GET"])
+def capabilities():
+    """Machine-readable feature list and deprecation schedule"""
+    return jsonify({
+        "api_prefix": API_PREFIX,
+        "features": list(API_FEATURES),
+        "error_codes": ERROR_CODE_TABLE,
+        "deprecations": {
+            "routes": DEPRECATED_ROUTES,
+            "fields": DEPRECATED_FIELDS,
+        },
+    })
+
+# Old spelling, which put a second version segment behind the /api/v1 prefix; its own endpoint keeps operationIds unique
+app.add_url_rule("/v1/capabilities", "capabilities_v1", capabilities, methods=["GET"])
+
+@app.route("/hardware", methods=["GET"])
+def hardware_devices():
+    """List registered hardware devices"""
     try:
-        with get_db() as conn:
-            conn.execute("SELECT 1")
-        return jsonify(
-            {
-                "status": "healthy",
-                "timestamp": utc_now(),
-                "uptime": time.time() - app.start_time,
-            }
+        devices = hardware_manager.list_devices()
+        for device in devices:
+            device["connected"] = device_connected(device)
+            device["capabilities"] = accelerator_capabilities(device)
+        devices.append(simulator_device())
+        for device in devices:
+            device["calibration"] = calibration_reference(device["id"])
+        return jsonify({"devices": devices, "total_count": len(devices)})
+    except Exception as e:
+        logger.error(f"Hardware registry error: {e}")
+        return exception_response(e)
+
+@app.route("/hardware/queues", methods=["GET"])
+def hardware_queues():
+    """Show who holds and who is waiting for each physical board"""
+    with device_queues_lock:
+        queues = list(device_queues.values())
+    return jsonify({"queues": [queue.status() for queue in queues]})
+
+@app.route("/hardware/<device_id>", methods=["GET"])
+def hardware_device_detail(device_id):
+    """Get a registered hardware device"""
+    if device_id == SIMULATOR_DEVICE_ID:
+        return jsonify(simulator_device())
+    device = hardware_manager.get_device(device_id)
+    if not device:
+        return error_response("Device not found", 404)
+    device["connected"] = device_connected(device)
+    device["capabilities"] = accelerator_capabilities(device)
+    return jsonify(device)
+
+@app.route("/hardware/<device_id>/config", methods=["GET", "PATCH"])
+def hardware_device_config(device_id):
+    """Get or change the chip-generation profile of a simulated device"""
+    if device_id != SIMULATOR_DEVICE_ID:
+        if hardware_manager.get_device(device_id):
+            return error_response("Only simulated devices are configurable", 400)
+        return error_response("Device not found", 404)
+    if request.method == "GET":
+        return jsonify({"device_id": device_id, "config": get_simulator_config(), "fields": list(SIMULATOR_CONFIG_FIELDS)})
+
+    data = request.get_json(silent=True)
+    if not isinstance(data, dict) or not data:
+        return error_response("Request body must be a non-empty object", 400)
+    config, errors = update_simulator_config(data)
+    if errors:
+        return error_response("Invalid simulator config", 400, details=errors)
+    logger.info(f"Simulator profile updated: {data}")
+    return jsonify({"device_id": device_id, "config": config})
+
+# Firmware images live in FIRMWARE_DIR/<device_id>/: current.hex is the last image that flashed
+# and verified, previous.hex the one before it
+TEENSY_LOADER_CLI = os.getenv("TEENSY_LOADER_CLI", "teensy_loader_cli")
+TEENSY_MCU = os.getenv("TEENSY_MCU", "TEENSY41")
+FIRMWARE_REENUMERATE_SECONDS = float(os.getenv("FIRMWARE_REENUMERATE_SECONDS", 5))
+FIRMWARE_EXTENSIONS = (".hex",)
+FIRMWARE_MAX_BYTES = int(os.getenv("FIRMWARE_MAX_BYTES", 32 * 1024 * 1024))  # 8 MB of flash is ~23 MB as Intel HEX
+
+def validate_intel_hex(data):
+    """Check every Intel HEX record's checksum and that the image ends with an EOF record"""
+    try:
+        lines = [line.strip() for line in data.decode("ascii").splitlines() if line.strip()]
+    except UnicodeDecodeError:
+        return ["Firmware image is not an Intel HEX text file"]
+    if not lines:
+        return ["Firmware image is empty"]
+    for number, line in enumerate(lines, 1):
+        try:
+            if not line.startswith(":"):
+                raise ValueError
+            record = bytes.fromhex(line[1:])
+        except ValueError:
+            return [f"Line {number} is not an Intel HEX record"]
+        if len(record) < 5 or len(record) != record[0] + 5:
+            return [f"Line {number} has the wrong length"]
+        if sum(record) & 0xFF:
+            return [f"Line {number} fails its record checksum"]
+    if lines[-1].upper() != ":00000001FF":
+        return ["Firmware image has no end-of-file record"]
+    return []
+
+def flash_firmware(image_path):
+    """Flash an image with teensy_loader_cli; -s asks the running firmware to enter the bootloader"""
+    import subprocess
+    try:
+        completed = subprocess.run(
+            [TEENSY_LOADER_CLI, f"--mcu={TEENSY_MCU}", "-w", "-s", "-v", str(image_path)],
+            capture_output=True, text=True, timeout=120,
+        )
+    except (OSError, subprocess.TimeoutExpired) as e:
+        return False, str(e)
+    output = (completed.stdout + completed.stderr).strip()
+    return completed.returncode == 0, output or f"{TEENSY_LOADER_CLI} exited with code {completed.returncode}"
+
+def verify_flashed_device(device):
+    """Re-probe the flashed board after reboot and confirm it runs supported firmware
+
+    Only its own port is opened, and the caller holds that port's device queue, so runs on other boards
+    are not interrupted.
+    """
+    time.sleep(FIRMWARE_REENUMERATE_SECONDS)
+    refreshed = hardware_manager.rediscover_device(device)
+    if not refreshed:
+        return None, "Device did not come back after flashing"
+    if not refreshed.get("firmware_supported"):
+        return refreshed, f"Device reports unsupported firmware {refreshed.get('firmware_version')}"
+    return refreshed, None
+
+def update_device_firmware(device, image):
+    """Flash, verify, and roll back to the last good image if either step fails"""
+    device_dir = FIRMWARE_DIR / device["id"]
+    device_dir.mkdir(parents=True, exist_ok=True)
+    candidate = device_dir / "candidate.hex"
+    candidate.write_bytes(image)
+    current = device_dir / "current.hex"
+
+    # Nothing else may talk to the board while it is in the bootloader
+    with device_queue(device["port"]).exclusive(f"firmware:{device['id']}"):
+        if device["device_type"] == "ldpc":
+            teensy_pool.close_all()
+        else:
+            sat_pool.close(device["port"])
+        flashed, output = flash_firmware(candidate)
+        refreshed, problem = verify_flashed_device(device) if flashed else (None, f"Flashing failed: {output}")
+
+        if problem is None:
+            if current.exists():
+                shutil.copyfile(current, device_dir / "previous.hex")
+            candidate.replace(current)
+            return {"status": "updated", "device": refreshed, "loader_output": output}
+
+        rollback = None
+        if current.exists():
+            rolled_back, rollback_output = flash_firmware(current)
+            rollback = {"flashed": rolled_back, "loader_output": rollback_output}
+            if rolled_back:
+                refreshed, _ = verify_flashed_device(device)
+        candidate.unlink(missing_ok=True)
+        return {"status": "rolled_back" if rollback else "failed", "error": problem,
+                "rollback": rollback, "device": refreshed, "loader_output": output}
+
+@app.route("/hardware/<device_id>/firmware", methods=["GET"])
+def hardware_device_firmware(device_id):
+    """Report a board's firmware and the images stored for it"""
+    device = hardware_manager.get_device(device_id)
+    if not device:
+        return error_response("Device not found", 404)
+    device_dir = FIRMWARE_DIR / device_id
+    return jsonify({
+        "device_id": device_id,
+        "firmware_version": device.get("firmware_version"),
+        "firmware_supported": device.get("firmware_supported"),
+        "minimum_version": MIN_FIRMWARE_VERSIONS.get(device["device_type"]),
+        "stored_images": sorted(p.name for p in device_dir.glob("*.hex")) if device_dir.exists() else [],
+    })
+
+@app.route("/admin/hardware/<device_id>/firmware", methods=["POST"])
+def admin_device_firmware(device_id):
+    """Upload and flash a new image (multipart: firmware, sha256); takes the admin key"""
+    device = hardware_manager.get_device(device_id)
+    if not device:
+        return error_response("Device not found", 404)
+
+    staging = Path(tempfile.mkdtemp(prefix=f"{TEMP_PREFIX}firmware-", dir=DATA_DIR))
+    try:
+        try:
+            fields, files = stream_multipart(staging, FIRMWARE_EXTENSIONS, FIRMWARE_MAX_BYTES)
+        except UploadError as e:
+            return upload_error_response(e)
+        upload = next((f for f in files if f["field"] == "firmware"), None)
+        expected = (fields.get("sha256") or "").lower()
+        if not upload:
+            return error_response("Missing firmware file", 400, "missing_field", {"field": "firmware"})
+        if not expected:
+            return error_response("Missing sha256 checksum", 400, "missing_field", {"field": "sha256"})
+        image = upload["path"].read_bytes()
+        actual = upload["sha256"]
+        if actual != expected:
+            return error_response("Checksum mismatch", 400, "checksum_mismatch", {"expected": expected, "actual": actual})
+        errors = validate_intel_hex(image)
+        if errors:
+            return error_response("Invalid firmware image", 400, details={"errors": errors})
+
+        logger.info(f"Flashing {device_id} with firmware {actual[:12]}")
+        result = update_device_firmware(device, image)
+        result["sha256"] = actual
+        if result["status"] != "updated":
+            logger.error(f"Firmware update of {device_id} failed: {result['error']}")
+            return jsonify(result), 502
+        return jsonify(result)
+
+    except Exception as e:
+        logger.error(f"Firmware update error: {e}")
+        return exception_response(e)
+    finally:
+        shutil.rmtree(staging, ignore_errors=True)
+
+@app.route("/hardware/reservations", methods=["GET", "POST"])
+def hardware_reservations():
+    """List or book hardware time slots"""
+    try:
+        if request.method == "GET":
+            start = request.args.get("from")
+            end = request.args.get("to")
+            reservations = list_reservations(
+                request.args.get("device_id"),
+                parse_reservation_time(start) if start else None,
+                parse_reservation_time(end) if end else None,
+            )
+            return jsonify({"reservations": reservations, "current": current_reservation(request.args.get("device_id"))})
+
+        data = request.get_json(silent=True) or {}
+        data["user"] = reservation_owner(data)
+        missing = [field for field in ("user", "start_time", "end_time") if not data.get(field)]
+        if missing:
+            return error_response(f"Missing required field: {missing[0]}", 400, "missing_field", {"field": missing[0]})
+        try:
+            start = parse_reservation_time(data["start_time"])
+            end = parse_reservation_time(data["end_time"])
+        except ValueError:
+            return error_response("start_time and end_time must be ISO 8601 timestamps", 400)
+        if end <= start:
+            return error_response("end_time must be after start_time", 400)
+        device_id = data.get("device_id")
+        if device_id and device_id != SIMULATOR_DEVICE_ID and not hardware_manager.get_device(device_id):
+            return error_response(f"Unknown device: {device_id}", 404)
+
+        reservation, conflicts = create_reservation(data["user"], start, end, device_id, data.get("note"))
+        if conflicts:
+            return error_response("Slot overlaps an existing reservation", 409, "reservation_conflict", {"conflicts": conflicts})
+        logger.info(f"Reserved hardware for {reservation['user']}: {reservation['start_time']} - {reservation['end_time']}")
+        return jsonify(reservation), 201
+    except Exception as e:
+        logger.error(f"Reservation error: {e}")
+        return exception_response(e)
+
+@app.route("/hardware/reservations/<reservation_id>", methods=["DELETE"])
+def hardware_reservation_delete(reservation_id):
+    """Cancel a reservation; tenant keys may only cancel their own"""
+    tenant = current_tenant()
+    with get_db() as conn:
+        row = conn.execute("SELECT user FROM hardware_reservations WHERE id = ?", (reservation_id,)).fetchone()
+        if not row:
+            return error_response("Reservation not found", 404)
+        if tenant and row["user"] != tenant["name"]:
+            return error_response("Reservation belongs to another user", 403)
+        conn.execute("DELETE FROM hardware_reservations WHERE id = ?", (reservation_id,))
+        conn.commit()
+    return jsonify({"message": "Reservation cancelled", "id": reservation_id})
+
+# ------------------------------ Hardware Calibration -------------------------
+# Small satisfiable instance used to self-test the simulator after calibration.
+# Physical boards cannot load arbitrary CNF and return no assignment to check, so their
+# self-test is recorded for timing only and never decides whether calibration passed.
+CALIBRATION_SELF_TEST_CNF = """c calibration self-test (SAT)
+p cnf 5 8
+1 2 -3 0
+-1 3 4 0
+2 -4 5 0
+-2 -5 3 0
+1 -3 -5 0
+-1 4 5 0
+3 4 -2 0
+-4 -5 1 0
+"""
+CALIBRATION_SELF_TEST_RUNS = int(os.getenv("CALIBRATION_SELF_TEST_RUNS", 5))
+CALIBRATION_TIMEOUT_SECONDS = float(os.getenv("CALIBRATION_TIMEOUT_SECONDS", 60))
+
+def self_test_step(runs):
+    solved = sum(1 for run in runs if run.get("satisfiable"))
+    return {
+        "status": "passed" if runs and solved == len(runs) else "failed",
+        "runs": len(runs),
+        "solved": solved,
+        "avg_solve_time_ms": sum(run["solve_time_ms"] for run in runs) / len(runs) if runs else None,
+    }
+
+def calibrate_simulator():
+    """The simulated network has ideal oscillators and comparators; only the self-test is meaningful"""
+    profile = get_simulator_config()
+    runs = []
+    for i in range(CALIBRATION_SELF_TEST_RUNS):
+        solver = OscillatorNetworkSimulator(seed=simulator_run_seed(profile, i))
+        start_time = time.time()
+        satisfiable, _ = solver.solve(CALIBRATION_SELF_TEST_CNF)
+        runs.append({"satisfiable": satisfiable, "solve_time_ms": (time.time() - start_time) * 1000})
+    return {
+        "oscillator_trim": {"status": "simulated", "values": {
+            "time_constant_ns": OSCILLATOR_TIME_CONSTANT_NS, "speedup_factor": profile["speedup_factor"],
+        }},
+        "comparator_offsets": {"status": "simulated", "values": {}},
+        "self_test": self_test_step(runs),
+    }
+
+def calibrate_board(device):
+    """Trim and offset calibration in firmware, then an unverifiable self-test run for timing"""
+    hardware = sat_pool.get_connection(device["id"])
+    with device_queue(hardware.port).exclusive(f"calibration:{device['id']}"):
+        try:
+            trim = hardware.calibrate(CALIBRATION_TIMEOUT_SECONDS)
+        except Exception as e:
+            return {"oscillator_trim": {"status": "failed", "error": str(e)}}
+        reported = trim["reported"]
+        offsets = {key: value for key, value in reported.items() if "offset" in key}
+        steps = {
+            "oscillator_trim": {
+                "status": "completed", "duration_ms": trim["duration_ms"],
+                "values": {key: value for key, value in reported.items() if key not in offsets},
+            },
+            # Older firmware calibrates the comparators without printing the offsets it settled on
+            "comparator_offsets": {"status": "completed" if offsets else "not_reported", "values": offsets},
+        }
+        try:
+            summary = hardware.solve_sat_problem(CALIBRATION_SELF_TEST_CNF, "daedalus", CALIBRATION_SELF_TEST_RUNS)
+            steps["self_test"] = dict(
+                self_test_step(summary["runs"]), status="unverifiable",
+                note="The firmware reports a verdict without an assignment, so the result cannot be checked",
+            )
+        except Exception as e:
+            steps["self_test"] = {"status": "unverifiable", "error": str(e)}
+    return steps
+
+def run_calibration(device):
+    """Calibrate a SAT accelerator and store the resulting profile"""
+    steps = calibrate_simulator() if device.get("simulated") else calibrate_board(device)
+    # Only the simulator's self-test can be checked; a board's is informational
+    passed = (
+        steps["oscillator_trim"]["status"] in ("completed", "simulated")
+        and steps.get("self_test", {}).get("status") in ("passed", "unverifiable")
+    )
+    profile = {
+        "id": str(uuid.uuid4()),
+        "device_id": device["id"],
+        "status": "passed" if passed else "failed",
+        "calibrated_at": utc_now(),
+        "firmware_version": device.get("firmware_version"),
+        "steps": steps,
+    }
+    with get_db() as conn:
+        conn.execute(
+            "INSERT INTO hardware_calibrations (id, device_id, status, profile, created) VALUES (?, ?, ?, ?, ?)",
+            (profile["id"], device["id"], profile["status"], json.dumps(profile), profile["calibrated_at"]),
         )
+        conn.commit()
+    return profile
+
+def list_calibrations(device_id, limit=20):
+    with get_db() as conn:
+        rows = conn.execute(
+            "SELECT profile FROM hardware_calibrations WHERE device_id = ? ORDER BY created DESC LIMIT ?",
+            (device_id, limit),
+        ).fetchall()
+    return [json.loads(row["profile"]) for row in rows]
+
+def calibration_reference(device_id):
+    """Identify the calibration in effect for a device, for attaching to run results"""
+    latest = list_calibrations(device_id, limit=1) if device_id else []
+    if not latest:
+        return None
+    profile = latest[0]
+    return {key: profile[key] for key in ("id", "device_id", "status", "calibrated_at")}
+
+def calibration_reference_for_port(port):
+    device = hardware_manager.device_at_port(port)
+    return calibration_reference(device["id"]) if device else None
+
+def calibration_target(device_id):
+    if device_id == SIMULATOR_DEVICE_ID:
+        return simulator_device(), None
+    device = hardware_manager.get_device(device_id)
+    if not device:
+        return None, error_response("Device not found", 404)
+    if device["device_type"] != "sat":
+        return None, error_response("Calibration is only available for SAT accelerators", 400)
+    return device, None
+
+@app.route("/hardware/<device_id>/calibrate", methods=["POST"])
+def hardware_device_calibrate(device_id):
+    """Run the calibration sequence and store the resulting profile"""
+    device, error = calibration_target(device_id)
+    if error:
+        return error
+    try:
+        profile = run_calibration(device)
+        logger.info(f"Calibrated {device_id}: {profile['status']}")
+        return jsonify(profile), 201
     except Exception as e:
-        return jsonify({"status": "unhealthy", "error": str(e)}), 500
+        logger.error(f"Calibration error: {e}")
+        return exception_response(e)
+
+@app.route("/hardware/<device_id>/calibration", methods=["GET"])
+def hardware_device_calibration(device_id):
+    """Current calibration profile of a device, with recent history"""
+    device, error = calibration_target(device_id)
+    if error:
+        return error
+    history = list_calibrations(device_id, limit=request.args.get("limit", 20, type=int))
+    return jsonify({"device_id": device_id, "current": history[0] if history else None, "history": history})
 
 @app.route("/hardware/status")
 def hardware_status():
@@ -510,17 +1960,24 @@ def hardware_status():
                 sat_connected = True
         except:
             pass
+
+        watchdog_events = [
+            dict(event, port=connection.port)
+            for connection in list(sat_pool.connections.values()) for event in connection.watchdog_events
+        ]
         
         return jsonify({
             "hardware_manager": hw_status,
             "ldpc_connected": ldpc_connected,
             "sat_connected": sat_connected,
+            "power_monitor": power_monitor.source if power_monitor else None,
+            "sat_watchdog_events": watchdog_events,
             "concurrent_support": True,
             "timestamp": utc_now()
         })
     except Exception as e:
         logger.error(f"Hardware status error: {e}")
-        return jsonify({"error": str(e)}), 500
+        return exception_response(e)
 
 @app.route("/hardware/discover", methods=["POST"])
 def hardware_discover():
@@ -529,13 +1986,14 @@ def hardware_discover():
         discovered = hardware_manager.discover_all_devices()
         return jsonify({
             "discovered_devices": discovered,
+            "devices": hardware_manager.list_devices(),
             "total_found": len(discovered),
             "message": f"Found {len(discovered)} devices",
             "timestamp": utc_now()
         })
     except Exception as e:
         logger.error(f"Device discovery error: {e}")
-        return jsonify({"error": str(e)}), 500
+        return exception_response(e)
 
 # ------------------------------ Tests API ------------------------------------
 @app.route("/tests", methods=["GET", "POST"])
@@ -551,8 +2009,8 @@ def handle_tests():
             with get_db() as conn:
                 # Build query
                 query = "SELECT * FROM tests"
-                params = []
-                conditions = []
+                scope, params = tenant_scope_sql()
+                conditions = [scope]
 
                 if chip_type:
                     conditions.append("chip_type = ?")
@@ -561,8 +2019,7 @@ def handle_tests():
                     conditions.append("status = ?")
                     params.append(status)
 
-                if conditions:
-                    query += " WHERE " + " AND ".join(conditions)
+                query += " WHERE " + " AND ".join(conditions)
 
                 query += " ORDER BY created DESC LIMIT ? OFFSET ?"
                 params.extend([limit, offset])
@@ -580,12 +2037,8 @@ def handle_tests():
                                 test[field] = {}
 
                 # Get total count
-                count_query = "SELECT COUNT(*) as count FROM tests"
-                if conditions:
-                    count_query += " WHERE " + " AND ".join(conditions)
-                    count = conn.execute(count_query, params[:-2]).fetchone()["count"]
-                else:
-                    count = conn.execute(count_query).fetchone()["count"]
+                count_query = "SELECT COUNT(*) as count FROM tests WHERE " + " AND ".join(conditions)
+                count = conn.execute(count_query, params[:-2]).fetchone()["count"]
 
                 return jsonify(
                     {
@@ -598,7 +2051,7 @@ def handle_tests():
 
         except Exception as e:
             logger.error(f"Error listing tests: {e}")
-            return jsonify({"error": str(e)}), 500
+            return exception_response(e)
 
     else:  # POST
         try:
@@ -606,12 +2059,15 @@ def handle_tests():
 
             # Validate required fields
             if not data.get("name") or not data.get("chip_type"):
-                return (
-                    jsonify({"error": "Missing required fields: name, chip_type"}),
-                    400,
+                return error_response(
+                    "Missing required fields: name, chip_type", 400, "missing_field",
+                    {"fields": ["name", "chip_type"]}
                 )
 
             test_id = generate_id()
+            config = data.get("config", {})
+            if current_tenant():
+                config = dict(config, tenant=current_tenant()["name"])
 
             with get_db() as conn:
                 conn.execute(
@@ -625,7 +2081,7 @@ def handle_tests():
                         data["chip_type"],
                         data.get("test_mode", "standard"),
                         data.get("environment", "lab"),
-                        json.dumps(data.get("config", {})),
+                        json.dumps(config),
                         "created",
                         utc_now(),
                         json.dumps(data.get("metadata", {})),
@@ -637,7 +2093,7 @@ def handle_tests():
 
         except Exception as e:
             logger.error(f"Error creating test: {e}")
-            return jsonify({"error": str(e)}), 500
+            return exception_response(e)
 
 @app.route("/tests/<test_id>", methods=["GET", "DELETE"])
 def handle_test_detail(test_id):
@@ -649,7 +2105,7 @@ def handle_test_detail(test_id):
                 test = cursor.fetchone()
 
                 if not test:
-                    return jsonify({"error": "Test not found"}), 404
+                    return error_response("Test not found", 404)
 
                 test_data = dict_from_row(test)
 
@@ -681,34 +2137,794 @@ def handle_test_detail(test_id):
             else:  # DELETE
                 cursor = conn.execute("DELETE FROM tests WHERE id = ?", (test_id,))
                 if cursor.rowcount == 0:
-                    return jsonify({"error": "Test not found"}), 404
+                    return error_response("Test not found", 404)
 
                 conn.commit()
+                result_store.delete_job(test_id)
+                object_storage.delete_prefix(storage_key(test_artifacts_dir(test_id)))
                 return jsonify({"message": "Test deleted successfully"})
 
     except Exception as e:
         logger.error(f"Error handling test {test_id}: {e}")
-        return jsonify({"error": str(e)}), 500
+        return exception_response(e)
 
-# Helper function for simplified hardware testing (no belief propagation)
-def run_hardware_test(snr_db, num_runs=1):
-    """Run simplified hardware test focusing on actual Teensy telemetry"""
+# ------------------------------ Object Storage -------------------------------
+# Presets, uploads and test artifacts live under DATA_DIR by default. With STORAGE_BACKEND=s3 they go to a bucket
+# instead (AWS S3 or anything speaking its API: MinIO, GCS interoperability, R2) and are cached locally when read.
+STORAGE_BACKEND = os.getenv("STORAGE_BACKEND", "local").lower()
+STORAGE_S3_BUCKET = os.getenv("STORAGE_S3_BUCKET", "")
+STORAGE_S3_PREFIX = os.getenv("STORAGE_S3_PREFIX", "").strip("/")
+STORAGE_S3_ENDPOINT = os.getenv("STORAGE_S3_ENDPOINT") or None
+STORAGE_S3_REGION = os.getenv("STORAGE_S3_REGION") or None
+STORAGE_CACHE_DIR = Path(os.getenv("STORAGE_CACHE_DIR", DATA_DIR / "storage-cache"))
+
+def storage_key(path):
+    """Object key for a path under DATA_DIR, so both backends use the same layout"""
+    return Path(path).relative_to(DATA_DIR).as_posix()
+
+class ObjectStorage:
+    """Keyed blobs; keys are "/"-separated paths such as "artifacts/<test_id>/results.json" """
+
+    def put_file(self, key, path, move=False):
+        raise NotImplementedError
+
+    def put_bytes(self, key, data):
+        raise NotImplementedError
+
+    def local_path(self, key):
+        """A local file holding the object's bytes, or None if there is no such object"""
+        raise NotImplementedError
+
+    def exists(self, key):
+        raise NotImplementedError
+
+    def delete(self, key):
+        raise NotImplementedError
+
+    def delete_prefix(self, prefix):
+        raise NotImplementedError
+
+    def list(self, prefix):
+        """Map key -> {"size_bytes", "modified" (epoch seconds)} for every object under prefix"""
+        raise NotImplementedError
+
+class LocalStorage(ObjectStorage):
+    """Objects are plain files under root"""
+
+    def __init__(self, root):
+        self.root = Path(root)
+
+    def path(self, key):
+        return self.root / key
+
+    def put_file(self, key, path, move=False):
+        target = self.path(key)
+        target.parent.mkdir(parents=True, exist_ok=True)
+        if move:
+            os.replace(path, target)
+        else:
+            shutil.copyfile(path, target)
+
+    def put_bytes(self, key, data):
+        target = self.path(key)
+        target.parent.mkdir(parents=True, exist_ok=True)
+        target.write_bytes(data)
+
+    def local_path(self, key):
+        path = self.path(key)
+        return path if path.is_file() else None
+
+    def exists(self, key):
+        return self.path(key).is_file()
+
+    def delete(self, key):
+        self.path(key).unlink(missing_ok=True)
+
+    def delete_prefix(self, prefix):
+        shutil.rmtree(self.path(prefix), ignore_errors=True)
+
+    def list(self, prefix):
+        directory = self.path(prefix)
+        if not directory.is_dir():
+            return {}
+        objects = {}
+        for path in sorted(directory.rglob("*")):
+            if path.is_file():
+                stat = path.stat()
+                objects[path.relative_to(self.root).as_posix()] = {"size_bytes": stat.st_size, "modified": stat.st_mtime}
+        return objects
+
+class S3Storage(ObjectStorage):
+    """Objects in an S3-compatible bucket, downloaded into cache_dir on read; needs boto3"""
+
+    def __init__(self, bucket, prefix, endpoint, region, cache_dir):
+        import boto3
+        from botocore.exceptions import ClientError
+
+        self.client = boto3.client("s3", endpoint_url=endpoint, region_name=region)
+        self.ClientError = ClientError
+        self.bucket, self.prefix, self.cache = bucket, prefix, LocalStorage(cache_dir)
+
+    def _key(self, key):
+        return f"{self.prefix}/{key}" if self.prefix else key
+
+    def _head(self, key):
+        try:
+            return self.client.head_object(Bucket=self.bucket, Key=self._key(key))
+        except self.ClientError as e:
+            if e.response.get("Error", {}).get("Code") in ("404", "NoSuchKey", "NotFound"):
+                return None
+            raise
+
+    def put_file(self, key, path, move=False):
+        self.client.upload_file(str(path), self.bucket, self._key(key))
+        # Keep the local copy as the cached one so the next read doesn't download it again
+        self.cache.put_file(key, path, move=move)
+
+    def put_bytes(self, key, data):
+        self.client.put_object(Bucket=self.bucket, Key=self._key(key), Body=data)
+        self.cache.put_bytes(key, data)
+
+    def local_path(self, key):
+        head = self._head(key)
+        if head is None:
+            self.cache.delete(key)
+            return None
+        cached = self.cache.path(key)
+        if cached.is_file() and cached.stat().st_size == head["ContentLength"] \
+                and cached.stat().st_mtime >= head["LastModified"].timestamp():
+            return cached
+        cached.parent.mkdir(parents=True, exist_ok=True)
+        partial = cached.with_name(f".{cached.name}.{uuid.uuid4().hex}.part")
+        try:
+            self.client.download_file(self.bucket, self._key(key), str(partial))
+            os.replace(partial, cached)
+        finally:
+            partial.unlink(missing_ok=True)
+        return cached
+
+    def exists(self, key):
+        return self._head(key) is not None
+
+    def delete(self, key):
+        self.client.delete_object(Bucket=self.bucket, Key=self._key(key))
+        self.cache.delete(key)
+
+    def delete_prefix(self, prefix):
+        keys = [self._key(key) for key in self.list(prefix)]
+        for i in range(0, len(keys), 1000):  # DeleteObjects takes at most 1000 keys
+            self.client.delete_objects(
+                Bucket=self.bucket, Delete={"Objects": [{"Key": k} for k in keys[i:i + 1000]], "Quiet": True}
+            )
+        self.cache.delete_prefix(prefix)
+
+    def list(self, prefix):
+        objects = {}
+        strip = len(self.prefix) + 1 if self.prefix else 0
+        pages = self.client.get_paginator("list_objects_v2").paginate(
+            Bucket=self.bucket, Prefix=self._key(prefix.rstrip("/") + "/")
+        )
+        for page in pages:
+            for obj in page.get("Contents", []):
+                objects[obj["Key"][strip:]] = {"size_bytes": obj["Size"], "modified": obj["LastModified"].timestamp()}
+        return objects
+
+OBJECT_STORAGES = {
+    "local": lambda: LocalStorage(DATA_DIR),
+    "s3": lambda: S3Storage(
+        STORAGE_S3_BUCKET, STORAGE_S3_PREFIX, STORAGE_S3_ENDPOINT, STORAGE_S3_REGION, STORAGE_CACHE_DIR
+    ),
+}
+
+def make_object_storage():
+    if STORAGE_BACKEND not in OBJECT_STORAGES:
+        raise RuntimeError(f"STORAGE_BACKEND must be one of: {', '.join(OBJECT_STORAGES)}")
+    if STORAGE_BACKEND == "s3" and not STORAGE_S3_BUCKET:
+        raise RuntimeError("STORAGE_BACKEND=s3 needs STORAGE_S3_BUCKET")
+    return OBJECT_STORAGES[STORAGE_BACKEND]()
+
+object_storage = make_object_storage()
+
+def is_preset_key(key):
+    """Shared presets (sat/presets/...) and tenant presets (tenants/<name>/presets/...)"""
+    parts = key.split("/")
+    return key.startswith(storage_key(SAT_PRESETS_DIR) + "/") or (
+        len(parts) > 3 and parts[0] == storage_key(TENANTS_DIR) and parts[2] == "presets"
+    )
+
+def push_directory_to_storage(directory):
+    """Upload every file under a local directory, e.g. a newly written preset, when storage is remote"""
+    if isinstance(object_storage, LocalStorage):
+        return
+    for path in sorted(directory.rglob("*")):
+        if path.is_file():
+            object_storage.put_file(storage_key(path), path)
+
+def sync_presets_from_storage():
+    """Mirror preset files from the bucket under DATA_DIR, where the CNF indexes read them"""
+    if isinstance(object_storage, LocalStorage):
+        return 0
+    copied = 0
+    for top in (storage_key(SAT_PRESETS_DIR), storage_key(TENANTS_DIR)):
+        for key, info in object_storage.list(top).items():
+            target = DATA_DIR / key
+            if not is_preset_key(key) or (
+                target.is_file() and target.stat().st_size == info["size_bytes"]
+                and target.stat().st_mtime >= info["modified"]
+            ):
+                continue
+            target.parent.mkdir(parents=True, exist_ok=True)
+            shutil.copyfile(object_storage.local_path(key), target)
+            copied += 1
+    return copied
+
+# ------------------------------ Test Artifacts -------------------------------
+import mimetypes
+from flask import Response, send_file
+
+def test_artifacts_dir(test_id):
+    return ARTIFACTS_DIR / test_id
+
+def write_test_artifact(test_id, name, content):
+    """Store a file produced by a test; dicts and lists are written as JSON. Returns the object key"""
+    if isinstance(content, (dict, list)):
+        content = json.dumps(content, indent=2, default=str)
+    key = f"{storage_key(test_artifacts_dir(test_id))}/{name}"
+    object_storage.put_bytes(key, content if isinstance(content, bytes) else content.encode())
+    return key
+
+def collect_test_artifacts(test_id):
+    """Map artifact name -> {"key" or "path", "size_bytes", "modified"} for everything a test has left behind"""
+    artifacts = {}
+    prefix = storage_key(test_artifacts_dir(test_id))
+    for key, info in object_storage.list(prefix).items():
+        artifacts[key[len(prefix) + 1:]] = dict(info, key=key)
+
+    # Files that live outside the artifact directory, always on local disk
+    for name, path in (("checkpoint.json", CHECKPOINT_DIR / f"{test_id}.json"),
+                       ("progress.json", Path(f"sat_progress_{test_id}.json"))):
+        if path.exists():
+            stat = path.stat()
+            artifacts[name] = {"path": path, "size_bytes": stat.st_size, "modified": stat.st_mtime}
+    return artifacts
+
+def artifact_file(artifact):
+    """Local file with an artifact's bytes, fetched from object storage if need be"""
+    return artifact.get("path") or object_storage.local_path(artifact["key"])
+
+def format_solution(assignment):
+    """SAT competition output format: status line plus v-lines ending in 0"""
+    lines = ["s SATISFIABLE"]
+    for i in range(0, len(assignment), 20):
+        lines.append("v " + " ".join(map(str, assignment[i:i + 20])))
+    lines.append("v 0")
+    return "\n".join(lines) + "\n"
+
+def write_solution_artifacts(test_id, all_results):
+    """Move the satisfying assignments out of a test's results into solutions/*.sol files"""
+    problems = all_results.get("batch_results") or [all_results]
+    written = 0
+    for problem in problems:
+        prefix = f"solutions/{problem['problem_index']}/" if "problem_index" in problem else "solutions/"
+        for solver, assignments in (problem.pop("solutions", None) or {}).items():
+            for i, assignment in enumerate(assignments):
+                if assignment:
+                    write_test_artifact(test_id, f"{prefix}{solver}-{i + 1}.sol", format_solution(assignment))
+                    written += 1
+    all_results.pop("solutions", None)
+    return written
+
+def write_event_log(test_id):
+    """Persist the buffered progress events, which otherwise expire from memory"""
+    events, _, truncated = test_events.events_since(test_id)
+    lines = [json.dumps(event, default=str) for event in events]
+    if truncated:
+        lines.insert(0, json.dumps({"type": "truncated", "data": {"note": "earlier events were dropped"}}))
+    return write_test_artifact(test_id, "events.ndjson", "\n".join(lines) + "\n")
+
+def describe_artifact(test_id, name, artifact):
+    return {
+        "name": name,
+        "content_type": mimetypes.guess_type(name)[0] or "application/octet-stream",
+        "size_bytes": artifact["size_bytes"],
+        "modified": datetime.fromtimestamp(artifact["modified"], timezone.utc).isoformat(),
+        "url": f"/tests/{test_id}/artifacts/{name}",
+    }
+
+@app.route("/tests/<test_id>/artifacts", methods=["GET"])
+def list_test_artifacts(test_id):
+    """List the files produced by a test"""
     try:
-        teensy = teensy_pool.get_connection()
-        
-        # Run the hardware test
-        hw_results = teensy.run_snr_test(snr_db, num_runs)
-        # Don't close - connection is managed by pool
-        
-        return hw_results
-        
+        with get_db() as conn:
+            if not conn.execute("SELECT 1 FROM tests WHERE id = ?", (test_id,)).fetchone():
+                return error_response("Test not found", 404)
+
+        artifacts = [describe_artifact(test_id, name, artifact) for name, artifact in collect_test_artifacts(test_id).items()]
+        return jsonify({
+            "test_id": test_id,
+            "artifacts": artifacts,
+            "total_size_bytes": sum(a["size_bytes"] for a in artifacts),
+        })
+
     except Exception as e:
-        logger.error(f"Hardware test error: {e}")
-        return {"error": str(e), "algorithm": "hardware_ldpc"}
+        logger.error(f"Error listing artifacts for {test_id}: {e}")
+        return exception_response(e)
 
-# ------------------------------ Teensy Connection Pool ------------------
-class TeensyConnectionPool:
-    """Manages persistent Teensy connections to avoid slow reconnections"""
+@app.route("/tests/<test_id>/artifacts/<path:name>", methods=["GET"])
+def get_test_artifact(test_id, name):
+    """Download a single test artifact"""
+    try:
+        # Only names from the listing are served, so the path can't escape the artifact directories
+        artifact = collect_test_artifacts(test_id).get(name)
+        path = artifact_file(artifact) if artifact else None
+        if not path:
+            return error_response("Artifact not found", 404)
+
+        content_type = mimetypes.guess_type(name)[0] or "application/octet-stream"
+        return send_file(path, mimetype=content_type, as_attachment=True, download_name=Path(name).name)
+
+    except Exception as e:
+        logger.error(f"Error serving artifact {name} for {test_id}: {e}")
+        return exception_response(e)
+
+# ------------------------------ Uploads --------------------------------------
+from werkzeug.http import parse_options_header
+from werkzeug.sansio.multipart import Data, Epilogue, Field, File, MultipartDecoder, NeedData
+from werkzeug.exceptions import ClientDisconnected
+from werkzeug.wsgi import get_input_stream
+
+UPLOADS_DIR = DATA_DIR / "uploads"
+# Multipart bodies are parsed as they arrive and file parts written straight to disk, so this can exceed
+# MAX_CONTENT_LENGTH, which only bounds bodies Flask buffers
+UPLOAD_MAX_BYTES = int(os.getenv("UPLOAD_MAX_BYTES", 512 * 1024 * 1024))
+UPLOAD_MAX_PARTS = int(os.getenv("UPLOAD_MAX_PARTS", 1000))
+UPLOAD_FIELD_MAX_BYTES = 64 * 1024  # plain form fields are kept in memory
+UPLOAD_CHUNK_BYTES = 64 * 1024
+# File types /uploads accepts, matched on the part's filename before any of its content is read
+UPLOAD_EXTENSIONS = tuple(e.strip().lower() for e in os.getenv("UPLOAD_EXTENSIONS", ".cnf,.cnf.gz,.csv,.json,.zip").split(","))
+
+class UploadError(Exception):
+    """A multipart upload was rejected; everything written for it has been removed"""
+
+    def __init__(self, message, status=400, code=None, details=None):
+        super().__init__(message)
+        self.status = status
+        self.code = code
+        self.details = details
+
+def upload_error_response(e):
+    return error_response(str(e), e.status, e.code, e.details)
+
+def safe_upload_name(filename):
+    """Client filename reduced to a bare name that can't escape the upload directory"""
+    name = re.sub(r"[^A-Za-z0-9._-]", "_", Path(filename.replace("\\", "/")).name).lstrip(".")
+    return name or "upload"
+
+def stream_multipart(directory, allowed_extensions, max_bytes=UPLOAD_MAX_BYTES):
+    """Parse the request body as it arrives, writing file parts into directory while hashing them.
+    Returns (fields, files); files are {field, filename, path, size_bytes, sha256} in upload order."""
+    content_type, options = parse_options_header(request.headers.get("Content-Type", ""))
+    if content_type != "multipart/form-data" or not options.get("boundary"):
+        raise UploadError("Expected a multipart/form-data body", 415)
+    if request.content_length is not None and request.content_length > max_bytes:
+        raise UploadError(f"Upload is larger than {max_bytes} bytes", 413, details={"limit_bytes": max_bytes})
+
+    stream = get_input_stream(request.environ, safe_fallback=False)
+    decoder = MultipartDecoder(options["boundary"].encode(), UPLOAD_FIELD_MAX_BYTES, max_parts=UPLOAD_MAX_PARTS)
+    directory.mkdir(parents=True, exist_ok=True)
+    fields, files, part, received = {}, [], None, 0
+    try:
+        done = False
+        while not done:
+            chunk = stream.read(UPLOAD_CHUNK_BYTES)
+            received += len(chunk)
+            if received > max_bytes:
+                raise UploadError(f"Upload is larger than {max_bytes} bytes", 413, details={"limit_bytes": max_bytes})
+            decoder.receive_data(chunk or None)
+            while True:
+                event = decoder.next_event()
+                if isinstance(event, NeedData):
+                    break
+                if isinstance(event, Epilogue):
+                    done = True
+                    break
+                if isinstance(event, File):
+                    extension = next((e for e in allowed_extensions if event.filename.lower().endswith(e)), None)
+                    if not extension:
+                        # Refused from the part headers, before any of the file is read
+                        raise UploadError(f"File type not allowed: {event.filename}", 415, "file_type_not_allowed",
+                                          {"allowed": list(allowed_extensions)})
+                    name = safe_upload_name(event.filename)
+                    path = directory / name
+                    if path.exists():
+                        path = directory / f"{len(files) + 1}-{name}"
+                    part = {"field": event.name, "filename": name, "path": path, "size_bytes": 0,
+                            "hash": hashlib.sha256(), "handle": open(path, "wb")}
+                elif isinstance(event, Field):
+                    part = {"field": event.name, "value": bytearray()}
+                elif isinstance(event, Data):
+                    if "handle" in part:
+                        part["handle"].write(event.data)
+                        part["hash"].update(event.data)
+                        part["size_bytes"] += len(event.data)
+                    else:
+                        part["value"] += event.data
+                    if not event.more_data:
+                        if "handle" in part:
+                            part["handle"].close()
+                            files.append({
+                                "field": part["field"], "filename": part["filename"], "path": part["path"],
+                                "size_bytes": part["size_bytes"], "sha256": part["hash"].hexdigest(),
+                            })
+                        else:
+                            fields[part["field"]] = part["value"].decode("utf-8", "replace")
+                        part = None
+            if not chunk and not done:
+                raise UploadError("Upload ended before the closing multipart boundary", 400)
+    except Exception as e:
+        if part and "handle" in part:
+            part["handle"].close()
+            files.append(part)
+        for written in files:
+            written["path"].unlink(missing_ok=True)
+        if isinstance(e, UploadError):
+            raise
+        if isinstance(e, HTTPException):
+            raise UploadError(e.description, e.code)
+        raise
+    return fields, files
+
+def verify_upload_checksums(fields, files):
+    """Check parts against the optional "checksums" field ({filename: sha256}), or "sha256" for a single file"""
+    expected = {}
+    if fields.get("checksums"):
+        try:
+            expected = {safe_upload_name(k): str(v).lower() for k, v in json.loads(fields["checksums"]).items()}
+        except (ValueError, AttributeError):
+            raise UploadError("checksums must be a JSON object of filename -> sha256", 400)
+    elif fields.get("sha256") and len(files) == 1:
+        expected = {files[0]["filename"]: fields["sha256"].lower()}
+
+    mismatched = [
+        {"filename": f["filename"], "expected": expected[f["filename"]], "actual": f["sha256"]}
+        for f in files if f["filename"] in expected and expected[f["filename"]] != f["sha256"]
+    ]
+    unknown = sorted(set(expected) - {f["filename"] for f in files})
+    if mismatched or unknown:
+        raise UploadError("Checksum mismatch", 400, "checksum_mismatch", {"mismatched": mismatched, "missing": unknown})
+    for f in files:
+        f["verified"] = f["filename"] in expected
+
+def uploads_root(tenant):
+    """Tenant uploads sit beside their presets and count against the same quota"""
+    return TENANTS_DIR / tenant["name"] / "uploads" if tenant else UPLOADS_DIR
+
+# Files are stored once per uploads root under objects/<sha256>; uploads refer to them by hash
+upload_objects_lock = threading.Lock()
+
+def upload_object_path(root, sha256):
+    return root / "objects" / sha256
+
+def store_upload_objects(root, files):
+    """Move each file into the object store, dropping the new copy when identical bytes are already there"""
+    for f in files:
+        key = storage_key(upload_object_path(root, f["sha256"]))
+        f["deduplicated"] = object_storage.exists(key)
+        if f["deduplicated"]:
+            f["path"].unlink()
+        else:
+            object_storage.put_file(key, f["path"], move=True)
+        f["path"] = key
+
+def release_upload_objects(root, upload_id, files):
+    """Remove the objects behind an upload's files that no other upload refers to"""
+    referenced = set()
+    for meta in root.glob("*/upload.json"):
+        if meta.parent.name != upload_id:
+            referenced.update(f["sha256"] for f in json.loads(meta.read_text())["files"])
+    for f in files:
+        if f["sha256"] not in referenced:
+            object_storage.delete(storage_key(upload_object_path(root, f["sha256"])))
+
+def delete_upload(root, upload_id, files):
+    with upload_objects_lock:
+        release_upload_objects(root, upload_id, files)
+        shutil.rmtree(root / upload_id, ignore_errors=True)
+
+def load_upload(upload_id):
+    if not re.fullmatch(r"[0-9a-f-]{36}", upload_id):
+        return None
+    path = uploads_root(current_tenant()) / upload_id / "upload.json"
+    return json.loads(path.read_text()) if path.is_file() else None
+
+def resolve_upload_file(reference):
+    """Stored object for "<upload_id>/<filename>" among the caller's uploads, or None"""
+    upload_id, _, filename = reference.partition("/")
+    upload = load_upload(upload_id)
+    stored = next((f for f in upload["files"] if f["filename"] == filename), None) if upload else None
+    if not stored:
+        return None
+    return object_storage.local_path(storage_key(upload_object_path(uploads_root(current_tenant()), stored["sha256"])))
+
+# CNF uploads up to this size are parsed for their canonical instance hash
+UPLOAD_HASH_MAX_BYTES = int(os.getenv("UPLOAD_HASH_MAX_BYTES", 64 * 1024 * 1024))
+
+def upload_instance_hash(f):
+    """Canonical hash of an uploaded .cnf or .cnf.gz, so it matches the same instance from a preset"""
+    name = f["filename"].lower()
+    if not name.endswith((".cnf", ".cnf.gz")) or f["size_bytes"] > UPLOAD_HASH_MAX_BYTES:
+        return None
+    opener = gzip.open if name.endswith(".gz") else open
+    try:
+        with opener(f["path"], "rt", errors="replace") as stream:
+            text = stream.read(UPLOAD_HASH_MAX_BYTES + 1)
+    except (OSError, EOFError):
+        return None
+    return safe_instance_hash(text) if len(text) <= UPLOAD_HASH_MAX_BYTES else None
+
+def finish_upload(tenant, upload_id, fields, files):
+    """Move received files into the object store and record the upload; raises UploadError over the file quota"""
+    root = uploads_root(tenant)
+    for f in files:
+        f["instance_hash"] = upload_instance_hash(f)
+    directory = root / upload_id
+    directory.mkdir(parents=True, exist_ok=True)
+    with upload_objects_lock:
+        store_upload_objects(root, files)
+        if tenant and tenant_upload_usage(tenant)["files"] > tenant["quota"]["upload_max_files"]:
+            release_upload_objects(root, upload_id, files)
+            shutil.rmtree(directory, ignore_errors=True)
+            raise UploadError("Upload quota exceeded", 413, "quota_exceeded",
+                              {"limits": {"files": tenant["quota"]["upload_max_files"]}})
+        upload = {
+            "upload_id": upload_id,
+            "created": utc_now(),
+            "tenant": tenant["name"] if tenant else None,
+            "fields": {k: v for k, v in fields.items() if k not in ("checksums", "sha256")},
+            "files": [{k: v for k, v in f.items() if k != "path"} for f in files],
+            "total_bytes": sum(f["size_bytes"] for f in files),
+            "stored_bytes": sum(f["size_bytes"] for f in files if not f["deduplicated"]),
+        }
+        (directory / "upload.json").write_text(json.dumps(upload, indent=2))
+    logger.info(f"Upload {upload_id}: {len(files)} files, {upload['total_bytes']} bytes "
+                f"({upload['stored_bytes']} new)")
+    return upload
+
+@app.route("/uploads", methods=["POST"])
+def create_upload():
+    """Stream a multipart upload of instance and measurement files to disk (optional checksums field)"""
+    tenant = current_tenant()
+    upload_id = generate_id()
+    root = uploads_root(tenant)
+    directory = root / upload_id
+    max_bytes = UPLOAD_MAX_BYTES
+    if tenant:
+        usage = tenant_upload_usage(tenant)
+        max_bytes = min(max_bytes, max(tenant["quota"]["upload_max_bytes"] - usage["bytes"], 0))
+    try:
+        fields, files = stream_multipart(directory, UPLOAD_EXTENSIONS, max_bytes)
+        if not files:
+            raise UploadError("No files in upload", 400, "missing_field", {"field": "file"})
+        verify_upload_checksums(fields, files)
+    except UploadError as e:
+        shutil.rmtree(directory, ignore_errors=True)
+        if e.status == 413 and e.code is None and max_bytes < UPLOAD_MAX_BYTES:
+            # The byte limit that tripped was the tenant's remaining quota
+            e.code, e.details = "quota_exceeded", {"limits": {"bytes": tenant["quota"]["upload_max_bytes"]}}
+        return upload_error_response(e)
+    except Exception as e:
+        shutil.rmtree(directory, ignore_errors=True)
+        logger.error(f"Upload error: {e}")
+        return exception_response(e)
+
+    try:
+        upload = finish_upload(tenant, upload_id, fields, files)
+    except UploadError as e:
+        return upload_error_response(e)
+    return jsonify(upload), 201
+
+@app.route("/uploads/<upload_id>", methods=["GET", "DELETE"])
+def upload_detail(upload_id):
+    """Describe or delete an upload"""
+    upload = load_upload(upload_id)
+    if not upload:
+        return error_response("Upload not found", 404)
+    if request.method == "DELETE":
+        delete_upload(uploads_root(current_tenant()), upload_id, upload["files"])
+        return jsonify({"message": f"Upload {upload_id} deleted"})
+    return jsonify(upload)
+
+# Resumable uploads follow the tus core protocol's offset handling: the client creates a session with the
+# final size, PATCHes bytes at Upload-Offset, and after a dropped connection asks for the offset to resume
+# from. The completed file becomes an ordinary upload with the session's ID.
+RESUMABLE_UPLOAD_TTL_SECONDS = float(os.getenv("RESUMABLE_UPLOAD_TTL_SECONDS", 24 * 3600))
+RESUMABLE_CONTENT_TYPE = "application/offset+octet-stream"
+resumable_locks = defaultdict(threading.Lock)
+
+def resumable_dir(tenant, session_id):
+    return uploads_root(tenant) / "partial" / session_id
+
+def load_resumable(session_id):
+    if not re.fullmatch(r"[0-9a-f-]{36}", session_id):
+        return None
+    directory = resumable_dir(current_tenant(), session_id)
+    path = directory / "session.json"
+    if not path.is_file():
+        return None
+    session = json.loads(path.read_text())
+    data = directory / "data"
+    session["offset"] = data.stat().st_size if data.exists() else 0
+    updated = data.stat().st_mtime if data.exists() else path.stat().st_mtime
+    session["expires"] = datetime.fromtimestamp(updated + RESUMABLE_UPLOAD_TTL_SECONDS, timezone.utc).isoformat()
+    return session
+
+def expired_resumable_sessions(root, cutoff):
+    """Session directories under root that have received nothing since cutoff"""
+    for directory in (root / "partial").glob("*"):
+        newest = max((p.stat().st_mtime for p in directory.iterdir()), default=0)
+        if newest < cutoff:
+            yield directory
+
+def remove_resumable_session(directory):
+    shutil.rmtree(directory, ignore_errors=True)
+    resumable_locks.pop(directory.name, None)
+
+def sweep_resumable_uploads(root):
+    """Remove sessions that have received nothing for RESUMABLE_UPLOAD_TTL_SECONDS"""
+    for directory in list(expired_resumable_sessions(root, time.time() - RESUMABLE_UPLOAD_TTL_SECONDS)):
+        remove_resumable_session(directory)
+
+def resumable_response(session, status=200):
+    response = jsonify(session)
+    response.headers["Upload-Offset"] = str(session["offset"])
+    response.headers["Upload-Length"] = str(session["size_bytes"])
+    response.headers["Cache-Control"] = "no-store"
+    return response, status
+
+@app.route("/uploads/resumable", methods=["POST"])
+def create_resumable_upload():
+    """Start a resumable upload of one large file (filename, size_bytes, optional sha256 and fields)"""
+    data = request.get_json(silent=True) or {}
+    filename = safe_upload_name(str(data.get("filename") or ""))
+    size_bytes = data.get("size_bytes")
+    if not data.get("filename"):
+        return error_response("filename is required", 400, "missing_field", {"field": "filename"})
+    if not any(filename.lower().endswith(e) for e in UPLOAD_EXTENSIONS):
+        return error_response(f"File type not allowed: {filename}", 415, "file_type_not_allowed",
+                              {"allowed": list(UPLOAD_EXTENSIONS)})
+    if not isinstance(size_bytes, int) or isinstance(size_bytes, bool) or size_bytes <= 0:
+        return error_response("size_bytes must be a positive integer", 400)
+    if size_bytes > UPLOAD_MAX_BYTES:
+        return error_response(f"Upload is larger than {UPLOAD_MAX_BYTES} bytes", 413,
+                              details={"limit_bytes": UPLOAD_MAX_BYTES})
+    if data.get("sha256") and not re.fullmatch(r"[0-9a-fA-F]{64}", str(data["sha256"])):
+        return error_response("sha256 must be 64 hex characters", 400)
+    fields = data.get("fields") or {}
+    if not isinstance(fields, dict):
+        return error_response("fields must be an object", 400)
+
+    tenant = current_tenant()
+    sweep_resumable_uploads(uploads_root(tenant))
+    if tenant:
+        # Bytes promised to the tenant's other open sessions count as already used
+        reserved = 0
+        for path in (uploads_root(tenant) / "partial").glob("*/session.json"):
+            data_path = path.parent / "data"
+            reserved += json.loads(path.read_text())["size_bytes"] - (data_path.stat().st_size if data_path.exists() else 0)
+        quota_error = check_upload_quota(tenant, size_bytes + reserved, 2)
+        if quota_error:
+            return quota_error
+
+    session_id = generate_id()
+    directory = resumable_dir(tenant, session_id)
+    directory.mkdir(parents=True)
+    (directory / "session.json").write_text(json.dumps({
+        "session_id": session_id,
+        "created": utc_now(),
+        "filename": filename,
+        "size_bytes": size_bytes,
+        "sha256": str(data["sha256"]).lower() if data.get("sha256") else None,
+        "fields": {str(k): str(v) for k, v in fields.items()},
+    }, indent=2))
+    (directory / "data").touch()
+    session = load_resumable(session_id)
+    response, status = resumable_response(session, 201)
+    response.headers["Location"] = api_path(f"/uploads/resumable/{session_id}")
+    return response, status
+
+@app.route("/uploads/resumable/<session_id>", methods=["GET", "HEAD", "PATCH", "DELETE"])
+def resumable_upload(session_id):
+    """Report the offset to resume from, append bytes at Upload-Offset, or abandon the upload"""
+    session = load_resumable(session_id)
+    if not session:
+        return error_response("Upload session not found", 404)
+    tenant = current_tenant()
+    directory = resumable_dir(tenant, session_id)
+    if request.method == "DELETE":
+        shutil.rmtree(directory, ignore_errors=True)
+        return jsonify({"message": f"Upload session {session_id} deleted"})
+    if request.method != "PATCH":
+        return resumable_response(session)
+
+    if request.mimetype != RESUMABLE_CONTENT_TYPE:
+        return error_response(f"Send the bytes as {RESUMABLE_CONTENT_TYPE}", 415,
+                              details={"content_type": request.mimetype})
+    lock = resumable_locks[session_id]
+    if not lock.acquire(blocking=False):
+        return error_response("Another request is writing to this upload", 409, "upload_in_progress",
+                              {"offset": session["offset"]})
+    try:
+        session = load_resumable(session_id)
+        try:
+            offset = int(request.headers.get("Upload-Offset", ""))
+        except ValueError:
+            return error_response("Upload-Offset header is required", 400, "missing_field", {"field": "Upload-Offset"})
+        if offset != session["offset"]:
+            # The client's view is stale, e.g. the last chunk partly arrived before the connection dropped
+            return error_response("Upload-Offset does not match the bytes received", 409, "offset_mismatch",
+                                  {"offset": session["offset"]})
+        remaining = session["size_bytes"] - offset
+        if request.content_length is not None and request.content_length > remaining:
+            return error_response(f"Only {remaining} bytes remain in this upload", 413,
+                                  details={"remaining_bytes": remaining})
+
+        stream = get_input_stream(request.environ, safe_fallback=False)
+        with open(directory / "data", "ab") as f:
+            try:
+                while remaining > 0:
+                    chunk = stream.read(min(UPLOAD_CHUNK_BYTES, remaining))
+                    if not chunk:
+                        break
+                    f.write(chunk)
+                    remaining -= len(chunk)
+            except ClientDisconnected:
+                # Keep what arrived; the client resumes from the new offset
+                logger.info(f"Upload session {session_id}: connection dropped at {session['size_bytes'] - remaining}")
+        session = load_resumable(session_id)
+        if session["offset"] < session["size_bytes"]:
+            return resumable_response(session)
+
+        path = directory / "data"
+        digest = hashlib.sha256()
+        with open(path, "rb") as f:
+            for block in iter(lambda: f.read(1024 * 1024), b""):
+                digest.update(block)
+        actual = digest.hexdigest()
+        if session["sha256"] and session["sha256"] != actual:
+            shutil.rmtree(directory, ignore_errors=True)
+            return error_response("Checksum mismatch", 400, "checksum_mismatch", {"mismatched": [
+                {"filename": session["filename"], "expected": session["sha256"], "actual": actual}]})
+        files = [{"field": "file", "filename": session["filename"], "path": path,
+                  "size_bytes": session["size_bytes"], "sha256": actual, "verified": bool(session["sha256"])}]
+        try:
+            session["upload"] = finish_upload(tenant, session_id, session["fields"], files)
+        except UploadError as e:
+            shutil.rmtree(directory, ignore_errors=True)
+            return upload_error_response(e)
+        shutil.rmtree(directory, ignore_errors=True)
+        return resumable_response(session)
+    finally:
+        lock.release()
+
+# Helper function for simplified hardware testing (no belief propagation)
+def run_hardware_test(snr_db, num_runs=1):
+    """Run simplified hardware test focusing on actual Teensy telemetry"""
+    try:
+        teensy = teensy_pool.get_connection()
+        
+        # Run the hardware test
+        hw_results = teensy.run_snr_test(snr_db, num_runs)
+        # Don't close - connection is managed by pool
+        
+        return hw_results
+        
+    except Exception as e:
+        logger.error(f"Hardware test error: {e}")
+        return {"error": str(e), "algorithm": "hardware_ldpc"}
+
+# ------------------------------ Teensy Connection Pool ------------------
+class TeensyConnectionPool:
+    """Manages persistent Teensy connections to avoid slow reconnections"""
     
     def __init__(self):
         self.connection = None
@@ -803,7 +3019,7 @@ class TeensyInterface:
             self.port = self.find_teensy_port()
         
         if not self.connect():
-            raise RuntimeError("Failed to connect to LDPC decoder hardware")
+            raise HardwareUnavailableError("Failed to connect to LDPC decoder hardware")
 
     def _add_to_history(self, message, direction="system"):
         """Add message to serial history with timestamp"""
@@ -1097,7 +3313,7 @@ class TeensyInterface:
     def execute_command(self, command, timeout=5):
         """Execute a single command and return response"""
         if not self.check_connection():
-            raise RuntimeError("LDPC hardware not connected - press RESET button on Teensy")
+            raise HardwareUnavailableError("LDPC hardware not connected - press RESET button on Teensy")
 
         try:
             # Clear any pending data
@@ -1202,7 +3418,7 @@ class TeensyInterface:
     def run_snr_test(self, snr_db, num_runs=1):
         """Run simplified test using CSV output from Teensy"""
         if not self.check_connection():
-            raise RuntimeError("Device not connected")
+            raise HardwareUnavailableError("Device not connected")
 
         logger.info(f"Starting simplified SNR {snr_db}dB test: {num_runs} runs")
 
@@ -1374,7 +3590,7 @@ def ldpc_deploy():
         mode = data.get("mode", "run")
 
         if not snr_runs:
-            return jsonify({"error": "snr_runs cannot be empty"}), 400
+            return error_response("snr_runs cannot be empty", 400)
 
         teensy = teensy_pool.get_connection()
         start_ts = utc_now()
@@ -1399,7 +3615,7 @@ def ldpc_deploy():
         )
     except Exception as e:
         logger.error(f"Deploy error: {e}")
-        return jsonify({"error": str(e)}), 500
+        return exception_response(e)
 
 @app.route("/ldpc/command", methods=["POST"])
 def ldpc_command():
@@ -1408,13 +3624,13 @@ def ldpc_command():
     try:
         cmd = request.get_json().get("command", "").strip()
         if not cmd:
-            return jsonify({"error": "command cannot be empty"}), 400
+            return error_response("command cannot be empty", 400)
         teensy = teensy_pool.get_connection()
         output = teensy.execute_command(cmd)
         return jsonify({"output": output})
     except Exception as e:
         logger.error(f"Command error: {e}")
-        return jsonify({"error": str(e)}), 500
+        return exception_response(e)
 
 @app.route("/ldpc/serial-history", methods=["GET"])
 def ldpc_serial_history():
@@ -1441,7 +3657,8 @@ def handle_ldpc_jobs():
     if request.method == "GET":
         try:
             with get_db() as conn:
-                cursor = conn.execute("SELECT * FROM ldpc_jobs ORDER BY created DESC")
+                scope, params = tenant_scope_sql()
+                cursor = conn.execute(f"SELECT * FROM ldpc_jobs WHERE {scope} ORDER BY created DESC", params)
                 jobs = [dict_from_row(row) for row in cursor]
 
                 # Parse JSON fields
@@ -1457,7 +3674,7 @@ def handle_ldpc_jobs():
 
         except Exception as e:
             logger.error(f"Error listing LDPC jobs: {e}")
-            return jsonify({"error": str(e)}), 500
+            return exception_response(e)
     
     else:  # POST
         try:
@@ -1475,13 +3692,13 @@ def handle_ldpc_jobs():
 
             # Validate parameters
             if not 1 <= start_snr <= 10 or not 1 <= end_snr <= 10:
-                return jsonify({"error": "SNR must be between 1 and 10 dB"}), 400
+                return error_response("SNR must be between 1 and 10 dB", 400)
             
             if start_snr > end_snr:
-                return jsonify({"error": "Start SNR must be <= End SNR"}), 400
+                return error_response("Start SNR must be <= End SNR", 400)
             
             if not 1 <= runs_per_snr <= 10:
-                return jsonify({"error": "Runs per SNR must be between 1 and 10"}), 400
+                return error_response("Runs per SNR must be between 1 and 10", 400)
 
             # Try to connect to hardware
             teensy = None
@@ -1493,12 +3710,12 @@ def handle_ldpc_jobs():
                 # Health check
                 health_status = teensy.check_chip_health()
                 if health_status["status"] != "healthy":
-                    raise RuntimeError(f"Hardware health check failed: {health_status}")
+                    raise HardwareUnavailableError(f"Hardware health check failed: {health_status}")
             except Exception as e:
-                return jsonify({
-                    "error": f"Hardware connection failed: {str(e)}",
-                    "suggestion": "Check Teensy connection and press RESET button if needed"
-                }), 500
+                return error_response(
+                    f"Hardware connection failed: {e}", 503, "hardware_unavailable",
+                    {"suggestion": "Check Teensy connection and press RESET button if needed"}
+                )
 
             # Store job in database with "running" status
             with get_db() as conn:
@@ -1516,7 +3733,8 @@ def handle_ldpc_jobs():
                             "start_snr": start_snr,
                             "end_snr": end_snr,
                             "runs_per_snr": runs_per_snr,
-                            "hardware_type": "AMORGOS_LDPC"
+                            "hardware_type": "AMORGOS_LDPC",
+                            "tenant": current_tenant()["name"] if current_tenant() else None
                         }),
                         "running",
                         utc_now(),
@@ -1604,7 +3822,7 @@ def handle_ldpc_jobs():
             except:
                 pass
             
-            return jsonify({"error": str(e)}), 500
+            return exception_response(e)
 
 @app.route("/ldpc/jobs/<job_id>", methods=["GET", "DELETE"])
 def handle_ldpc_job_detail(job_id):
@@ -1616,7 +3834,7 @@ def handle_ldpc_job_detail(job_id):
                 job = cursor.fetchone()
 
                 if not job:
-                    return jsonify({"error": "Job not found"}), 404
+                    return error_response("Job not found", 404)
 
                 job_data = dict_from_row(job)
 
@@ -1633,39 +3851,40 @@ def handle_ldpc_job_detail(job_id):
             else:  # DELETE
                 cursor = conn.execute("DELETE FROM ldpc_jobs WHERE id = ?", (job_id,))
                 if cursor.rowcount == 0:
-                    return jsonify({"error": "Job not found"}), 404
+                    return error_response("Job not found", 404)
 
                 conn.commit()
                 return jsonify({"message": "Job deleted successfully"})
 
     except Exception as e:
         logger.error(f"Error handling LDPC job {job_id}: {e}")
-        return jsonify({"error": str(e)}), 500
+        return exception_response(e)
 
 @app.route("/ldpc/test-summaries", methods=["GET"])
 def get_test_summaries():
     """Get summaries of all tests for comparison dropdown"""
     try:
+        scope, params = tenant_scope_sql()
         with get_db() as conn:
             # Get LDPC jobs
-            ldpc_cursor = conn.execute("""
+            ldpc_cursor = conn.execute(f"""
                 SELECT id, name, status, created, 
                        json_extract(metadata, '$.performance_summary.convergence_rate') as convergence_rate,
                        json_extract(metadata, '$.performance_summary.energy_efficiency_pj_per_bit') as energy_per_bit,
                        json_extract(metadata, '$.test_configuration.algorithm_type') as algorithm_type
                 FROM ldpc_jobs 
-                WHERE status = 'completed'
+                WHERE status = 'completed' AND {scope}
                 ORDER BY created DESC
-            """)
+            """, params)
             ldpc_jobs = [dict_from_row(row) for row in ldpc_cursor]
             
             # Get other tests (SAT, etc.)
-            test_cursor = conn.execute("""
+            test_cursor = conn.execute(f"""
                 SELECT id, name, chip_type, status, created
                 FROM tests 
-                WHERE status = 'completed'
+                WHERE status = 'completed' AND {scope}
                 ORDER BY created DESC
-            """)
+            """, params)
             other_tests = [dict_from_row(row) for row in test_cursor]
             
             # Format for dropdown
@@ -1695,46 +3914,64 @@ def get_test_summaries():
             
     except Exception as e:
         logger.error(f"Error fetching test summaries: {e}")
-        return jsonify({"error": str(e)}), 500
+        return exception_response(e)
 
 # ------------------------------ SAT Solver Implementations -------------------
+import queue
 import random
-from collections import defaultdict
+from concurrent.futures import FIRST_COMPLETED, ProcessPoolExecutor, ThreadPoolExecutor, as_completed, wait
+
+class DimacsParseError(ValueError):
+    """Malformed DIMACS, with the 1-based line it was found on"""
+
+    def __init__(self, message, line=None):
+        super().__init__(f"line {line}: {message}" if line else message)
+        self.line = line
+
+def parse_dimacs(dimacs_str):
+    """Parse DIMACS CNF format into (num_vars, clauses)"""
+    lines = dimacs_str.split('\n')
+    clauses = []
+    num_vars = 0
+
+    for number, line in enumerate(lines, 1):
+        line = line.strip()
+        if line.startswith('c') or not line:
+            continue
+        elif line.startswith('%'):
+            break  # SATLIB end-of-formula marker
+        elif line.startswith('p cnf'):
+            parts = line.split()
+            try:
+                num_vars = int(parts[2])
+            except (IndexError, ValueError):
+                raise DimacsParseError(f"malformed header {line!r}", number)
+        else:
+            try:
+                clause = [int(x) for x in line.split() if x != '0']
+            except ValueError:
+                raise DimacsParseError(f"non-integer literal in {line!r}", number)
+            if clause:
+                clauses.append(clause)
+
+    return num_vars, clauses
 
 class MiniSATSolver:
     """Python implementation of DPLL-based SAT solver (MiniSAT-like)"""
     
-    def __init__(self):
+    def __init__(self, stop_event=None):
         self.propagations = 0
         self.decisions = 0
         self.conflicts = 0
         self.clauses = []
         self.assignment = {}
         self.watch_lists = defaultdict(list)
+        self.stop_event = stop_event
+        self.cancelled = False
         
-    def parse_dimacs(self, dimacs_str):
-        """Parse DIMACS CNF format"""
-        lines = dimacs_str.strip().split('\n')
-        self.clauses = []
-        num_vars = 0
-        
-        for line in lines:
-            line = line.strip()
-            if line.startswith('c') or not line:
-                continue
-            elif line.startswith('p cnf'):
-                parts = line.split()
-                num_vars = int(parts[2])
-            else:
-                clause = [int(x) for x in line.split() if x != '0']
-                if clause:
-                    self.clauses.append(clause)
-        
-        return num_vars
-    
     def solve(self, dimacs_cnf):
         """Main DPLL solving algorithm"""
-        num_vars = self.parse_dimacs(dimacs_cnf)
+        num_vars, self.clauses = parse_dimacs(dimacs_cnf)
         self.assignment = {}
         
         # Initialize watch lists
@@ -1764,6 +4001,10 @@ class MiniSATSolver:
     
     def _dpll(self):
         """DPLL recursive algorithm"""
+        if self.stop_event and self.stop_event.is_set():
+            self.cancelled = True
+            return False
+
         # Unit propagation
         conflict = self._unit_propagate()
         if conflict:
@@ -1853,35 +4094,21 @@ class MiniSATSolver:
 class WalkSATSolver:
     """Python implementation of WalkSAT local search algorithm"""
     
-    def __init__(self, max_flips=100000, noise=0.5):
+    def __init__(self, max_flips=100000, noise=0.5, stop_event=None, seed=None):
         self.max_flips = max_flips
         self.noise = noise
         self.total_flips = 0
         self.restarts = 0
+        self.stop_event = stop_event
+        self.cancelled = False
+        # Each run draws from its own generator, so a recorded seed reproduces the run
+        self.seed = seed
+        self.rng = random.Random(seed)
+        self.unsatisfied_clauses = None
         
-    def parse_dimacs(self, dimacs_str):
-        """Parse DIMACS CNF format"""
-        lines = dimacs_str.strip().split('\n')
-        clauses = []
-        num_vars = 0
-        
-        for line in lines:
-            line = line.strip()
-            if line.startswith('c') or not line:
-                continue
-            elif line.startswith('p cnf'):
-                parts = line.split()
-                num_vars = int(parts[2])
-            else:
-                clause = [int(x) for x in line.split() if x != '0']
-                if clause:
-                    clauses.append(clause)
-        
-        return num_vars, clauses
-    
     def solve(self, dimacs_cnf):
         """Main WalkSAT algorithm"""
-        num_vars, clauses = self.parse_dimacs(dimacs_cnf)
+        num_vars, clauses = parse_dimacs(dimacs_cnf)
         
         # Multiple restarts
         for restart in range(10):
@@ -1890,14 +4117,18 @@ class WalkSATSolver:
             # Random initial assignment
             assignment = {}
             for i in range(1, num_vars + 1):
-                assignment[i] = random.random() > 0.5
+                assignment[i] = self.rng.random() > 0.5
             
             # Local search
             for flip in range(self.max_flips // 10):
+                if self.stop_event and self.stop_event.is_set():
+                    self.cancelled = True
+                    return False, None
                 self.total_flips += 1
                 
                 # Check if satisfied
                 unsat_clauses = self._get_unsat_clauses(assignment, clauses)
+                self.unsatisfied_clauses = len(unsat_clauses)
                 if not unsat_clauses:
                     # Found solution
                     result = []
@@ -1906,12 +4137,12 @@ class WalkSATSolver:
                     return True, result
                 
                 # Pick random unsatisfied clause
-                clause = random.choice(unsat_clauses)
+                clause = self.rng.choice(unsat_clauses)
                 
                 # Choose variable to flip
-                if random.random() < self.noise:
+                if self.rng.random() < self.noise:
                     # Random walk
-                    lit = random.choice(clause)
+                    lit = self.rng.choice(clause)
                     var = abs(lit)
                 else:
                     # Greedy: minimize break count
@@ -1977,7 +4208,7 @@ class SATDecomposer:
     
     def decompose_spectral(self, dimacs_cnf, max_vars=50):
         """Use spectral analysis to decompose SAT problem"""
-        num_vars, clauses = self._parse_dimacs(dimacs_cnf)
+        num_vars, clauses = parse_dimacs(dimacs_cnf)
         
         if num_vars <= max_vars:
             # Small enough for hardware
@@ -2021,26 +4252,6 @@ class SATDecomposer:
         
         return subproblems
     
-    def _parse_dimacs(self, dimacs_str):
-        """Parse DIMACS format"""
-        lines = dimacs_str.strip().split('\n')
-        clauses = []
-        num_vars = 0
-        
-        for line in lines:
-            line = line.strip()
-            if line.startswith('c') or not line:
-                continue
-            elif line.startswith('p cnf'):
-                parts = line.split()
-                num_vars = int(parts[2])
-            else:
-                clause = [int(x) for x in line.split() if x != '0']
-                if clause:
-                    clauses.append(clause)
-        
-        return num_vars, clauses
-    
     def _find_components(self, graph, num_vars):
         """Find connected components in variable graph"""
         visited = set()
@@ -2094,166 +4305,1829 @@ class SATDecomposer:
                     mapped_clause.append(str(mapped_lit))
             if mapped_clause:
                 dimacs += " ".join(mapped_clause) + " 0\n"
-        
+
         return dimacs
 
 
-# ------------------------------ SAT Hardware Interface ---------------------------
-class SATHardwareInterface:
-    """Interface for communicating with Teensy 4.1 running DAEDALUS 3-SAT solver"""
+# Worker processes conquering cubes in parallel; 1 conquers them in sequence in the calling thread
+CUBE_WORKERS = int(os.getenv("CUBE_WORKERS", os.cpu_count() or 1))
 
-    def __init__(self, port=None, baudrate=2_000_000):
-        self.port = port
-        self.baudrate = baudrate
-        self.serial = None
-        self.connected = False
-        self.last_heartbeat = time.time()
-        self.connection_attempts = 0
-        self.max_connection_attempts = 3
-        
-        # Serial history buffer
-        self.serial_history = []
-        self.max_history = 100
-        
-        # Auto-detect port if not specified
-        if not self.port:
-            self.port = self.find_daedalus_port()
-        
-        if not self.connect():
-            raise RuntimeError("Failed to connect to DAEDALUS 3-SAT solver hardware")
+# Set in each cube worker process; the parent sets it to stop every cube still running
+_cube_stop_event = None
 
-    def _add_to_history(self, message, direction="system"):
-        """Add message to serial history with timestamp"""
-        timestamp = datetime.now().strftime("%H:%M:%S")
-        entry = {
-            "timestamp": timestamp,
-            "message": message,
-            "direction": direction
-        }
-        
-        self.serial_history.append(entry)
-        
-        if len(self.serial_history) > self.max_history:
-            self.serial_history = self.serial_history[-self.max_history:]
+def _init_cube_worker(stop_event):
+    global _cube_stop_event
+    _cube_stop_event = stop_event
 
-    def find_daedalus_port(self):
-        """Auto-detect DAEDALUS Teensy port (dedicated to 3-SAT solver)"""
-        # Check with hardware manager first
-        available_ports = hardware_manager.get_available_ports_for_device("sat")
-        
-        # Test available ports from hardware manager
-        for port_name in available_ports:
-            try:
-                test_serial = serial.Serial(port_name, self.baudrate, timeout=0.1)
-                test_serial.close()
-                if hardware_manager.register_port(port_name, "sat"):
-                    logger.info(f"Found DAEDALUS Teensy at managed port: {port_name}")
-                    self._add_to_history(f"Found DAEDALUS at managed port: {port_name}")
-                    return port_name
-            except:
-                pass
-        
-        # Extended search for DAEDALUS-specific ports
-        daedalus_known_ports = [
-            "/dev/cu.usbmodem138999801",  # Primary DAEDALUS port
-            "/dev/cu.usbmodem139000201",  # Alternative DAEDALUS port  
-            "/dev/cu.usbmodem139000301",  # Backup DAEDALUS port
-            "/dev/tty.usbmodem138999801", # Alternative format
-        ]
-        
-        for port_name in daedalus_known_ports:
-            if not hardware_manager.is_port_available(port_name, "sat"):
+def _conquer_cube(num_vars, clauses, cube):
+    return CubeAndConquerSolver.conquer(num_vars, clauses, cube, _cube_stop_event)
+
+class CubeAndConquerSolver:
+    """Split hard formulas into cubes via lookahead, then conquer the cubes in parallel
+
+    MiniSATSolver is pure Python, so threads would only take turns on the GIL; the cubes go to
+    CUBE_WORKERS worker processes instead. Workers are forked, so they start with the parent's
+    state rather than re-importing this module, and the first satisfiable cube stops the rest.
+    """
+
+    def __init__(self, max_depth=4, lookahead_candidates=10, stop_event=None):
+        self.max_depth = max_depth
+        self.lookahead_candidates = lookahead_candidates
+        self.stop_event = stop_event
+        self.cancelled = False
+        # Every cube refuted or conquered as UNSAT: the formula itself is UNSAT
+        self.proved_unsat = False
+        self.cubes = []
+
+    def solve(self, dimacs_cnf):
+        """Partition the formula into cubes and solve each cube independently"""
+        num_vars, clauses = parse_dimacs(dimacs_cnf)
+        self.cubes = []
+        self.cancelled = False
+        self.proved_unsat = False
+
+        # Lookahead phase: split into cubes, dropping refuted branches early
+        open_cubes = []
+        self._split(clauses, [], 0, open_cubes)
+
+        # Conquer phase: each cube is the formula plus its literals as unit clauses
+        workers = min(CUBE_WORKERS, len(open_cubes))
+        if workers > 1 and "fork" in multiprocessing.get_all_start_methods():
+            found = self._conquer_in_parallel(num_vars, clauses, open_cubes, workers)
+        else:
+            found = self._conquer_in_sequence(num_vars, clauses, open_cubes)
+
+        if found:
+            return True, found
+        self.proved_unsat = not self.cancelled
+        return False, None
+
+    def _caller_stopped(self):
+        return self.stop_event is not None and self.stop_event.is_set()
+
+    def _conquer_in_sequence(self, num_vars, clauses, open_cubes):
+        found = None
+        for position, cube in enumerate(open_cubes):
+            if self._caller_stopped():
+                self.cancelled = True
+            if self.cancelled or found is not None:
+                # Not needed once a model is found, or past the cutoff
+                self.cubes.extend({"cube": c, "status": "SKIPPED", "solve_time_ms": 0} for c in open_cubes[position:])
+                break
+            outcome = self.conquer(num_vars, clauses, cube, self.stop_event)
+            assignment = outcome.pop("assignment")
+            self.cubes.append(outcome)
+            if outcome["status"] == "SAT":
+                found = assignment
+            elif outcome["status"] == "CUTOFF":
+                self.cancelled = True
+        return found
+
+    def _conquer_in_parallel(self, num_vars, clauses, open_cubes, workers):
+        """Conquer cubes across worker processes until one is SAT, all are UNSAT or the caller's cutoff passes"""
+        context = multiprocessing.get_context("fork")
+        stop = context.Event()
+        found = None
+        outcomes = {}
+        with ProcessPoolExecutor(max_workers=workers, mp_context=context,
+                                 initializer=_init_cube_worker, initargs=(stop,)) as executor:
+            futures = {executor.submit(_conquer_cube, num_vars, clauses, cube): position
+                       for position, cube in enumerate(open_cubes)}
+            pending = set(futures)
+            while pending:
+                done, pending = wait(pending, timeout=0.05, return_when=FIRST_COMPLETED)
+                for future in done:
+                    if future.cancelled():
+                        continue
+                    outcome = outcomes[futures[future]] = future.result()
+                    if outcome["status"] == "SAT" and found is None:
+                        found = outcome["assignment"]
+                if found is None and self._caller_stopped():
+                    self.cancelled = True
+                if (found is not None or self.cancelled) and not stop.is_set():
+                    # Running cubes see the event and return; queued ones never start
+                    stop.set()
+                    for future in pending:
+                        future.cancel()
+
+        for position, cube in enumerate(open_cubes):
+            outcome = outcomes.get(position)
+            if outcome is None or outcome["status"] == "CUTOFF" and found is not None:
+                # Never started, or stopped because another cube had already found a model
+                self.cubes.append({"cube": cube, "status": "SKIPPED", "solve_time_ms": 0})
                 continue
-                
-            try:
-                test_serial = serial.Serial(port_name, self.baudrate, timeout=0.1)
-                test_serial.close()
-                if hardware_manager.register_port(port_name, "sat"):
-                    logger.info(f"Found DAEDALUS Teensy at known port: {port_name}")
-                    self._add_to_history(f"Found DAEDALUS at known port: {port_name}")
-                    return port_name
-            except:
-                pass
-        
-        # Auto-detection with device identification
-        for port in serial.tools.list_ports.comports():
-            # Skip if this port is likely the LDPC device or already in use
-            if (port.device in ["/dev/cu.usbmodem158960201", "/dev/tty.usbmodem158960201", "/dev/cu.usbmodem158960301"] or
-                not hardware_manager.is_port_available(port.device, "sat")):
+            outcome.pop("assignment")
+            self.cubes.append(outcome)
+        return found
+
+    def _split(self, clauses, cube, depth, open_cubes):
+        """Recursively split on the variable with the best lookahead score"""
+        assignment = {abs(lit): lit > 0 for lit in cube}
+        if self._propagate(clauses, assignment) is None:
+            self.cubes.append({"cube": cube, "status": "REFUTED", "solve_time_ms": 0})
+            return
+
+        if depth >= self.max_depth:
+            open_cubes.append(cube)
+            return
+
+        var = self._lookahead_variable(clauses, assignment)
+        if var is None:
+            open_cubes.append(cube)
+            return
+
+        self._split(clauses, cube + [var], depth + 1, open_cubes)
+        self._split(clauses, cube + [-var], depth + 1, open_cubes)
+
+    def _lookahead_variable(self, clauses, assignment):
+        """Pick the free variable whose two branches propagate the most"""
+        occurrences = defaultdict(int)
+        for clause in clauses:
+            if self._clause_satisfied(clause, assignment):
                 continue
-                
-            port_desc = port.description.lower()
-            if any(id in port_desc for id in ["teensy", "usb serial", "usbmodem"]):
-                # Try to identify device by sending a test command
-                try:
-                    test_serial = serial.Serial(port.device, self.baudrate, timeout=2)
-                    time.sleep(0.5)
-                    test_serial.write(b"STATUS\n")
-                    test_serial.flush()
-                    time.sleep(1)
-                    
-                    response = ""
-                    while test_serial.in_waiting:
-                        line = test_serial.readline().decode('utf-8', errors='ignore').strip()
-                        response += line + " "
-                    
-                    test_serial.close()
-                    
-                    # Check if this is the DAEDALUS device
-                    if "DAEDALUS" in response or "3-SAT" in response or ("STATUS:READY" in response and "AMORGOS" not in response):
-                        if hardware_manager.register_port(port.device, "sat"):
-                            logger.info(f"Identified DAEDALUS Teensy at {port.device}: {port.description}")
-                            self._add_to_history(f"Identified DAEDALUS at {port.device}")
-                            return port.device
-                except Exception as e:
-                    logger.debug(f"Failed to test DAEDALUS port {port.device}: {e}")
-                    continue
-            
-            # Check VID/PID for Teensy (last resort)
-            if port.vid == 0x16C0:  # PJRC vendor ID
-                # Skip known LDPC ports
-                if (port.device not in ["/dev/cu.usbmodem158960201", "/dev/tty.usbmodem158960201", "/dev/cu.usbmodem158960301"] and
-                    hardware_manager.is_port_available(port.device, "sat")):
-                    if hardware_manager.register_port(port.device, "sat"):
-                        logger.info(f"Found DAEDALUS Teensy by VID/PID at {port.device}")
-                        self._add_to_history(f"Found DAEDALUS by VID/PID at {port.device}")
-                        return port.device
-        
-        return None
+            for lit in clause:
+                if abs(lit) not in assignment:
+                    occurrences[abs(lit)] += 1
 
-    def connect(self):
-        """Establish connection to DAEDALUS Teensy"""
-        self.connection_attempts += 1
-        
-        try:
-            if not self.port:
-                error_msg = "No DAEDALUS device found"
-                logger.error(error_msg)
-                self._add_to_history(f"❌ {error_msg}")
-                return False
+        if not occurrences:
+            return None
 
-            connect_msg = f"Connecting to DAEDALUS at {self.port} (attempt {self.connection_attempts})"
-            logger.info(connect_msg)
-            self._add_to_history(f"🔌 {connect_msg}")
-            
-            if self.serial and self.serial.is_open:
-                self.serial.close()
-                time.sleep(0.5)
-            
-            self.serial = serial.Serial(
-                port=self.port,
-                baudrate=self.baudrate,
-                timeout=5,
-                write_timeout=2,
-                exclusive=True
-            )
+        candidates = sorted(occurrences, key=occurrences.get, reverse=True)
+        best_var = None
+        best_score = -1
 
-            self.serial.reset_input_buffer()
-            self.serial.reset_output_buffer()
+        for var in candidates[:self.lookahead_candidates]:
+            positive = self._propagate(clauses, {**assignment, var: True})
+            negative = self._propagate(clauses, {**assignment, var: False})
 
-            logger.info("Waiting for DAEDALUS initialization...")
-            self._add_to_history("⏳ Waiting for DAEDALUS initialization...")
-            time.sleep(2)
+            # A failed literal means the other branch is forced; split there first
+            if positive is None or negative is None:
+                return var
+
+            # March-style product of propagated assignments on both branches
+            score = (len(positive) - len(assignment)) * (len(negative) - len(assignment))
+            if score > best_score:
+                best_score = score
+                best_var = var
+
+        return best_var
+
+    def _propagate(self, clauses, assignment):
+        """Unit propagation; returns the extended assignment or None on conflict"""
+        assignment = dict(assignment)
+        changed = True
+        while changed:
+            changed = False
+            for clause in clauses:
+                if self._clause_satisfied(clause, assignment):
+                    continue
+                unassigned = [lit for lit in clause if abs(lit) not in assignment]
+                if not unassigned:
+                    return None
+                if len(unassigned) == 1:
+                    lit = unassigned[0]
+                    assignment[abs(lit)] = lit > 0
+                    changed = True
+        return assignment
+
+    def _clause_satisfied(self, clause, assignment):
+        for lit in clause:
+            var = abs(lit)
+            if var in assignment and assignment[var] == (lit > 0):
+                return True
+        return False
+
+    @staticmethod
+    def conquer(num_vars, clauses, cube, stop_event=None):
+        """Solve the formula restricted to a single cube"""
+        dimacs = f"p cnf {num_vars} {len(clauses) + len(cube)}\n"
+        for clause in clauses + [[lit] for lit in cube]:
+            dimacs += " ".join(map(str, clause)) + " 0\n"
+
+        solver = MiniSATSolver(stop_event=stop_event)
+        start_time = time.time()
+        satisfiable, assignment = solver.solve(dimacs)
+        solve_time = (time.time() - start_time) * 1000
+
+        return {
+            "cube": cube,
+            "status": "SAT" if satisfiable else "CUTOFF" if solver.cancelled else "UNSAT",
+            "solve_time_ms": solve_time,
+            "decisions": solver.decisions,
+            "propagations": solver.propagations,
+            "assignment": assignment,
+        }
+
+# Scale from simulated oscillator time to chip time and energy
+OSCILLATOR_TIME_CONSTANT_NS = float(os.getenv("OSCILLATOR_TIME_CONSTANT_NS", 1.0))
+OSCILLATOR_POWER_MW = float(os.getenv("OSCILLATOR_POWER_MW", 5.0))
+
+class OscillatorNetworkSimulator:
+    """Continuous-time coupled-oscillator model of the DAEDALUS solver core
+
+    Each variable is an oscillator phase; cos(phase) > 0 reads as True. Clause coupling
+    pulls phases toward satisfying assignments, second-harmonic injection locking (SHIL)
+    binarizes them, and noise lets the network escape local minima. Noise anneals down
+    and SHIL anneals up over each run.
+    """
+
+    def __init__(self, coupling=4.0, noise=1.0, shil_strength=0.3, steps=1000, dt=0.1,
+                 max_restarts=5, check_every=10, stop_event=None, seed=None):
+        self.coupling = coupling
+        self.noise = noise
+        self.shil_strength = shil_strength
+        self.steps = steps
+        self.dt = dt
+        self.max_restarts = max_restarts
+        self.check_every = check_every
+        self.stop_event = stop_event
+        # A seeded generator makes the whole trajectory reproducible
+        self.seed = seed
+        self.rng = random.Random(seed)
+        self.cancelled = False
+        self.total_steps = 0
+        self.restarts = 0
+        self.unsatisfied_clauses = None
+
+    @property
+    def simulated_time_ns(self):
+        return self.total_steps * self.dt * OSCILLATOR_TIME_CONSTANT_NS
+
+    def solve(self, dimacs_cnf):
+        num_vars, clauses = parse_dimacs(dimacs_cnf)
+        self.total_steps = 0
+        self.restarts = 0
+        if not clauses:
+            return True, {v: True for v in range(1, num_vars + 1)}
+
+        for restart in range(self.max_restarts + 1):
+            self.restarts = restart
+            phases = [self.rng.uniform(0, 2 * math.pi) for _ in range(num_vars + 1)]
+            for step in range(self.steps):
+                if self.stop_event and self.stop_event.is_set():
+                    self.cancelled = True
+                    return False, None
+
+                progress = step / self.steps
+                self._step(phases, clauses, self.noise * (1.0 - progress), self.shil_strength * progress)
+                self.total_steps += 1
+
+                if step % self.check_every == 0 or step == self.steps - 1:
+                    assignment = {v: math.cos(phases[v]) > 0 for v in range(1, num_vars + 1)}
+                    self.unsatisfied_clauses = sum(
+                        1 for clause in clauses
+                        if not any(assignment[abs(lit)] == (lit > 0) for lit in clause)
+                    )
+                    if self.unsatisfied_clauses == 0:
+                        return True, assignment
+
+        return False, None
+
+    def _step(self, phases, clauses, noise, shil):
+        """One Euler-Maruyama step of the phase dynamics"""
+        spins = [math.cos(phase) for phase in phases]
+        force = [0.0] * len(phases)
+
+        for clause in clauses:
+            # Degree to which each literal is false, in [0, 1]
+            falseness = [(1.0 - spins[abs(lit)] * (1 if lit > 0 else -1)) / 2 for lit in clause]
+            for i, lit in enumerate(clause):
+                others = 1.0
+                for j, value in enumerate(falseness):
+                    if j != i:
+                        others *= value
+                # Push the literal toward true in proportion to how unsatisfied the rest of the clause is
+                force[abs(lit)] += (1 if lit > 0 else -1) * others
+
+        noise_scale = noise * math.sqrt(self.dt)
+        for v in range(1, len(phases)):
+            drift = -self.coupling * force[v] * math.sin(phases[v]) / 2 - shil * math.sin(2 * phases[v])
+            phases[v] += drift * self.dt + noise_scale * self.rng.gauss(0.0, 1.0)
+
+# Chip-generation profile of the simulated accelerator: field -> (type, min, max, default).
+# Defaults come from the environment and can be changed at runtime via PATCH /hardware/<id>/config.
+SIMULATOR_DEVICE_ID = "sat-simulator"
+SIMULATOR_CONFIG_FIELDS = {
+    "max_variables": (int, 1, 1_000_000, int(os.getenv("SIMULATOR_MAX_VARIABLES", 100))),
+    "max_clauses": (int, 1, 10_000_000, int(os.getenv("SIMULATOR_MAX_CLAUSES", 500))),
+    "speedup_factor": (float, 0.001, 1_000_000.0, float(os.getenv("SIMULATOR_SPEEDUP_FACTOR", 1.0))),
+    "success_rate": (float, 0.0, 1.0, float(os.getenv("SIMULATOR_SUCCESS_RATE", 1.0))),
+    "power_mw": (float, 0.0, 100_000.0, OSCILLATOR_POWER_MW),
+    # Deterministic mode: a non-negative seed fixes the RNG, a non-zero latency replaces simulated time
+    "seed": (int, -1, 2**31 - 1, int(os.getenv("SIMULATOR_SEED", -1))),
+    "fixed_latency_ns": (float, 0.0, 1e12, float(os.getenv("SIMULATOR_FIXED_LATENCY_NS", 0.0))),
+}
+simulator_config = {field: spec[3] for field, spec in SIMULATOR_CONFIG_FIELDS.items()}
+simulator_config_lock = threading.Lock()
+
+def get_simulator_config():
+    with simulator_config_lock:
+        return dict(simulator_config)
+
+def update_simulator_config(overrides):
+    """Apply a partial update; nothing changes unless every field is valid"""
+    with simulator_config_lock:
+        updated = dict(simulator_config)
+        errors = apply_config_overrides(SIMULATOR_CONFIG_FIELDS, updated, overrides)
+        if not errors:
+            simulator_config.update(updated)
+        return dict(simulator_config), errors
+
+def run_simulator_profile(solver_config):
+    """The simulator profile a run uses: the one its test captured at start, else the live one"""
+    return (solver_config or {}).get("simulator") or get_simulator_config()
+
+def simulator_device():
+    """Registry entry for the simulated accelerator, listed alongside physical boards"""
+    config = get_simulator_config()
+    device = {
+        "id": SIMULATOR_DEVICE_ID,
+        "device_type": "sat",
+        "chip": "DAEDALUS (simulated)",
+        "port": None,
+        "simulated": True,
+        "connected": True,
+        "config": config,
+    }
+    device["capabilities"] = dict(
+        accelerator_capabilities(device),
+        deterministic=config["seed"] >= 0,
+        seed=config["seed"] if config["seed"] >= 0 else None,
+        fixed_latency=config["fixed_latency_ns"] > 0,
+    )
+    return device
+
+def simulator_run_seed(profile, iteration):
+    """Seed for one iteration in deterministic mode; iterations differ but every rerun matches"""
+    if profile["seed"] < 0:
+        return None
+    return profile["seed"] + iteration
+
+# ------------------------------ QUBO / Ising Annealer ----------------------
+ISING_ANNEALER_POWER_MW = float(os.getenv("ISING_ANNEALER_POWER_MW", 5.0))
+
+def split_long_clauses(num_vars, clauses):
+    """Rewrite clauses longer than three literals as 3-literal chains with fresh variables"""
+    split = []
+    for clause in clauses:
+        clause = list(clause)
+        while len(clause) > 3:
+            num_vars += 1
+            split.append([clause[0], clause[1], num_vars])
+            clause = [-num_vars] + clause[2:]
+        split.append(clause)
+    return num_vars, split
+
+def cnf_to_qubo(num_vars, clauses):
+    """QUBO whose minimum energy is the number of unsatisfied clauses
+
+    The falseness u of each literal is linear in its variable. Clauses of up to two literals
+    contribute u1*u2 directly. A 3-literal clause gets an auxiliary variable w and contributes
+    w*u3 + u1*u2 - 2*u1*w - 2*u2*w + 3*w, which equals u1*u2*u3 once minimized over w.
+    Returns (num_binary_vars, Q, offset) with Q keyed by (i, j), i <= j; (i, i) holds linear terms.
+    """
+    num_vars, clauses = split_long_clauses(num_vars, clauses)
+    qubo = defaultdict(float)
+    offset = 0.0
+
+    def falseness(lit):
+        # u = a + b * x
+        return (1.0, -1.0, lit) if lit > 0 else (0.0, 1.0, -lit)
+
+    def add_product(left, right, scale=1.0):
+        nonlocal offset
+        a1, b1, i = left
+        a2, b2, j = right
+        offset += scale * a1 * a2
+        qubo[(i, i)] += scale * b1 * a2
+        qubo[(j, j)] += scale * a1 * b2
+        qubo[(min(i, j), max(i, j))] += scale * b1 * b2
+
+    def add_linear(term, scale=1.0):
+        nonlocal offset
+        a, b, i = term
+        offset += scale * a
+        qubo[(i, i)] += scale * b
+
+    for clause in clauses:
+        literals = sorted(set(clause), key=abs)
+        if any(-lit in literals for lit in literals):
+            continue  # tautology
+        if not literals:
+            offset += 1.0
+            continue
+        terms = [falseness(lit) for lit in literals]
+        if len(terms) == 1:
+            add_linear(terms[0])
+        elif len(terms) == 2:
+            add_product(terms[0], terms[1])
+        else:
+            num_vars += 1
+            aux = (0.0, 1.0, num_vars)
+            u1, u2, u3 = terms
+            add_product(aux, u3)
+            add_product(u1, u2)
+            add_product(u1, aux, -2.0)
+            add_product(u2, aux, -2.0)
+            add_linear(aux, 3.0)
+
+    return num_vars, {key: value for key, value in qubo.items() if value}, offset
+
+def qubo_to_ising(qubo, offset=0.0):
+    """Substitute x = (1 + s) / 2; returns (h, J, offset) over spins s in {-1, +1}"""
+    h, coupling = defaultdict(float), {}
+    for (i, j), value in qubo.items():
+        if i == j:
+            h[i] += value / 2
+            offset += value / 2
+        else:
+            coupling[(i, j)] = coupling.get((i, j), 0.0) + value / 4
+            h[i] += value / 4
+            h[j] += value / 4
+            offset += value / 4
+    return dict(h), coupling, offset
+
+class SimulatedIsingAnnealer:
+    """Ising-native accelerator model: anneals the CNF's Ising form and reads spins back as variables
+
+    Stands in for an annealer-style device so SAT-native (oscillator, DAEDALUS) and Ising-native
+    hardware can be compared on the same presets.
+    """
+
+    def __init__(self, sweeps=1000, beta_start=0.1, beta_end=5.0, stop_event=None, seed=None):
+        self.sweeps = sweeps
+        self.beta_start = beta_start
+        self.beta_end = beta_end
+        self.stop_event = stop_event
+        self.seed = seed
+        self.rng = random.Random(seed)
+        self.cancelled = False
+        self.sweeps_done = 0
+        self.num_spins = 0
+        self.best_energy = None
+        self.unsatisfied_clauses = None
+
+    def solve(self, dimacs_cnf):
+        num_vars, clauses = parse_dimacs(dimacs_cnf)
+        self.sweeps_done = 0
+        if not clauses:
+            return True, {v: True for v in range(1, num_vars + 1)}
+
+        self.num_spins, qubo, offset = cnf_to_qubo(num_vars, clauses)
+        h, coupling, offset = qubo_to_ising(qubo, offset)
+        neighbors = defaultdict(list)
+        for (i, j), value in coupling.items():
+            neighbors[i].append((j, value))
+            neighbors[j].append((i, value))
+
+        spins = [0] + [self.rng.choice((-1, 1)) for _ in range(self.num_spins)]
+        energy = offset + sum(h.get(i, 0.0) * spins[i] for i in range(1, self.num_spins + 1)) + sum(
+            value * spins[i] * spins[j] for (i, j), value in coupling.items()
+        )
+        self.best_energy = energy
+        for sweep in range(self.sweeps):
+            if self.stop_event and self.stop_event.is_set():
+                self.cancelled = True
+                return False, None
+
+            beta = self.beta_start + (self.beta_end - self.beta_start) * sweep / max(self.sweeps - 1, 1)
+            for i in range(1, self.num_spins + 1):
+                field = h.get(i, 0.0) + sum(value * spins[j] for j, value in neighbors[i])
+                delta = -2 * spins[i] * field
+                if delta <= 0 or self.rng.random() < math.exp(-beta * delta):
+                    spins[i] = -spins[i]
+                    energy += delta
+            self.sweeps_done += 1
+            self.best_energy = min(self.best_energy, energy)
+
+            # Only the original variables are read out; auxiliary spins are internal to the encoding
+            assignment = {v: spins[v] > 0 for v in range(1, num_vars + 1)}
+            self.unsatisfied_clauses = sum(
+                1 for clause in clauses if not any(assignment[abs(lit)] == (lit > 0) for lit in clause)
+            )
+            if self.unsatisfied_clauses == 0:
+                return True, assignment
+
+        return False, None
+
+@app.route("/sat/ising", methods=["POST"])
+def sat_ising_form():
+    """Ising form of a CNF instance, for submitting to external annealers"""
+    data = request.get_json(silent=True) or {}
+    if not data.get("dimacs"):
+        return error_response("Missing required field: dimacs", 400, "missing_field", {"field": "dimacs"})
+    try:
+        num_vars, clauses = parse_dimacs(data["dimacs"])
+        num_spins, qubo, offset = cnf_to_qubo(num_vars, clauses)
+        h, coupling, offset = qubo_to_ising(qubo, offset)
+    except Exception as e:
+        return dimacs_error_response(e)
+    return jsonify({
+        "num_variables": num_vars,
+        "num_spins": num_spins,
+        # Spins 1..num_variables are the CNF variables (+1 = True); the rest are auxiliary
+        "h": {str(i): value for i, value in sorted(h.items()) if value},
+        "J": [[i, j, value] for (i, j), value in sorted(coupling.items()) if value],
+        "offset": offset,
+    })
+
+class CNFPreprocessor:
+    """Simplify CNF instances before they are handed to a solver or the chip"""
+
+    def __init__(self, max_rounds=20, subsumption=True):
+        self.max_rounds = max_rounds
+        self.subsumption = subsumption
+
+    def simplify(self, dimacs_cnf):
+        """Simplify a DIMACS instance and report how it maps to the original"""
+        num_vars, raw_clauses = parse_dimacs(dimacs_cnf)
+        stats = defaultdict(int)
+
+        # Normalize: drop duplicate literals, tautologies and repeated clauses
+        clauses = {}  # frozenset of literals -> index of the original clause
+        for origin, clause in enumerate(raw_clauses):
+            lits = frozenset(clause)
+            if any(-lit in lits for lit in lits):
+                stats["tautologies_removed"] += 1
+            elif lits in clauses:
+                stats["duplicates_removed"] += 1
+            else:
+                clauses[lits] = origin
+
+        fixed = {}  # var -> (value, reason)
+        conflict = False
+
+        for _ in range(self.max_rounds):
+            changed = False
+
+            # Unit propagation
+            units = [next(iter(lits)) for lits in clauses if len(lits) == 1]
+            for lit in units:
+                var = abs(lit)
+                if var in fixed:
+                    if fixed[var][0] != (lit > 0):
+                        conflict = True
+                    continue
+                fixed[var] = (lit > 0, "unit")
+                changed = True
+            if conflict:
+                break
+
+            # Pure literals can be set without losing satisfiability
+            polarity = defaultdict(set)
+            for lits in clauses:
+                for lit in lits:
+                    polarity[abs(lit)].add(lit > 0)
+            for var, signs in polarity.items():
+                if len(signs) == 1 and var not in fixed:
+                    fixed[var] = (next(iter(signs)), "pure")
+                    changed = True
+
+            if not changed:
+                break
+
+            clauses, conflict = self._apply_assignment(clauses, fixed, stats)
+            if conflict:
+                break
+
+        if self.subsumption and not conflict:
+            clauses = self._remove_subsumed(clauses, stats)
+
+        return self._build_report(num_vars, raw_clauses, clauses, fixed, conflict, stats)
+
+    def _apply_assignment(self, clauses, fixed, stats):
+        """Drop satisfied clauses and falsified literals under the fixed assignment"""
+        reduced = {}
+        for lits, origin in clauses.items():
+            if any(abs(lit) in fixed and fixed[abs(lit)][0] == (lit > 0) for lit in lits):
+                stats["satisfied_removed"] += 1
+                continue
+            remaining = frozenset(lit for lit in lits if abs(lit) not in fixed)
+            if not remaining:
+                return {}, True
+            if len(remaining) < len(lits):
+                stats["literals_removed"] += len(lits) - len(remaining)
+            if remaining in reduced:
+                stats["duplicates_removed"] += 1
+                continue
+            reduced[remaining] = origin
+        return reduced, False
+
+    def _remove_subsumed(self, clauses, stats):
+        """Remove clauses that are supersets of a shorter clause"""
+        kept = {}
+        frequency = Counter(lit for lits in clauses for lit in lits)
+        # Each kept clause is filed under its rarest literal only; a subset of this clause
+        # has its own filing literal among ours, so looking under every one of ours finds it
+        watched = defaultdict(list)
+        for lits in sorted(clauses, key=len):
+            if any(other <= lits for lit in lits for other in watched[lit]):
+                stats["subsumed_removed"] += 1
+                continue
+            kept[lits] = clauses[lits]
+            if lits:
+                watched[min(lits, key=frequency.__getitem__)].append(lits)
+        return kept
+
+    def _build_report(self, num_vars, raw_clauses, clauses, fixed, conflict, stats):
+        """Renumber the remaining variables and render the simplified instance"""
+        if conflict:
+            status = "UNSAT"
+            remaining_vars = []
+            simplified = [([], None)]
+        else:
+            status = "SAT" if not clauses else "UNKNOWN"
+            remaining_vars = sorted({abs(lit) for lits in clauses for lit in lits})
+            simplified = sorted(
+                ((sorted(lits, key=abs), origin) for lits, origin in clauses.items()),
+                key=lambda item: item[1]
+            )
+
+        new_index = {var: i + 1 for i, var in enumerate(remaining_vars)}
+        dimacs = (
+            f"c Simplified from {num_vars} variables, {len(raw_clauses)} clauses\n"
+            f"p cnf {len(remaining_vars)} {len(simplified)}\n"
+        )
+        for lits, _ in simplified:
+            renamed = [new_index[abs(lit)] * (1 if lit > 0 else -1) for lit in lits]
+            dimacs += " ".join(map(str, renamed + [0])) + "\n"
+
+        return {
+            "status": status,
+            "dimacs": dimacs,
+            "original": {"variables": num_vars, "clauses": len(raw_clauses)},
+            "simplified": {"variables": len(remaining_vars), "clauses": len(simplified)},
+            "variable_map": {str(new_index[var]): var for var in remaining_vars},
+            "clause_map": [origin for _, origin in simplified],
+            "fixed_variables": {
+                str(var): {"value": value, "reason": reason}
+                for var, (value, reason) in sorted(fixed.items())
+            },
+            "eliminated_variables": sorted(
+                set(range(1, num_vars + 1)) - set(remaining_vars) - set(fixed)
+            ),
+            "stats": dict(stats),
+        }
+
+
+# ------------------------------ SAT Instance Features ------------------------
+import math
+
+def _distribution_stats(values):
+    """Mean, coefficient of variation, min, max and entropy of a distribution"""
+    if not values:
+        return {"mean": 0, "cv": 0, "min": 0, "max": 0, "entropy": 0}
+
+    n = len(values)
+    mean = sum(values) / n
+    variance = sum((v - mean) ** 2 for v in values) / n
+    counts = defaultdict(int)
+    for v in values:
+        counts[v] += 1
+    entropy = sum(-(c / n) * math.log(c / n) for c in counts.values())
+
+    return {
+        "mean": mean,
+        "cv": math.sqrt(variance) / mean if mean else 0,
+        "min": min(values),
+        "max": max(values),
+        "entropy": entropy,
+    }
+
+def compute_cnf_features(num_vars, clauses):
+    """SATzilla-style structural features of a CNF formula"""
+    num_clauses = len(clauses)
+
+    var_occurrences = defaultdict(int)
+    var_positive = defaultdict(int)
+    horn_occurrences = defaultdict(int)
+    vig = defaultdict(set)
+    clause_lengths = []
+    clause_balance = []
+    horn_clauses = 0
+
+    for clause in clauses:
+        positives = sum(1 for lit in clause if lit > 0)
+        clause_lengths.append(len(clause))
+        clause_balance.append(positives / len(clause))
+
+        is_horn = positives <= 1
+        if is_horn:
+            horn_clauses += 1
+
+        variables = [abs(lit) for lit in clause]
+        for lit in clause:
+            var_occurrences[abs(lit)] += 1
+            if lit > 0:
+                var_positive[abs(lit)] += 1
+            if is_horn:
+                horn_occurrences[abs(lit)] += 1
+        for i in range(len(variables)):
+            for j in range(i + 1, len(variables)):
+                if variables[i] != variables[j]:
+                    vig[variables[i]].add(variables[j])
+                    vig[variables[j]].add(variables[i])
+
+    variables = range(1, num_vars + 1)
+    var_degrees = [var_occurrences[v] for v in variables]
+    var_balance = [
+        var_positive[v] / var_occurrences[v] for v in variables if var_occurrences[v]
+    ]
+    vig_degrees = [len(vig[v]) for v in variables]
+
+    # Local clustering coefficient of the variable interaction graph
+    clustering = []
+    for v in variables:
+        neighbours = list(vig[v])
+        k = len(neighbours)
+        if k < 2:
+            continue
+        links = sum(
+            1
+            for i in range(k)
+            for j in range(i + 1, k)
+            if neighbours[j] in vig[neighbours[i]]
+        )
+        clustering.append(2 * links / (k * (k - 1)))
+
+    widths = width_estimates(vig, include_min_fill=num_vars <= TREEWIDTH_MIN_FILL_MAX_VARIABLES)
+
+    # Community structure of the weighted VIG
+    membership, modularity = louvain_communities(build_vig(clauses))
+    community_sizes = defaultdict(int)
+    for community in membership.values():
+        community_sizes[community] += 1
+
+    return {
+        "num_variables": num_vars,
+        "num_clauses": num_clauses,
+        "clause_variable_ratio": num_clauses / num_vars if num_vars else 0,
+        "clause_length": _distribution_stats(clause_lengths),
+        "binary_clause_fraction": clause_lengths.count(2) / num_clauses if num_clauses else 0,
+        "ternary_clause_fraction": clause_lengths.count(3) / num_clauses if num_clauses else 0,
+        "variable_occurrences": _distribution_stats(var_degrees),
+        "clause_balance": _distribution_stats(clause_balance),
+        "variable_balance": _distribution_stats(var_balance),
+        "horn_fraction": horn_clauses / num_clauses if num_clauses else 0,
+        "horn_variable_occurrences": _distribution_stats([horn_occurrences[v] for v in variables]),
+        "vig_degree": _distribution_stats(vig_degrees),
+        "vig_clustering": _distribution_stats(clustering),
+        "vig_modularity": modularity,
+        "community_count": len(community_sizes),
+        "community_size": _distribution_stats(list(community_sizes.values())),
+        **widths,
+    }
+
+def extract_cnf_features(dimacs_cnf):
+    """Parse a DIMACS string and compute its structural features"""
+    num_vars, clauses = parse_dimacs(dimacs_cnf)
+    return compute_cnf_features(num_vars, clauses)
+
+# Min-fill costs ~0.3s at 100 variables, too slow for bulk listings beyond this size
+TREEWIDTH_MIN_FILL_MAX_VARIABLES = int(os.getenv("TREEWIDTH_MIN_FILL_MAX_VARIABLES", 60))
+
+def _fill_in(graph, vertex):
+    """Edges needed to turn a vertex's neighbourhood into a clique"""
+    neighbours = graph[vertex]
+    d = len(neighbours)
+    return d * (d - 1) // 2 - sum(len(graph[n] & neighbours) for n in neighbours) // 2
+
+def elimination_width(adjacency, heuristic="min_degree"):
+    """Treewidth upper bound from a greedy elimination ordering; returns (width, order)"""
+    graph = {v: set(neighbours) for v, neighbours in adjacency.items()}
+    fill = {v: _fill_in(graph, v) for v in graph} if heuristic == "min_fill" else None
+    width = 0
+    order = []
+
+    while graph:
+        if fill is not None:
+            vertex = min(fill, key=lambda v: (fill[v], v))
+            del fill[vertex]
+        else:
+            vertex = min(graph, key=lambda v: (len(graph[v]), v))
+
+        neighbours = graph.pop(vertex)
+        width = max(width, len(neighbours))
+        order.append(vertex)
+        for n in neighbours:
+            graph[n].discard(vertex)
+            graph[n].update(neighbours - {n})
+
+        if fill is not None:
+            affected = set(neighbours)
+            for n in neighbours:
+                affected |= graph[n]
+            for v in affected:
+                fill[v] = _fill_in(graph, v)
+
+    return width, order
+
+def degeneracy(adjacency):
+    """Largest minimum degree over repeated min-degree deletion; a treewidth lower bound"""
+    graph = {v: set(neighbours) for v, neighbours in adjacency.items()}
+    best = 0
+    while graph:
+        vertex = min(graph, key=lambda v: len(graph[v]))
+        best = max(best, len(graph[vertex]))
+        for n in graph.pop(vertex):
+            graph[n].discard(vertex)
+    return best
+
+def cuthill_mckee_order(adjacency):
+    """Breadth-first ordering from low-degree vertices, lower-degree neighbours first"""
+    order = []
+    seen = set()
+    for root in sorted(adjacency, key=lambda v: (len(adjacency[v]), v)):
+        if root in seen:
+            continue
+        seen.add(root)
+        queue = deque([root])
+        while queue:
+            vertex = queue.popleft()
+            order.append(vertex)
+            for n in sorted(adjacency[vertex] - seen, key=lambda v: (len(adjacency[v]), v)):
+                seen.add(n)
+                queue.append(n)
+    return order
+
+def arrangement_cutwidth(adjacency, order):
+    """Maximum number of edges crossing any gap of a linear arrangement"""
+    position = {v: i for i, v in enumerate(order)}
+    delta = [0] * (len(order) + 1)
+    for u, neighbours in adjacency.items():
+        for v in neighbours:
+            if position[u] < position[v]:
+                delta[position[u]] += 1
+                delta[position[v]] -= 1
+
+    width = crossing = 0
+    for change in delta:
+        crossing += change
+        width = max(width, crossing)
+    return width
+
+def width_estimates(adjacency, include_min_fill=True):
+    """Heuristic treewidth bounds and cutwidth of a variable interaction graph"""
+    min_degree_width, elimination_order = elimination_width(adjacency, "min_degree")
+    estimates = {
+        "treewidth_lower_bound": degeneracy(adjacency),
+        "treewidth_min_degree": min_degree_width,
+        "treewidth_min_fill": elimination_width(adjacency, "min_fill")[0] if include_min_fill else None,
+        "cutwidth": min(
+            arrangement_cutwidth(adjacency, cuthill_mckee_order(adjacency)),
+            arrangement_cutwidth(adjacency, elimination_order),
+        ) if adjacency else 0,
+    }
+    return estimates
+
+# Features of preset files, keyed by path and invalidated on modification
+_cnf_feature_cache = {}
+_cnf_feature_cache_lock = threading.Lock()
+
+def get_cnf_file_info(preset, path):
+    """Describe a preset CNF file including its structural features"""
+    mtime = path.stat().st_mtime
+    key = str(path)
+
+    with _cnf_feature_cache_lock:
+        cached = _cnf_feature_cache.get(key)
+    if cached and cached[0] == mtime:
+        return cached[1]
+
+    text = path.read_text()
+    features = extract_cnf_features(text)
+    info = {
+        "id": f"{preset}/{path.name}",
+        "preset": preset,
+        "filename": path.name,
+        "instance_hash": safe_instance_hash(text),
+        "variables": features["num_variables"],
+        "clauses": features["num_clauses"],
+        "ratio": features["clause_variable_ratio"],
+        "size_bytes": path.stat().st_size,
+        "features": features,
+    }
+
+    with _cnf_feature_cache_lock:
+        _cnf_feature_cache[key] = (mtime, info)
+    return info
+
+# Presets to index ahead of the first request: comma-separated names or "*" for all
+PRELOAD_PRESETS = [p.strip() for p in os.getenv("PRELOAD_PRESETS", "").split(",") if p.strip()]
+# Re-index on this interval (0 = only at startup) so edited or added files are picked up
+PRELOAD_INTERVAL_SECONDS = float(os.getenv("PRELOAD_INTERVAL_SECONDS", 0))
+
+# Global preload status reported by /health
+preload_status = {"state": "disabled" if not PRELOAD_PRESETS else "pending", "presets": {}}
+
+# How often a listing re-stats a preset's files to notice additions, removals and edits
+CNF_INDEX_CHECK_SECONDS = float(os.getenv("CNF_INDEX_CHECK_SECONDS", 2))
+
+class CNFFileIndex:
+    """Listing entries (file info plus predicted difficulty) per preset, rebuilt only when its files change"""
+
+    def __init__(self, root=SAT_PRESETS_DIR):
+        self.root = root
+        self.presets = {}
+        self.version = 0
+        self.modified_at = time.time()
+        # Versions restart with the process; the epoch keeps old ETags from matching new ones
+        self.epoch = uuid.uuid4().hex[:8]
+        self.lock = threading.Lock()
+
+    @staticmethod
+    def signature(paths):
+        return tuple((path.name, stat.st_mtime_ns, stat.st_size) for path in paths for stat in [path.stat()])
+
+    def preset_state(self, preset):
+        """Provenance, lock and snapshots: shown in listings but not part of the file entries"""
+        extras = [self.root / preset / PRESET_PROVENANCE_FILE]
+        snapshots = ()
+        if self.root == SAT_PRESETS_DIR:
+            # Locks and snapshots exist for shared presets only
+            extras.append(PRESET_LOCKS_DIR / f"{preset}.json")
+            snapshot_root = PRESET_SNAPSHOTS_DIR / preset
+            snapshots = tuple(sorted(d.name for d in snapshot_root.iterdir() if not d.name.startswith(TEMP_PREFIX))) \
+                if snapshot_root.is_dir() else ()
+        return self.signature([path for path in extras if path.exists()]), snapshots
+
+    def bump(self):
+        self.version += 1
+        self.modified_at = time.time()
+
+    def entries(self, preset):
+        with self.lock:
+            cached = self.presets.get(preset)
+        if cached and time.time() - cached["checked"] < CNF_INDEX_CHECK_SECONDS:
+            return cached["entries"]
+
+        paths = sorted((self.root / preset).glob("*.cnf"))
+        signature, state = self.signature(paths), self.preset_state(preset)
+        if cached and cached["signature"] == signature:
+            with self.lock:
+                if cached["state"] != state:
+                    cached["state"] = state
+                    self.bump()
+                cached["checked"] = time.time()
+            return cached["entries"]
+
+        entries = []
+        for path in paths:
+            info = dict(get_cnf_file_info(preset, path))
+            info["difficulty"], info["difficulty_confidence"] = difficulty_model.predict(info["features"])
+            entries.append(info)
+        with self.lock:
+            self.presets[preset] = {"signature": signature, "state": state, "entries": entries, "checked": time.time()}
+            self.bump()
+        return entries
+
+    def preset_names(self):
+        """Presets on disk; forgets removed ones"""
+        names = sorted(d.name for d in self.root.iterdir() if d.is_dir()) if self.root.is_dir() else []
+        with self.lock:
+            removed = set(self.presets) - set(names)
+            for preset in removed:
+                del self.presets[preset]
+            if removed:
+                self.bump()
+        return names
+
+    def refresh(self, presets=None):
+        """Bring the given presets (default all) up to date and return the resulting validator"""
+        for preset in self.preset_names():
+            if presets is None or preset in presets:
+                self.entries(preset)
+        with self.lock:
+            return f"{self.epoch}-{self.version}", self.modified_at
+
+    def invalidate(self):
+        """Drop everything, e.g. after the difficulty model changes"""
+        with self.lock:
+            self.presets.clear()
+            self.bump()
+
+cnf_index = CNFFileIndex()
+# One index per tenant preset tree, created on first use
+tenant_indexes = {}
+tenant_indexes_lock = threading.Lock()
+
+def tenant_preset_index(tenant):
+    with tenant_indexes_lock:
+        if tenant["name"] not in tenant_indexes:
+            tenant_indexes[tenant["name"]] = CNFFileIndex(tenant_presets_dir(tenant))
+        return tenant_indexes[tenant["name"]]
+
+def visible_preset_indexes():
+    """Indexes the caller can read: their own namespace first, then the shared presets"""
+    tenant = current_tenant()
+    return ([tenant_preset_index(tenant)] if tenant else []) + [cnf_index]
+
+def preset_index_for(preset):
+    """Index holding the preset as the caller sees it; own presets shadow shared ones"""
+    for index in visible_preset_indexes():
+        if (index.root / preset).is_dir():
+            return index
+    return None
+
+def preset_path(preset):
+    """Directory of a preset visible to the caller, or the shared location if there is none"""
+    index = preset_index_for(preset)
+    return (index.root if index else SAT_PRESETS_DIR) / preset
+
+def refresh_preset_indexes(presets=None):
+    """Combined validator over every index the caller can see"""
+    tags, modified_at = [], 0
+    for index in visible_preset_indexes():
+        tag, index_modified_at = index.refresh(presets)
+        tags.append(tag)
+        modified_at = max(modified_at, index_modified_at)
+    return ".".join(tags), modified_at
+
+def conditional_response(etag, last_modified, build):
+    """304 when the client's If-None-Match/If-Modified-Since still matches, else build() with validators set"""
+    etag = f'W/"{etag}"'
+    if_none_match = request.headers.get("If-None-Match")
+    if_modified_since = request.headers.get("If-Modified-Since")
+    if if_none_match:
+        # Weak comparison: compressed and identity bodies share a tag
+        tags = {tag.strip().removeprefix("W/") for tag in if_none_match.split(",")}
+        not_modified = "*" in tags or etag.removeprefix("W/") in tags
+    elif if_modified_since:
+        try:
+            not_modified = int(last_modified) <= parsedate_to_datetime(if_modified_since).timestamp()
+        except (TypeError, ValueError):
+            not_modified = False
+    else:
+        not_modified = False
+
+    if not_modified:
+        response = Response(status=304)
+    else:
+        response = build()
+        if response.status_code != 200:
+            return response
+    response.headers["ETag"] = etag
+    response.headers["Last-Modified"] = formatdate(last_modified, usegmt=True)
+    # Let clients cache but always revalidate, which is what makes polling cheap
+    response.headers["Cache-Control"] = "no-cache"
+    return response
+
+def preload_presets(presets):
+    """Build the CNF file index (features and difficulty predictions) for the given presets"""
+    if not SAT_PRESETS_DIR.is_dir():
+        return {}
+    if "*" in presets:
+        presets = sorted(d.name for d in SAT_PRESETS_DIR.iterdir() if d.is_dir())
+
+    stats = {}
+    for preset in presets:
+        preset_dir = SAT_PRESETS_DIR / preset
+        if not preset_dir.is_dir():
+            logger.warning(f"Preload skipped unknown preset: {preset}")
+            continue
+        start = time.time()
+        try:
+            count = len(cnf_index.entries(preset))
+        except Exception as e:
+            logger.warning(f"Preload failed for {preset}: {e}")
+            count = 0
+        stats[preset] = {"files": count, "seconds": round(time.time() - start, 3)}
+        logger.info(f"Preloaded {count} files from {preset} in {stats[preset]['seconds']}s")
+    return stats
+
+def start_preset_preloader():
+    """Index the configured presets in the background, then on PRELOAD_INTERVAL_SECONDS"""
+    if not PRELOAD_PRESETS:
+        return None
+
+    def run():
+        while True:
+            preload_status["state"] = "running"
+            preload_status["presets"] = preload_presets(PRELOAD_PRESETS)
+            preload_status["state"] = "ready"
+            preload_status["completed_at"] = utc_now()
+            if PRELOAD_INTERVAL_SECONDS <= 0:
+                return
+            time.sleep(PRELOAD_INTERVAL_SECONDS)
+
+    thread = threading.Thread(target=run, daemon=True, name="preset-preloader")
+    thread.start()
+    return thread
+
+# Only DIMACS files are ever served out of the preset and snapshot directories
+CNF_FILE_EXTENSIONS = (".cnf",)
+
+def resolve_preset_file(file_id):
+    """Map a "preset/filename" or "preset@snapshot/filename" id to a CNF file"""
+    parts = file_id.split("/")
+    if len(parts) != 2 or any(p in ("", ".", "..") or "\\" in p or "\0" in p for p in parts):
+        return None
+    if parts[1].startswith(".") or Path(parts[1]).suffix.lower() not in CNF_FILE_EXTENSIONS:
+        return None
+
+    preset, _, snapshot = parts[0].partition("@")
+    # Hidden directories include the snapshot staging areas, which are never complete
+    if preset.startswith(".") or snapshot.startswith("."):
+        return None
+    if snapshot:
+        if not (valid_preset_name(preset) and valid_preset_name(snapshot)):
+            return None
+        root, path = PRESET_SNAPSHOTS_DIR, PRESET_SNAPSHOTS_DIR / preset / snapshot / parts[1]
+    else:
+        if not valid_preset_name(parts[0]):
+            return None
+        root = preset_path(parts[0]).parent
+        path = root / parts[0] / parts[1]
+
+    path = path.resolve()
+    if root.resolve() not in path.parents or not path.is_file():
+        return None
+    return path
+
+# ------------------------------ Preset Locks & Snapshots ---------------------
+import hashlib
+
+def valid_preset_name(name):
+    return bool(name) and name not in (".", "..") and all(ch.isalnum() or ch in "-_." for ch in name)
+
+def preset_manifest(directory):
+    """Content hashes of every CNF file in a directory plus one hash over all of them"""
+    files = {path.name: hashlib.sha256(path.read_bytes()).hexdigest() for path in sorted(directory.glob("*.cnf"))}
+    content_hash = hashlib.sha256("".join(f"{name}:{digest}\n" for name, digest in files.items()).encode()).hexdigest()
+    return {"files": files, "file_count": len(files), "content_hash": content_hash}
+
+def load_preset_lock(preset):
+    path = PRESET_LOCKS_DIR / f"{preset}.json"
+    return json.loads(path.read_text()) if path.exists() else None
+
+def compare_manifests(expected, current):
+    expected_files, current_files = expected["files"], current["files"]
+    return {
+        "drifted": expected["content_hash"] != current["content_hash"],
+        "expected_hash": expected["content_hash"],
+        "current_hash": current["content_hash"],
+        "added": sorted(set(current_files) - set(expected_files)),
+        "removed": sorted(set(expected_files) - set(current_files)),
+        "modified": sorted(n for n in expected_files if n in current_files and expected_files[n] != current_files[n]),
+    }
+
+def preset_drift(preset):
+    """Differences between a locked preset and its lock manifest; None if not locked"""
+    lock = load_preset_lock(preset)
+    if not lock:
+        return None
+    return compare_manifests(lock, preset_manifest(SAT_PRESETS_DIR / preset))
+
+def lock_preset(preset):
+    """Record the preset's content hashes and make its files read-only"""
+    preset_dir = SAT_PRESETS_DIR / preset
+    manifest = dict(preset_manifest(preset_dir), preset=preset, locked_at=utc_now())
+    PRESET_LOCKS_DIR.mkdir(parents=True, exist_ok=True)
+    (PRESET_LOCKS_DIR / f"{preset}.json").write_text(json.dumps(manifest, indent=2))
+    for path in preset_dir.glob("*.cnf"):
+        path.chmod(0o444)
+    return manifest
+
+def unlock_preset(preset):
+    (PRESET_LOCKS_DIR / f"{preset}.json").unlink(missing_ok=True)
+    for path in (SAT_PRESETS_DIR / preset).glob("*.cnf"):
+        path.chmod(0o644)
+
+def create_preset_snapshot(preset, name):
+    """Copy a preset into an immutable named snapshot
+
+    The copy is staged in a temporary directory and renamed into place, so a
+    failed or concurrent snapshot never leaves a half-written one behind.
+    """
+    source = SAT_PRESETS_DIR / preset
+    snapshot_root = PRESET_SNAPSHOTS_DIR / preset
+    snapshot_root.mkdir(parents=True, exist_ok=True)
+    staging = Path(tempfile.mkdtemp(prefix=f"{TEMP_PREFIX}{name}.", dir=snapshot_root))
+    try:
+        for path in sorted(source.glob("*.cnf")):
+            shutil.copy2(path, staging / path.name)
+            (staging / path.name).chmod(0o444)
+
+        manifest = dict(preset_manifest(staging), preset=preset, snapshot=name, created_at=utc_now(),
+                        file_id_prefix=f"{preset}@{name}/", provenance=load_preset_provenance(preset))
+        manifest_path = staging / "manifest.json"
+        manifest_path.write_text(json.dumps(manifest, indent=2))
+        manifest_path.chmod(0o444)
+        # rename() refuses a non-empty target, so a racing snapshot of the same name loses cleanly
+        staging.rename(snapshot_root / name)
+    except BaseException:
+        shutil.rmtree(staging, ignore_errors=True)
+        raise
+    return manifest
+
+def load_preset_snapshot(preset, name):
+    manifest_path = PRESET_SNAPSHOTS_DIR / preset / name / "manifest.json"
+    return json.loads(manifest_path.read_text()) if manifest_path.exists() else None
+
+def list_preset_snapshots(preset):
+    snapshot_root = PRESET_SNAPSHOTS_DIR / preset
+    if not snapshot_root.is_dir():
+        return []
+    snapshots = [load_preset_snapshot(preset, d.name) for d in sorted(snapshot_root.iterdir())
+                 if d.is_dir() and not d.name.startswith(TEMP_PREFIX)]
+    return [s for s in snapshots if s]
+
+def preset_content_reference(preset_id):
+    """Content hash of the preset a run used and the snapshot it matches, if any
+
+    Plain preset names are mutable, so the hash is taken when a run starts and
+    paired with the newest snapshot holding identical content.
+    """
+    preset, _, snapshot = preset_id.partition("@")
+    if not valid_preset_name(preset) or (snapshot and not valid_preset_name(snapshot)):
+        return None
+    if snapshot:
+        manifest = load_preset_snapshot(preset, snapshot)
+        return {"preset": preset, "snapshot": snapshot, "content_hash": manifest["content_hash"],
+                "locked": True} if manifest else None
+
+    directory = preset_path(preset)
+    if not directory.is_dir():
+        return None
+    content_hash = preset_manifest(directory)["content_hash"]
+    matching = [s for s in list_preset_snapshots(preset) if s["content_hash"] == content_hash] \
+        if directory.parent == SAT_PRESETS_DIR else []
+    return {
+        "preset": preset,
+        "snapshot": max(matching, key=lambda s: s["created_at"])["snapshot"] if matching else None,
+        "content_hash": content_hash,
+        "locked": directory.parent == SAT_PRESETS_DIR and load_preset_lock(preset) is not None,
+    }
+
+# Optional provenance file a preset directory may carry next to its CNF files
+PRESET_PROVENANCE_FILE = "manifest.json"
+PRESET_PROVENANCE_FIELDS = ("source", "description", "generator", "expected", "citation", "created")
+PRESET_EXPECTED_VALUES = ("sat", "unsat", "mixed", "unknown")
+
+def load_preset_provenance(preset_id):
+    """Provenance of a preset ("preset" or "preset@snapshot"); None if it has no manifest.json"""
+    preset, _, snapshot = preset_id.partition("@")
+    if not valid_preset_name(preset) or (snapshot and not valid_preset_name(snapshot)):
+        return None
+    if snapshot:
+        # Snapshots freeze the provenance they were taken with
+        return (load_preset_snapshot(preset, snapshot) or {}).get("provenance")
+
+    path = preset_path(preset) / PRESET_PROVENANCE_FILE
+    if not path.is_file():
+        return None
+    try:
+        manifest = json.loads(path.read_text())
+    except (OSError, ValueError) as e:
+        logger.warning(f"Ignoring unreadable {path}: {e}")
+        return None
+    if not isinstance(manifest, dict):
+        logger.warning(f"Ignoring {path}: expected a JSON object")
+        return None
+    provenance = {field: manifest[field] for field in PRESET_PROVENANCE_FIELDS if field in manifest}
+    if provenance.get("expected") not in (None,) + PRESET_EXPECTED_VALUES:
+        logger.warning(f"{path}: expected should be one of {', '.join(PRESET_EXPECTED_VALUES)}")
+        provenance["expected"] = "unknown"
+    return provenance
+
+def build_vig(clauses):
+    """Weighted variable interaction graph: (u, v) with u < v -> co-occurrence count"""
+    edges = defaultdict(int)
+    for clause in clauses:
+        variables = sorted({abs(lit) for lit in clause})
+        for i in range(len(variables)):
+            for j in range(i + 1, len(variables)):
+                edges[(variables[i], variables[j])] += 1
+    return edges
+
+def louvain_communities(edges, max_levels=10):
+    """Louvain community detection; returns (node -> community, modularity)"""
+    adjacency = defaultdict(lambda: defaultdict(float))
+    for (u, v), weight in edges.items():
+        adjacency[u][v] += weight
+        adjacency[v][u] += weight
+    if not adjacency:
+        return {}, 0.0
+
+    membership = {node: node for node in adjacency}
+    graph = adjacency
+    for _ in range(max_levels):
+        partition, moved = _louvain_local_moves(graph)
+        if not moved:
+            break
+        membership = {node: partition[c] for node, c in membership.items()}
+
+        # Collapse each community into a single node; internal edges become self-loops
+        aggregated = defaultdict(lambda: defaultdict(float))
+        for u, neighbours in graph.items():
+            for v, weight in neighbours.items():
+                aggregated[partition[u]][partition[v]] += weight
+        graph = aggregated
+
+    # Relabel communities 0..k-1, largest first
+    sizes = defaultdict(int)
+    for community in membership.values():
+        sizes[community] += 1
+    order = {c: i for i, c in enumerate(sorted(sizes, key=lambda c: (-sizes[c], c)))}
+    membership = {node: order[c] for node, c in membership.items()}
+    return membership, vig_modularity(adjacency, membership)
+
+def _louvain_local_moves(graph):
+    """One Louvain phase: greedily move nodes to the neighbouring community with best gain"""
+    degree = {node: sum(neighbours.values()) for node, neighbours in graph.items()}
+    total_weight = sum(degree.values())
+    community = {node: node for node in graph}
+    community_degree = dict(degree)
+    moved = False
+
+    improved = True
+    while improved:
+        improved = False
+        for node in sorted(graph):
+            current = community[node]
+            community_degree[current] -= degree[node]
+
+            links = defaultdict(float)
+            for neighbour, weight in graph[node].items():
+                if neighbour != node:
+                    links[community[neighbour]] += weight
+
+            best, best_gain = current, links.get(current, 0.0) - community_degree[current] * degree[node] / total_weight
+            for candidate, weight in links.items():
+                gain = weight - community_degree[candidate] * degree[node] / total_weight
+                if gain > best_gain + 1e-12:
+                    best, best_gain = candidate, gain
+
+            community_degree[best] += degree[node]
+            if best != current:
+                community[node] = best
+                improved = moved = True
+
+    return community, moved
+
+def vig_modularity(adjacency, membership):
+    """Newman modularity of a partition of a weighted graph"""
+    total_weight = sum(sum(neighbours.values()) for neighbours in adjacency.values())
+    if not total_weight:
+        return 0.0
+
+    internal = 0.0
+    community_degree = defaultdict(float)
+    for u, neighbours in adjacency.items():
+        community_degree[membership[u]] += sum(neighbours.values())
+        for v, weight in neighbours.items():
+            if membership[u] == membership[v]:
+                internal += weight
+
+    return internal / total_weight - sum((d / total_weight) ** 2 for d in community_degree.values())
+
+
+# ------------------------------ SAT Difficulty Model -------------------------
+DIFFICULTY_CLASSES = ["easy", "medium", "hard"]
+
+def difficulty_feature_vector(features):
+    """Flatten the scalar features used by the difficulty model"""
+    return [
+        features["clause_variable_ratio"],
+        math.log(max(features["num_variables"], 1)),
+        features["clause_length"]["mean"],
+        features["variable_occurrences"]["cv"],
+        features["clause_balance"]["mean"],
+        features["clause_balance"]["cv"],
+        features["horn_fraction"],
+        features["vig_degree"]["mean"],
+        features["vig_degree"]["cv"],
+        features["vig_clustering"]["mean"],
+    ]
+
+class DifficultyPredictor:
+    """Nearest-centroid classifier from instance features to a TTS class"""
+
+    def __init__(self):
+        self.means = None
+        self.scales = None
+        self.centroids = {}
+        self.tts_boundaries_ms = []
+        self.metadata = {}
+
+    @property
+    def trained(self):
+        return bool(self.centroids)
+
+    def fit(self, samples):
+        """Train from (features, tts_ms) pairs; classes are TTS tertiles"""
+        if len(samples) < len(DIFFICULTY_CLASSES):
+            raise ValueError(f"Need at least {len(DIFFICULTY_CLASSES)} samples, got {len(samples)}")
+
+        tts_sorted = sorted(tts for _, tts in samples)
+        n = len(tts_sorted)
+        self.tts_boundaries_ms = [tts_sorted[n // 3], tts_sorted[(2 * n) // 3]]
+
+        vectors = [difficulty_feature_vector(f) for f, _ in samples]
+        dims = len(vectors[0])
+        self.means = [sum(v[i] for v in vectors) / n for i in range(dims)]
+        self.scales = []
+        for i in range(dims):
+            variance = sum((v[i] - self.means[i]) ** 2 for v in vectors) / n
+            self.scales.append(math.sqrt(variance) or 1.0)
+
+        grouped = defaultdict(list)
+        for vector, (_, tts) in zip(vectors, samples):
+            grouped[self.tts_class(tts)].append(self._standardize(vector))
+
+        self.centroids = {
+            label: [sum(v[i] for v in members) / len(members) for i in range(dims)]
+            for label, members in grouped.items()
+        }
+        self.metadata = {
+            "trained_at": utc_now(),
+            "samples": n,
+            "class_counts": {label: len(members) for label, members in grouped.items()},
+        }
+
+    def tts_class(self, tts_ms):
+        if tts_ms <= self.tts_boundaries_ms[0]:
+            return "easy"
+        if tts_ms <= self.tts_boundaries_ms[1]:
+            return "medium"
+        return "hard"
+
+    def predict(self, features):
+        """Return (difficulty, confidence) for a feature dictionary"""
+        if not self.trained:
+            return ratio_difficulty(features["clause_variable_ratio"]), None
+
+        probabilities = self.predict_proba(features)
+        label = max(probabilities, key=probabilities.get)
+        return label, probabilities[label]
+
+    def predict_proba(self, features):
+        """Class probabilities from a softmax over negative centroid distances"""
+        vector = self._standardize(difficulty_feature_vector(features))
+        distances = {
+            label: math.sqrt(sum((a - b) ** 2 for a, b in zip(vector, centroid)))
+            for label, centroid in self.centroids.items()
+        }
+        weights = {k: math.exp(-d) for k, d in distances.items()}
+        total = sum(weights.values())
+        return {label: weights.get(label, 0.0) / total for label in DIFFICULTY_CLASSES}
+
+    def _standardize(self, vector):
+        return [(x - m) / s for x, m, s in zip(vector, self.means, self.scales)]
+
+    def to_dict(self):
+        return {
+            "means": self.means,
+            "scales": self.scales,
+            "centroids": self.centroids,
+            "tts_boundaries_ms": self.tts_boundaries_ms,
+            "metadata": self.metadata,
+        }
+
+    @classmethod
+    def from_dict(cls, data):
+        model = cls()
+        model.means = data["means"]
+        model.scales = data["scales"]
+        model.centroids = data["centroids"]
+        model.tts_boundaries_ms = data["tts_boundaries_ms"]
+        model.metadata = data.get("metadata", {})
+        return model
+
+def ratio_difficulty(ratio):
+    """Phase-transition heuristic used until a model has been trained"""
+    if ratio > 4.26:
+        return "hard"
+    if ratio > 3.0:
+        return "medium"
+    return "easy"
+
+def iter_stored_sat_problems():
+    """Yield (dimacs, family, solver_results) for every problem in completed SAT tests"""
+    with get_db() as conn:
+        cursor = conn.execute(
+            """
+            SELECT t.config, r.results FROM tests t
+            JOIN test_results r ON r.test_id = t.id
+            WHERE t.chip_type = 'SAT' AND t.status = 'completed'
+        """
+        )
+        rows = [dict_from_row(row) for row in cursor]
+
+    for row in rows:
+        try:
+            config = json.loads(row["config"] or "{}")
+            results = json.loads(row["results"] or "{}")
+        except json.JSONDecodeError:
+            continue
+
+        if "batch_results" in results:
+            problems = [
+                (generate_satlib_dimacs(p["satlib_benchmark"], p["problem_index"]),
+                 p["satlib_benchmark"], p["solver_results"])
+                for p in results["batch_results"]
+            ]
+        elif config.get("dimacs"):
+            problems = [(config["dimacs"], "custom", results.get("solver_results", {}))]
+        else:
+            continue
+
+        yield from problems
+
+def collect_difficulty_samples(reference_solver="walksat"):
+    """Gather (features, tts_ms, family) samples from completed SAT tests
+
+    The label is TTS at TTS_TARGET_PROBABILITY, so an instance the solver rarely solves is as hard as
+    its restarts make it. Instances it never solved score, PAR-2 style, twice the longest time seen
+    anywhere, which puts them among the hardest rather than as fast as their cutoff.
+    """
+    samples, longest_ms = [], 0.0
+    for dimacs, family, solver_results in iter_stored_sat_problems():
+        runs = solver_results.get(reference_solver)
+        if not runs:
+            continue
+        tts = time_to_solution(runs)
+        longest_ms = max([longest_ms, tts["tts_ms"] or 0.0] + [r.get("solve_time_ms") or 0.0 for r in runs])
+        samples.append((extract_cnf_features(dimacs), tts["tts_ms"], family))
+
+    unsolved_ms = 2 * longest_ms
+    return [(features, unsolved_ms if tts is None else tts, family) for features, tts, family in samples]
+
+DIFFICULTY_MODEL_PATH = MODELS_DIR / "difficulty.json"
+difficulty_model = DifficultyPredictor()
+
+def load_difficulty_model():
+    """Load the persisted difficulty model, if one has been trained"""
+    global difficulty_model
+    if DIFFICULTY_MODEL_PATH.exists():
+        try:
+            difficulty_model = DifficultyPredictor.from_dict(
+                json.loads(DIFFICULTY_MODEL_PATH.read_text())
+            )
+            logger.info(f"Loaded difficulty model ({difficulty_model.metadata.get('samples')} samples)")
+        except Exception as e:
+            logger.error(f"Failed to load difficulty model: {e}")
+
+def save_difficulty_model(model):
+    MODELS_DIR.mkdir(parents=True, exist_ok=True)
+    DIFFICULTY_MODEL_PATH.write_text(json.dumps(model.to_dict(), indent=2))
+
+DIFFICULTY_EVAL_PATH = MODELS_DIR / "difficulty_eval.json"
+DIFFICULTY_RETRAIN_ACCURACY = float(os.getenv("DIFFICULTY_RETRAIN_ACCURACY", 0.5))
+DIFFICULTY_RETRAIN_ECE = float(os.getenv("DIFFICULTY_RETRAIN_ECE", 0.15))
+
+def _calibration_metrics(predictions, num_bins=5):
+    """Accuracy, Brier score and expected calibration error of (probabilities, label) pairs"""
+    n = len(predictions)
+    correct = 0
+    brier = 0.0
+    bins = [[] for _ in range(num_bins)]
+
+    for probabilities, actual in predictions:
+        predicted = max(probabilities, key=probabilities.get)
+        confidence = probabilities[predicted]
+        hit = predicted == actual
+        correct += hit
+        brier += sum((probabilities[c] - (c == actual)) ** 2 for c in DIFFICULTY_CLASSES)
+        bins[min(int(confidence * num_bins), num_bins - 1)].append((confidence, hit))
+
+    reliability = []
+    ece = 0.0
+    for i, members in enumerate(bins):
+        if not members:
+            continue
+        mean_confidence = sum(c for c, _ in members) / len(members)
+        accuracy = sum(h for _, h in members) / len(members)
+        ece += len(members) / n * abs(mean_confidence - accuracy)
+        reliability.append({
+            "bin": [i / num_bins, (i + 1) / num_bins],
+            "count": len(members),
+            "mean_confidence": mean_confidence,
+            "accuracy": accuracy,
+        })
+
+    return {
+        "samples": n,
+        "accuracy": correct / n,
+        "brier_score": brier / n,
+        "expected_calibration_error": ece,
+        "reliability": reliability,
+    }
+
+def evaluate_difficulty_model(samples):
+    """Leave-one-family-out evaluation of the difficulty model on historical results"""
+    families = defaultdict(list)
+    for features, tts, family in samples:
+        families[family].append((features, tts))
+
+    per_family = {}
+    pooled = []
+    for family, held_out in sorted(families.items()):
+        training = [(f, tts) for other, members in families.items() if other != family for f, tts in members]
+        model = DifficultyPredictor()
+        try:
+            model.fit(training)
+        except ValueError as e:
+            per_family[family] = {"samples": len(held_out), "skipped": str(e)}
+            continue
+
+        predictions = [(model.predict_proba(f), model.tts_class(tts)) for f, tts in held_out]
+        per_family[family] = _calibration_metrics(predictions)
+        pooled.extend(predictions)
+
+    overall = _calibration_metrics(pooled) if pooled else None
+    return {
+        "evaluated_at": utc_now(),
+        "method": "leave_one_family_out",
+        "families": per_family,
+        "overall": overall,
+        "needs_retraining": bool(overall) and (
+            overall["accuracy"] < DIFFICULTY_RETRAIN_ACCURACY
+            or overall["expected_calibration_error"] > DIFFICULTY_RETRAIN_ECE
+        ),
+    }
+
+def load_difficulty_evaluation():
+    """Most recent stored evaluation of the difficulty model, if any"""
+    if not DIFFICULTY_EVAL_PATH.exists():
+        return None
+    try:
+        return json.loads(DIFFICULTY_EVAL_PATH.read_text())
+    except Exception as e:
+        logger.error(f"Failed to load difficulty model evaluation: {e}")
+        return None
+
+def save_difficulty_evaluation(evaluation):
+    MODELS_DIR.mkdir(parents=True, exist_ok=True)
+    DIFFICULTY_EVAL_PATH.write_text(json.dumps(evaluation, indent=2))
+
+
+# ------------------------------ SAT Hardware Interface ---------------------------
+# Silence longer than this mid-solve means the chip or the Teensy bridge has hung
+HARDWARE_WATCHDOG_SECONDS = float(os.getenv("HARDWARE_WATCHDOG_SECONDS", 15))
+HARDWARE_MAX_RETRIES = int(os.getenv("HARDWARE_MAX_RETRIES", 2))
+
+class HardwareHangError(RuntimeError):
+    """The board stopped responding in the middle of a transaction"""
+
+class SATHardwareInterface:
+    """Interface for communicating with Teensy 4.1 running DAEDALUS 3-SAT solver"""
+
+    def __init__(self, port=None, baudrate=2_000_000):
+        self.port = port
+        self.baudrate = baudrate
+        self.serial = None
+        self.connected = False
+        self.last_heartbeat = time.time()
+        self.connection_attempts = 0
+        self.max_connection_attempts = 3
+        
+        # Serial history buffer
+        self.serial_history = []
+        self.max_history = 100
+
+        # Watchdog trips and the resets that followed
+        self.watchdog_events = []
+        
+        # Auto-detect port if not specified
+        if not self.port:
+            self.port = self.find_daedalus_port()
+        
+        if not self.connect():
+            raise HardwareUnavailableError("Failed to connect to DAEDALUS 3-SAT solver hardware")
+
+    def _add_to_history(self, message, direction="system"):
+        """Add message to serial history with timestamp"""
+        timestamp = datetime.now().strftime("%H:%M:%S")
+        entry = {
+            "timestamp": timestamp,
+            "message": message,
+            "direction": direction
+        }
+        
+        self.serial_history.append(entry)
+        
+        if len(self.serial_history) > self.max_history:
+            self.serial_history = self.serial_history[-self.max_history:]
+
+    def find_daedalus_port(self):
+        """Auto-detect DAEDALUS Teensy port (dedicated to 3-SAT solver)"""
+        # Check with hardware manager first
+        available_ports = hardware_manager.get_available_ports_for_device("sat")
+        
+        # Test available ports from hardware manager
+        for port_name in available_ports:
+            try:
+                test_serial = serial.Serial(port_name, self.baudrate, timeout=0.1)
+                test_serial.close()
+                if hardware_manager.register_port(port_name, "sat"):
+                    logger.info(f"Found DAEDALUS Teensy at managed port: {port_name}")
+                    self._add_to_history(f"Found DAEDALUS at managed port: {port_name}")
+                    return port_name
+            except:
+                pass
+        
+        # Extended search for DAEDALUS-specific ports
+        daedalus_known_ports = [
+            "/dev/cu.usbmodem138999801",  # Primary DAEDALUS port
+            "/dev/cu.usbmodem139000201",  # Alternative DAEDALUS port  
+            "/dev/cu.usbmodem139000301",  # Backup DAEDALUS port
+            "/dev/tty.usbmodem138999801", # Alternative format
+        ]
+        
+        for port_name in daedalus_known_ports:
+            if not hardware_manager.is_port_available(port_name, "sat"):
+                continue
+                
+            try:
+                test_serial = serial.Serial(port_name, self.baudrate, timeout=0.1)
+                test_serial.close()
+                if hardware_manager.register_port(port_name, "sat"):
+                    logger.info(f"Found DAEDALUS Teensy at known port: {port_name}")
+                    self._add_to_history(f"Found DAEDALUS at known port: {port_name}")
+                    return port_name
+            except:
+                pass
+        
+        # Auto-detection with device identification
+        for port in serial.tools.list_ports.comports():
+            # Skip if this port is likely the LDPC device or already in use
+            if (port.device in ["/dev/cu.usbmodem158960201", "/dev/tty.usbmodem158960201", "/dev/cu.usbmodem158960301"] or
+                not hardware_manager.is_port_available(port.device, "sat")):
+                continue
+                
+            port_desc = port.description.lower()
+            if any(id in port_desc for id in ["teensy", "usb serial", "usbmodem"]):
+                # Try to identify device by sending a test command
+                try:
+                    test_serial = serial.Serial(port.device, self.baudrate, timeout=2)
+                    time.sleep(0.5)
+                    test_serial.write(b"STATUS\n")
+                    test_serial.flush()
+                    time.sleep(1)
+                    
+                    response = ""
+                    while test_serial.in_waiting:
+                        line = test_serial.readline().decode('utf-8', errors='ignore').strip()
+                        response += line + " "
+                    
+                    test_serial.close()
+                    
+                    # Check if this is the DAEDALUS device
+                    if "DAEDALUS" in response or "3-SAT" in response or ("STATUS:READY" in response and "AMORGOS" not in response):
+                        if hardware_manager.register_port(port.device, "sat"):
+                            logger.info(f"Identified DAEDALUS Teensy at {port.device}: {port.description}")
+                            self._add_to_history(f"Identified DAEDALUS at {port.device}")
+                            return port.device
+                except Exception as e:
+                    logger.debug(f"Failed to test DAEDALUS port {port.device}: {e}")
+                    continue
+            
+            # Check VID/PID for Teensy (last resort)
+            if port.vid == 0x16C0:  # PJRC vendor ID
+                # Skip known LDPC ports
+                if (port.device not in ["/dev/cu.usbmodem158960201", "/dev/tty.usbmodem158960201", "/dev/cu.usbmodem158960301"] and
+                    hardware_manager.is_port_available(port.device, "sat")):
+                    if hardware_manager.register_port(port.device, "sat"):
+                        logger.info(f"Found DAEDALUS Teensy by VID/PID at {port.device}")
+                        self._add_to_history(f"Found DAEDALUS by VID/PID at {port.device}")
+                        return port.device
+        
+        return None
+
+    def connect(self):
+        """Establish connection to DAEDALUS Teensy"""
+        self.connection_attempts += 1
+        
+        try:
+            if not self.port:
+                error_msg = "No DAEDALUS device found"
+                logger.error(error_msg)
+                self._add_to_history(f"❌ {error_msg}")
+                return False
+
+            connect_msg = f"Connecting to DAEDALUS at {self.port} (attempt {self.connection_attempts})"
+            logger.info(connect_msg)
+            self._add_to_history(f"🔌 {connect_msg}")
+            
+            if self.serial and self.serial.is_open:
+                self.serial.close()
+                time.sleep(0.5)
+            
+            self.serial = serial.Serial(
+                port=self.port,
+                baudrate=self.baudrate,
+                timeout=5,
+                write_timeout=2,
+                exclusive=True
+            )
+
+            self.serial.reset_input_buffer()
+            self.serial.reset_output_buffer()
+
+            logger.info("Waiting for DAEDALUS initialization...")
+            self._add_to_history("⏳ Waiting for DAEDALUS initialization...")
+            time.sleep(2)
 
             # Read startup messages
             startup_messages = []
@@ -2362,7 +6236,7 @@ class SATHardwareInterface:
     def execute_command(self, command, timeout=10):
         """Execute command on DAEDALUS"""
         if not self.check_connection():
-            raise RuntimeError("DAEDALUS not connected - check hardware")
+            raise HardwareUnavailableError("DAEDALUS not connected - check hardware")
 
         try:
             # Clear pending data
@@ -2396,10 +6270,87 @@ class SATHardwareInterface:
             self._add_to_history(f"❌ {error_msg}")
             raise RuntimeError(f"DAEDALUS hardware command failed: {str(e)}")
 
+    def calibrate(self, timeout=60):
+        """Run the firmware calibration sequence, collecting any CALIBRATION:KEY=value lines it prints"""
+        if not self.check_connection():
+            raise HardwareUnavailableError("DAEDALUS not connected")
+
+        self.serial.reset_input_buffer()
+        self.serial.write(b"CALIBRATION:START\n")
+        self.serial.flush()
+        self._add_to_history("CALIBRATION:START", "sent")
+
+        reported = {}
+        start_time = time.time()
+        while time.time() - start_time < timeout:
+            if not self.serial.in_waiting:
+                continue
+            line = self.serial.readline().decode('utf-8', errors='ignore').strip()
+            if not line:
+                continue
+            self._add_to_history(line, "received")
+            if line == "CALIBRATION:COMPLETE":
+                return {"duration_ms": (time.time() - start_time) * 1000, "reported": reported}
+            if "ERROR:" in line:
+                raise RuntimeError(f"Calibration error: {line}")
+            key, sep, value = line.removeprefix("CALIBRATION:").partition("=")
+            if line.startswith("CALIBRATION:") and sep:
+                try:
+                    reported[key.lower()] = float(value)
+                except ValueError:
+                    reported[key.lower()] = value
+
+        raise HardwareHangError(f"Calibration did not complete within {timeout:.0f}s")
+
+    def reset_board(self):
+        """Send RESET and wait for the board to come back; reconnect if it doesn't"""
+        try:
+            self.serial.reset_input_buffer()
+            self.serial.write(b"RESET\n")
+            self.serial.flush()
+            self._add_to_history("RESET", "sent")
+            start_time = time.time()
+            while time.time() - start_time < 5:
+                if self.serial.in_waiting:
+                    line = self.serial.readline().decode('utf-8', errors='ignore').strip()
+                    self._add_to_history(line, "received")
+                    if "STATUS:READY" in line:
+                        return "reset"
+        except Exception as e:
+            logger.warning(f"DAEDALUS reset failed: {e}")
+
+        # The bridge itself is unresponsive: drop the port and open it again
+        try:
+            self.serial.close()
+        except Exception:
+            pass
+        self.connected = False
+        return "reconnected" if self.connect() else "failed"
+
     def solve_sat_problem(self, dimacs_cnf, solver_type="daedalus", problem_count=1):
-        """Solve SAT problem using DAEDALUS hardware"""
+        """Solve SAT problem using DAEDALUS hardware, resetting and retrying if the board hangs"""
+        failures = []
+        for attempt in range(1, HARDWARE_MAX_RETRIES + 2):
+            try:
+                summary = self._solve_once(dimacs_cnf, solver_type, problem_count)
+            except HardwareHangError as e:
+                recovery = self.reset_board()
+                event = {"attempt": attempt, "error": str(e), "recovery": recovery, "timestamp": utc_now()}
+                failures.append(event)
+                self.watchdog_events = (self.watchdog_events + [event])[-self.max_history:]
+                logger.warning(f"DAEDALUS watchdog tripped on attempt {attempt}: {e} ({recovery})")
+                self._add_to_history(f"⚠️ Watchdog: {e}; board {recovery}")
+                if recovery == "failed":
+                    break
+                continue
+            summary["watchdog"] = {"attempts": attempt, "failures": failures}
+            return summary
+
+        raise HardwareUnavailableError(f"DAEDALUS hung on {len(failures)} attempts: {failures[-1]['error']}")
+
+    def _solve_once(self, dimacs_cnf, solver_type, problem_count):
         if not self.check_connection():
-            raise RuntimeError("DAEDALUS not connected")
+            raise HardwareUnavailableError("DAEDALUS not connected")
 
         logger.info(f"Starting SAT solve: {solver_type}, {problem_count} problems")
 
@@ -2447,17 +6398,24 @@ class SATHardwareInterface:
                         raise RuntimeError(f"DAEDALUS error: {line}")
 
             if not ack_received:
-                raise RuntimeError("No acknowledgment received")
+                raise HardwareHangError("No acknowledgment received")
 
-            # Collect results
+            # Collect results; arrival times let a power monitor attribute energy to each run
             results = []
+            received_at = []
             start_time = time.time()
+            last_activity = start_time
             
             while time.time() - start_time < 60:  # 60 second timeout
+                if time.time() - last_activity > HARDWARE_WATCHDOG_SECONDS:
+                    raise HardwareHangError(
+                        f"No response for {HARDWARE_WATCHDOG_SECONDS:.0f}s after {len(results)} results"
+                    )
                 if self.serial.in_waiting:
                     line = self.serial.readline().decode('utf-8', errors='ignore').strip()
                     if not line:
                         continue
+                    last_activity = time.time()
                         
                     self._add_to_history(line, "received")
                     
@@ -2475,6 +6433,7 @@ class SATHardwareInterface:
                                 "success": True
                             }
                             results.append(result)
+                            received_at.append(time.perf_counter())
                             
                     elif line == "TEST_COMPLETE":
                         logger.info("SAT test completed")
@@ -2508,7 +6467,8 @@ class SATHardwareInterface:
                 "total_time_ms": total_time,
                 "avg_energy_nj": avg_energy,
                 "avg_power_mw": avg_power,
-                "runs": results
+                "runs": results,
+                "received_at": received_at
             }
 
             logger.info(f"SAT solve completed: {successful_solves} problems, "
@@ -2516,6 +6476,9 @@ class SATHardwareInterface:
             
             return summary
 
+        except HardwareHangError:
+            # solve_sat_problem owns recovery from hangs
+            raise
         except Exception as e:
             logger.error(f"SAT solve error: {e}")
             # Reset on error
@@ -2544,66 +6507,1254 @@ class SATHardwareInterface:
 
 # SAT Hardware connection pool
 class SATConnectionPool:
-    """Manages DAEDALUS hardware connections"""
+    """Manages DAEDALUS hardware connections, one per board"""
     
     def __init__(self):
-        self.connection = None
-        self.last_used = time.time()
+        self.connections = {}  # port -> SATHardwareInterface
+        self.connection = None  # most recently used, for status and serial history
+        self.last_used = {}
         self.connection_lock = threading.Lock()
         self.max_idle_time = 30
         
-    def get_connection(self):
-        """Get or create DAEDALUS connection"""
+    def get_connection(self, device_id=None):
+        """Get or create DAEDALUS connection, optionally pinned to a registered device"""
+        port = None
+        if device_id:
+            device = hardware_manager.get_device(device_id)
+            if not device or device["device_type"] != "sat":
+                raise ValueError(f"Unknown DAEDALUS device: {device_id}")
+            port = device["port"]
+
         with self.connection_lock:
             current_time = time.time()
+            # Unpinned requests keep using whichever board they were last given
+            if port:
+                connection = self.connections.get(port)
+            else:
+                connection = self.connection or next(iter(self.connections.values()), None)
             
-            if self.connection and self.connection.connected:
+            if connection and connection.connected:
                 try:
-                    if self.connection.check_connection():
-                        self.last_used = current_time
+                    # The heartbeat talks over serial, so only while nobody holds the board; a board
+                    # in use is checked by whoever holds it (_solve_once checks before each solve)
+                    with device_queue(connection.port).try_exclusive("heartbeat") as ticket:
+                        healthy = connection.check_connection() if ticket else bool(
+                            connection.serial and connection.serial.is_open
+                        )
+                    if healthy:
+                        self.last_used[connection.port] = current_time
+                        self.connection = connection
                         logger.info("♻️ Reusing existing DAEDALUS connection")
-                        return self.connection
+                        return connection
                     else:
                         logger.warning("DAEDALUS connection check failed")
-                        self.connection = None
+                        connection = self._drop(connection)
                 except Exception as e:
                     logger.warning(f"DAEDALUS health check failed: {e}")
-                    self.connection = None
+                    connection = self._drop(connection)
             
-            if (self.connection and 
-                current_time - self.last_used > self.max_idle_time):
+            if (connection and 
+                current_time - self.last_used.get(connection.port, current_time) > self.max_idle_time):
                 logger.info("Closing idle DAEDALUS connection")
-                try:
-                    self.connection.close()
-                except:
-                    pass
-                self.connection = None
+                connection = self._drop(connection, close=True)
             
-            if not self.connection:
+            if not connection:
                 logger.info("🔌 Creating new DAEDALUS connection...")
                 try:
-                    self.connection = SATHardwareInterface()
-                    self.last_used = current_time
+                    connection = SATHardwareInterface(port=port)
                     logger.info("✅ New DAEDALUS connection established")
                 except Exception as e:
                     logger.error(f"Failed to create DAEDALUS connection: {e}")
                     raise
+                self.connections[connection.port] = connection
+                self.last_used[connection.port] = current_time
             
-            return self.connection
+            self.connection = connection
+            return connection
+
+    def _drop(self, connection, close=False):
+        if close:
+            try:
+                connection.close()
+            except:
+                pass
+        self.connections.pop(connection.port, None)
+        if self.connection is connection:
+            self.connection = None
+        return None
+
+    def connection_for(self, port):
+        with self.connection_lock:
+            return self.connections.get(port)
+
+    def close(self, port):
+        """Close the connection to one board"""
+        with self.connection_lock:
+            connection = self.connections.get(port)
+            if connection:
+                self._drop(connection, close=True)
     
     def close_all(self):
         """Close all DAEDALUS connections"""
         with self.connection_lock:
-            if self.connection:
+            for connection in self.connections.values():
                 try:
-                    self.connection.close()
+                    connection.close()
                 except:
                     pass
-                self.connection = None
+            self.connections = {}
+            self.connection = None
 
 # Global SAT connection pool
 sat_pool = SATConnectionPool()
 
+# ------------------------------ Hardware Work Queues -------------------------
+HARDWARE_QUEUE_TIMEOUT_SECONDS = float(os.getenv("HARDWARE_QUEUE_TIMEOUT_SECONDS", 600))
+
+class DeviceWorkQueue:
+    """First-come-first-served exclusive access to one physical board"""
+
+    def __init__(self, device):
+        self.device = device
+        self.condition = threading.Condition()
+        self.waiting = deque()
+        self.holder = None
+        self.completed = 0
+
+    @contextmanager
+    def exclusive(self, owner=None, timeout=HARDWARE_QUEUE_TIMEOUT_SECONDS):
+        """Block until every earlier request has released the device"""
+        ticket = {"owner": owner, "enqueued_at": utc_now()}
+        with self.condition:
+            self.waiting.append(ticket)
+            acquired = self.condition.wait_for(
+                lambda: self.holder is None and self.waiting[0] is ticket, timeout
+            )
+            if not acquired:
+                self.waiting.remove(ticket)
+                self.condition.notify_all()
+                raise TimeoutError(f"Timed out after {timeout}s waiting for {self.device}")
+            self.waiting.popleft()
+            ticket["started_at"] = utc_now()
+            self.holder = ticket
+
+        try:
+            yield ticket
+        finally:
+            with self.condition:
+                self.holder = None
+                self.completed += 1
+                self.condition.notify_all()
+
+    @contextmanager
+    def try_exclusive(self, owner=None):
+        """Hold the device only if it is free right now; yields None rather than waiting"""
+        with self.condition:
+            if self.holder is not None or self.waiting:
+                ticket = None
+            else:
+                ticket = {"owner": owner, "enqueued_at": utc_now(), "started_at": utc_now()}
+                self.holder = ticket
+        if ticket is None:
+            yield None
+            return
+        try:
+            yield ticket
+        finally:
+            with self.condition:
+                self.holder = None
+                self.condition.notify_all()
+
+    def position(self, owner):
+        """0 while the owner holds the device, 1.. while queued, None otherwise"""
+        with self.condition:
+            if self.holder and self.holder["owner"] == owner:
+                return 0
+            for i, ticket in enumerate(self.waiting):
+                if ticket["owner"] == owner:
+                    return i + 1
+        return None
+
+    def status(self):
+        with self.condition:
+            return {
+                "device": self.device,
+                "busy": self.holder is not None,
+                "holder": dict(self.holder) if self.holder else None,
+                "queue": [dict(ticket) for ticket in self.waiting],
+                "queue_length": len(self.waiting),
+                "completed": self.completed,
+            }
+
+# Global per-port work queues
+device_queues = {}
+device_queues_lock = threading.Lock()
+
+def device_queue(port):
+    with device_queues_lock:
+        if port not in device_queues:
+            device_queues[port] = DeviceWorkQueue(port)
+        return device_queues[port]
+
+def hardware_queue_position(owner):
+    """The owner's position in whichever device queue it is in, if any"""
+    with device_queues_lock:
+        queues = list(device_queues.values())
+    for queue in queues:
+        position = queue.position(owner)
+        if position is not None:
+            return {"device": queue.device, "position": position}
+    return None
+
+# ------------------------------ Hardware Reservations ------------------------
+# What a hardware-backed job does when someone else holds the current slot: "simulate" or "queue"
+RESERVATION_FALLBACK = os.getenv("RESERVATION_FALLBACK", "simulate")
+RESERVATION_MAX_WAIT_SECONDS = float(os.getenv("RESERVATION_MAX_WAIT_SECONDS", 3600))
+RESERVATION_FALLBACKS = ("simulate", "queue")
+
+def parse_reservation_time(value):
+    """ISO 8601 timestamp -> aware UTC datetime; naive times are taken as UTC"""
+    parsed = datetime.fromisoformat(str(value).replace("Z", "+00:00"))
+    if parsed.tzinfo is None:
+        parsed = parsed.replace(tzinfo=timezone.utc)
+    return parsed.astimezone(timezone.utc)
+
+def list_reservations(device_id=None, start=None, end=None):
+    """Reservations overlapping [start, end); a reservation without device_id covers every SAT board"""
+    query = "SELECT * FROM hardware_reservations WHERE 1=1"
+    params = []
+    if device_id:
+        query += " AND (device_id IS NULL OR device_id = ?)"
+        params.append(device_id)
+    if end:
+        query += " AND start_time < ?"
+        params.append(end.isoformat())
+    if start:
+        query += " AND end_time > ?"
+        params.append(start.isoformat())
+    with get_db() as conn:
+        rows = conn.execute(query + " ORDER BY start_time", params).fetchall()
+    return [dict_from_row(row) for row in rows]
+
+def reservation_owner(data):
+    """Who books or claims hardware time: a tenant key is always its tenant, the operator key names the user"""
+    tenant = current_tenant()
+    return tenant["name"] if tenant else data.get("user")
+
+def create_reservation(user, start, end, device_id=None, note=None):
+    """Book a slot; returns (reservation, conflicts) and books nothing on conflict"""
+    with get_db() as conn:
+        # BEGIN IMMEDIATE so two overlapping bookings can't both pass the check
+        conn.execute("BEGIN IMMEDIATE")
+        query = "SELECT * FROM hardware_reservations WHERE start_time < ? AND end_time > ?"
+        params = [end.isoformat(), start.isoformat()]
+        if device_id:
+            query += " AND (device_id IS NULL OR device_id = ?)"
+            params.append(device_id)
+        conflicts = [dict_from_row(row) for row in conn.execute(query, params).fetchall()]
+        if conflicts:
+            conn.rollback()
+            return None, conflicts
+        reservation = {
+            "id": generate_id(),
+            "user": user,
+            "device_id": device_id,
+            "start_time": start.isoformat(),
+            "end_time": end.isoformat(),
+            "note": note,
+            "created": utc_now(),
+        }
+        conn.execute(
+            "INSERT INTO hardware_reservations (id, user, device_id, start_time, end_time, note, created) "
+            "VALUES (:id, :user, :device_id, :start_time, :end_time, :note, :created)",
+            reservation,
+        )
+        conn.commit()
+    return reservation, []
+
+def current_reservation(device_id=None):
+    now = datetime.now(timezone.utc)
+    active = list_reservations(device_id, start=now, end=now + timedelta(microseconds=1))
+    return active[0] if active else None
+
+def acquire_reservation_slot(user, device_id=None, fallback=RESERVATION_FALLBACK):
+    """Decide whether a hardware-backed job may use the chip now; the result is its provenance
+
+    Unreserved time is open to everyone. While another user holds the slot the job either waits
+    for the slot to end (up to RESERVATION_MAX_WAIT_SECONDS) or is rerouted to the simulator.
+    """
+    waited = 0.0
+    deadline = time.time() + RESERVATION_MAX_WAIT_SECONDS
+    while True:
+        reservation = current_reservation(device_id)
+        provenance = {
+            "user": user,
+            "device_id": device_id,
+            "reservation_id": reservation["id"] if reservation else None,
+            "reserved_by": reservation["user"] if reservation else None,
+            "checked_at": utc_now(),
+            "waited_seconds": round(waited, 3),
+        }
+        if not reservation:
+            return dict(provenance, decision="unreserved")
+        if user and reservation["user"] == user:
+            return dict(provenance, decision="reserved", window=[reservation["start_time"], reservation["end_time"]])
+        if fallback != "queue" or time.time() >= deadline:
+            return dict(provenance, decision="simulated")
+
+        remaining = (parse_reservation_time(reservation["end_time"]) - datetime.now(timezone.utc)).total_seconds()
+        pause = max(0.05, min(remaining, deadline - time.time(), 5.0))
+        time.sleep(pause)
+        waited += pause
+
+# ------------------------------ Accelerator Capabilities ---------------------
+# Every backend describes itself with the same fields, so clients can choose one without
+# knowing what it is: max_variables, max_clauses, supports_offload,
+# supports_partial_assignments and power_budget_mw (None where a limit does not apply).
+DAEDALUS_MAX_CLAUSES = int(os.getenv("DAEDALUS_MAX_CLAUSES", 430))
+AMORGOS_POWER_BUDGET_MW = float(os.getenv("AMORGOS_POWER_BUDGET_MW", 5.9))
+
+def daedalus_capabilities(device):
+    return {
+        "max_variables": DAEDALUS_MAX_VARIABLES,
+        "max_clauses": DAEDALUS_MAX_CLAUSES,
+        # Physical boards are what the offload policy sends instances to
+        "supports_offload": True,
+        # The firmware reports SAT/UNSAT per run, never an assignment
+        "supports_partial_assignments": False,
+        "power_budget_mw": DAEDALUS_POWER_ENVELOPE_MW[1],
+    }
+
+def simulator_capabilities(device):
+    config = device["config"]
+    return {
+        "max_variables": config["max_variables"],
+        "max_clauses": config["max_clauses"],
+        "supports_offload": False,
+        # A run that does not converge returns no assignment at all
+        "supports_partial_assignments": False,
+        "power_budget_mw": config["power_mw"],
+    }
+
+def amorgos_capabilities(device):
+    # An LDPC decoder: it takes codewords, not CNF
+    return {
+        "max_variables": None,
+        "max_clauses": None,
+        "supports_offload": False,
+        "supports_partial_assignments": False,
+        "power_budget_mw": AMORGOS_POWER_BUDGET_MW,
+    }
+
+ACCELERATOR_CAPABILITIES = {"sat": daedalus_capabilities, "ldpc": amorgos_capabilities}
+
+def accelerator_capabilities(device):
+    if device.get("simulated"):
+        return simulator_capabilities(device)
+    return ACCELERATOR_CAPABILITIES[device["device_type"]](device)
+
+# ------------------------------ Fault Injection ------------------------------
+FAULT_TYPES = ("bit_flip", "dropped_response", "latency_spike")
+
+class InjectedFault(HardwareHangError):
+    """A dropped response produced by fault injection rather than by the board"""
+
+class FaultInjectingAccelerator:
+    """Wraps an accelerator backend and injects faults at the rates in the solver config
+
+    Handles both backend shapes: boards (solve_sat_problem, returning a summary with runs) and
+    simulators (solve, returning (satisfiable, assignment)). Affected runs list their faults.
+    """
+
+    def __init__(self, backend, solver_config, seed_key=""):
+        self.backend = backend
+        self.bit_flip_rate = solver_config["fault_bit_flip_rate"]
+        self.drop_rate = solver_config["fault_drop_rate"]
+        self.latency_spike_rate = solver_config["fault_latency_spike_rate"]
+        self.latency_spike_ms = solver_config["fault_latency_spike_ms"]
+        seed = solver_config["fault_seed"]
+        # With a seed, the same instance sees the same faults on every rerun
+        self.rng = random.Random(f"{seed}:{seed_key}") if seed >= 0 else random.Random()
+        self.last_faults = []
+        self.injected_latency_ns = 0.0
+
+    def __getattr__(self, name):
+        return getattr(self.backend, name)
+
+    def _latency_spike_ms(self):
+        if self.rng.random() >= self.latency_spike_rate:
+            return 0.0
+        time.sleep(self.latency_spike_ms / 1000)
+        return self.latency_spike_ms
+
+    def solve_sat_problem(self, dimacs_cnf, solver_type="daedalus", problem_count=1):
+        if self.rng.random() < self.drop_rate:
+            raise InjectedFault("Injected fault: response dropped")
+        summary = self.backend.solve_sat_problem(dimacs_cnf, solver_type, problem_count)
+        runs = []
+        for run in summary["runs"]:
+            run, faults = dict(run), []
+            if self.rng.random() < self.bit_flip_rate:
+                run["satisfiable"] = not run["satisfiable"]
+                faults.append("bit_flip")
+            spike_ms = self._latency_spike_ms()
+            if spike_ms:
+                run["solve_time_ms"] += spike_ms
+                faults.append("latency_spike")
+            if faults:
+                run["faults"] = faults
+            runs.append(run)
+        return dict(summary, runs=runs)
+
+    def solve(self, dimacs_cnf):
+        self.last_faults = []
+        self.injected_latency_ns = 0.0
+        if self.rng.random() < self.drop_rate:
+            self.last_faults.append("dropped_response")
+            return False, None
+        satisfiable, assignment = self.backend.solve(dimacs_cnf)
+        if assignment and self.rng.random() < self.bit_flip_rate:
+            assignment = dict(assignment)
+            variable = self.rng.choice(sorted(assignment))
+            assignment[variable] = not assignment[variable]
+            # The host verifies the readout, so a flipped bit only costs the run if it breaks a clause
+            _, clauses = parse_dimacs(dimacs_cnf)
+            satisfiable = all(any(assignment[abs(lit)] == (lit > 0) for lit in clause) for clause in clauses)
+            self.last_faults.append("bit_flip")
+        spike_ms = self._latency_spike_ms()
+        if spike_ms:
+            self.injected_latency_ns = spike_ms * 1e6
+            self.last_faults.append("latency_spike")
+        return satisfiable, assignment
+
+    @property
+    def simulated_time_ns(self):
+        return self.backend.simulated_time_ns + self.injected_latency_ns
+
+def fault_injection_enabled(solver_config):
+    return any(
+        (solver_config or {}).get(field, 0) > 0
+        for field in ("fault_bit_flip_rate", "fault_drop_rate", "fault_latency_spike_rate")
+    )
+
+def with_fault_injection(backend, solver_config, seed_key=""):
+    if not fault_injection_enabled(solver_config):
+        return backend
+    return FaultInjectingAccelerator(backend, solver_config, seed_key)
+
+def summarize_fault_injection(problems, solver_config):
+    """Count injected faults and compare how faulted and clean runs fared, per solver"""
+    injected = {fault: 0 for fault in FAULT_TYPES}
+    outcomes = {}
+    for problem in problems:
+        dropped = problem.get("offload_decision", {}).get("fault_injection", {}).get("dropped_response", 0)
+        injected["dropped_response"] += dropped
+        for solver_name, runs in problem.get("solver_results", {}).items():
+            solver_outcomes = outcomes.setdefault(solver_name, {"faulted": [], "clean": []})
+            for run in runs:
+                for fault in run.get("faults", []):
+                    injected[fault] += 1
+                solver_outcomes["faulted" if run.get("faults") else "clean"].append(bool(run.get("success")))
+
+    def rate(values):
+        return sum(values) / len(values) if values else None
+
+    return {
+        "config": {field: value for field, value in solver_config.items() if field.startswith("fault_")},
+        "injected": injected,
+        "solvers": {
+            solver_name: {
+                "faulted_runs": len(o["faulted"]),
+                "faulted_success_rate": rate(o["faulted"]),
+                "clean_runs": len(o["clean"]),
+                "clean_success_rate": rate(o["clean"]),
+            }
+            for solver_name, o in outcomes.items()
+        },
+    }
+
+# ------------------------------ Hardware Offload Policy ----------------------
+
+# Firmware problem types top out at uf100, and the oscillator array is 3-SAT only
+DAEDALUS_MAX_VARIABLES = int(os.getenv("DAEDALUS_MAX_VARIABLES", 100))
+DAEDALUS_MAX_CLAUSE_LENGTH = int(os.getenv("DAEDALUS_MAX_CLAUSE_LENGTH", 3))
+OFFLOAD_THRESHOLD = float(os.getenv("OFFLOAD_THRESHOLD", 0.5))
+
+def size_offload_score(context):
+    """Larger instances (up to capacity) gain the most from hardware"""
+    return min(context["num_variables"] / context["max_variables"], 1.0)
+
+def ratio_offload_score(context):
+    """Instances near the 3-SAT phase transition are hardest in software"""
+    return math.exp(-abs(context["ratio"] - 4.26))
+
+def reliability_offload_score(context):
+    """Recent hardware success rate; optimistic until there is history"""
+    rate = context["hardware_success_rate"]
+    return 1.0 if rate is None else rate
+
+class OffloadPredictor:
+    """Logistic regression estimating the probability that DAEDALUS beats software"""
+
+    def __init__(self):
+        self.weights = None
+        self.bias = 0.0
+        self.means = None
+        self.scales = None
+        self.metadata = {}
+
+    @property
+    def trained(self):
+        return self.weights is not None
+
+    def fit(self, samples, epochs=500, learning_rate=0.1, l2=0.01):
+        """Train from (features, hardware_won) pairs with batch gradient descent"""
+        if len(samples) < 4:
+            raise ValueError(f"Need at least 4 samples, got {len(samples)}")
+        labels = [1.0 if won else 0.0 for _, won in samples]
+        if len(set(labels)) < 2:
+            raise ValueError("Need samples where hardware both won and lost")
+
+        vectors = [difficulty_feature_vector(f) for f, _ in samples]
+        n, dims = len(vectors), len(vectors[0])
+        self.means = [sum(v[i] for v in vectors) / n for i in range(dims)]
+        self.scales = [
+            math.sqrt(sum((v[i] - self.means[i]) ** 2 for v in vectors) / n) or 1.0
+            for i in range(dims)
+        ]
+        xs = [self._standardize(v) for v in vectors]
+
+        self.weights = [0.0] * dims
+        self.bias = 0.0
+        for _ in range(epochs):
+            grad_w = [0.0] * dims
+            grad_b = 0.0
+            for x, y in zip(xs, labels):
+                error = self._sigmoid(self._logit(x)) - y
+                for i in range(dims):
+                    grad_w[i] += error * x[i]
+                grad_b += error
+            for i in range(dims):
+                self.weights[i] -= learning_rate * (grad_w[i] / n + l2 * self.weights[i])
+            self.bias -= learning_rate * grad_b / n
+
+        correct = sum((self._sigmoid(self._logit(x)) >= 0.5) == (y == 1.0) for x, y in zip(xs, labels))
+        self.metadata = {
+            "trained_at": utc_now(),
+            "samples": n,
+            "hardware_wins": int(sum(labels)),
+            "training_accuracy": correct / n,
+        }
+
+    def predict_proba(self, features):
+        """Probability that hardware offload beats software on this instance"""
+        return self._sigmoid(self._logit(self._standardize(difficulty_feature_vector(features))))
+
+    def _logit(self, x):
+        return self.bias + sum(w * xi for w, xi in zip(self.weights, x))
+
+    def _standardize(self, vector):
+        return [(x - m) / s for x, m, s in zip(vector, self.means, self.scales)]
+
+    @staticmethod
+    def _sigmoid(z):
+        if z < -60:
+            return 0.0
+        return 1.0 / (1.0 + math.exp(-z))
+
+    def to_dict(self):
+        return {
+            "weights": self.weights,
+            "bias": self.bias,
+            "means": self.means,
+            "scales": self.scales,
+            "metadata": self.metadata,
+        }
+
+    @classmethod
+    def from_dict(cls, data):
+        model = cls()
+        model.weights = data["weights"]
+        model.bias = data["bias"]
+        model.means = data["means"]
+        model.scales = data["scales"]
+        model.metadata = data.get("metadata", {})
+        return model
+
+def collect_offload_samples(software_solver="walksat"):
+    """Gather (features, hardware_won, family) samples from stored hardware comparisons"""
+    samples = []
+    for dimacs, family, solver_results in iter_stored_sat_problems():
+        races = [r for r in solver_results.get("race", []) if r.get("hardware_speedup") is not None]
+        if races:
+            speedup = sum(r["hardware_speedup"] for r in races) / len(races)
+            hardware_won = speedup > 1.0
+        else:
+            hardware_runs = solver_results.get("daedalus")
+            software_runs = solver_results.get(software_solver)
+            if not hardware_runs or not software_runs:
+                continue
+            hardware_time = sum(r["solve_time_ms"] for r in hardware_runs) / len(hardware_runs)
+            software_time = sum(r["solve_time_ms"] for r in software_runs) / len(software_runs)
+            hardware_won = hardware_time < software_time
+        samples.append((extract_cnf_features(dimacs), hardware_won, family))
+    return samples
+
+class HardwareOffloadPolicy:
+    """Decide whether an instance should be sent to DAEDALUS"""
+
+    def __init__(self, max_variables=DAEDALUS_MAX_VARIABLES, max_clause_length=DAEDALUS_MAX_CLAUSE_LENGTH,
+                 threshold=OFFLOAD_THRESHOLD, min_success_rate=0.5, min_history=5, history_size=50):
+        self.max_variables = max_variables
+        self.max_clause_length = max_clause_length
+        self.threshold = threshold
+        self.min_success_rate = min_success_rate
+        self.min_history = min_history
+        self.outcomes = deque(maxlen=history_size)
+        self.lock = threading.Lock()
+        self.scorers = {}
+        self.predictor = None  # a trained OffloadPredictor replaces the heuristic scorers
+        self.register_scorer("size", size_offload_score)
+        self.register_scorer("ratio", ratio_offload_score)
+        self.register_scorer("reliability", reliability_offload_score)
+
+    def register_scorer(self, name, scorer, weight=1.0):
+        """Add or replace a scoring function mapping a context to [0, 1]"""
+        self.scorers[name] = (scorer, weight)
+
+    def record_outcome(self, success):
+        with self.lock:
+            self.outcomes.append(bool(success))
+
+    @property
+    def success_rate(self):
+        with self.lock:
+            if not self.outcomes:
+                return None
+            return sum(self.outcomes) / len(self.outcomes)
+
+    def decide(self, num_vars, clauses, hardware_available=True, threshold=None, max_variables=None,
+               min_success_rate=None):
+        """Return {use_hardware, reason, confidence, scores} for an instance; keyword overrides apply to this call only"""
+        threshold = self.threshold if threshold is None else threshold
+        max_variables = self.max_variables if max_variables is None else max_variables
+        min_success_rate = self.min_success_rate if min_success_rate is None else min_success_rate
+        context = {
+            "num_variables": num_vars,
+            "num_clauses": len(clauses),
+            "ratio": len(clauses) / num_vars if num_vars else 0.0,
+            "max_clause_length": max((len(c) for c in clauses), default=0),
+            "max_variables": max_variables,
+            "hardware_success_rate": self.success_rate,
+            "hardware_history": len(self.outcomes),
+        }
+
+        # Hard limits veto offload regardless of score
+        if not hardware_available:
+            return self._decision(False, "DAEDALUS not connected", 1.0, context)
+        if num_vars > max_variables:
+            return self._decision(False, f"{num_vars} variables exceeds hardware capacity of {max_variables}", 1.0, context)
+        if context["max_clause_length"] > self.max_clause_length:
+            return self._decision(False, f"Clauses longer than {self.max_clause_length} literals are not supported", 1.0, context)
+        if (context["hardware_history"] >= self.min_history
+                and context["hardware_success_rate"] < min_success_rate):
+            return self._decision(
+                False, f"Recent hardware success rate {context['hardware_success_rate']:.0%} is below {min_success_rate:.0%}",
+                1.0, context
+            )
+
+        if self.predictor and self.predictor.trained:
+            scores = {"learned": self.predictor.predict_proba(compute_cnf_features(num_vars, clauses))}
+            score = scores["learned"]
+        else:
+            scores = {name: scorer(context) for name, (scorer, _) in self.scorers.items()}
+            total_weight = sum(weight for _, weight in self.scorers.values())
+            score = sum(scores[name] * weight for name, (_, weight) in self.scorers.items()) / total_weight
+        use_hardware = score >= threshold
+
+        # Explain with the scorer that pushed hardest in the chosen direction
+        pick = max if use_hardware else min
+        driver = pick(scores, key=scores.get)
+        reason = f"Offload score {score:.2f} {'>=' if use_hardware else '<'} {threshold:.2f} (driven by {driver})"
+        confidence = score if use_hardware else 1.0 - score
+        return self._decision(use_hardware, reason, confidence, context, scores)
+
+    def _decision(self, use_hardware, reason, confidence, context, scores=None):
+        return {
+            "use_hardware": use_hardware,
+            "reason": reason,
+            "confidence": confidence,
+            "scores": scores or {},
+            "context": context,
+        }
+
+# Global offload policy shared by all SAT tests
+offload_policy = HardwareOffloadPolicy()
+
+OFFLOAD_MODEL_PATH = MODELS_DIR / "offload.json"
+
+def load_offload_model():
+    """Attach the persisted offload predictor to the policy, if one has been trained"""
+    if OFFLOAD_MODEL_PATH.exists():
+        try:
+            offload_policy.predictor = OffloadPredictor.from_dict(json.loads(OFFLOAD_MODEL_PATH.read_text()))
+            logger.info(f"Loaded offload model ({offload_policy.predictor.metadata.get('samples')} samples)")
+        except Exception as e:
+            logger.error(f"Failed to load offload model: {e}")
+
+def save_offload_model(model):
+    MODELS_DIR.mkdir(parents=True, exist_ok=True)
+    OFFLOAD_MODEL_PATH.write_text(json.dumps(model.to_dict(), indent=2))
+
+# ------------------------------ Energy Attribution ---------------------------
+# Host power model, used when the CPU's energy can't be measured; DAEDALUS reports its own energy over serial
+HOST_ACTIVE_POWER_W = float(os.getenv("HOST_ACTIVE_POWER_W", 15.0))
+HOST_IDLE_POWER_W = float(os.getenv("HOST_IDLE_POWER_W", 2.0))
+# Where host energy comes from: "rapl" (Linux powercap), "powermetrics" (macOS, needs root), "model",
+# or "auto" for the first counter that can be read, else the model
+HOST_ENERGY_SOURCE = os.getenv("HOST_ENERGY_SOURCE", "auto").lower()
+HOST_ENERGY_SOURCES = ("auto", "rapl", "powermetrics", "model")
+RAPL_ROOT = Path(os.getenv("RAPL_ROOT", "/sys/class/powercap"))
+POWERMETRICS_INTERVAL_MS = int(os.getenv("POWERMETRICS_INTERVAL_MS", 100))
+
+class RaplCounter:
+    """Cumulative CPU package energy from Linux powercap: Intel RAPL, and AMD on kernels that map it there"""
+    source = "rapl"
+
+    def __init__(self, root=RAPL_ROOT):
+        # Package zones only; intel-rapl:0:0 and the like are subzones already counted in their package
+        self.zones = [z for z in sorted(root.glob("intel-rapl:*")) if re.fullmatch(r"intel-rapl:\d+", z.name)]
+        if not self.zones:
+            raise OSError(f"No RAPL package zones under {root}")
+        self.ranges = [int((z / "max_energy_range_uj").read_text()) for z in self.zones]
+        self.read()  # energy_uj is root-only on kernels patched for PLATYPUS
+
+    def read(self):
+        return [int((z / "energy_uj").read_text()) for z in self.zones]
+
+    def delta_uj(self, start, end):
+        # Each counter wraps to zero after max_energy_range_uj
+        return sum(e - s if e >= s else e + r - s for s, e, r in zip(start, end, self.ranges))
+
+class PowermetricsCounter:
+    """macOS: integrate the CPU power powermetrics samples into a cumulative counter"""
+    source = "powermetrics"
+    # Apple silicon reports "CPU Power: 812 mW"; Intel Macs the package power in watts
+    POWER_LINE = re.compile(r"(?:CPU Power|Intel energy model derived package power \(CPUs\+GT\+SA\)):\s*([\d.]+)\s*(mW|W)")
+
+    def __init__(self, interval_ms=POWERMETRICS_INTERVAL_MS):
+        if sys.platform != "darwin":
+            raise OSError("powermetrics is only available on macOS")
+        self.interval_s = interval_ms / 1000
+        self.energy_uj, self.watts, self.sampled_at = 0.0, 0.0, time.perf_counter()
+        self.lock = threading.Lock()
+        self.process = subprocess.Popen(
+            ["powermetrics", "--samplers", "cpu_power", "-i", str(interval_ms)],
+            stdout=subprocess.PIPE, stderr=subprocess.DEVNULL, text=True,
+        )
+        time.sleep(min(2 * self.interval_s, 1.0))
+        if self.process.poll() is not None:
+            raise OSError("powermetrics exited; it must run as root")
+        threading.Thread(target=self._run, daemon=True, name="powermetrics").start()
+
+    def _run(self):
+        for line in self.process.stdout:
+            match = self.POWER_LINE.search(line)
+            if match:
+                watts = float(match.group(1)) / (1000 if match.group(2) == "mW" else 1)
+                with self.lock:
+                    self.energy_uj += watts * self.interval_s * 1e6
+                    self.watts, self.sampled_at = watts, time.perf_counter()
+
+    def read(self):
+        # Extrapolate from the latest sample, so solves shorter than the interval still register
+        with self.lock:
+            return [self.energy_uj + self.watts * (time.perf_counter() - self.sampled_at) * 1e6]
+
+    def delta_uj(self, start, end):
+        return end[0] - start[0]
+
+ENERGY_COUNTERS = {"rapl": RaplCounter, "powermetrics": PowermetricsCounter}
+
+def open_energy_counter():
+    """The configured CPU energy counter, or None to fall back to the host power model"""
+    if HOST_ENERGY_SOURCE not in HOST_ENERGY_SOURCES:
+        raise RuntimeError(f"HOST_ENERGY_SOURCE must be one of: {', '.join(HOST_ENERGY_SOURCES)}")
+    names = list(ENERGY_COUNTERS) if HOST_ENERGY_SOURCE == "auto" else [HOST_ENERGY_SOURCE]
+    for name in names:
+        if name not in ENERGY_COUNTERS:
+            break
+        try:
+            counter = ENERGY_COUNTERS[name]()
+            logger.info(f"Measuring host energy with {name}")
+            return counter
+        except (OSError, ValueError) as e:
+            (logger.info if HOST_ENERGY_SOURCE == "auto" else logger.warning)(f"Host energy: {name} unavailable: {e}")
+    logger.info("Host energy is modelled from CPU time (runs are flagged energy_simulated)")
+    return None
+
+cpu_energy_counter = open_energy_counter()
+
+def host_energy_status():
+    """How host energy figures in results were obtained"""
+    source = cpu_energy_counter.source if cpu_energy_counter else "model"
+    return {
+        "source": source,
+        "simulated": cpu_energy_counter is None,
+        "scope": "cpu package, shared with anything else running" if cpu_energy_counter else
+                 f"process cpu time x {HOST_ACTIVE_POWER_W} W + blocked time x {HOST_IDLE_POWER_W} W",
+    }
+
+class HostEnergyMeter:
+    """Measure the wall-clock and CPU time, and CPU energy where a counter is available, of one host phase
+
+    A counter reads the whole package, so concurrent solves each see the others' energy too. Without
+    one, or once it fails, energy is modelled from CPU time and the meter reports itself as simulated.
+    CPU time is the whole process's plus its finished child processes', so work a solver hands to
+    worker threads or processes is counted; like the counters, it then also includes whatever else
+    the server runs meanwhile.
+    """
+
+    def __init__(self, active_power_w=HOST_ACTIVE_POWER_W, idle_power_w=HOST_IDLE_POWER_W, counter=None):
+        self.wall_s = 0.0
+        self.cpu_s = 0.0
+        self.active_power_w = active_power_w
+        self.idle_power_w = idle_power_w
+        self.counter = counter
+        self.measured_uj = 0.0
+
+    def __enter__(self):
+        self._wall_start = time.perf_counter()
+        self._cpu_start = self.cpu_seconds()
+        if self.counter:
+            try:
+                self._counter_start = self.counter.read()
+            except OSError:
+                self.counter = None
+        return self
+
+    def __exit__(self, *exc):
+        self.wall_s += time.perf_counter() - self._wall_start
+        self.cpu_s += self.cpu_seconds() - self._cpu_start
+        if self.counter:
+            try:
+                self.measured_uj += self.counter.delta_uj(self._counter_start, self.counter.read())
+            except OSError:
+                self.counter = None
+        return False
+
+    @staticmethod
+    def cpu_seconds():
+        # Children only count once reaped, which a process pool does when it shuts down
+        children = os.times()
+        return time.process_time() + children.children_user + children.children_system
+
+    @property
+    def source(self):
+        return self.counter.source if self.counter else "model"
+
+    @property
+    def simulated(self):
+        return self.counter is None
+
+    @property
+    def energy_nj(self):
+        if self.counter:
+            return self.measured_uj * 1000
+        # Busy CPU time is charged at active power, time spent blocked at idle power
+        blocked_s = max(self.wall_s - self.cpu_s, 0.0)
+        return (self.cpu_s * self.active_power_w + blocked_s * self.idle_power_w) * 1e9
+
+    @property
+    def power_mw(self):
+        return self.energy_nj / self.wall_s / 1e6 if self.wall_s else None
+
+    def run_fields(self):
+        """energy_nj, power_mw and their provenance for a run the host CPU solved"""
+        return {
+            "energy_nj": self.energy_nj,
+            "power_mw": self.power_mw,
+            "energy_source": self.source,
+            "energy_simulated": self.simulated,
+        }
+
+def host_energy_meter(solver_config=None):
+    """Meter on the CPU energy counter, with the request's host power model (else the server's) as fallback"""
+    solver_config = solver_config or {}
+    return HostEnergyMeter(
+        solver_config.get("host_active_power_w", HOST_ACTIVE_POWER_W),
+        solver_config.get("host_idle_power_w", HOST_IDLE_POWER_W),
+        cpu_energy_counter,
+    )
+
+@contextmanager
+def solve_cutoff(solver_config):
+    """Stop event that fires once the request's per-solve cutoff has passed"""
+    stop_event = threading.Event()
+    cutoff = (solver_config or {}).get("cutoff_seconds", 0)
+    timer = None
+    if cutoff > 0:
+        timer = threading.Timer(cutoff, stop_event.set)
+        timer.daemon = True
+        timer.start()
+    try:
+        yield stop_event
+    finally:
+        if timer:
+            timer.cancel()
+
+def energy_breakdown(host_orchestration_nj=0.0, host_solving_nj=0.0, accelerator_nj=0.0):
+    return {
+        "host_orchestration_nj": host_orchestration_nj,
+        "host_solving_nj": host_solving_nj,
+        "accelerator_nj": accelerator_nj,
+        "total_system_nj": host_orchestration_nj + host_solving_nj + accelerator_nj,
+    }
+
+def summarize_energy(solver_results):
+    """Sum the per-phase energy of every run"""
+    totals = energy_breakdown()
+    for results in solver_results.values():
+        for result in results:
+            for phase, value in result.get("energy_breakdown", {}).items():
+                totals[phase] += value
+    return totals
+
+# ------------------------------ Power Monitor --------------------------------
+# Shunt monitor on the DAEDALUS supply rail: "ina226", "ina3221", "simulated", or "none" to keep
+# the firmware's per-run energy estimate
+POWER_MONITOR = os.getenv("POWER_MONITOR", "none").lower()
+POWER_MONITOR_BUS = int(os.getenv("POWER_MONITOR_BUS", 1))
+POWER_MONITOR_ADDRESS = int(os.getenv("POWER_MONITOR_ADDRESS", "0x40"), 0)
+POWER_MONITOR_CHANNEL = int(os.getenv("POWER_MONITOR_CHANNEL", 1))  # INA3221 only
+POWER_MONITOR_SHUNT_OHMS = float(os.getenv("POWER_MONITOR_SHUNT_OHMS", 0.1))
+POWER_MONITOR_INTERVAL_SECONDS = float(os.getenv("POWER_MONITOR_INTERVAL_SECONDS", 0.002))
+SIMULATED_RAIL_VOLTS = 1.2
+SIMULATED_RAIL_MILLIAMPS = 4.0
+
+def _swap16(word):
+    # SMBus words are little-endian, INA registers big-endian
+    return ((word & 0xFF) << 8) | (word >> 8)
+
+def _signed16(value):
+    return value - 0x10000 if value & 0x8000 else value
+
+class INA226Monitor:
+    """TI INA226: shunt voltage LSB 2.5 uV, bus voltage LSB 1.25 mV"""
+    source = "ina226"
+
+    def __init__(self, bus, address, shunt_ohms):
+        from smbus2 import SMBus
+        self.bus = SMBus(bus)
+        self.address = address
+        self.shunt_ohms = shunt_ohms
+
+    def _read(self, register):
+        return _swap16(self.bus.read_word_data(self.address, register))
+
+    def read_power_mw(self):
+        shunt_v = _signed16(self._read(0x01)) * 2.5e-6
+        bus_v = self._read(0x02) * 1.25e-3
+        return bus_v * shunt_v / self.shunt_ohms * 1000
+
+class INA3221Monitor(INA226Monitor):
+    """TI INA3221: three channels, values left-aligned by 3 bits; shunt LSB 40 uV, bus LSB 8 mV"""
+    source = "ina3221"
+
+    def __init__(self, bus, address, shunt_ohms, channel):
+        super().__init__(bus, address, shunt_ohms)
+        self.channel = channel
+
+    def read_power_mw(self):
+        offset = 2 * (self.channel - 1)
+        shunt_v = (_signed16(self._read(0x01 + offset)) >> 3) * 40e-6
+        bus_v = (self._read(0x02 + offset) >> 3) * 8e-3
+        return bus_v * shunt_v / self.shunt_ohms * 1000
+
+class SimulatedPowerMonitor:
+    """Stand-in when no monitor is wired up: nominal rail current with a little noise"""
+    source = "simulated"
+
+    def read_power_mw(self):
+        return SIMULATED_RAIL_VOLTS * max(random.gauss(SIMULATED_RAIL_MILLIAMPS, 0.2), 0.0)
+
+def open_power_monitor():
+    """The configured monitor, or None when disabled or when the configured monitor can't be opened
+
+    A monitor that fails to open disables measurement rather than substituting made-up readings,
+    so runs keep the firmware's energy estimate.
+    """
+    if POWER_MONITOR == "none":
+        return None
+    if POWER_MONITOR == "simulated":
+        return SimulatedPowerMonitor()
+    try:
+        if POWER_MONITOR == "ina3221":
+            return INA3221Monitor(POWER_MONITOR_BUS, POWER_MONITOR_ADDRESS, POWER_MONITOR_SHUNT_OHMS, POWER_MONITOR_CHANNEL)
+        return INA226Monitor(POWER_MONITOR_BUS, POWER_MONITOR_ADDRESS, POWER_MONITOR_SHUNT_OHMS)
+    except Exception as e:
+        logger.error(f"Power monitor {POWER_MONITOR} unavailable; power measurement is disabled: {e}")
+        return None
+
+power_monitor = open_power_monitor()
+
+class PowerSampler:
+    """Sample the power monitor in the background and integrate energy over the window"""
+
+    def __init__(self, monitor, interval=POWER_MONITOR_INTERVAL_SECONDS):
+        self.monitor = monitor
+        self.interval = interval
+        self.samples = []
+        self.errors = 0
+        self._stop = threading.Event()
+        self._thread = None
+
+    def __enter__(self):
+        self._thread = threading.Thread(target=self._run, daemon=True)
+        self._thread.start()
+        return self
+
+    def __exit__(self, *exc):
+        self._stop.set()
+        self._thread.join()
+        return False
+
+    def _run(self):
+        while True:
+            try:
+                self.samples.append((time.perf_counter(), self.monitor.read_power_mw()))
+            except Exception:
+                self.errors += 1
+            if self._stop.wait(self.interval):
+                break
+
+    @property
+    def energy_nj(self):
+        # Trapezoidal rule; mW * s = mJ = 1e6 nJ
+        return sum(
+            (t1 - t0) * (p0 + p1) / 2 for (t0, p0), (t1, p1) in zip(self.samples, self.samples[1:])
+        ) * 1e6
+
+    def power_at(self, t):
+        """Power interpolated between the samples either side of t, held flat beyond the ends"""
+        index = bisect.bisect_left(self.samples, (t,))
+        if index == 0:
+            return self.samples[0][1]
+        if index == len(self.samples):
+            return self.samples[-1][1]
+        (t0, p0), (t1, p1) = self.samples[index - 1], self.samples[index]
+        return p0 + (p1 - p0) * (t - t0) / (t1 - t0) if t1 > t0 else p1
+
+    def energy_between(self, start, end):
+        """Energy in nJ over [start, end] (perf_counter seconds), from the samples inside it"""
+        if not self.samples or end <= start:
+            return None
+        points = [(start, self.power_at(start))]
+        points += [(t, p) for t, p in self.samples if start < t < end]
+        points.append((end, self.power_at(end)))
+        return sum((t1 - t0) * (p0 + p1) / 2 for (t0, p0), (t1, p1) in zip(points, points[1:])) * 1e6
+
+    @property
+    def avg_power_mw(self):
+        if len(self.samples) < 2:
+            return self.samples[0][1] if self.samples else None
+        return self.energy_nj / 1e6 / (self.samples[-1][0] - self.samples[0][0])
+
+    def summary(self):
+        return {
+            "source": self.monitor.source,
+            "samples": len(self.samples),
+            "read_errors": self.errors,
+            "window_energy_nj": self.energy_nj,
+            "avg_power_mw": self.avg_power_mw,
+            "peak_power_mw": max((p for _, p in self.samples), default=None),
+        }
+
+def apply_measured_energy(summary, sampler):
+    """Replace the firmware's per-run energy estimate with the rail energy measured during each run
+
+    A run spans the solve time the board reported, ending when its RESULT line arrived.
+    """
+    measurement = sampler.summary()
+    runs = summary["runs"]
+    if measurement["avg_power_mw"] is None:
+        return runs, measurement
+    measured = []
+    for run, received_at in zip(runs, summary["received_at"]):
+        duration_s = run.get("solve_time_ms", 0) / 1000
+        energy_nj = sampler.energy_between(received_at - duration_s, received_at)
+        if energy_nj is None:
+            measured.append(run)
+            continue
+        run = dict(run, estimated_energy_nj=run.get("energy_nj"), energy_source=measurement["source"])
+        run["energy_nj"] = energy_nj
+        # nJ / s = nW
+        run["power_mw"] = energy_nj / duration_s / 1e6
+        measured.append(run)
+    return measured, measurement
+
+def run_daedalus_offload(dimacs_cnf, num_vars, clauses, num_iterations, solver_config=None):
+    """Apply the offload policy and run the instance on DAEDALUS if it says so"""
+    solver_config = solver_config or {}
+    try:
+        hardware = sat_pool.get_connection(solver_config.get("device_id"))
+        hardware_available = hardware.connected
+    except Exception as e:
+        logger.warning(f"DAEDALUS unavailable for offload: {e}")
+        hardware, hardware_available = None, False
+
+    decision = offload_policy.decide(
+        num_vars, clauses, hardware_available,
+        threshold=solver_config.get("offload_threshold"),
+        max_variables=solver_config.get("max_hardware_variables"),
+        min_success_rate=solver_config.get("min_hardware_success_rate"),
+    )
+    if not hardware_available and solver_config.get("device_id"):
+        # The board that was asked for is gone; the batch scheduler moves its work elsewhere
+        decision["board_failure"] = True
+    if not decision["use_hardware"]:
+        return decision, []
+
+    try:
+        require_supported_firmware(hardware.port)
+        backend = with_fault_injection(hardware, solver_config, dimacs_cnf)
+        with device_queue(hardware.port).exclusive(threading.current_thread().name):
+            with host_energy_meter(solver_config) as host, (PowerSampler(power_monitor) if power_monitor else nullcontext()) as sampler:
+                hw_summary = backend.solve_sat_problem(dimacs_cnf, "daedalus", num_iterations)
+    except TimeoutError as e:
+        # Waiting behind other runs says nothing about the board's reliability
+        decision["error"] = str(e)
+        return decision, []
+    except InjectedFault as e:
+        # Counts against the offload policy like a real drop, but the board itself is fine
+        offload_policy.record_outcome(False)
+        decision["error"] = str(e)
+        decision["fault_injection"] = {"dropped_response": 1}
+        return decision, []
+    except Exception as e:
+        offload_policy.record_outcome(False)
+        decision["error"] = str(e)
+        decision["board_failure"] = True
+        return decision, []
+
+    offload_policy.record_outcome(True)
+    decision["calibration"] = calibration_reference_for_port(hardware.port)
+    if hw_summary.get("watchdog", {}).get("failures"):
+        decision["watchdog"] = hw_summary["watchdog"]
+    runs = hw_summary["runs"]
+    if sampler:
+        runs, decision["power_measurement"] = apply_measured_energy(hw_summary, sampler)
+    # The host sits in the serial transaction for the whole batch of runs; split it evenly
+    orchestration_nj = host.energy_nj / max(len(runs), 1)
+    results = [
+        dict(run, iteration=i + 1, energy_breakdown=energy_breakdown(
+            host_orchestration_nj=orchestration_nj, accelerator_nj=run.get("energy_nj", 0)
+        ))
+        for i, run in enumerate(runs)
+    ]
+    return decision, results
+
+RACE_SOFTWARE_SOLVERS = {"walksat": WalkSATSolver, "minisat": MiniSATSolver}
+
+def assignment_satisfies(clauses, assignment):
+    """Whether a list of DIMACS literals satisfies every clause"""
+    true_literals = set(assignment or ())
+    return all(any(lit in true_literals for lit in clause) for clause in clauses)
+
+def race_hardware_software(dimacs_cnf, software_solver="walksat", solver_config=None):
+    """Run a software solver and DAEDALUS concurrently; the first definitive answer wins
+
+    Definitive means a model that checks out against the clauses, or UNSAT from a complete solver.
+    The firmware reports a verdict without a model, so the board can only win once it sends one.
+    """
+    stop_event = threading.Event()
+    solver = make_software_solver(software_solver, solver_config, stop_event)
+    software_host, hardware_host = host_energy_meter(solver_config), host_energy_meter(solver_config)
+    queue_owner = threading.current_thread().name
+    clauses = parse_dimacs(dimacs_cnf)[1]
+    start_time = time.time()
+
+    def run_software():
+        with software_host:
+            satisfiable, assignment = solver.solve(dimacs_cnf)
+        return {
+            "solver": software_solver,
+            "satisfiable": satisfiable,
+            "assignment": assignment,
+            "elapsed_ms": (time.time() - start_time) * 1000,
+            "cancelled": solver.cancelled,
+            "complete": software_solver in COMPLETE_SOLVERS,
+        }
+
+    def run_hardware():
+        hardware = sat_pool.get_connection((solver_config or {}).get("device_id"))
+        require_supported_firmware(hardware.port)
+        backend = with_fault_injection(hardware, solver_config, dimacs_cnf)
+        # Held until the serial transaction ends, even after software has won
+        with device_queue(hardware.port).exclusive(queue_owner):
+            with hardware_host, (PowerSampler(power_monitor) if power_monitor else nullcontext()) as sampler:
+                hw_summary = backend.solve_sat_problem(dimacs_cnf, "daedalus", 1)
+        runs, measurement = apply_measured_energy(hw_summary, sampler) if sampler else (hw_summary["runs"], None)
+        run = runs[0]
+        return {
+            "solver": "daedalus",
+            "satisfiable": run["satisfiable"],
+            "assignment": run.get("assignment"),
+            "elapsed_ms": (time.time() - start_time) * 1000,
+            "device_time_ms": run["solve_time_ms"],
+            "energy_nj": run["energy_nj"],
+            "power_measurement": measurement,
+            "calibration": calibration_reference_for_port(hardware.port),
+            "faults": run.get("faults", []),
+            "cancelled": False,
+            "complete": False,
+        }
+
+    entrants = {}
+    winner = None
+    # Leaving the block waits for both sides: a serial transaction can't be interrupted, and the
+    # board must not be handed to the next run while its answer is still arriving
+    with ThreadPoolExecutor(max_workers=2) as executor:
+        futures = {executor.submit(run_software): "software", executor.submit(run_hardware): "hardware"}
+        for future in as_completed(futures):
+            side = futures[future]
+            try:
+                entrant = future.result()
+            except Exception as e:
+                entrants[side] = {"error": str(e), "elapsed_ms": (time.time() - start_time) * 1000, "definitive": False}
+                continue
+            assignment = entrant.pop("assignment")
+            complete = entrant.pop("complete")
+            if entrant["satisfiable"]:
+                entrant["verified"] = bool(assignment) and assignment_satisfies(clauses, assignment)
+                entrant["definitive"] = entrant["verified"]
+            else:
+                entrant["definitive"] = complete and not entrant["cancelled"]
+            entrants[side] = entrant
+            if winner is None and entrant["definitive"]:
+                winner = side
+                stop_event.set()
+
+    software, hardware = entrants["software"], entrants["hardware"]
+    speedup = None
+    if winner and "error" not in software and "error" not in hardware:
+        # When the loser was cancelled its elapsed time is only a lower bound
+        speedup = software["elapsed_ms"] / max(hardware["elapsed_ms"], 1e-6)
+
+    return {
+        # None when neither side produced a checked model or a proof of UNSAT
+        "winner": winner,
+        "software": software,
+        "hardware": hardware,
+        "hardware_speedup": speedup,
+        "speedup_is_lower_bound": bool(winner) and bool(software.get("cancelled") or hardware.get("cancelled")),
+        "energy_breakdown": energy_breakdown(
+            host_orchestration_nj=hardware_host.energy_nj,
+            host_solving_nj=software_host.energy_nj,
+            accelerator_nj=hardware.get("energy_nj", 0),
+        ),
+    }
+
 # ------------------------------ SATLIB Benchmark Generators ------------------
 import random
 
@@ -2653,15 +7804,16 @@ def generate_satlib_dimacs(benchmark_id, problem_index=1):
 
 def generate_uniform_random_3sat(vars_num, clauses, satisfiable, problem_index=1):
     """Generate uniform random 3-SAT problems"""
-    # Use problem index as seed for reproducibility
-    random.seed(42 + problem_index * 1000)
+    # Use problem index as seed for reproducibility; a generator of our own, since batch
+    # problems are generated on several board threads at once
+    rng = random.Random(42 + problem_index * 1000)
     
     clauses_list = []
     for _ in range(clauses):
         clause = []
-        variables = random.sample(range(1, vars_num + 1), 3)
+        variables = rng.sample(range(1, vars_num + 1), 3)
         for var in variables:
-            if random.random() < 0.5:
+            if rng.random() < 0.5:
                 clause.append(-var)
             else:
                 clause.append(var)
@@ -2682,16 +7834,28 @@ def generate_uniform_random_3sat(vars_num, clauses, satisfiable, problem_index=1
     
     return dimacs
 
+def generate_random_ksat(num_vars, num_clauses, k, rng, label=""):
+    """Uniform random k-SAT: k distinct variables per clause, each negated with probability 1/2"""
+    lines = [
+        f"c Uniform random {k}-SAT ({num_vars} vars, {num_clauses} clauses){' ' + label if label else ''}",
+        f"c Clause-to-variable ratio: {num_clauses / num_vars:.2f}",
+        f"p cnf {num_vars} {num_clauses}",
+    ]
+    for _ in range(num_clauses):
+        clause = [var if rng.random() < 0.5 else -var for var in rng.sample(range(1, num_vars + 1), k)]
+        lines.append(" ".join(map(str, clause)) + " 0")
+    return "\n".join(lines) + "\n"
+
 def generate_graph_coloring(vertices, edges, colors, problem_index=1):
     """Generate graph coloring problems as SAT"""
-    random.seed(42 + problem_index * 1000)
+    rng = random.Random(42 + problem_index * 1000)
     vars_num = vertices * colors
     
     # Generate random graph edges
     edge_list = []
     while len(edge_list) < edges:
-        v1 = random.randint(0, vertices - 1)
-        v2 = random.randint(0, vertices - 1)
+        v1 = rng.randint(0, vertices - 1)
+        v2 = rng.randint(0, vertices - 1)
         if v1 != v2 and (v1, v2) not in edge_list and (v2, v1) not in edge_list:
             edge_list.append((v1, v2))
     
@@ -2731,11 +7895,11 @@ def generate_graph_coloring(vertices, edges, colors, problem_index=1):
 
 def generate_controlled_backbone(vars_num, clauses, backbone_size, problem_index=1):
     """Generate controlled backbone size problems"""
-    random.seed(42 + problem_index * 1000)
+    rng = random.Random(42 + problem_index * 1000)
     
     # Create backbone variables (forced assignments)
-    backbone_vars = random.sample(range(1, vars_num + 1), backbone_size)
-    backbone_assignments = {var: random.choice([True, False]) for var in backbone_vars}
+    backbone_vars = rng.sample(range(1, vars_num + 1), backbone_size)
+    backbone_assignments = {var: rng.choice([True, False]) for var in backbone_vars}
     
     clauses_list = []
     
@@ -2750,9 +7914,9 @@ def generate_controlled_backbone(vars_num, clauses, backbone_size, problem_index
     remaining_clauses = clauses - len(clauses_list)
     for _ in range(remaining_clauses):
         clause = []
-        variables = random.sample(range(1, vars_num + 1), 3)
+        variables = rng.sample(range(1, vars_num + 1), 3)
         for var in variables:
-            if random.random() < 0.5:
+            if rng.random() < 0.5:
                 clause.append(-var)
             else:
                 clause.append(var)
@@ -2818,14 +7982,14 @@ def generate_logistics(logistics_type, problem_index=1):
 
 def generate_aim(vars_num, clauses, satisfiable, problem_index=1):
     """Generate AIM problems"""
-    random.seed(42 + problem_index * 1000)
+    rng = random.Random(42 + problem_index * 1000)
     
     clauses_list = []
     for _ in range(clauses):
         clause = []
-        variables = random.sample(range(1, vars_num + 1), 3)
+        variables = rng.sample(range(1, vars_num + 1), 3)
         for var in variables:
-            if random.random() < 0.5:
+            if rng.random() < 0.5:
                 clause.append(-var)
             else:
                 clause.append(var)
@@ -2905,12 +8069,198 @@ def generate_pigeonhole(pigeons, holes, problem_index=1):
     
     return dimacs
 
-def run_single_sat_test(dimacs_cnf, enable_minisat, enable_walksat, enable_daedalus, num_iterations):
+# Bump whenever the statistics derived from raw runs change, so stored summaries can be recomputed
+SUMMARY_VERSION = 4
+# Target probability of at least one success for TTS, and the confidence level of its interval
+TTS_TARGET_PROBABILITY = float(os.getenv("TTS_TARGET_PROBABILITY", 0.99))
+TTS_CONFIDENCE = 0.95
+TTS_CONFIDENCE_Z = 1.959964
+
+def wilson_interval(successes, trials, z=TTS_CONFIDENCE_Z):
+    """Wilson score interval for a binomial proportion; stays inside [0, 1] even at 0 or n successes"""
+    if trials == 0:
+        return None, None
+    p = successes / trials
+    denominator = 1 + z * z / trials
+    centre = (p + z * z / (2 * trials)) / denominator
+    margin = z * math.sqrt(p * (1 - p) / trials + z * z / (4 * trials * trials)) / denominator
+    return max(centre - margin, 0.0), min(centre + margin, 1.0)
+
+def tts_for(run_time_ms, success_probability, target=TTS_TARGET_PROBABILITY):
+    """Expected time to reach `target` confidence of a success by independent restarts
+
+    TTS_p = t * ln(1 - p) / ln(1 - s), with at least one run: once a single run succeeds with
+    probability >= p, TTS is just the run time. Infinite (None) when no run succeeds.
+    """
+    if not success_probability:
+        return None
+    if success_probability >= 1.0:
+        return run_time_ms
+    return run_time_ms * max(math.log(1 - target) / math.log(1 - success_probability), 1.0)
+
+def time_to_solution(results, target=TTS_TARGET_PROBABILITY):
+    """TTS_p from measured per-run success, with the success interval it was derived from
+
+    t is the mean time of all runs, failed ones included, since each restart costs a full run.
+    The TTS interval maps the success interval's bounds through the same formula.
+    """
+    runs = len(results)
+    successes = sum(1 for r in results if r.get("success", False))
+    run_time_ms = sum(r.get("solve_time_ms", 0) for r in results) / runs
+    low, high = wilson_interval(successes, runs)
+    return {
+        "target_probability": target,
+        "run_time_ms": run_time_ms,
+        "success_probability": successes / runs,
+        "success_probability_ci": [low, high],
+        "tts_ms": tts_for(run_time_ms, successes / runs, target),
+        # Higher success gives lower TTS, so the bounds swap; None means unbounded
+        "tts_ci_ms": [tts_for(run_time_ms, high, target), tts_for(run_time_ms, low, target)],
+        "confidence": TTS_CONFIDENCE,
+        "runs": runs,
+    }
+
+def summarize_instance_tts(batch_results, target=TTS_TARGET_PROBABILITY):
+    """Per-solver median over instances of each instance's own TTS_p
+
+    Pooling a batch's runs into one TTS blends easy and hard instances; the per-instance median
+    is the usual figure for a family. Instances never solved count as infinitely slow.
+    """
+    per_solver = defaultdict(list)
+    for problem in batch_results:
+        for solver_name, runs in problem.get("solver_results", {}).items():
+            if runs:
+                per_solver[solver_name].append(time_to_solution(runs, target)["tts_ms"])
+    summary = {}
+    for solver_name, values in per_solver.items():
+        ordered = sorted(values, key=lambda v: math.inf if v is None else v)
+        median = ordered[(len(ordered) - 1) // 2]
+        summary[solver_name] = {
+            "target_probability": target,
+            "instances": len(values),
+            "solved_instances": sum(1 for v in values if v is not None),
+            "median_tts_ms": median,
+        }
+    return summary
+
+def summarize_solver_results(solver_results):
+    """Per-solver statistics derived from the raw per-run records"""
+    comparison = {}
+    for solver_name, results in solver_results.items():
+        if not results:
+            continue
+        total_runs = len(results)
+        comparison[solver_name] = {
+            "avg_solve_time_ms": sum(r.get("solve_time_ms", 0) for r in results) / total_runs,
+            "avg_energy_nj": sum(r.get("energy_nj", 0) for r in results) / total_runs,
+            "avg_system_energy_nj": sum(r.get("energy_breakdown", {}).get("total_system_nj", 0) for r in results) / total_runs,
+            "success_rate": sum(1 for r in results if r.get("success", False)) / total_runs,
+            "tts": time_to_solution(results),
+            "total_runs": total_runs,
+        }
+    return comparison
+
+def resolve_instance_weights(weights):
+    """Validate {"families": {preset: w}, "instances": {"preset#problem_index": w}}; returns (weights, errors)"""
+    if weights is None:
+        return None, []
+    if not isinstance(weights, dict) or set(weights) - {"families", "instances"}:
+        return None, ["weights must be an object with optional families and instances maps"]
+    errors = []
+    resolved = {}
+    for scope in ("families", "instances"):
+        table = weights.get(scope, {})
+        if not isinstance(table, dict):
+            errors.append(f"weights.{scope} must be an object")
+            continue
+        for key, value in table.items():
+            if isinstance(value, bool) or not isinstance(value, (int, float)) or value < 0:
+                errors.append(f"weights.{scope}.{key} must be a non-negative number")
+            # Problem indices repeat across families, so an instance is only named by both
+            family, _, index = str(key).rpartition("#")
+            if scope == "instances" and not (family and index.isdigit()):
+                errors.append(f"weights.instances.{key} must be keyed as family#problem_index, e.g. uf20-91#3")
+        resolved[scope] = {str(key): float(value) for key, value in table.items()
+                           if isinstance(value, (int, float)) and not isinstance(value, bool)}
+    return resolved, errors
+
+def instance_weight(problem, weights):
+    """Weight of one batch problem; unlisted families and instances count 1"""
+    key = f"{problem.get('satlib_benchmark')}#{problem.get('problem_index')}"
+    return (weights.get("families", {}).get(problem.get("satlib_benchmark"), 1.0)
+            * weights.get("instances", {}).get(key, 1.0))
+
+def _weighted_median(pairs):
+    pairs = sorted(pairs)
+    total = sum(w for _, w in pairs)
+    cumulative = 0.0
+    for value, weight in pairs:
+        cumulative += weight
+        if cumulative >= total / 2:
+            return value
+    return None
+
+def summarize_weighted(batch_results, weights):
+    """Per-solver statistics where each instance counts by its weight rather than once per run
+
+    Runs of an instance are first averaged, so instances with more iterations don't dominate.
+    """
+    per_solver = defaultdict(list)
+    for problem in batch_results:
+        weight = instance_weight(problem, weights)
+        if weight == 0:
+            continue
+        for solver_name, runs in problem.get("solver_results", {}).items():
+            if not runs:
+                continue
+            per_solver[solver_name].append((
+                weight,
+                sum(r.get("solve_time_ms", 0) for r in runs) / len(runs),
+                sum(1 for r in runs if r.get("success", False)) / len(runs),
+                sum(r.get("energy_nj", 0) for r in runs) / len(runs),
+            ))
+
+    comparison = {}
+    for solver_name, instances in per_solver.items():
+        total_weight = sum(w for w, _, _, _ in instances)
+        if total_weight == 0:
+            continue
+        comparison[solver_name] = {
+            "weighted_avg_solve_time_ms": sum(w * t for w, t, _, _ in instances) / total_weight,
+            "weighted_median_solve_time_ms": _weighted_median([(t, w) for w, t, _, _ in instances]),
+            "weighted_success_rate": sum(w * r for w, _, r, _ in instances) / total_weight,
+            "weighted_avg_energy_nj": sum(w * e for w, _, _, e in instances) / total_weight,
+            "instances": len(instances),
+            "total_weight": total_weight,
+        }
+    return {"weights": weights, "solver_comparison": comparison}
+
+def summarize_offload(batch_results):
+    decisions = [p["offload_decision"] for p in batch_results if "offload_decision" in p]
+    return {
+        "offloaded": sum(1 for d in decisions if d["use_hardware"] and "error" not in d),
+        "failed": sum(1 for d in decisions if "error" in d),
+        "declined": sum(1 for d in decisions if not d["use_hardware"]),
+    }
+
+def assignment_literals(assignment):
+    """Solver output (literal list or variable -> bool) as DIMACS literals ordered by variable"""
+    if isinstance(assignment, dict):
+        return [var if value else -var for var, value in sorted(assignment.items())]
+    return sorted(assignment, key=abs)
+
+def repeated_run_seed(base, iteration):
+    """Seed for one of several independent runs: base + iteration, or a fresh random one when base is -1"""
+    return base + iteration if base >= 0 else secrets.randbelow(2**31)
+
+def run_single_sat_test(dimacs_cnf, enable_minisat, enable_walksat, enable_daedalus, num_iterations, enable_cube=False, enable_oscillator=False, race_solver=None, solver_config=None, enable_ising=False):
     """Run a single SAT problem with multiple solvers"""
+    solver_config = solver_config or resolve_solver_config(None)[0]
     all_results = {
         "solver_results": {},
         "summary": {},
-        "iterations": num_iterations
+        "iterations": num_iterations,
+        "host_energy": host_energy_status(),
     }
     
     # Parse problem size
@@ -2928,20 +8278,24 @@ def run_single_sat_test(dimacs_cnf, enable_minisat, enable_walksat, enable_daeda
     if enable_minisat:
         minisat_results = []
         for i in range(num_iterations):
-            solver = MiniSATSolver()
-            start_time = time.time()
-            satisfiable, assignment = solver.solve(dimacs_cnf)
-            solve_time = (time.time() - start_time) * 1000
+            with solve_cutoff(solver_config) as cutoff:
+                solver = MiniSATSolver(stop_event=cutoff)
+                start_time = time.time()
+                with host_energy_meter(solver_config) as host:
+                    satisfiable, assignment = solver.solve(dimacs_cnf)
+                solve_time = (time.time() - start_time) * 1000
             
             minisat_results.append({
                 "iteration": i + 1,
                 "satisfiable": satisfiable,
+                "assignment": assignment if satisfiable else None,
                 "solve_time_ms": solve_time,
+                "cutoff_reached": solver.cancelled,
                 "propagations": solver.propagations,
                 "decisions": solver.decisions,
                 "conflicts": solver.conflicts,
-                "energy_nj": solve_time * 0.5,
-                "power_mw": 5.0,
+                **host.run_fields(),
+                "energy_breakdown": energy_breakdown(host_solving_nj=host.energy_nj),
                 "success": True
             })
         
@@ -2950,50 +8304,482 @@ def run_single_sat_test(dimacs_cnf, enable_minisat, enable_walksat, enable_daeda
     if enable_walksat:
         walksat_results = []
         for i in range(num_iterations):
-            solver = WalkSATSolver(max_flips=100000, noise=0.5)
-            start_time = time.time()
-            satisfiable, assignment = solver.solve(dimacs_cnf)
-            solve_time = (time.time() - start_time) * 1000
+            seed = repeated_run_seed(solver_config["walksat_seed"], i)
+            with solve_cutoff(solver_config) as cutoff:
+                solver = make_software_solver("walksat", solver_config, cutoff, seed=seed)
+                start_time = time.time()
+                with host_energy_meter(solver_config) as host:
+                    satisfiable, assignment = solver.solve(dimacs_cnf)
+                solve_time = (time.time() - start_time) * 1000
             
             walksat_results.append({
                 "iteration": i + 1,
                 "satisfiable": satisfiable,
+                "assignment": assignment if satisfiable else None,
                 "solve_time_ms": solve_time,
-                "flips": getattr(solver, 'total_flips', 0),
-                "restarts": getattr(solver, 'restarts', 0),
-                "energy_nj": solve_time * 0.3,
-                "power_mw": 3.0,
+                "cutoff_reached": solver.cancelled,
+                "flips": solver.total_flips,
+                "restarts": solver.restarts,
+                "unsatisfied_clauses": solver.unsatisfied_clauses,
+                "seed": seed,
+                **host.run_fields(),
+                "energy_breakdown": energy_breakdown(host_solving_nj=host.energy_nj),
                 "success": satisfiable
             })
         
         all_results["solver_results"]["walksat"] = walksat_results
     
+    if enable_cube:
+        cube_results = []
+        for i in range(num_iterations):
+            with solve_cutoff(solver_config) as cutoff:
+                solver = CubeAndConquerSolver(stop_event=cutoff)
+                start_time = time.time()
+                with host_energy_meter(solver_config) as host:
+                    satisfiable, assignment = solver.solve(dimacs_cnf)
+                solve_time = (time.time() - start_time) * 1000
+
+            cube_results.append({
+                "iteration": i + 1,
+                "satisfiable": satisfiable,
+                "assignment": assignment if satisfiable else None,
+                "solve_time_ms": solve_time,
+                "cutoff_reached": solver.cancelled,
+                "proved_unsat": solver.proved_unsat,
+                "cube_count": len(solver.cubes),
+                "cubes": solver.cubes,
+                **host.run_fields(),
+                "energy_breakdown": energy_breakdown(host_solving_nj=host.energy_nj),
+                # Only a model or a refutation of every cube answers the instance
+                "success": satisfiable or solver.proved_unsat
+            })
+
+        all_results["solver_results"]["cube_and_conquer"] = cube_results
+
+    if enable_oscillator:
+        profile = run_simulator_profile(solver_config)
+        all_results["simulator_config"] = profile
+        all_results["calibration"] = calibration_reference(SIMULATOR_DEVICE_ID)
+        oscillator_results = []
+        for i in range(num_iterations):
+            if num_vars > profile["max_variables"] or num_clauses > profile["max_clauses"]:
+                oscillator_results.append({
+                    "iteration": i + 1,
+                    "satisfiable": False,
+                    "solve_time_ms": 0,
+                    "error": f"Problem exceeds simulated accelerator capacity "
+                             f"({profile['max_variables']} variables, {profile['max_clauses']} clauses)",
+                    "success": False
+                })
+                continue
+
+            seed = simulator_run_seed(profile, i)
+            with solve_cutoff(solver_config) as cutoff:
+                solver = with_fault_injection(
+                    make_software_solver("oscillator", solver_config, cutoff, seed=seed), solver_config,
+                    f"{i}:{dimacs_cnf}"
+                )
+                start_time = time.time()
+                with host_energy_meter(solver_config) as host:
+                    satisfiable, assignment = solver.solve(dimacs_cnf)
+                solve_time = (time.time() - start_time) * 1000
+            # Model an unreliable readout: a solution found by the network can still be lost
+            readout_failed = satisfiable and solver.rng.random() >= profile["success_rate"]
+            if profile["fixed_latency_ns"] > 0:
+                simulated_time_ns = profile["fixed_latency_ns"]
+            else:
+                simulated_time_ns = solver.simulated_time_ns / profile["speedup_factor"]
+
+            oscillator_results.append({
+                "iteration": i + 1,
+                "satisfiable": satisfiable and not readout_failed,
+                "assignment": assignment if satisfiable and not readout_failed else None,
+                "solve_time_ms": solve_time,
+                "steps": solver.total_steps,
+                "restarts": solver.restarts,
+                "unsatisfied_clauses": solver.unsatisfied_clauses,
+                "readout_failed": readout_failed,
+                "cutoff_reached": solver.cancelled,
+                "seed": seed,
+                # What the run would take on the chip, not on the host simulating it
+                "simulated_time_ns": simulated_time_ns,
+                "energy_nj": simulated_time_ns * profile["power_mw"] / 1000,
+                "energy_breakdown": energy_breakdown(host_solving_nj=host.energy_nj),
+                "power_mw": profile["power_mw"],
+                "success": satisfiable and not readout_failed
+            })
+            if getattr(solver, "last_faults", None):
+                oscillator_results[-1]["faults"] = solver.last_faults
+
+        all_results["solver_results"]["oscillator"] = oscillator_results
+
+    if enable_ising:
+        ising_results = []
+        for i in range(num_iterations):
+            seed = repeated_run_seed(solver_config["ising_seed"], i)
+            with solve_cutoff(solver_config) as cutoff:
+                solver = make_software_solver("ising", solver_config, cutoff, seed=seed)
+                start_time = time.time()
+                with host_energy_meter(solver_config) as host:
+                    satisfiable, assignment = solver.solve(dimacs_cnf)
+                solve_time = (time.time() - start_time) * 1000
+
+            ising_results.append({
+                "iteration": i + 1,
+                "satisfiable": satisfiable,
+                "assignment": assignment if satisfiable else None,
+                "solve_time_ms": solve_time,
+                "cutoff_reached": solver.cancelled,
+                "sweeps": solver.sweeps_done,
+                "num_spins": solver.num_spins,
+                "best_energy": solver.best_energy,
+                "unsatisfied_clauses": solver.unsatisfied_clauses,
+                "seed": seed,
+                "energy_nj": solve_time * ISING_ANNEALER_POWER_MW * 1000,
+                "energy_breakdown": energy_breakdown(host_solving_nj=host.energy_nj),
+                "power_mw": ISING_ANNEALER_POWER_MW,
+                "success": satisfiable
+            })
+
+        all_results["solver_results"]["ising"] = ising_results
+
+    if enable_daedalus:
+        decision, daedalus_results = run_daedalus_offload(
+            dimacs_cnf, num_vars, parse_dimacs(dimacs_cnf)[1], num_iterations, solver_config
+        )
+        all_results["offload_decision"] = decision
+        all_results["solver_results"]["daedalus"] = daedalus_results
+
+    if race_solver:
+        race_results = []
+        for i in range(num_iterations):
+            race = race_hardware_software(dimacs_cnf, race_solver, solver_config)
+            winner = race[race["winner"]] if race["winner"] else {}
+            race_results.append({
+                "iteration": i + 1,
+                "winner": race["winner"],
+                "satisfiable": winner.get("satisfiable", False),
+                "solve_time_ms": winner.get("elapsed_ms", 0),
+                "software": race["software"],
+                "hardware": race["hardware"],
+                "hardware_speedup": race["hardware_speedup"],
+                "speedup_is_lower_bound": race["speedup_is_lower_bound"],
+                "energy_nj": winner.get("energy_nj", winner.get("elapsed_ms", 0) * 0.3),
+                "energy_breakdown": race["energy_breakdown"],
+                "success": race["winner"] is not None
+            })
+            if race["hardware"].get("faults"):
+                race_results[-1]["faults"] = race["hardware"]["faults"]
+
+        all_results["solver_results"]["race"] = race_results
+
+    # Tag each run with the algorithm that produced it
+    for solver_name, results in all_results["solver_results"].items():
+        for result in results:
+            result.setdefault("solver", solver_name)
+
     # Calculate summary statistics
     summary = {
         "problem_size": f"{num_vars} vars, {num_clauses} clauses",
         "iterations": num_iterations,
-        "solver_comparison": {},
-        "problem_count": 1
+        "solver_comparison": summarize_solver_results(all_results["solver_results"]),
+        "problem_count": 1,
+        "summary_version": SUMMARY_VERSION
     }
-    
-    for solver_name, results in all_results["solver_results"].items():
-        if results:
-            avg_time = sum(r["solve_time_ms"] for r in results) / len(results)
-            avg_energy = sum(r.get("energy_nj", 0) for r in results) / len(results)
-            success_rate = sum(1 for r in results if r.get("success", False)) / len(results)
-            
-            summary["solver_comparison"][solver_name] = {
-                "avg_solve_time_ms": avg_time,
-                "avg_energy_nj": avg_energy,
-                "success_rate": success_rate,
-                "total_runs": len(results)
-            }
-    
+    summary["energy_breakdown"] = summarize_energy(all_results["solver_results"])
+
+    if fault_injection_enabled(solver_config):
+        summary["fault_injection"] = summarize_fault_injection([all_results], solver_config)
+
+    all_results["known_answer"] = check_known_answer(dimacs_cnf, all_results["solver_results"])
+    summary["known_answer_check"] = summarize_known_answers([(None, all_results["known_answer"])])
+    if all_results["known_answer"]["contradictions"]:
+        logger.warning(f"Solver output contradicts known answer: {all_results['known_answer']['contradictions']}")
+
     all_results["summary"] = summary
+    # Assignments are kept apart from the per-run metrics and written out as solution files
+    all_results["solutions"] = {
+        solver: [assignment_literals(a) if a else None for a in (run.pop("assignment", None) for run in runs)]
+        for solver, runs in all_results["solver_results"].items()
+    }
     return all_results
 
-def run_batch_sat_tests(satlib_benchmark, problem_indices, enable_minisat, enable_walksat, enable_daedalus, num_iterations, test_id=None):
-    """Run batch SAT tests across multiple SATLIB problems with real-time progress"""
+# ------------------------------ Result Cache ---------------------------------
+from collections import OrderedDict
+
+# Software-only solves of an identical instance and configuration are served from here
+RESULT_CACHE_SIZE = int(os.getenv("RESULT_CACHE_SIZE", 1024))  # entries kept in memory; 0 disables the cache
+RESULT_CACHE_DIR = os.getenv("RESULT_CACHE_DIR", "")  # optional on-disk tier that survives restarts
+
+class ResultCache:
+    """LRU of single-problem results by key, backed by JSON files when a directory is set"""
+
+    def __init__(self, max_entries, directory=None):
+        self.max_entries = max_entries
+        self.directory = Path(directory) if directory else None
+        self.entries = OrderedDict()
+        self.lock = threading.Lock()
+        self.hits = self.misses = self.disk_hits = 0
+
+    def path(self, key):
+        return self.directory / key[:2] / f"{key}.json"
+
+    def get(self, key):
+        with self.lock:
+            results = self.entries.get(key)
+            if results is not None:
+                self.entries.move_to_end(key)
+                self.hits += 1
+                return copy.deepcopy(results)
+        results = None
+        if self.directory and self.path(key).exists():
+            try:
+                results = json.loads(self.path(key).read_text())
+            except (OSError, ValueError) as e:
+                logger.warning(f"Unreadable result cache entry {key}: {e}")
+        with self.lock:
+            if results is None:
+                self.misses += 1
+                return None
+            self.hits += 1
+            self.disk_hits += 1
+            self._remember(key, results)
+            return copy.deepcopy(results)
+
+    def put(self, key, results):
+        results = copy.deepcopy(results)
+        with self.lock:
+            self._remember(key, results)
+        if self.directory:
+            path = self.path(key)
+            path.parent.mkdir(parents=True, exist_ok=True)
+            tmp_path = path.with_suffix(".tmp")
+            tmp_path.write_text(json.dumps(results, default=str))
+            tmp_path.replace(path)
+
+    def _remember(self, key, results):
+        self.entries[key] = results
+        self.entries.move_to_end(key)
+        while len(self.entries) > self.max_entries:
+            self.entries.popitem(last=False)
+
+    def clear(self):
+        with self.lock:
+            cleared = len(self.entries)
+            self.entries.clear()
+        if self.directory and self.directory.exists():
+            shutil.rmtree(self.directory, ignore_errors=True)
+        return cleared
+
+    def stats(self):
+        with self.lock:
+            lookups = self.hits + self.misses
+            return {
+                "enabled": self.max_entries > 0,
+                "entries": len(self.entries),
+                "max_entries": self.max_entries,
+                "directory": str(self.directory) if self.directory else None,
+                "hits": self.hits,
+                "disk_hits": self.disk_hits,
+                "misses": self.misses,
+                "hit_rate": self.hits / lookups if lookups else None,
+            }
+
+result_cache = ResultCache(RESULT_CACHE_SIZE, RESULT_CACHE_DIR or None)
+
+def draws_fresh_seeds(solvers, solver_config, enable_oscillator):
+    """Whether an enabled stochastic solver picks a new seed per run (seed -1), making its results unrepeatable"""
+    seeds = [
+        solver_config.get("walksat_seed") if solvers["walksat"] else None,
+        solver_config.get("ising_seed") if solvers["ising"] else None,
+        run_simulator_profile(solver_config)["seed"] if enable_oscillator else None,
+    ]
+    if enable_oscillator and any(solver_config.get(rate) for rate in (
+        "fault_bit_flip_rate", "fault_drop_rate", "fault_latency_spike_rate"
+    )):
+        seeds.append(solver_config.get("fault_seed"))
+    return -1 in seeds
+
+def result_cache_key(dimacs_cnf, solvers, num_iterations, solver_config, enable_oscillator):
+    """Canonical instance hash plus every setting that can change the outcome, seeds included"""
+    settings = {
+        "instance": instance_hash(dimacs_cnf),
+        "solvers": solvers,
+        "iterations": num_iterations,
+        "solver_config": {k: v for k, v in solver_config.items() if k not in ("device_id", "simulator")},
+        # The oscillator draws on the simulated chip profile and its seed
+        "simulator": run_simulator_profile(solver_config) if enable_oscillator else None,
+    }
+    return hashlib.sha256(json.dumps(settings, sort_keys=True).encode()).hexdigest()
+
+def cached_single_sat_test(dimacs_cnf, enable_minisat, enable_walksat, enable_daedalus, num_iterations,
+                           enable_cube=False, enable_oscillator=False, race_solver=None, solver_config=None,
+                           enable_ising=False, use_cache=True, reuse_timings=True):
+    """run_single_sat_test through the result cache; runs that touch a board are always measured afresh
+
+    Runs that draw fresh seeds are never cached. With reuse_timings off the instance is solved
+    again and the fresh result replaces the cached one, so timings are always new measurements.
+    """
+    solver_config = solver_config or resolve_solver_config(None)[0]
+    run = lambda: run_single_sat_test(
+        dimacs_cnf, enable_minisat, enable_walksat, enable_daedalus, num_iterations, enable_cube=enable_cube,
+        enable_oscillator=enable_oscillator, race_solver=race_solver, solver_config=solver_config,
+        enable_ising=enable_ising
+    )
+    if not use_cache or not result_cache.max_entries or enable_daedalus or race_solver:
+        return run()
+
+    solvers = {"minisat": enable_minisat, "walksat": enable_walksat, "cube_and_conquer": enable_cube,
+               "oscillator": enable_oscillator, "ising": enable_ising}
+    if draws_fresh_seeds(solvers, solver_config, enable_oscillator):
+        return run()
+    key = result_cache_key(dimacs_cnf, solvers, num_iterations, solver_config, enable_oscillator)
+    results = result_cache.get(key) if reuse_timings else None
+    if results is None:
+        results = run()
+        result_cache.put(key, results)
+        results["cache"] = {"hit": False, "key": key}
+    else:
+        results["cache"] = {"hit": True, "key": key}
+    return results
+
+@app.route("/sat/result-cache", methods=["GET", "DELETE"])
+def sat_result_cache():
+    """Result cache statistics, or drop every cached result"""
+    if request.method == "DELETE":
+        cleared = result_cache.clear()
+        logger.info(f"Result cache cleared ({cleared} in-memory entries)")
+        return jsonify({"cleared": cleared, **result_cache.stats()})
+    return jsonify(result_cache.stats())
+
+# Batch runs snapshot their progress so they can be resumed after a crash or restart
+CHECKPOINT_EVERY_PROBLEMS = int(os.getenv("CHECKPOINT_EVERY_PROBLEMS", 5))
+CHECKPOINT_EVERY_SECONDS = float(os.getenv("CHECKPOINT_EVERY_SECONDS", 30))
+
+def checkpoint_path(test_id):
+    return CHECKPOINT_DIR / f"{test_id}.json"
+
+def solver_seeds(solver_config):
+    """The seed settings each solver's own generator starts from"""
+    return {field: value for field, value in (solver_config or {}).items() if field.endswith("_seed")}
+
+def save_batch_checkpoint(test_id, state):
+    """Atomically write a batch checkpoint"""
+    CHECKPOINT_DIR.mkdir(parents=True, exist_ok=True)
+    state = dict(state, test_id=test_id, saved_at=utc_now())
+    tmp_path = checkpoint_path(test_id).with_suffix(".tmp")
+    tmp_path.write_text(json.dumps(state))
+    tmp_path.replace(checkpoint_path(test_id))
+
+def load_batch_checkpoint(test_id):
+    path = checkpoint_path(test_id)
+    if not path.exists():
+        return None
+    return json.loads(path.read_text())
+
+def delete_batch_checkpoint(test_id):
+    checkpoint_path(test_id).unlink(missing_ok=True)
+
+# Set on SIGTERM; running batches checkpoint at the next problem boundary and stop
+shutdown_requested = threading.Event()
+# Set through /admin/drain: batches checkpoint and stop as on shutdown, but the server keeps running
+checkpoint_requested = threading.Event()
+
+class BatchInterrupted(Exception):
+    """A batch stopped for shutdown after checkpointing; resumable via /sat/tests/<id>/resume"""
+
+def order_problems_by_difficulty(satlib_benchmark, problem_indices, hardest_first=False, deadline=None):
+    """Order batch problems by predicted difficulty (easiest first by default)
+
+    Problems not yet ranked when the deadline passes keep their order and follow the ranked ones.
+    """
+    rank = {label: i for i, label in enumerate(DIFFICULTY_CLASSES)}
+    ranked, unranked = [], []
+    for position, problem_idx in enumerate(problem_indices):
+        if deadline and time.time() >= deadline:
+            logger.info(f"Difficulty ordering hit its deadline after {position} of {len(problem_indices)} problems")
+            unranked = list(problem_indices[position:])
+            break
+        features = extract_cnf_features(generate_satlib_dimacs(satlib_benchmark, problem_idx))
+        label, _ = difficulty_model.predict(features)
+        ranked.append((rank[label], problem_idx))
+    return [p for _, p in sorted(ranked, key=lambda r: r[0], reverse=hardest_first)] + unranked
+
+# Hardware batches are spread across every registered DAEDALUS board unless one is pinned
+MULTI_BOARD_BATCHES = os.getenv("MULTI_BOARD_BATCHES", "true").lower() == "true"
+
+def schedulable_sat_boards():
+    return [
+        d["id"] for d in hardware_manager.list_devices()
+        if d["device_type"] == "sat" and d.get("firmware_supported") is not False
+    ]
+
+class BoardScheduler:
+    """Runs batch problems in parallel, one per free board, moving work off boards that fail"""
+
+    def __init__(self, device_ids, name="boards"):
+        self.free_boards = queue.Queue()
+        for device_id in device_ids:
+            self.free_boards.put(device_id)
+        self.assignments = {device_id: 0 for device_id in device_ids}
+        self.failed_boards = []
+        self.lock = threading.Lock()
+        self.executor = ThreadPoolExecutor(max_workers=len(device_ids), thread_name_prefix=name)
+        self.futures = {}
+
+    def submit(self, position, run):
+        """Queue run(device_id) for a batch position; device_id is None once every board has failed"""
+        self.futures[position] = self.executor.submit(self._run, run)
+
+    def result(self, position):
+        return self.futures.pop(position).result()
+
+    def _run(self, run):
+        reassigned_from = []
+        while True:
+            device_id = self.free_boards.get()
+            if device_id is None:
+                # Every board failed; leave the sentinel for the other workers
+                self.free_boards.put(None)
+                results = run(None)
+                break
+            try:
+                results = run(device_id)
+            except Exception:
+                # The problem failed, not the board: hand the board on and let the batch record the error
+                self.free_boards.put(device_id)
+                raise
+            if not results.get("offload_decision", {}).get("board_failure"):
+                with self.lock:
+                    self.assignments[device_id] += 1
+                self.free_boards.put(device_id)
+                results["device_id"] = device_id
+                break
+            logger.warning(f"Board {device_id} failed; moving its work to the remaining boards")
+            reassigned_from.append(device_id)
+            with self.lock:
+                self.failed_boards.append(device_id)
+                if len(self.failed_boards) == len(self.assignments):
+                    self.free_boards.put(None)
+        if reassigned_from:
+            results["reassigned_from"] = reassigned_from
+        return results
+
+    def summary(self):
+        with self.lock:
+            return {"problems_per_board": dict(self.assignments), "failed_boards": list(self.failed_boards)}
+
+    def shutdown(self):
+        """Drop queued problems and wait for those already on a board, so no board is left mid-run"""
+        self.executor.shutdown(wait=True, cancel_futures=True)
+
+def run_batch_sat_tests(satlib_benchmark, problem_indices, enable_minisat, enable_walksat, enable_daedalus, num_iterations, test_id=None, enable_cube=False, enable_oscillator=False, time_budget_seconds=None, race_solver=None, checkpoint=None, solver_config=None, enable_ising=False, use_cache=True, reuse_cached_timings=False, tenant=None, reservation=None, reservation_fallback=RESERVATION_FALLBACK, started_at=None):
+    """Run batch SAT tests across multiple SATLIB problems with real-time progress
+
+    A tenant's batch is charged after every problem and stops once its daily budget is spent.
+    Hardware batches re-check the reservation calendar before every problem, so a long batch
+    moves to the simulator rather than run into someone else's slot.
+    """
     logger.info(f"Starting batch SAT test: {satlib_benchmark}, {len(problem_indices)} problems, {num_iterations} iterations each")
     
     all_results = {
@@ -3012,18 +8798,121 @@ def run_batch_sat_tests(satlib_benchmark, problem_indices, enable_minisat, enabl
         all_results["solver_results"]["walksat"] = []
     if enable_daedalus:
         all_results["solver_results"]["daedalus"] = []
+    if enable_cube:
+        all_results["solver_results"]["cube_and_conquer"] = []
+    if enable_oscillator:
+        all_results["solver_results"]["oscillator"] = []
+    if enable_ising:
+        all_results["solver_results"]["ising"] = []
+    if race_solver:
+        all_results["solver_results"]["race"] = []
     
     total_problems_solved = 0
-    total_solve_time = {"minisat": 0, "walksat": 0, "daedalus": 0}
-    total_energy = {"minisat": 0, "walksat": 0, "daedalus": 0}
-    total_success = {"minisat": 0, "walksat": 0, "daedalus": 0}
-    
+    # Work done for the batch before it reached here, such as difficulty ordering, counts against the budget
+    batch_start = started_at or time.time()
+    problems_attempted = 0
+    budget_exhausted = solve_budget_exhausted = False
+    start_position = 0
+
+    if checkpoint:
+        problem_indices = checkpoint["problem_indices"]
+        all_results = checkpoint["all_results"]
+        total_problems_solved = all_results["problems_completed"]
+        problems_attempted = checkpoint["problems_attempted"]
+        start_position = checkpoint["position"]
+        batch_start = time.time() - checkpoint["elapsed_seconds"]
+        # Solvers draw from generators seeded per run, so their seeds are all a resume needs
+        solver_config = dict(solver_config or {}, **checkpoint.get("solver_seeds", {}))
+        logger.info(f"Resuming batch {test_id} at problem {start_position + 1}/{len(problem_indices)}")
+
+    last_checkpoint_position, last_checkpoint_time = start_position, time.time()
+    last_charged = time.time()
+    if test_id:
+        active_batch_results[test_id] = all_results
+
+    scheduler = None
+    if MULTI_BOARD_BATCHES and (enable_daedalus or race_solver) and not (solver_config or {}).get("device_id"):
+        boards = schedulable_sat_boards()
+        if len(boards) > 1:
+            scheduler = BoardScheduler(boards, name=test_id or "batch")
+            logger.info(f"Spreading batch {test_id} across {len(boards)} boards: {', '.join(boards)}")
+
+    def solve_problem(problem_idx, device_id=None):
+        config = solver_config
+        if device_id:
+            config = dict(solver_config or {}, device_id=device_id)
+        dimacs = generate_satlib_dimacs(satlib_benchmark, problem_idx)
+        record_generated_known_answer(dimacs, f"{satlib_benchmark}/{problem_idx}")
+        start_time = time.time()
+        results = cached_single_sat_test(
+            dimacs, enable_minisat, enable_walksat, enable_daedalus,
+            num_iterations, enable_cube=enable_cube, enable_oscillator=enable_oscillator, race_solver=race_solver,
+            solver_config=config, enable_ising=enable_ising, use_cache=use_cache, reuse_timings=reuse_cached_timings
+        )
+        results["runtime_ms"] = (time.time() - start_time) * 1000
+        # Analysis and publishing read this back rather than generating the instance again
+        num_vars, clauses = parse_dimacs(dimacs)
+        results["instance"] = {"hash": instance_hash(dimacs), "num_variables": num_vars, "num_clauses": len(clauses)}
+        return results
+
+    def schedule_ahead(idx):
+        """Keep one problem per board in flight ahead of the one being collected"""
+        for ahead in range(idx, min(idx + len(scheduler.assignments), len(problem_indices))):
+            if ahead not in scheduler.futures:
+                scheduler.submit(ahead, lambda device_id, p=problem_indices[ahead]: solve_problem(p, device_id))
+
     # Process each problem with progress updates
     for idx, problem_idx in enumerate(problem_indices):
+        if idx < start_position:
+            continue
+
+        draining = test_id and (shutdown_requested.is_set() or checkpoint_requested.is_set())
+        if test_id and (draining or idx > last_checkpoint_position and (
+            idx - last_checkpoint_position >= CHECKPOINT_EVERY_PROBLEMS
+            or time.time() - last_checkpoint_time >= CHECKPOINT_EVERY_SECONDS
+        )):
+            save_batch_checkpoint(test_id, {
+                "problem_indices": problem_indices,
+                "position": idx,
+                "all_results": all_results,
+                "problems_attempted": problems_attempted,
+                "elapsed_seconds": time.time() - batch_start,
+                "solver_seeds": solver_seeds(solver_config),
+            })
+            last_checkpoint_position, last_checkpoint_time = idx, time.time()
+        if draining:
+            if scheduler:
+                scheduler.shutdown()
+            reason = "Server shutting down" if shutdown_requested.is_set() else "Drained by an administrator"
+            raise BatchInterrupted(f"{reason}; checkpointed at problem {idx + 1} of {len(problem_indices)}")
+
+        # In time-budgeted mode, stop picking new problems once the budget is spent
+        if time_budget_seconds and time.time() - batch_start >= time_budget_seconds:
+            logger.info(f"Time budget of {time_budget_seconds}s exhausted after {idx} problems")
+            budget_exhausted = True
+            break
+        if tenant and solve_seconds_left(tenant) <= 0:
+            logger.info(f"Tenant {tenant} used up today's solve budget after {idx} problems")
+            solve_budget_exhausted = True
+            break
+        problems_attempted += 1
+
+        if reservation and (enable_daedalus or race_solver):
+            slot = acquire_reservation_slot(reservation["user"], reservation["device_id"], reservation_fallback)
+            if slot["decision"] == "simulated":
+                logger.info(f"Batch {test_id}: hardware now reserved by {slot['reserved_by']}, "
+                            f"simulating from problem {problem_idx}")
+                enable_daedalus, race_solver, enable_oscillator = False, None, True
+                all_results["solver_results"].setdefault("oscillator", [])
+                all_results["reservation_rerouted"] = dict(slot, problem_index=problem_idx)
+
         try:
             # Update progress in database if test_id provided
             if test_id:
                 progress_percent = (idx / len(problem_indices)) * 100
+                if time_budget_seconds:
+                    elapsed_fraction = (time.time() - batch_start) / time_budget_seconds
+                    progress_percent = max(progress_percent, min(elapsed_fraction, 1.0) * 100)
                 with get_db() as conn:
                     conn.execute(
                         """UPDATE tests SET metadata = json_set(
@@ -3036,32 +8925,39 @@ def run_batch_sat_tests(satlib_benchmark, problem_indices, enable_minisat, enabl
                         (problem_idx, progress_percent, idx, len(problem_indices), test_id)
                     )
                     conn.commit()
+                test_events.publish(test_id, "progress", {
+                    "current_problem_index": problem_idx,
+                    "progress_percent": progress_percent,
+                    "problems_completed": idx,
+                    "total_problems": len(problem_indices),
+                })
                 
                 logger.info(f"Batch progress: {idx+1}/{len(problem_indices)} - Problem {problem_idx}")
             
-            # Generate the specific problem
-            dimacs_cnf = generate_satlib_dimacs(satlib_benchmark, problem_idx)
-            
-            # Run single test for this problem
-            problem_results = run_single_sat_test(
-                dimacs_cnf, enable_minisat, enable_walksat, enable_daedalus, num_iterations
-            )
+            # Run single test for this problem, on whichever board is free when spreading across boards
+            if scheduler:
+                schedule_ahead(idx)
+                problem_results = scheduler.result(idx)
+            else:
+                problem_results = solve_problem(problem_idx)
             
             # Add problem-specific metadata
             problem_results["problem_index"] = problem_idx
             problem_results["satlib_benchmark"] = satlib_benchmark
             all_results["batch_results"].append(problem_results)
+            if test_id:
+                test_events.publish(test_id, "problem_completed", {
+                    "problem_index": problem_idx,
+                    "file": f"{satlib_benchmark}/{problem_idx}",
+                    "solved": any(
+                        run.get("satisfiable") for runs in problem_results["solver_results"].values() for run in runs
+                    ),
+                    "runtime_ms": problem_results["runtime_ms"],
+                })
             
             # Aggregate results for overall statistics
             for solver_name, results in problem_results["solver_results"].items():
                 all_results["solver_results"][solver_name].extend(results)
-                
-                # Update totals
-                for result in results:
-                    total_solve_time[solver_name] += result.get("solve_time_ms", 0)
-                    total_energy[solver_name] += result.get("energy_nj", 0)
-                    if result.get("success", False):
-                        total_success[solver_name] += 1
             
             total_problems_solved += 1
             all_results["problems_completed"] = total_problems_solved
@@ -3073,6 +8969,14 @@ def run_batch_sat_tests(satlib_benchmark, problem_indices, enable_minisat, enabl
         except Exception as e:
             logger.error(f"Error processing problem {problem_idx}: {e}")
             continue
+        finally:
+            if tenant:
+                now = time.time()
+                charge_solve_seconds(tenant, now - last_charged)
+                last_charged = now
+
+    if scheduler:
+        scheduler.shutdown()
     
     # Final progress update
     if test_id:
@@ -3087,6 +8991,11 @@ def run_batch_sat_tests(satlib_benchmark, problem_indices, enable_minisat, enabl
                 (total_problems_solved, len(problem_indices), test_id)
             )
             conn.commit()
+        test_events.publish(test_id, "progress", {
+            "progress_percent": 100,
+            "problems_completed": total_problems_solved,
+            "total_problems": len(problem_indices),
+        })
     
     # Calculate batch summary statistics
     summary = {
@@ -3095,54 +9004,712 @@ def run_batch_sat_tests(satlib_benchmark, problem_indices, enable_minisat, enabl
         "total_runs": sum(len(all_results["solver_results"][s]) for s in all_results["solver_results"]),
         "satlib_benchmark": satlib_benchmark,
         "problem_indices": problem_indices,
-        "solver_comparison": {}
+        "solver_comparison": summarize_solver_results(all_results["solver_results"]),
+        "summary_version": SUMMARY_VERSION
     }
+    instance_tts = summarize_instance_tts(all_results["batch_results"])
+    for solver_name, stats in summary["solver_comparison"].items():
+        stats["problems_solved"] = total_problems_solved
+        stats["instance_tts"] = instance_tts.get(solver_name)
     
-    for solver_name in ["minisat", "walksat", "daedalus"]:
-        if solver_name in all_results["solver_results"] and all_results["solver_results"][solver_name]:
-            results = all_results["solver_results"][solver_name]
-            total_runs = len(results)
-            
-            summary["solver_comparison"][solver_name] = {
-                "avg_solve_time_ms": total_solve_time[solver_name] / total_runs if total_runs > 0 else 0,
-                "avg_energy_nj": total_energy[solver_name] / total_runs if total_runs > 0 else 0,
-                "success_rate": total_success[solver_name] / total_runs if total_runs > 0 else 0,
-                "total_runs": total_runs,
-                "problems_solved": total_problems_solved
-            }
+    summary["energy_breakdown"] = summarize_energy(all_results["solver_results"])
+
+    if enable_daedalus:
+        summary["hardware_offload"] = summarize_offload(all_results["batch_results"])
+
+    if scheduler:
+        summary["board_assignment"] = scheduler.summary()
+
+    if fault_injection_enabled(solver_config):
+        summary["fault_injection"] = summarize_fault_injection(all_results["batch_results"], solver_config)
+
+    summary["known_answer_check"] = summarize_known_answers([
+        (p["problem_index"], p["known_answer"]) for p in all_results["batch_results"] if "known_answer" in p
+    ])
+    if summary["known_answer_check"]["contradictions"]:
+        logger.warning(
+            f"{len(summary['known_answer_check']['contradictions'])} solver results contradict known answers "
+            f"in {satlib_benchmark}"
+        )
+
+    summary["regression_check"] = compare_to_reference(satlib_benchmark, summary)
+    if summary["regression_check"]["regressions"]:
+        logger.warning(f"Regressions against {satlib_benchmark} reference: {summary['regression_check']['regressions']}")
+
+    summary["anomalies"] = detect_batch_anomalies(
+        satlib_benchmark, all_results["solver_results"], summary["solver_comparison"], test_id
+    )
+    if summary["anomalies"]["flags"]:
+        logger.warning(
+            f"Batch {test_id} flagged: {', '.join(flag['type'] for flag in summary['anomalies']['flags'])}"
+        )
+
+    if tenant:
+        summary["solve_budget_exhausted"] = solve_budget_exhausted
+    if time_budget_seconds:
+        summary["time_budget"] = {
+            "budget_seconds": time_budget_seconds,
+            "elapsed_seconds": time.time() - batch_start,
+            "budget_exhausted": budget_exhausted,
+            "problems_available": len(problem_indices),
+            "problems_attempted": problems_attempted,
+            "problems_completed": total_problems_solved,
+            "coverage": total_problems_solved / len(problem_indices) if problem_indices else 0,
+            "completed_indices": [p["problem_index"] for p in all_results["batch_results"]],
+        }
     
     all_results["summary"] = summary
+    active_batch_results.pop(test_id, None)
     
     logger.info(f"Batch SAT test completed: {total_problems_solved} problems, {summary['total_runs']} total runs")
     return all_results
 
+# ------------------------------ Known Answers --------------------------------
+# Solvers whose UNSAT is a proof rather than giving up
+COMPLETE_SOLVERS = {"minisat", "cube_and_conquer"}
+
+# SATLIB family prefixes and the status every instance in the family has
+SATLIB_FAMILY_STATUS = [
+    ("uuf", "UNSAT"), ("uf", "SAT"), ("flat", "SAT"), ("sw", "SAT"),
+    ("hole", "UNSAT"), ("dubois", "UNSAT"), ("pret", "UNSAT"),
+]
+
+def satlib_family_status(name):
+    name = name.lower()
+    if name.startswith("aim"):
+        return "SAT" if "yes" in name else "UNSAT" if "no" in name else None
+    for prefix, status in SATLIB_FAMILY_STATUS:
+        if name.startswith(prefix):
+            return status
+    return None
+
+def instance_hash(dimacs_cnf):
+    """Hash of the clause set, independent of comments and clause or literal order"""
+    num_vars, clauses = parse_dimacs(dimacs_cnf)
+    normalized = sorted(tuple(sorted(set(clause))) for clause in clauses)
+    text = f"{num_vars}|" + ";".join(" ".join(map(str, clause)) for clause in normalized)
+    return hashlib.sha256(text.encode()).hexdigest()
+
+def safe_instance_hash(dimacs_cnf):
+    """instance_hash, or None for text that doesn't parse as DIMACS"""
+    try:
+        return instance_hash(dimacs_cnf)
+    except DimacsParseError:
+        return None
+
+def store_known_answers(entries):
+    """Upsert (instance_hash, status, source, label) tuples"""
+    with get_db() as conn:
+        conn.executemany(
+            """
+            INSERT INTO sat_known_answers (instance_hash, status, source, label, imported)
+            VALUES (?, ?, ?, ?, ?)
+            ON CONFLICT (instance_hash) DO UPDATE SET
+                status = excluded.status, source = excluded.source,
+                label = excluded.label, imported = excluded.imported
+        """,
+            [(h, status, source, label, utc_now()) for h, status, source, label in entries],
+        )
+        conn.commit()
+    return len(entries)
+
+def record_generated_known_answer(dimacs_cnf, label):
+    """Record the "c Expected:" status a generator wrote into an instance, keeping any imported answer"""
+    match = re.search(r"^c Expected: (SAT|UNSAT)\s*$", dimacs_cnf, re.MULTILINE)
+    if not match:
+        return
+    with get_db() as conn:
+        conn.execute(
+            """
+            INSERT INTO sat_known_answers (instance_hash, status, source, label, imported)
+            VALUES (?, ?, 'generator', ?, ?)
+            ON CONFLICT (instance_hash) DO NOTHING
+        """,
+            (instance_hash(dimacs_cnf), match.group(1), label, utc_now()),
+        )
+        conn.commit()
+
+def import_preset_known_answers(presets=None):
+    """Record the SATLIB status of every file in presets whose family has a known status"""
+    counts = {}
+    for preset in presets or preset_diagnostics()["presets"]:
+        preset_dir = SAT_PRESETS_DIR / preset
+        entries = []
+        for path in sorted(preset_dir.glob("*.cnf")):
+            status = satlib_family_status(preset) or satlib_family_status(path.name)
+            if status:
+                entries.append((instance_hash(path.read_text()), status, "satlib", f"{preset}/{path.name}"))
+        counts[preset] = store_known_answers(entries)
+    return counts
+
+def lookup_known_answer(hash_value):
+    with get_db() as conn:
+        return dict_from_row(conn.execute(
+            "SELECT * FROM sat_known_answers WHERE instance_hash = ?", (hash_value,)
+        ).fetchone())
+
+def check_known_answer(dimacs_cnf, solver_results):
+    """Compare every run's verdict with the instance's known status"""
+    hash_value = instance_hash(dimacs_cnf)
+    known = lookup_known_answer(hash_value)
+    check = {
+        "instance_hash": hash_value,
+        "known_status": known["status"] if known else None,
+        "source": known["source"] if known else None,
+        "contradictions": [],
+    }
+    if not known:
+        return check
+
+    for solver, runs in solver_results.items():
+        for run in runs:
+            if run.get("cancelled"):
+                continue
+            # SAT on an UNSAT instance is always wrong; UNSAT on a SAT instance only counts from complete solvers
+            if run.get("satisfiable") and known["status"] == "UNSAT":
+                reported = "SAT"
+            elif not run.get("satisfiable") and known["status"] == "SAT" and solver in COMPLETE_SOLVERS:
+                reported = "UNSAT"
+            else:
+                continue
+            check["contradictions"].append({
+                "solver": solver, "iteration": run.get("iteration"),
+                "expected": known["status"], "reported": reported,
+            })
+    return check
+
+def summarize_known_answers(checks):
+    """Roll per-problem checks up into a summary; checks are (problem_index, check) pairs"""
+    contradictions = [
+        dict(contradiction, problem_index=problem_index)
+        for problem_index, check in checks for contradiction in check["contradictions"]
+    ]
+    known = sum(1 for _, check in checks if check["known_status"])
+    return {
+        "status": "contradiction" if contradictions else "consistent" if known else "unknown",
+        "problems_with_known_answer": known,
+        "problems_without_known_answer": len(checks) - known,
+        "contradictions": contradictions,
+    }
+
+# ------------------------------ Batch Anomaly Detection ----------------------
+ANOMALY_MIN_HISTORY = int(os.getenv("ANOMALY_MIN_HISTORY", 3))
+ANOMALY_SUCCESS_DROP = float(os.getenv("ANOMALY_SUCCESS_DROP", 0.2))
+ANOMALY_MIN_RUNS = int(os.getenv("ANOMALY_MIN_RUNS", 10))
+# A bimodality coefficient above 5/9 is what a uniform distribution scores
+ANOMALY_BIMODALITY_THRESHOLD = float(os.getenv("ANOMALY_BIMODALITY_THRESHOLD", 0.555))
+# Power the DAEDALUS board can plausibly draw while solving
+DAEDALUS_POWER_ENVELOPE_MW = (
+    float(os.getenv("DAEDALUS_POWER_MIN_MW", 0.5)), float(os.getenv("DAEDALUS_POWER_MAX_MW", 100.0))
+)
+
+def historical_success_rates(preset, exclude_test_id=None):
+    """Per-solver success rates of earlier completed batches on the same preset"""
+    with get_db() as conn:
+        cursor = conn.execute(
+            """
+            SELECT id, json_extract(metadata, '$.summary.solver_comparison') AS comparison FROM tests
+            WHERE chip_type = 'SAT' AND status = 'completed'
+              AND json_extract(metadata, '$.summary.satlib_benchmark') = ?
+        """,
+            (preset,),
+        )
+        rows = [dict_from_row(row) for row in cursor]
+
+    history = defaultdict(list)
+    for row in rows:
+        if row["id"] == exclude_test_id or not row["comparison"]:
+            continue
+        for solver, stats in json.loads(row["comparison"]).items():
+            history[solver].append(stats["success_rate"])
+    return history
+
+def bimodality_coefficient(values):
+    """Sarle's bimodality coefficient; None when there are too few values or no spread"""
+    n = len(values)
+    if n < 4:
+        return None
+    mean = sum(values) / n
+    m2 = sum((v - mean) ** 2 for v in values) / n
+    if m2 == 0:
+        return None
+    g1 = (sum((v - mean) ** 3 for v in values) / n) / m2 ** 1.5
+    g2 = (sum((v - mean) ** 4 for v in values) / n) / m2 ** 2 - 3
+    # Sample-size corrected skewness and excess kurtosis
+    skew = g1 * math.sqrt(n * (n - 1)) / (n - 2)
+    excess_kurtosis = ((n + 1) * g2 + 6) * (n - 1) / ((n - 2) * (n - 3))
+    return (skew ** 2 + 1) / (excess_kurtosis + 3 * (n - 1) ** 2 / ((n - 2) * (n - 3)))
+
+def detect_batch_anomalies(preset, solver_results, comparison, exclude_test_id=None):
+    """Flag a batch whose numbers look wrong before it feeds into aggregate analyses"""
+    flags = []
+
+    history = historical_success_rates(preset, exclude_test_id)
+    for solver, stats in comparison.items():
+        rates = history.get(solver, [])
+        if len(rates) < ANOMALY_MIN_HISTORY:
+            continue
+        baseline = sum(rates) / len(rates)
+        if stats["success_rate"] < baseline - ANOMALY_SUCCESS_DROP:
+            flags.append({
+                "type": "success_rate_drop",
+                "solver": solver,
+                "success_rate": stats["success_rate"],
+                "baseline": baseline,
+                "history": len(rates),
+            })
+
+    for solver, runs in solver_results.items():
+        times = [r["solve_time_ms"] for r in runs if r.get("success") and r.get("solve_time_ms")]
+        if len(times) >= ANOMALY_MIN_RUNS:
+            # Log scale: TTS is heavy-tailed, and two clusters show up as two humps in log space
+            coefficient = bimodality_coefficient([math.log(t) for t in times])
+            if coefficient is not None and coefficient > ANOMALY_BIMODALITY_THRESHOLD:
+                flags.append({"type": "bimodal_tts", "solver": solver, "bimodality_coefficient": coefficient})
+
+    low, high = DAEDALUS_POWER_ENVELOPE_MW
+    outside = [
+        r for r in solver_results.get("daedalus", [])
+        if r.get("energy_nj", 0) < 0 or ("power_mw" in r and not low <= r["power_mw"] <= high)
+    ]
+    if outside:
+        flags.append({
+            "type": "energy_out_of_envelope",
+            "solver": "daedalus",
+            "runs": len(outside),
+            "envelope_mw": [low, high],
+            "observed_mw": sorted({r.get("power_mw") for r in outside if r.get("power_mw") is not None}),
+        })
+
+    return {"status": "anomalous" if flags else "ok", "flags": flags}
+
+# ------------------------------ SAT Regression References --------------------
+REGRESSION_SUCCESS_TOLERANCE = float(os.getenv("REGRESSION_SUCCESS_TOLERANCE", 0.05))
+REGRESSION_TTS_TOLERANCE = float(os.getenv("REGRESSION_TTS_TOLERANCE", 0.25))
+
+def reference_from_results(all_results):
+    """Per-solver reference envelope (success rate, mean and p95 TTS) from batch results"""
+    references = {}
+    for solver, runs in all_results.get("solver_results", {}).items():
+        if not runs:
+            continue
+        times = sorted(r.get("solve_time_ms", 0) for r in runs)
+        references[solver] = {
+            "success_rate": sum(1 for r in runs if r.get("success")) / len(runs),
+            "tts_mean_ms": sum(times) / len(times),
+            "tts_p95_ms": times[min(int(0.95 * len(times)), len(times) - 1)],
+            "total_runs": len(runs),
+        }
+    return references
+
+def get_preset_references(preset):
+    with get_db() as conn:
+        cursor = conn.execute("SELECT * FROM sat_references WHERE preset = ?", (preset,))
+        return {row["solver"]: dict_from_row(row) for row in cursor}
+
+def compare_to_reference(preset, summary):
+    """Flag solvers whose success rate or TTS fell outside the preset's reference envelope"""
+    references = get_preset_references(preset)
+    if not references:
+        return {"status": "no_reference", "solvers": {}, "regressions": []}
+
+    solvers = {}
+    regressions = []
+    for solver, stats in summary.get("solver_comparison", {}).items():
+        reference = references.get(solver)
+        if not reference:
+            continue
+
+        checks = {
+            "success_rate": stats["success_rate"],
+            "reference_success_rate": reference["success_rate"],
+            "avg_solve_time_ms": stats["avg_solve_time_ms"],
+            "reference_tts_mean_ms": reference["tts_mean_ms"],
+            "issues": [],
+        }
+        if stats["success_rate"] < reference["success_rate"] - REGRESSION_SUCCESS_TOLERANCE:
+            checks["issues"].append("success_rate")
+        if stats["avg_solve_time_ms"] > reference["tts_mean_ms"] * (1 + REGRESSION_TTS_TOLERANCE):
+            checks["issues"].append("tts")
+        solvers[solver] = checks
+        regressions.extend(f"{solver}:{issue}" for issue in checks["issues"])
+
+    return {
+        "status": "regression" if regressions else "pass",
+        "solvers": solvers,
+        "regressions": regressions,
+        "tolerances": {"success_rate": REGRESSION_SUCCESS_TOLERANCE, "tts": REGRESSION_TTS_TOLERANCE},
+    }
+
+# ------------------------------ Simulation Calibration -----------------------
+SIM_CORRELATION_PATH = MODELS_DIR / "sim_correlation.json"
+
+def stored_instance(problem):
+    """Hash and size of the instance a batch problem was solved on, as recorded when it ran
+
+    Results from before sizes were recorded fall back to the known-answer hash; None if neither is there.
+    """
+    if problem.get("instance"):
+        return problem["instance"]
+    hash_value = (problem.get("known_answer") or {}).get("instance_hash")
+    return {"hash": hash_value, "num_variables": None, "num_clauses": None} if hash_value else None
+
+def iter_test_problems(bundle):
+    """Yield (instance_hash, label, solver_results) for every problem stored with a test"""
+    config = bundle["test"]["config"]
+    for result in bundle["results"]:
+        results = result["results"]
+        if "batch_results" in results:
+            for problem in results["batch_results"]:
+                instance = stored_instance(problem)
+                if not instance:
+                    continue
+                label = f"{problem['satlib_benchmark']}#{problem['problem_index']}"
+                yield instance["hash"], label, problem.get("solver_results", {})
+        elif config.get("dimacs"):
+            yield instance_hash(config["dimacs"]), "custom", results.get("solver_results", {})
+
+def chip_time_ms(run, simulated):
+    """Time the run took (or would take) on the chip itself, not on the host"""
+    if simulated:
+        return run["simulated_time_ns"] / 1e6 if run.get("simulated_time_ns") is not None else None
+    return run.get("solve_time_ms")
+
+def _instance_stats(runs, simulated):
+    solved = [run for run in runs if run.get("satisfiable")]
+    times = [chip_time_ms(run, simulated) for run in solved]
+    times = [t for t in times if t is not None]
+    return {
+        "runs": len(runs),
+        "success_rate": len(solved) / len(runs),
+        "tts_ms": sum(times) / len(times) if times else None,
+    }
+
+def _quantile(sorted_values, q):
+    return sorted_values[min(int(q * len(sorted_values)), len(sorted_values) - 1)]
+
+def _pearson(xs, ys):
+    n = len(xs)
+    if n < 2:
+        return None
+    mean_x, mean_y = sum(xs) / n, sum(ys) / n
+    cov = sum((x - mean_x) * (y - mean_y) for x, y in zip(xs, ys))
+    var_x = sum((x - mean_x) ** 2 for x in xs)
+    var_y = sum((y - mean_y) ** 2 for y in ys)
+    if var_x == 0 or var_y == 0:
+        return None
+    return cov / math.sqrt(var_x * var_y)
+
+def sim_silicon_correlation(test_ids, simulator="oscillator", hardware="daedalus"):
+    """Pair simulator and hardware runs of the same instances across an experiment's tests
+
+    Instances are matched by content hash, so a simulator batch and a hardware batch of the
+    same preset pair up even when they ran as separate tests. TTS is compared in chip time.
+    """
+    sim_runs, hw_runs, labels, missing = defaultdict(list), defaultdict(list), {}, []
+    for test_id in test_ids:
+        bundle = load_result_bundle(test_id)
+        if not bundle:
+            missing.append(test_id)
+            continue
+        for hash_value, label, solver_results in iter_test_problems(bundle):
+            labels.setdefault(hash_value, label)
+            sim_runs[hash_value].extend(solver_results.get(simulator, []))
+            hw_runs[hash_value].extend(solver_results.get(hardware, []))
+
+    instances = []
+    for hash_value in sorted(set(sim_runs) & set(hw_runs), key=lambda h: labels[h]):
+        if not sim_runs[hash_value] or not hw_runs[hash_value]:
+            continue
+        sim = _instance_stats(sim_runs[hash_value], simulated=True)
+        hw = _instance_stats(hw_runs[hash_value], simulated=False)
+        ratio = hw["tts_ms"] / sim["tts_ms"] if hw["tts_ms"] and sim["tts_ms"] else None
+        instances.append({
+            "instance_hash": hash_value,
+            "label": labels[hash_value],
+            "simulator": sim,
+            "hardware": hw,
+            "tts_ratio": ratio,
+            "success_rate_gap": hw["success_rate"] - sim["success_rate"],
+        })
+
+    report = {
+        "generated_at": utc_now(),
+        "test_ids": list(test_ids),
+        "missing_tests": missing,
+        "simulator": simulator,
+        "hardware": hardware,
+        "paired_instances": len(instances),
+        "instances": instances,
+    }
+    if not instances:
+        return report
+
+    gaps = [i["success_rate_gap"] for i in instances]
+    report["success_rate"] = {
+        "simulator": sum(i["simulator"]["success_rate"] for i in instances) / len(instances),
+        "hardware": sum(i["hardware"]["success_rate"] for i in instances) / len(instances),
+        "mean_gap": sum(gaps) / len(gaps),
+        "max_abs_gap": max(abs(g) for g in gaps),
+    }
+
+    ratios = sorted(i["tts_ratio"] for i in instances if i["tts_ratio"])
+    if ratios:
+        log_ratios = [math.log(r) for r in ratios]
+        mean_log = sum(log_ratios) / len(log_ratios)
+        timed = [i for i in instances if i["tts_ratio"]]
+        report["tts_ratio"] = {
+            "count": len(ratios),
+            # Geometric mean is the multiplicative bias: hardware TTS ~= bias * simulated TTS
+            "geometric_mean": math.exp(mean_log),
+            "median": _quantile(ratios, 0.5),
+            "p05": _quantile(ratios, 0.05),
+            "p95": _quantile(ratios, 0.95),
+            "min": ratios[0],
+            "max": ratios[-1],
+            "log_stddev": math.sqrt(sum((x - mean_log) ** 2 for x in log_ratios) / len(log_ratios)),
+            "log_tts_correlation": _pearson(
+                [math.log(i["simulator"]["tts_ms"]) for i in timed],
+                [math.log(i["hardware"]["tts_ms"]) for i in timed],
+            ),
+        }
+    return report
+
+def load_sim_correlation():
+    """Most recent stored simulation-vs-silicon report, if any"""
+    if not SIM_CORRELATION_PATH.exists():
+        return None
+    try:
+        return json.loads(SIM_CORRELATION_PATH.read_text())
+    except Exception as e:
+        logger.error(f"Failed to load simulation correlation report: {e}")
+        return None
+
+def save_sim_correlation(report):
+    MODELS_DIR.mkdir(parents=True, exist_ok=True)
+    SIM_CORRELATION_PATH.write_text(json.dumps(report, indent=2))
+
+# ------------------------------ Remote Instances -----------------------------
+import http.client
+import ipaddress
+import urllib.error
+import urllib.parse
+import urllib.request
+
+# Single-instance solves may name an http(s) URL (SATLIB, lab object storage) instead of sending the text
+URL_FETCH_MAX_BYTES = int(os.getenv("URL_FETCH_MAX_BYTES", 16 * 1024 * 1024))  # downloaded and decompressed
+URL_FETCH_TIMEOUT_SECONDS = float(os.getenv("URL_FETCH_TIMEOUT_SECONDS", 30))  # whole download, not per read
+# Comma-separated hosts instances may come from; empty allows any public host
+URL_FETCH_ALLOWED_HOSTS = {
+    host.strip().lower() for host in os.getenv("URL_FETCH_ALLOWED_HOSTS", "").split(",") if host.strip()
+}
+# Off by default so requests can't make the server probe its own network
+URL_FETCH_ALLOW_PRIVATE = os.getenv("URL_FETCH_ALLOW_PRIVATE", "false").lower() == "true"
+
+class InstanceFetchError(Exception):
+    """A remote instance could not be fetched or failed verification"""
+
+    def __init__(self, message, status=400, code=None):
+        super().__init__(message)
+        self.status = status
+        self.code = code
+
+def check_fetch_url(url):
+    """Refuse non-http(s) URLs and hosts outside the allowlist; addresses are checked when connecting"""
+    parsed = urllib.parse.urlparse(url)
+    if parsed.scheme not in ("http", "https") or not parsed.hostname:
+        raise InstanceFetchError("dimacs_url must be an http or https URL")
+    host = parsed.hostname.lower()
+    if URL_FETCH_ALLOWED_HOSTS and host not in URL_FETCH_ALLOWED_HOSTS:
+        raise InstanceFetchError(f"{host} is not an allowed instance host", 403, "host_not_allowed")
+
+def checked_address(host, port):
+    """Resolve a host once and return the address to connect to, refusing non-public ones unless allowed"""
+    try:
+        addresses = [info[4][0] for info in socket.getaddrinfo(host, port, proto=socket.IPPROTO_TCP)]
+    except socket.gaierror as e:
+        raise InstanceFetchError(f"Cannot resolve {host}: {e}", 502, "instance_fetch_failed")
+    if not URL_FETCH_ALLOW_PRIVATE and any(not ipaddress.ip_address(a.split("%")[0]).is_global for a in addresses):
+        raise InstanceFetchError(f"{host} resolves to a non-public address", 403, "host_not_allowed")
+    return addresses[0]
+
+def pinned_connection(connection_class):
+    """An http.client connection that connects to the address it checked, so DNS can't change in between"""
+
+    class PinnedConnection(connection_class):
+        def __init__(self, *args, **kwargs):
+            super().__init__(*args, **kwargs)
+            # TLS still verifies against self.host; only the TCP connect uses the pinned address
+            self._create_connection = lambda address, *rest: socket.create_connection(
+                (checked_address(self.host, address[1]), address[1]), *rest
+            )
+
+    return PinnedConnection
+
+class PinnedHTTPHandler(urllib.request.HTTPHandler):
+    def http_open(self, req):
+        return self.do_open(pinned_connection(http.client.HTTPConnection), req)
+
+class PinnedHTTPSHandler(urllib.request.HTTPSHandler):
+    def https_open(self, req):
+        return self.do_open(pinned_connection(http.client.HTTPSConnection), req, context=self._context)
+
+class CheckedRedirectHandler(urllib.request.HTTPRedirectHandler):
+    """Apply the URL checks to every redirect hop, not just the first request"""
+
+    def redirect_request(self, req, fp, code, msg, headers, newurl):
+        check_fetch_url(newurl)
+        return super().redirect_request(req, fp, code, msg, headers, newurl)
+
+def fetch_instance(url, sha256=None):
+    """Download a DIMACS instance (optionally gzipped) and verify its checksum; returns (text, source)"""
+    check_fetch_url(url)
+    opener = urllib.request.build_opener(PinnedHTTPHandler, PinnedHTTPSHandler, CheckedRedirectHandler)
+    fetch_request = urllib.request.Request(url, headers={"User-Agent": f"dacroq-api/{API_VERSION}"})
+    deadline = time.monotonic() + URL_FETCH_TIMEOUT_SECONDS
+    chunks, size = [], 0
+    try:
+        with opener.open(fetch_request, timeout=URL_FETCH_TIMEOUT_SECONDS) as response:
+            length = response.headers.get("Content-Length")
+            if length and length.isdigit() and int(length) > URL_FETCH_MAX_BYTES:
+                raise InstanceFetchError(f"Instance is larger than {URL_FETCH_MAX_BYTES} bytes", 413)
+            while True:
+                # read1 returns whatever one socket read brings, so a trickling server can't outlast the deadline
+                chunk = response.read1(64 * 1024)
+                if not chunk:
+                    break
+                size += len(chunk)
+                if size > URL_FETCH_MAX_BYTES:
+                    raise InstanceFetchError(f"Instance is larger than {URL_FETCH_MAX_BYTES} bytes", 413)
+                if time.monotonic() > deadline:
+                    raise TimeoutError()
+                chunks.append(chunk)
+    except urllib.error.HTTPError as e:
+        raise InstanceFetchError(f"Fetching {url} returned HTTP {e.code}", 502, "instance_fetch_failed")
+    except (TimeoutError, socket.timeout):
+        raise InstanceFetchError(f"Fetching {url} took longer than {URL_FETCH_TIMEOUT_SECONDS}s", 504)
+    except urllib.error.URLError as e:
+        if isinstance(e.reason, (TimeoutError, socket.timeout)):
+            raise InstanceFetchError(f"Fetching {url} took longer than {URL_FETCH_TIMEOUT_SECONDS}s", 504)
+        raise InstanceFetchError(f"Could not fetch {url}: {e.reason}", 502, "instance_fetch_failed")
+    body = b"".join(chunks)
+
+    digest = hashlib.sha256(body).hexdigest()
+    if sha256 and digest != sha256.lower():
+        raise InstanceFetchError(f"Checksum mismatch: expected {sha256.lower()}, got {digest}", 400, "checksum_mismatch")
+    if body[:2] == b"\x1f\x8b":
+        decompressor = zlib.decompressobj(16 + zlib.MAX_WBITS)
+        try:
+            body = decompressor.decompress(body, URL_FETCH_MAX_BYTES + 1)
+        except zlib.error as e:
+            raise InstanceFetchError(f"Corrupt gzip data: {e}", 400, "parse_error")
+        if len(body) > URL_FETCH_MAX_BYTES or decompressor.unconsumed_tail:
+            raise InstanceFetchError(f"Instance is larger than {URL_FETCH_MAX_BYTES} bytes uncompressed", 413)
+    try:
+        text = body.decode("utf-8")
+        num_vars, clauses = parse_dimacs(text)
+    except (UnicodeDecodeError, ValueError, IndexError) as e:
+        raise InstanceFetchError(f"Invalid DIMACS: {e}", 400, "parse_error")
+    if not num_vars or not clauses:
+        raise InstanceFetchError("Invalid DIMACS: no 'p cnf' header or no clauses", 400, "parse_error")
+
+    logger.info(f"Fetched {size} byte instance from {url}")
+    return text, {"url": url, "sha256": digest, "bytes": size, "verified": bool(sha256), "fetched": utc_now()}
+
 # ------------------------------ SAT Routes -----------------------------------
-def run_test_async(test_id, batch_mode, data, enable_minisat, enable_walksat, enable_daedalus, num_iterations):
+# Generated families have no fixed size; a budgeted batch without explicit indices draws from this many
+TIME_BUDGET_DEFAULT_POOL = 1000
+
+def run_test_async(test_id, batch_mode, data, enable_minisat, enable_walksat, enable_daedalus, num_iterations, checkpoint=None):
     """Run test asynchronously in background thread"""
+    started = time.time()
     try:
         logger.info(f"Starting async test execution for test_id: {test_id}")
+        test_events.publish(test_id, "resumed" if checkpoint else "started", {"batch_mode": batch_mode})
+
+        # Taken before any instance is read so edits made mid-run can't go unnoticed
+        preset_reference = preset_content_reference(data["satlib_benchmark"]) if batch_mode else None
+
+        reservation = None
+        if enable_daedalus or data.get("race_software_solver"):
+            reservation = acquire_reservation_slot(
+                data.get("user"), (data.get("solver_config") or {}).get("device_id"),
+                data.get("reservation_fallback", RESERVATION_FALLBACK)
+            )
+            if reservation["decision"] == "simulated":
+                # Someone else holds the chip: run the same job on the simulated accelerator instead
+                logger.info(f"Test {test_id}: hardware reserved by {reservation['reserved_by']}, using simulator")
+                enable_daedalus = False
+                data = dict(data, race_software_solver=None, enable_oscillator=True)
         
         if batch_mode:
+            problem_indices = data["problem_indices"]
+            batch_started = time.time()
+            order_by = data.get("order_by", "index")
+            if order_by in ("difficulty", "difficulty_desc") and not checkpoint:
+                time_budget = data.get("time_budget_seconds")
+                problem_indices = order_problems_by_difficulty(
+                    data["satlib_benchmark"], problem_indices,
+                    hardest_first=order_by == "difficulty_desc",
+                    deadline=batch_started + time_budget if time_budget else None
+                )
+
             all_results = run_batch_sat_tests(
                 data["satlib_benchmark"],
-                data["problem_indices"],
+                problem_indices,
                 enable_minisat,
                 enable_walksat,
                 enable_daedalus,
                 num_iterations,
-                test_id  # Pass test_id for progress tracking
+                test_id,  # Pass test_id for progress tracking
+                enable_cube=data.get("enable_cube_and_conquer", False),
+                enable_oscillator=data.get("enable_oscillator", False),
+                time_budget_seconds=data.get("time_budget_seconds"),
+                race_solver=data.get("race_software_solver"),
+                checkpoint=checkpoint,
+                solver_config=data.get("solver_config"),
+                enable_ising=data.get("enable_ising", False),
+                use_cache=not data.get("bypass_cache", False),
+                reuse_cached_timings=data.get("reuse_cached_timings", False),
+                tenant=data.get("tenant"),
+                reservation=reservation,
+                reservation_fallback=data.get("reservation_fallback", RESERVATION_FALLBACK),
+                started_at=batch_started
             )
         else:
-            all_results = run_single_sat_test(
+            all_results = cached_single_sat_test(
                 data["dimacs"],
                 enable_minisat,
                 enable_walksat,
                 enable_daedalus,
-                num_iterations
+                num_iterations,
+                enable_cube=data.get("enable_cube_and_conquer", False),
+                enable_oscillator=data.get("enable_oscillator", False),
+                race_solver=data.get("race_software_solver"),
+                solver_config=data.get("solver_config"),
+                enable_ising=data.get("enable_ising", False),
+                use_cache=not data.get("bypass_cache", False)
             )
         
         # Calculate summary from results
         summary = all_results.get("summary", {})
+        if batch_mode and data.get("weights"):
+            summary["weighted"] = summarize_weighted(all_results["batch_results"], data["weights"])
+        if reservation:
+            all_results["reservation"] = reservation
+        provenance = load_preset_provenance(data["satlib_benchmark"]) if batch_mode else None
+        if provenance:
+            all_results["preset_provenance"] = provenance
+        if preset_reference:
+            all_results["preset_snapshot"] = preset_reference
+        all_results["runs_stored"] = record_job_runs(test_id, data, all_results, batch_mode)
+        try:
+            write_solution_artifacts(test_id, all_results)
+        except Exception as e:
+            logger.warning(f"Could not write solution files for {test_id}: {e}")
+            all_results.pop("solutions", None)
+            for problem in all_results.get("batch_results", []):
+                problem.pop("solutions", None)
 
         # Update test with results
         with get_db() as conn:
@@ -3157,7 +9724,10 @@ def run_test_async(test_id, batch_mode, data, enable_minisat, enable_walksat, en
                     json.dumps({
                         "solver": data.get("solver_type", "minisat"),
                         "batch_mode": batch_mode,
-                        "summary": summary
+                        "summary": summary,
+                        "reservation": reservation,
+                        "preset_provenance": provenance,
+                        "preset_snapshot": preset_reference
                     }),
                     test_id
                 )
@@ -3173,10 +9743,29 @@ def run_test_async(test_id, batch_mode, data, enable_minisat, enable_walksat, en
             )
             conn.commit()
 
+        delete_batch_checkpoint(test_id)
+        try:
+            write_test_artifact(test_id, "results.json", all_results)
+            write_test_artifact(test_id, "summary.json", summary)
+        except Exception as e:
+            logger.warning(f"Could not write artifacts for {test_id}: {e}")
         logger.info(f"Test {test_id} completed successfully")
+        test_events.publish(test_id, "completed", {"summary": summary})
+        write_event_log(test_id)
+
+    except BatchInterrupted as e:
+        logger.warning(f"Test {test_id} interrupted: {e}")
+        active_batch_results.pop(test_id, None)
+        test_events.publish(test_id, "interrupted", {"reason": str(e)})
+        with get_db() as conn:
+            conn.execute("UPDATE tests SET status = 'interrupted' WHERE id = ?", (test_id,))
+            conn.commit()
+        write_event_log(test_id)
 
     except Exception as e:
         logger.error(f"Async test execution failed for {test_id}: {e}")
+        active_batch_results.pop(test_id, None)
+        test_events.publish(test_id, "failed", {"error": str(e)})
         
         # Update test status to failed
         try:
@@ -3186,33 +9775,242 @@ def run_test_async(test_id, batch_mode, data, enable_minisat, enable_walksat, en
                     ("failed", test_id)
                 )
                 conn.commit()
+            write_event_log(test_id)
         except Exception as db_error:
             logger.error(f"Failed to update test status to failed: {db_error}")
 
+    finally:
+        # Batches charge their tenant problem by problem
+        if data.get("tenant") and not batch_mode:
+            try:
+                charge_solve_seconds(data["tenant"], time.time() - started)
+            except Exception as e:
+                logger.error(f"Could not record solve time for tenant {data['tenant']}: {e}")
+
+# Algorithms implied by solver_type when no enable_* flags are sent
+SOLVER_TYPE_FLAGS = {
+    "minisat": {"enable_minisat": True},
+    "walksat": {"enable_walksat": True},
+    "daedalus": {"enable_daedalus": True},
+    "hardware": {"enable_daedalus": True},
+    "cube_and_conquer": {"enable_cube_and_conquer": True},
+    "oscillator": {"enable_oscillator": True},
+    "ising": {"enable_ising": True},
+    "hybrid": {"race_software_solver": "walksat"},
+}
+SOLVER_ENABLE_FIELDS = (
+    "enable_minisat", "enable_walksat", "enable_daedalus", "enable_cube_and_conquer", "enable_oscillator",
+    "enable_ising", "race_software_solver"
+)
+
+# Per-request solver/offload settings: field -> (type, min, max, default)
+SOLVER_CONFIG_FIELDS = {
+    "walksat_max_flips": (int, 1, 10_000_000, 100000),
+    "walksat_noise": (float, 0.0, 1.0, 0.5),
+    # Base seed for repeated runs; iteration i uses seed + i. -1 draws a fresh seed per run, still recorded
+    "walksat_seed": (int, -1, 2**31 - 1, -1),
+    "offload_threshold": (float, 0.0, 1.0, OFFLOAD_THRESHOLD),
+    "max_hardware_variables": (int, 1, DAEDALUS_MAX_VARIABLES, DAEDALUS_MAX_VARIABLES),
+    "min_hardware_success_rate": (float, 0.0, 1.0, 0.5),
+    "oscillator_coupling": (float, 0.0, 100.0, 4.0),
+    "oscillator_noise": (float, 0.0, 10.0, 1.0),
+    "oscillator_shil_strength": (float, 0.0, 10.0, 0.3),
+    "oscillator_steps": (int, 10, 1_000_000, 1000),
+    "ising_sweeps": (int, 1, 1_000_000, 1000),
+    "ising_beta_start": (float, 0.0, 100.0, 0.1),
+    "ising_beta_end": (float, 0.0, 100.0, 5.0),
+    "ising_seed": (int, -1, 2**31 - 1, -1),  # as walksat_seed
+    # Fault injection for reliability studies; all rates default to off
+    "fault_bit_flip_rate": (float, 0.0, 1.0, 0.0),
+    "fault_drop_rate": (float, 0.0, 1.0, 0.0),
+    "fault_latency_spike_rate": (float, 0.0, 1.0, 0.0),
+    "fault_latency_spike_ms": (float, 0.0, 60_000.0, 100.0),
+    "fault_seed": (int, -1, 2**31 - 1, -1),
+    # Wall-clock limit on each software solve (0 = run to completion)
+    "cutoff_seconds": (float, 0.0, 3600.0, 0.0),
+    # Host power model used for energy attribution, e.g. the lab machine's CPU TDP
+    "host_active_power_w": (float, 0.1, 1000.0, HOST_ACTIVE_POWER_W),
+    "host_idle_power_w": (float, 0.0, 1000.0, HOST_IDLE_POWER_W),
+}
+
+def resolve_solver_config(overrides):
+    """Merge request overrides over the defaults; returns (config, errors)"""
+    config = {field: spec[3] for field, spec in SOLVER_CONFIG_FIELDS.items()}
+    errors = []
+    if overrides is None:
+        return config, errors
+    if not isinstance(overrides, dict):
+        return config, ["solver_config must be an object"]
+
+    return config, apply_config_overrides(SOLVER_CONFIG_FIELDS, config, overrides)
+
+def apply_config_overrides(fields, config, overrides):
+    """Validate overrides against a field table and apply the valid ones to config in place"""
+    errors = []
+    for field, value in overrides.items():
+        if field not in fields:
+            errors.append(f"Unknown field: {field}")
+            continue
+        kind, low, high, _ = fields[field]
+        if isinstance(value, bool) or not isinstance(value, (int, float)) or (kind is int and value != int(value)):
+            errors.append(f"{field} must be {'an integer' if kind is int else 'a number'}")
+        elif not low <= value <= high:
+            errors.append(f"{field} must be between {low} and {high}")
+        else:
+            config[field] = kind(value)
+    return errors
+
+def make_software_solver(name, solver_config=None, stop_event=None, seed=None):
+    """Instantiate a software solver with the request's settings applied"""
+    solver_config = solver_config or resolve_solver_config(None)[0]
+    if name == "walksat":
+        return WalkSATSolver(
+            max_flips=solver_config["walksat_max_flips"], noise=solver_config["walksat_noise"], stop_event=stop_event,
+            seed=seed,
+        )
+    if name == "ising":
+        return SimulatedIsingAnnealer(
+            sweeps=solver_config["ising_sweeps"],
+            beta_start=solver_config["ising_beta_start"],
+            beta_end=solver_config["ising_beta_end"],
+            stop_event=stop_event,
+            seed=seed,
+        )
+    if name == "oscillator":
+        return OscillatorNetworkSimulator(
+            coupling=solver_config["oscillator_coupling"],
+            noise=solver_config["oscillator_noise"],
+            shil_strength=solver_config["oscillator_shil_strength"],
+            steps=solver_config["oscillator_steps"],
+            stop_event=stop_event,
+            seed=seed,
+        )
+    return RACE_SOFTWARE_SOLVERS[name](stop_event=stop_event)
+
+# Background threads of tests started by this process
+active_test_threads = {}
+# In-flight batch results by test ID, read by streaming clients while the batch runs
+active_batch_results = {}
+
+def mark_interrupted_tests():
+    """Tests left 'running' by a previous process can never finish; flag them"""
+    with get_db() as conn:
+        cursor = conn.execute(
+            "UPDATE tests SET status = 'interrupted' WHERE chip_type = 'SAT' AND status = 'running'"
+        )
+        conn.commit()
+    if cursor.rowcount:
+        logger.warning(f"Marked {cursor.rowcount} SAT tests as interrupted; resume them via /sat/tests/<id>/resume")
+
 @app.route("/sat/solve", methods=["POST"])
 def sat_solve():
     """Solve SAT problem using hardware or software with batch support - ASYNC VERSION"""
+    return start_sat_test(request.get_json())
+
+def start_sat_test(data):
+    """Validate a solve request, record the test and start it in the background"""
     try:
-        data = request.get_json()
-        
         # Check for batch mode
         batch_mode = data.get("batch_mode", False)
         
         # Validate required fields based on mode
         if not data.get("name"):
-            return jsonify({"error": "Missing required field: name"}), 400
+            return error_response("Missing required field: name", 400, "missing_field", {"field": "name"})
+        tenant = current_tenant()
+        if tenant:
+            budget_error = check_solve_budget(tenant)
+            if budget_error:
+                return budget_error
+        data["tenant"] = tenant["name"] if tenant else None
+        data["user"] = reservation_owner(data)
             
         if batch_mode:
             # Batch mode validation
-            if not data.get("satlib_benchmark") or not data.get("problem_indices"):
-                return jsonify({"error": "Batch mode requires satlib_benchmark and problem_indices"}), 400
+            time_budget = data.get("time_budget_seconds")
+            if not data.get("satlib_benchmark") or not (data.get("problem_indices") or time_budget):
+                return error_response("Batch mode requires satlib_benchmark and problem_indices or time_budget_seconds", 400)
+            if time_budget is not None:
+                if isinstance(time_budget, bool) or not isinstance(time_budget, (int, float)) or time_budget <= 0:
+                    return error_response("time_budget_seconds must be a positive number", 400)
+                # Without an explicit range the scheduler may pick from the whole benchmark family
+                data.setdefault("problem_indices", list(range(1, TIME_BUDGET_DEFAULT_POOL + 1)))
+            if data.get("order_by", "index") not in ("index", "difficulty", "difficulty_desc"):
+                return error_response("order_by must be one of: index, difficulty, difficulty_desc", 400)
+        elif data.get("dimacs_upload"):
+            if data.get("dimacs") or data.get("dimacs_url"):
+                return error_response("Send only one of dimacs, dimacs_url or dimacs_upload", 400)
+            path = resolve_upload_file(str(data["dimacs_upload"]))
+            if not path:
+                return error_response("Upload file not found", 404, details={"dimacs_upload": data["dimacs_upload"]})
+            opener = gzip.open if str(data["dimacs_upload"]).endswith(".gz") else open
+            with opener(path, "rt", errors="replace") as f:
+                data["dimacs"] = f.read()
+            # The object name is the content hash, so runs can be joined back to the exact bytes uploaded
+            data["dimacs_source"] = {"upload": data["dimacs_upload"], "sha256": path.name}
+        elif data.get("dimacs_url"):
+            if data.get("dimacs"):
+                return error_response("Send either dimacs or dimacs_url, not both", 400)
+            try:
+                data["dimacs"], data["dimacs_source"] = fetch_instance(data["dimacs_url"], data.get("dimacs_sha256"))
+            except InstanceFetchError as e:
+                return error_response(str(e), e.status, e.code, {"url": data["dimacs_url"]})
         else:
             # Single mode validation
             if not data.get("dimacs"):
-                return jsonify({"error": "Single mode requires dimacs field"}), 400
+                return error_response("Single mode requires dimacs, dimacs_url or dimacs_upload field", 400)
 
-        test_name = data["name"]
         solver_type = data.get("solver_type", "minisat")
+        if solver_type not in SOLVER_TYPE_FLAGS:
+            return error_response(
+                f"solver_type must be one of: {', '.join(SOLVER_TYPE_FLAGS)}", 400
+            )
+        # Requests that don't pick algorithms explicitly run what solver_type names
+        explicit_fields = [key for key in SOLVER_ENABLE_FIELDS if key in data]
+        if not explicit_fields:
+            data.update(SOLVER_TYPE_FLAGS[solver_type])
+        if "enable_hardware" in data:
+            note_deprecated_field("enable_hardware")
+            if "enable_daedalus" not in explicit_fields:
+                data["enable_daedalus"] = data["enable_hardware"]
+
+        race_solver = data.get("race_software_solver")
+        if race_solver and race_solver not in RACE_SOFTWARE_SOLVERS:
+            return error_response(
+                f"race_software_solver must be one of: {', '.join(RACE_SOFTWARE_SOLVERS)}", 400
+            )
+
+        solver_config, config_errors = resolve_solver_config(data.get("solver_config"))
+        if config_errors:
+            return error_response("Invalid solver_config", 400, details={"errors": config_errors})
+        device_id = data.get("device_id")
+        if device_id == SIMULATOR_DEVICE_ID:
+            # The simulated accelerator stands in for a board: hardware runs go to the oscillator model
+            if data.get("enable_daedalus") or data.get("race_software_solver"):
+                data.update(enable_daedalus=False, race_software_solver=None, enable_oscillator=True)
+        elif device_id:
+            device = hardware_manager.get_device(device_id)
+            if not device or device["device_type"] != "sat":
+                return error_response(f"Unknown DAEDALUS device: {device_id}", 404)
+            if device.get("firmware_supported") is False:
+                return error_response(
+                    f"{device_id} runs unsupported firmware {device['firmware_version']}", 409, "unsupported_firmware",
+                    {"required": MIN_FIRMWARE_VERSIONS["sat"]}
+                )
+        # The target board is part of the effective configuration
+        solver_config["device_id"] = device_id
+        if data.get("enable_oscillator") or data.get("enable_daedalus") or data.get("race_software_solver"):
+            # PATCH /hardware/sat-simulator/config mustn't change a test already running; hardware
+            # tests may be moved to the simulator when someone else's reservation begins
+            solver_config["simulator"] = get_simulator_config()
+        data["solver_config"] = solver_config
+        weights, weight_errors = resolve_instance_weights(data.get("weights"))
+        if weight_errors:
+            return error_response("Invalid weights", 400, details={"errors": weight_errors})
+        data["weights"] = weights
+        if data.get("reservation_fallback", RESERVATION_FALLBACK) not in RESERVATION_FALLBACKS:
+            return error_response(f"reservation_fallback must be one of: {', '.join(RESERVATION_FALLBACKS)}", 400)
+
+        test_name = data["name"]
         enable_minisat = data.get("enable_minisat", False)
         enable_walksat = data.get("enable_walksat", False)
         enable_daedalus = data.get("enable_daedalus", False)
@@ -3228,9 +10026,20 @@ def sat_solve():
             "algorithms": {
                 "minisat": enable_minisat,
                 "walksat": enable_walksat,
-                "daedalus": enable_daedalus
+                "daedalus": enable_daedalus,
+                "cube_and_conquer": data.get("enable_cube_and_conquer", False),
+                "oscillator": data.get("enable_oscillator", False),
+                "ising": data.get("enable_ising", False),
+                "race": data.get("race_software_solver")
             },
-            "iterations": num_iterations
+            # Effective settings after defaults, so the run can be reproduced exactly
+            "solver_config": solver_config,
+            "iterations": num_iterations,
+            "user": data.get("user"),
+            "tenant": data["tenant"],
+            "reservation_fallback": data.get("reservation_fallback", RESERVATION_FALLBACK),
+            "bypass_cache": bool(data.get("bypass_cache", False)),
+            "reuse_cached_timings": bool(data.get("reuse_cached_timings", False))
         }
         
         if batch_mode:
@@ -3238,10 +10047,15 @@ def sat_solve():
                 "batch_mode": True,
                 "satlib_benchmark": data["satlib_benchmark"],
                 "problem_indices": data["problem_indices"],
-                "exclude_indices": data.get("exclude_indices", [])
+                "exclude_indices": data.get("exclude_indices", []),
+                "time_budget_seconds": data.get("time_budget_seconds"),
+                "order_by": data.get("order_by", "index"),
+                "weights": weights
             })
         else:
             config_data["dimacs"] = data["dimacs"]
+            if data.get("dimacs_source"):
+                config_data["dimacs_source"] = data["dimacs_source"]
         
         # Store test in database with "running" status
         with get_db() as conn:
@@ -3276,8 +10090,10 @@ def sat_solve():
         test_thread = threading.Thread(
             target=run_test_async,
             args=(test_id, batch_mode, data, enable_minisat, enable_walksat, enable_daedalus, num_iterations),
-            daemon=True
+            daemon=True,
+            name=test_id  # identifies the test in hardware work queues
         )
+        active_test_threads[test_id] = test_thread
         test_thread.start()
 
         # Return immediately with test_id
@@ -3292,15 +10108,99 @@ def sat_solve():
 
     except Exception as e:
         logger.error(f"SAT solve error: {e}")
-        return jsonify({"error": str(e)}), 500
+        return exception_response(e)
+
+# Solvers /solve-one runs in the request; hardware goes through /sat/solve and its reservations
+SOLVE_ONE_SOLVERS = ("minisat", "walksat", "cube_and_conquer", "oscillator", "ising")
+DIMACS_MIMETYPES = ("text/plain", "application/x-dimacs")
+
+def solve_one_config(args):
+    """solver_config overrides from query parameters; returns (config, errors)"""
+    overrides = {}
+    errors = []
+    for field, (kind, _, _, _) in SOLVER_CONFIG_FIELDS.items():
+        if args.get(field) is None:
+            continue
+        try:
+            overrides[field] = kind(args.get(field))
+        except ValueError:
+            errors.append(f"{field} must be {'an integer' if kind is int else 'a number'}")
+    config, config_errors = resolve_solver_config(overrides)
+    return config, errors + config_errors
+
+@app.route("/solve-one", methods=["POST"])
+def solve_one():
+    """Solve one DIMACS instance sent as the raw request body and return its result"""
+    if request.mimetype not in DIMACS_MIMETYPES:
+        return error_response(
+            f"Send the instance as {' or '.join(DIMACS_MIMETYPES)}", 415, details={"content_type": request.mimetype}
+        )
+    solver = request.args.get("solver", "minisat")
+    if solver not in SOLVE_ONE_SOLVERS:
+        return error_response(f"solver must be one of: {', '.join(SOLVE_ONE_SOLVERS)}", 400)
+    solver_config, config_errors = solve_one_config(request.args)
+    if config_errors:
+        return error_response("Invalid solver_config", 400, details={"errors": config_errors})
+
+    tenant = current_tenant()
+    if tenant:
+        budget_error = check_solve_budget(tenant)
+        if budget_error:
+            return budget_error
+
+    dimacs = request.get_data(as_text=True)
+    try:
+        num_vars, clauses = parse_dimacs(dimacs)
+    except ValueError as e:
+        return dimacs_error_response(e)
+    if not num_vars or not clauses:
+        return error_response("Invalid DIMACS: no 'p cnf' header or no clauses", 400, "parse_error")
+
+    started = time.time()
+    try:
+        flags = SOLVER_TYPE_FLAGS[solver]
+        results = cached_single_sat_test(
+            dimacs, flags.get("enable_minisat", False), flags.get("enable_walksat", False), False, 1,
+            enable_cube=flags.get("enable_cube_and_conquer", False),
+            enable_oscillator=flags.get("enable_oscillator", False),
+            solver_config=solver_config,
+            enable_ising=flags.get("enable_ising", False),
+            use_cache=request.args.get("bypass_cache", "false").lower() != "true",
+        )
+    except Exception as e:
+        logger.error(f"Solve-one error: {e}")
+        return exception_response(e)
+    finally:
+        if tenant:
+            charge_solve_seconds(tenant["name"], time.time() - started)
+
+    try:
+        result_store.record_runs(run_records(
+            None, request.args.get("name", "solve-one"), solver_config, results, tenant["name"] if tenant else None
+        ))
+    except Exception as e:
+        logger.error(f"Could not store solve-one run: {e}")
+    run = results["solver_results"][solver][0]
+    assignment = results.get("solutions", {}).get(solver, [None])[0]
+    return jsonify(dict(
+        run,
+        assignment=assignment,
+        instance_hash=instance_hash(dimacs),
+        variables=num_vars,
+        clauses=len(clauses),
+        known_answer=results.get("known_answer"),
+        solver_config=solver_config,
+        cache=results.get("cache"),
+    ))
 
 @app.route("/sat/tests", methods=["GET"])
 def sat_tests():
     """List SAT tests"""
     try:
         with get_db() as conn:
+            scope, params = tenant_scope_sql()
             cursor = conn.execute(
-                "SELECT * FROM tests WHERE chip_type = 'SAT' ORDER BY created DESC LIMIT 50"
+                f"SELECT * FROM tests WHERE chip_type = 'SAT' AND {scope} ORDER BY created DESC LIMIT 50", params
             )
             tests = [dict_from_row(row) for row in cursor]
 
@@ -3317,7 +10217,7 @@ def sat_tests():
 
     except Exception as e:
         logger.error(f"Error listing SAT tests: {e}")
-        return jsonify({"error": str(e)}), 500
+        return exception_response(e)
 
 @app.route("/sat/tests/<test_id>", methods=["GET"])
 def sat_test_detail(test_id):
@@ -3328,7 +10228,7 @@ def sat_test_detail(test_id):
             test = cursor.fetchone()
 
             if not test:
-                return jsonify({"error": "Test not found"}), 404
+                return error_response("Test not found", 404)
 
             test_data = dict_from_row(test)
 
@@ -3342,6 +10242,11 @@ def sat_test_detail(test_id):
 
             # For running tests, check for real-time progress info
             if test_data.get('status') == 'running':
+                queue_position = hardware_queue_position(test_id)
+                if queue_position:
+                    if not test_data.get('metadata'):
+                        test_data['metadata'] = {}
+                    test_data['metadata']['hardware_queue'] = queue_position
                 progress_file = f"sat_progress_{test_id}.json"
                 if os.path.exists(progress_file):
                     try:
@@ -3373,22 +10278,23 @@ def sat_test_detail(test_id):
 
     except Exception as e:
         logger.error(f"Error getting SAT test {test_id}: {e}")
-        return jsonify({"error": str(e)}), 500
+        return exception_response(e)
 
 @app.route("/sat/test-summaries", methods=["GET"])
 def sat_test_summaries():
     """Get SAT test summaries for comparison"""
     try:
+        scope, params = tenant_scope_sql()
         with get_db() as conn:
-            cursor = conn.execute("""
+            cursor = conn.execute(f"""
                 SELECT id, name, status, created,
                        json_extract(metadata, '$.solver') as solver,
                        json_extract(metadata, '$.satisfiable') as satisfiable,
                        json_extract(metadata, '$.solve_time_ms') as solve_time
                 FROM tests 
-                WHERE chip_type = 'SAT' AND status = 'completed'
+                WHERE chip_type = 'SAT' AND status = 'completed' AND {scope}
                 ORDER BY created DESC
-            """)
+            """, params)
             tests = [dict_from_row(row) for row in cursor]
             
             summaries = []
@@ -3407,7 +10313,1012 @@ def sat_test_summaries():
             
     except Exception as e:
         logger.error(f"Error fetching SAT test summaries: {e}")
-        return jsonify({"error": str(e)}), 500
+        return exception_response(e)
+
+@app.route("/sat/weighted-summary", methods=["POST"])
+def sat_weighted_summary():
+    """Weighted per-solver comparison pooled over the instances of one or more batch tests"""
+    try:
+        data = request.get_json(silent=True) or {}
+        test_ids = data.get("test_ids")
+        if not isinstance(test_ids, list) or not test_ids:
+            return error_response("test_ids must be a non-empty list", 400)
+        weights, errors = resolve_instance_weights(data.get("weights", {}))
+        if errors:
+            return error_response("Invalid weights", 400, details={"errors": errors})
+
+        batch_results, skipped = [], []
+        for test_id in test_ids:
+            bundle = load_result_bundle(test_id)
+            problems = [p for r in bundle["results"] for p in r["results"].get("batch_results", [])] if bundle else []
+            if not problems:
+                skipped.append(test_id)
+            batch_results.extend(problems)
+
+        summary = summarize_weighted(batch_results, weights)
+        summary.update({"test_ids": test_ids, "skipped_tests": skipped, "instances": len(batch_results)})
+        return jsonify(summary)
+
+    except Exception as e:
+        logger.error(f"Weighted summary error: {e}")
+        return exception_response(e)
+
+# ------------------------------ Result Export --------------------------------
+# Keys that identify people, machines or database rows rather than measurements
+ANONYMIZED_KEYS = {
+    "id", "test_id", "request_id", "name", "email", "user_id",
+    "device_id", "port", "serial_number", "identity", "description", "url",
+}
+# Keys whose value names the machine; only these are redacted, so measurements that mention it survive
+HOST_KEYS = {"host", "hostname", "machine", "node"}
+_UUID_PATTERN = re.compile(r"\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b", re.IGNORECASE)
+_PATH_PATTERN = re.compile(r"(?<![\w.])(?:[A-Za-z]:\\|/)(?:[\w.\-]+[/\\])*[\w.\-]+")
+
+def load_result_bundle(test_id):
+    """A SAT test with its stored results, JSON fields decoded"""
+    with get_db() as conn:
+        row = conn.execute("SELECT * FROM tests WHERE id = ? AND chip_type = 'SAT'", (test_id,)).fetchone()
+        if not row:
+            return None
+        test = dict_from_row(row)
+        results = [
+            dict_from_row(r) for r in conn.execute(
+                "SELECT * FROM test_results WHERE test_id = ? ORDER BY timestamp", (test_id,)
+            )
+        ]
+
+    for field in ["config", "metadata"]:
+        test[field] = json.loads(test[field]) if test.get(field) else {}
+    for result in results:
+        result["results"] = json.loads(result["results"]) if result.get("results") else {}
+    return {"test": test, "results": results}
+
+def _scrub_string(value):
+    value = _UUID_PATTERN.sub("<redacted-id>", value)
+    return _PATH_PATTERN.sub("<redacted-path>", value)
+
+def _scrub(value):
+    if isinstance(value, dict):
+        scrubbed = {}
+        for key, item in value.items():
+            if key in ANONYMIZED_KEYS:
+                continue
+            if key in HOST_KEYS and isinstance(item, str):
+                scrubbed[key] = "<redacted-host>"
+                continue
+            if key == "dimacs" and isinstance(item, str):
+                # Comment lines carry provenance (authors, paths); the clauses are what matter
+                item = "\n".join(line for line in item.splitlines() if not line.startswith("c"))
+            scrubbed[key] = _scrub(item)
+        return scrubbed
+    if isinstance(value, list):
+        return [_scrub(item) for item in value]
+    if isinstance(value, str):
+        return _scrub_string(value)
+    return value
+
+def created_day(test):
+    """Day resolution is enough to order experiments; None when the test has no creation time"""
+    return (test.get("created") or "")[:10] or None
+
+def anonymize_bundle(bundle, sample_id):
+    """Strip identifiers, hostnames and paths while keeping every measurement"""
+    anonymized = _scrub(bundle)
+    anonymized["sample_id"] = sample_id
+    anonymized["test"]["created"] = created_day(bundle["test"])
+    for result in anonymized["results"]:
+        result.pop("timestamp", None)
+    return anonymized
+
+@app.route("/sat/tests/<test_id>/export", methods=["GET"])
+def sat_test_export(test_id):
+    """Export a test's full result bundle, optionally anonymized for publication"""
+    try:
+        bundle = load_result_bundle(test_id)
+        if not bundle:
+            return error_response("Test not found", 404)
+        if request.args.get("anonymize", "false").lower() == "true":
+            bundle = anonymize_bundle(bundle, "sample-1")
+        return jsonify(bundle)
+
+    except Exception as e:
+        logger.error(f"Error exporting test {test_id}: {e}")
+        return exception_response(e)
+
+@app.route("/sat/export", methods=["GET"])
+def sat_export():
+    """Export completed SAT tests as one dataset; ?test_id= may be repeated to pick tests"""
+    try:
+        test_ids = request.args.getlist("test_id")
+        tenant = current_tenant()
+        if not test_ids:
+            scope, params = tenant_scope_sql()
+            with get_db() as conn:
+                test_ids = [
+                    row["id"] for row in conn.execute(
+                        f"SELECT id FROM tests WHERE chip_type = 'SAT' AND status = 'completed' AND {scope} ORDER BY created",
+                        params,
+                    )
+                ]
+
+        anonymize = request.args.get("anonymize", "false").lower() == "true"
+        samples = []
+        for test_id in test_ids:
+            bundle = load_result_bundle(test_id) if not tenant or tenant_owns("tests", test_id, tenant) else None
+            if not bundle:
+                return error_response(f"Test not found: {test_id}", 404)
+            samples.append(anonymize_bundle(bundle, f"sample-{len(samples) + 1}") if anonymize else bundle)
+
+        return jsonify({
+            "exported_at": utc_now(),
+            "anonymized": anonymize,
+            "sample_count": len(samples),
+            "samples": samples,
+        })
+
+    except Exception as e:
+        logger.error(f"Error exporting SAT results: {e}")
+        return exception_response(e)
+
+# ------------------------------ Public Datasets ------------------------------
+# Published datasets are plain JSON files plus an index.json, so the directory can also be
+# copied to any static host as-is.
+PUBLISHED_RUN_FIELDS = (
+    "iteration", "satisfiable", "success", "solve_time_ms", "simulated_time_ns",
+    "energy_nj", "power_mw", "energy_source", "steps", "restarts", "propagations",
+)
+
+def _published_instance(fingerprint, family, solver_results, num_variables, num_clauses):
+    """One instance by fingerprint with its per-run timings; the clauses themselves stay private"""
+    return {
+        "fingerprint": fingerprint,
+        "family": family,
+        "num_variables": num_variables,
+        "num_clauses": num_clauses,
+        "runs": {
+            solver: [{field: run[field] for field in PUBLISHED_RUN_FIELDS if field in run} for run in runs]
+            for solver, runs in solver_results.items() if runs
+        },
+    }
+
+def hardware_profile(config, results):
+    """What the measurements were taken on, without naming the machine"""
+    simulator = results.get("simulator_config") or next(
+        (p["simulator_config"] for p in results.get("batch_results", []) if "simulator_config" in p), None
+    )
+    return {
+        "chip": "DAEDALUS",
+        "algorithms": config.get("algorithms", {}),
+        "simulator_config": simulator,
+        "power_monitor": power_monitor.source if power_monitor else "firmware_estimate",
+    }
+
+def build_published_experiment(bundle, sample_id):
+    config = bundle["test"]["config"]
+    instances = []
+    profile = preset_snapshot = None
+    for result in bundle["results"]:
+        results = result["results"]
+        profile = profile or hardware_profile(config, results)
+        preset_snapshot = preset_snapshot or results.get("preset_snapshot")
+        if "batch_results" in results:
+            for problem in results["batch_results"]:
+                instance = stored_instance(problem)
+                if not instance:
+                    continue
+                instances.append(_published_instance(
+                    instance["hash"], problem["satlib_benchmark"], problem.get("solver_results", {}),
+                    instance["num_variables"], instance["num_clauses"]
+                ))
+        elif config.get("dimacs"):
+            num_vars, clauses = parse_dimacs(config["dimacs"])
+            instances.append(_published_instance(
+                instance_hash(config["dimacs"]), "custom", results.get("solver_results", {}), num_vars, len(clauses)
+            ))
+    return {
+        "sample_id": sample_id,
+        "date": created_day(bundle["test"]),
+        "solver_type": config.get("solver_type"),
+        "iterations": config.get("iterations"),
+        "solver_config": _scrub(config.get("solver_config", {})),
+        "hardware_profile": profile,
+        "preset_snapshot": preset_snapshot,
+        "instances": instances,
+    }
+
+def list_published_datasets():
+    index_path = PUBLIC_DATASETS_DIR / "index.json"
+    if not index_path.exists():
+        return []
+    return json.loads(index_path.read_text())["datasets"]
+
+def _write_dataset_index(datasets):
+    PUBLIC_DATASETS_DIR.mkdir(parents=True, exist_ok=True)
+    (PUBLIC_DATASETS_DIR / "index.json").write_text(
+        json.dumps({"updated_at": utc_now(), "datasets": datasets}, indent=2)
+    )
+
+def publish_dataset(test_ids, title, description=""):
+    """Snapshot anonymized results of the chosen completed tests as a public dataset"""
+    experiments = []
+    for test_id in test_ids:
+        bundle = load_result_bundle(test_id)
+        if not bundle:
+            raise LookupError(f"Test not found: {test_id}")
+        if bundle["test"]["status"] != "completed":
+            raise ValueError(f"Test {test_id} is not completed")
+        experiments.append(build_published_experiment(bundle, f"sample-{len(experiments) + 1}"))
+
+    dataset_id = generate_id()
+    entry = {
+        "dataset_id": dataset_id,
+        "title": title,
+        "description": description,
+        "published_at": utc_now(),
+        "experiment_count": len(experiments),
+        "instance_count": sum(len(e["instances"]) for e in experiments),
+    }
+    PUBLIC_DATASETS_DIR.mkdir(parents=True, exist_ok=True)
+    (PUBLIC_DATASETS_DIR / f"{dataset_id}.json").write_text(
+        json.dumps(dict(entry, experiments=experiments), indent=2)
+    )
+    _write_dataset_index(list_published_datasets() + [entry])
+    # Kept private so the publication can be traced back and withdrawn
+    with get_db() as conn:
+        for test_id in test_ids:
+            conn.execute(
+                "UPDATE tests SET metadata = json_set(COALESCE(metadata, '{}'), '$.published_in', ?) WHERE id = ?",
+                (dataset_id, test_id),
+            )
+        conn.commit()
+    return entry
+
+def unpublish_dataset(dataset_id):
+    datasets = list_published_datasets()
+    remaining = [d for d in datasets if d["dataset_id"] != dataset_id]
+    if len(remaining) == len(datasets):
+        return False
+    (PUBLIC_DATASETS_DIR / f"{dataset_id}.json").unlink(missing_ok=True)
+    _write_dataset_index(remaining)
+    with get_db() as conn:
+        conn.execute(
+            "UPDATE tests SET metadata = json_remove(metadata, '$.published_in') "
+            "WHERE json_extract(metadata, '$.published_in') = ?",
+            (dataset_id,),
+        )
+        conn.commit()
+    return True
+
+@app.route("/sat/publications", methods=["POST"])
+def sat_publish():
+    """Opt selected completed tests into a public, anonymized dataset"""
+    try:
+        data = request.get_json(silent=True) or {}
+        test_ids = data.get("test_ids")
+        if not isinstance(test_ids, list) or not test_ids:
+            return error_response("test_ids must be a non-empty list", 400)
+        if not data.get("title"):
+            return error_response("Missing required field: title", 400, "missing_field", {"field": "title"})
+        try:
+            entry = publish_dataset(test_ids, data["title"], data.get("description", ""))
+        except LookupError as e:
+            return error_response(str(e), 404)
+        except ValueError as e:
+            return error_response(str(e), 409)
+        logger.info(f"Published dataset {entry['dataset_id']} from {len(test_ids)} tests")
+        return jsonify(entry), 201
+
+    except Exception as e:
+        logger.error(f"Error publishing dataset: {e}")
+        return exception_response(e)
+
+@app.route("/sat/publications/<dataset_id>", methods=["DELETE"])
+def sat_unpublish(dataset_id):
+    """Withdraw a public dataset"""
+    if not unpublish_dataset(dataset_id):
+        return error_response("Dataset not found", 404)
+    return jsonify({"message": "Dataset withdrawn", "dataset_id": dataset_id})
+
+@app.route("/public/datasets", methods=["GET"])
+def public_datasets():
+    """Published datasets (no API key required)"""
+    return jsonify({"datasets": list_published_datasets()})
+
+@app.route("/public/datasets/<dataset_id>", methods=["GET"])
+def public_dataset_detail(dataset_id):
+    """A published dataset's contents (no API key required)"""
+    if not any(d["dataset_id"] == dataset_id for d in list_published_datasets()):
+        return error_response("Dataset not found", 404)
+    return send_file(PUBLIC_DATASETS_DIR / f"{dataset_id}.json", mimetype="application/json")
+
+@app.route("/sat/cnf-features", methods=["POST"])
+def sat_cnf_features():
+    """Compute structural features of a DIMACS CNF instance"""
+    try:
+        data = request.get_json()
+        dimacs = data.get("dimacs") if data else None
+        if not dimacs:
+            return error_response("Missing required field: dimacs", 400, "missing_field", {"field": "dimacs"})
+
+        return jsonify({"features": extract_cnf_features(dimacs)})
+
+    except ValueError as e:
+        return dimacs_error_response(e)
+    except Exception as e:
+        logger.error(f"CNF feature extraction error: {e}")
+        return exception_response(e)
+
+@app.route("/sat/simplify", methods=["POST"])
+def sat_simplify():
+    """Run the CNF preprocessor and return the reduced instance with its mapping"""
+    try:
+        data = request.get_json()
+        dimacs = data.get("dimacs") if data else None
+        if not dimacs:
+            return error_response("Missing required field: dimacs", 400, "missing_field", {"field": "dimacs"})
+
+        preprocessor = CNFPreprocessor(subsumption=data.get("subsumption", True))
+        return jsonify(preprocessor.simplify(dimacs))
+
+    except ValueError as e:
+        return dimacs_error_response(e)
+    except Exception as e:
+        logger.error(f"CNF simplification error: {e}")
+        return exception_response(e)
+
+CNF_FILES_MAX_LIMIT = int(os.getenv("CNF_FILES_MAX_LIMIT", 5000))
+# Query parameter -> (type, entry field, comparison)
+CNF_FILE_RANGE_FILTERS = {
+    "min_vars": (int, "variables", "min"),
+    "max_vars": (int, "variables", "max"),
+    "min_clauses": (int, "clauses", "min"),
+    "max_clauses": (int, "clauses", "max"),
+    "min_ratio": (float, "ratio", "min"),
+    "max_ratio": (float, "ratio", "max"),
+}
+
+def parse_cnf_file_query(args):
+    """Filters and page bounds from the listing query string; returns (query, errors)"""
+    query = {"preset": args.get("preset"), "ranges": {}, "difficulty": None, "limit": None, "offset": 0}
+    errors = []
+    for name, (kind, _, _) in CNF_FILE_RANGE_FILTERS.items():
+        if args.get(name) is not None:
+            try:
+                query["ranges"][name] = kind(args.get(name))
+            except ValueError:
+                errors.append(f"{name} must be {'an integer' if kind is int else 'a number'}")
+    if args.get("difficulty"):
+        query["difficulty"] = {d.strip() for d in args.get("difficulty").split(",") if d.strip()}
+        unknown = query["difficulty"] - set(DIFFICULTY_CLASSES)
+        if unknown:
+            errors.append(f"difficulty must be one of: {', '.join(DIFFICULTY_CLASSES)}")
+    for name, low, high in (("limit", 1, CNF_FILES_MAX_LIMIT), ("offset", 0, None)):
+        if args.get(name) is not None:
+            try:
+                value = int(args.get(name))
+            except ValueError:
+                value = None
+            if value is None or value < low or (high is not None and value > high):
+                errors.append(f"{name} must be an integer between {low} and {high}" if high
+                              else f"{name} must be a non-negative integer")
+            else:
+                query[name] = value
+    return query, errors
+
+def cnf_file_matches(info, query):
+    if query["difficulty"] and info["difficulty"] not in query["difficulty"]:
+        return False
+    for name, value in query["ranges"].items():
+        _, field, bound = CNF_FILE_RANGE_FILTERS[name]
+        if (info[field] < value) if bound == "min" else (info[field] > value):
+            return False
+    return True
+
+@app.route("/sat/cnf-files", methods=["GET"])
+def sat_cnf_files():
+    """List preset CNF files with their structural features, filtered and paginated"""
+    try:
+        query, errors = parse_cnf_file_query(request.args)
+        if errors:
+            return error_response("Invalid query", 400, details={"errors": errors})
+
+        def build():
+            files = []
+            provenance = {}
+            for index in visible_preset_indexes():
+                for preset in index.preset_names():
+                    if query["preset"] and preset != query["preset"] or preset in provenance:
+                        continue
+                    # Once per preset rather than repeated on each of its files
+                    provenance[preset] = load_preset_provenance(preset)
+                    files.extend(info for info in index.entries(preset) if cnf_file_matches(info, query))
+
+            end = query["offset"] + query["limit"] if query["limit"] else None
+            return jsonify({
+                "files": files[query["offset"]:end],
+                "total_count": len(files),
+                "offset": query["offset"],
+                "limit": query["limit"],
+                "provenance": provenance,
+            })
+
+        version, modified_at = refresh_preset_indexes({query["preset"]} if query["preset"] else None)
+        # Each filter/page combination is its own representation
+        query_hash = hashlib.sha1(json.dumps(sorted(request.args.items())).encode()).hexdigest()[:12]
+        return conditional_response(f"{version}-{query_hash}", modified_at, build)
+
+    except Exception as e:
+        logger.error(f"Error listing CNF files: {e}")
+        return exception_response(e)
+
+@app.route("/sat/cnf-files/<path:file_id>/vig", methods=["GET"])
+def sat_cnf_file_vig(file_id):
+    """Variable interaction graph of a preset CNF file in compact edge-list form"""
+    try:
+        path = resolve_preset_file(file_id)
+        if not path:
+            return error_response("CNF file not found", 404, "preset_not_found", {"file_id": file_id})
+
+        num_vars, clauses = parse_dimacs(path.read_text())
+        edges = build_vig(clauses)
+        response = {
+            "id": file_id,
+            "num_variables": num_vars,
+            "num_edges": len(edges),
+            "max_weight": max(edges.values(), default=0),
+            # [u, v, co-occurrence count] with u < v
+            "edges": [[u, v, w] for (u, v), w in sorted(edges.items())],
+        }
+
+        if request.args.get("communities", "").lower() in ("1", "true", "yes"):
+            membership, modularity = louvain_communities(edges)
+            # Index i holds the community of variable i + 1; None for variables without edges
+            response["communities"] = [membership.get(v) for v in range(1, num_vars + 1)]
+            response["community_count"] = len(set(membership.values()))
+            response["modularity"] = modularity
+
+        return jsonify(response)
+
+    except Exception as e:
+        logger.error(f"Error building VIG for {file_id}: {e}")
+        return exception_response(e)
+
+@app.route("/sat/cnf-files/<path:file_id>/content", methods=["GET"])
+def sat_cnf_file_content(file_id):
+    """Raw DIMACS text of a preset CNF file"""
+    try:
+        # Ids are resolved inside the presets root, so no client path ever reaches the filesystem directly
+        path = resolve_preset_file(file_id)
+        if not path:
+            return error_response("CNF file not found", 404, "preset_not_found", {"file_id": file_id})
+
+        stat = path.stat()
+        return conditional_response(f"{stat.st_mtime_ns:x}-{stat.st_size:x}", stat.st_mtime,
+                                    lambda: Response(path.read_text(), mimetype="text/plain"))
+
+    except Exception as e:
+        logger.error(f"Error reading CNF file {file_id}: {e}")
+        return exception_response(e)
+
+@app.route("/sat/cnf-files/<path:file_id>", methods=["GET"])
+def sat_cnf_file_detail(file_id):
+    """Describe a single preset CNF file, including full width estimates"""
+    try:
+        path = resolve_preset_file(file_id)
+        if not path:
+            return error_response("CNF file not found", 404, "preset_not_found", {"file_id": file_id})
+
+        info = dict(get_cnf_file_info(file_id.split("/")[0], path))
+        info["difficulty"], info["difficulty_confidence"] = difficulty_model.predict(info["features"])
+        info["provenance"] = load_preset_provenance(file_id.split("/")[0])
+
+        # The listing skips min-fill on large instances; a single file can afford it
+        num_vars, clauses = parse_dimacs(path.read_text())
+        adjacency = defaultdict(set)
+        for u, v in build_vig(clauses):
+            adjacency[u].add(v)
+            adjacency[v].add(u)
+        info["widths"] = width_estimates(adjacency)
+
+        return jsonify(info)
+
+    except Exception as e:
+        logger.error(f"Error describing CNF file {file_id}: {e}")
+        return exception_response(e)
+
+@app.route("/sat/presets", methods=["GET"])
+def sat_presets():
+    """List presets with their lock state and snapshots"""
+    try:
+        def build():
+            presets = []
+            tenant = current_tenant()
+            own = tenant_preset_index(tenant).preset_names() if tenant else []
+            for preset in own:
+                presets.append({
+                    "preset": preset,
+                    "namespace": tenant["name"],
+                    "file_count": len(list((tenant_presets_dir(tenant) / preset).glob("*.cnf"))),
+                    "locked": False,
+                    "drifted": False,
+                    "snapshots": [],
+                    "provenance": load_preset_provenance(preset),
+                })
+            for preset, file_count in preset_diagnostics()["presets"].items():
+                if preset in own:
+                    continue
+                drift = preset_drift(preset)
+                presets.append({
+                    "preset": preset,
+                    "namespace": "shared",
+                    "file_count": file_count,
+                    "locked": drift is not None,
+                    "drifted": bool(drift and drift["drifted"]),
+                    "snapshots": [s["snapshot"] for s in list_preset_snapshots(preset)],
+                    "provenance": load_preset_provenance(preset),
+                })
+            return jsonify({"presets": presets})
+
+        # Drift checks hash every file, so an unchanged index answers 304 without them
+        return conditional_response(*refresh_preset_indexes(), build)
+
+    except Exception as e:
+        logger.error(f"Error listing presets: {e}")
+        return exception_response(e)
+
+@app.route("/sat/presets/<preset>/lock", methods=["GET", "POST", "DELETE"])
+def sat_preset_lock(preset):
+    """Inspect, create or remove a preset's content lock"""
+    try:
+        if not valid_preset_name(preset) or not (SAT_PRESETS_DIR / preset).is_dir():
+            return error_response("Preset not found", 404, "preset_not_found", {"preset": preset})
+        if request.method != "GET" and current_tenant():
+            return error_response("Shared presets are read-only to tenant keys", 403)
+
+        if request.method == "POST":
+            if load_preset_lock(preset):
+                return error_response("Preset is already locked", 409)
+            manifest = lock_preset(preset)
+            logger.info(f"Locked preset {preset} ({manifest['file_count']} files, {manifest['content_hash'][:12]})")
+            return jsonify(manifest), 201
+
+        if request.method == "DELETE":
+            if not load_preset_lock(preset):
+                return error_response("Preset is not locked", 404)
+            unlock_preset(preset)
+            return jsonify({"message": f"Preset {preset} unlocked"})
+
+        lock = load_preset_lock(preset)
+        if not lock:
+            return error_response("Preset is not locked", 404)
+        return jsonify(dict(lock, drift=preset_drift(preset)))
+
+    except Exception as e:
+        logger.error(f"Error handling lock for preset {preset}: {e}")
+        return exception_response(e)
+
+@app.route("/sat/presets/<preset>/snapshots", methods=["GET", "POST"])
+def sat_preset_snapshots(preset):
+    """List snapshots of a preset or create a new one"""
+    try:
+        if not valid_preset_name(preset) or not (SAT_PRESETS_DIR / preset).is_dir():
+            return error_response("Preset not found", 404, "preset_not_found", {"preset": preset})
+
+        if request.method == "GET":
+            return jsonify({"preset": preset, "snapshots": list_preset_snapshots(preset)})
+        if current_tenant():
+            return error_response("Shared presets are read-only to tenant keys", 403)
+
+        name = (request.get_json(silent=True) or {}).get("name")
+        if not name:
+            return error_response("Missing required field: name", 400, "missing_field", {"field": "name"})
+        if not valid_preset_name(name) or name.startswith(TEMP_PREFIX):
+            return error_response("Snapshot names may only contain letters, digits, '-', '_' and '.'", 400)
+        if (PRESET_SNAPSHOTS_DIR / preset / name).exists():
+            return error_response(f"Snapshot {name} already exists", 409)
+
+        try:
+            manifest = create_preset_snapshot(preset, name)
+        except OSError:
+            if (PRESET_SNAPSHOTS_DIR / preset / name).exists():
+                return error_response(f"Snapshot {name} already exists", 409)
+            raise
+        logger.info(f"Created snapshot {preset}@{name} ({manifest['file_count']} files)")
+        return jsonify(manifest), 201
+
+    except Exception as e:
+        logger.error(f"Error handling snapshots for preset {preset}: {e}")
+        return exception_response(e)
+
+@app.route("/sat/presets/<preset>/snapshots/<name>", methods=["GET"])
+def sat_preset_snapshot_detail(preset, name):
+    """Show a snapshot's manifest and verify its files still match it"""
+    try:
+        if not (valid_preset_name(preset) and valid_preset_name(name)):
+            return error_response("Snapshot not found", 404)
+        manifest = load_preset_snapshot(preset, name)
+        if not manifest:
+            return error_response("Snapshot not found", 404)
+        verification = compare_manifests(manifest, preset_manifest(PRESET_SNAPSHOTS_DIR / preset / name))
+        return jsonify(dict(manifest, verification=verification))
+
+    except Exception as e:
+        logger.error(f"Error reading snapshot {preset}@{name}: {e}")
+        return exception_response(e)
+
+import tempfile
+
+# Bounds on server-side instance generation
+GENERATE_MAX_COUNT = int(os.getenv("GENERATE_MAX_COUNT", 1000))
+GENERATE_MAX_VARIABLES = int(os.getenv("GENERATE_MAX_VARIABLES", 10000))
+GENERATE_MAX_CLAUSES = int(os.getenv("GENERATE_MAX_CLAUSES", 200000))
+GENERATE_FIELDS = {
+    "n": (int, 1, GENERATE_MAX_VARIABLES, 50),
+    "ratio": (float, 0.01, 100.0, 4.26),  # 4.26 is the 3-SAT satisfiability threshold
+    "k": (int, 1, 10, 3),
+    "count": (int, 1, GENERATE_MAX_COUNT, 1),
+    "seed": (int, 0, 2**31 - 1, 0),
+}
+
+@app.route("/sat/generate", methods=["POST"])
+def sat_generate():
+    """Generate random k-SAT instances, optionally saved as a new preset"""
+    try:
+        data = request.get_json(silent=True) or {}
+        params = {field: spec[3] for field, spec in GENERATE_FIELDS.items()}
+        params["seed"] = random.randrange(2**31)
+        errors = apply_config_overrides(GENERATE_FIELDS, params, {k: v for k, v in data.items() if k in GENERATE_FIELDS})
+        num_clauses = max(1, round(params["n"] * params["ratio"]))
+        if not errors and params["k"] > params["n"]:
+            errors.append("k must not exceed n")
+        if not errors and num_clauses > GENERATE_MAX_CLAUSES:
+            errors.append(f"n * ratio must not exceed {GENERATE_MAX_CLAUSES} clauses")
+        if errors:
+            return error_response("Invalid generation parameters", 400, details={"errors": errors})
+
+        preset = data.get("preset")
+        tenant = current_tenant()
+        # Tenant keys write into their own namespace; shared presets stay read-only to them
+        presets_root = tenant_presets_dir(tenant) if tenant else SAT_PRESETS_DIR
+        if preset is not None:
+            if not valid_preset_name(preset):
+                return error_response("Preset names may only contain letters, digits, '-', '_' and '.'", 400)
+            if (SAT_PRESETS_DIR / preset).exists() or (presets_root / preset).exists():
+                return error_response(f"Preset {preset} already exists", 409, "preset_exists")
+
+        rng = random.Random(params["seed"])
+        width = len(str(params["count"]))
+        instances = []
+        for i in range(params["count"]):
+            label = f"seed {params['seed']}, instance {i + 1}"
+            instances.append(generate_random_ksat(params["n"], num_clauses, params["k"], rng, label))
+
+        if preset is None:
+            files = []
+            for dimacs in instances:
+                features = extract_cnf_features(dimacs)
+                info = {
+                    "id": None,
+                    "preset": None,
+                    "filename": None,
+                    "variables": features["num_variables"],
+                    "clauses": features["num_clauses"],
+                    "ratio": features["clause_variable_ratio"],
+                    "size_bytes": len(dimacs.encode()),
+                    "features": features,
+                    "dimacs": dimacs,
+                }
+                info["difficulty"], info["difficulty_confidence"] = difficulty_model.predict(features)
+                files.append(info)
+            return jsonify({"parameters": dict(params, clauses=num_clauses), "files": files, "total_count": len(files)})
+
+        provenance = json.dumps({
+            "source": "generated",
+            "description": f"Uniform random {params['k']}-SAT from POST /sat/generate",
+            "generator": dict(params, clauses=num_clauses, algorithm="uniform-random-ksat"),
+            # Near the threshold a random instance may go either way
+            "expected": "unknown",
+            "created": utc_now(),
+        }, indent=2)
+        if tenant:
+            new_bytes = sum(len(dimacs.encode()) for dimacs in instances) + len(provenance.encode())
+            quota_error = check_upload_quota(tenant, new_bytes, len(instances) + 1)
+            if quota_error:
+                return quota_error
+
+        # Write beside the presets root and rename, so listings never see a half-written preset
+        presets_root.mkdir(parents=True, exist_ok=True)
+        staging = Path(tempfile.mkdtemp(prefix=f"{TEMP_PREFIX}{preset}.", dir=presets_root.parent))
+        try:
+            for i, dimacs in enumerate(instances):
+                (staging / f"{preset}-{i + 1:0{width}d}.cnf").write_text(dimacs)
+            (staging / PRESET_PROVENANCE_FILE).write_text(provenance)
+            staging.rename(presets_root / preset)
+        except Exception:
+            shutil.rmtree(staging, ignore_errors=True)
+            raise
+        push_directory_to_storage(presets_root / preset)
+        owner = f" for tenant {tenant['name']}" if tenant else ""
+        logger.info(f"Generated preset {preset}{owner}: {params['count']} random {params['k']}-SAT instances, seed {params['seed']}")
+
+        files = (tenant_preset_index(tenant) if tenant else cnf_index).entries(preset)
+        return jsonify({
+            "preset": preset, "parameters": dict(params, clauses=num_clauses), "files": files, "total_count": len(files),
+            "provenance": load_preset_provenance(preset),
+        }), 201
+
+    except Exception as e:
+        logger.error(f"Instance generation error: {e}")
+        return exception_response(e)
+
+@app.route("/sat/difficulty-model", methods=["GET"])
+def sat_difficulty_model():
+    """Describe the currently loaded difficulty model"""
+    return jsonify({
+        "trained": difficulty_model.trained,
+        "tts_boundaries_ms": difficulty_model.tts_boundaries_ms,
+        "metadata": difficulty_model.metadata,
+        "evaluation": load_difficulty_evaluation(),
+    })
+
+@app.route("/sat/difficulty-model/train", methods=["POST"])
+def sat_difficulty_model_train():
+    """Retrain the difficulty model from stored SAT test history"""
+    global difficulty_model
+    try:
+        data = request.get_json(silent=True) or {}
+        reference_solver = data.get("reference_solver", "walksat")
+
+        samples = collect_difficulty_samples(reference_solver)
+        model = DifficultyPredictor()
+        try:
+            model.fit([(features, tts) for features, tts, _ in samples])
+        except ValueError as e:
+            return error_response(str(e), 400, "insufficient_data")
+
+        model.metadata["reference_solver"] = reference_solver
+        save_difficulty_model(model)
+        difficulty_model = model
+        # Listings carry predicted difficulty
+        cnf_index.invalidate()
+
+        logger.info(f"Difficulty model retrained on {len(samples)} samples")
+        return jsonify({
+            "message": "Difficulty model trained",
+            "tts_boundaries_ms": model.tts_boundaries_ms,
+            "metadata": model.metadata,
+        })
+
+    except Exception as e:
+        logger.error(f"Difficulty model training error: {e}")
+        return exception_response(e)
+
+@app.route("/sat/difficulty-model/evaluate", methods=["POST"])
+def sat_difficulty_model_evaluate():
+    """Cross-validate the difficulty model per instance family and store calibration metrics"""
+    try:
+        data = request.get_json(silent=True) or {}
+        reference_solver = data.get("reference_solver", "walksat")
+
+        samples = collect_difficulty_samples(reference_solver)
+        if not samples:
+            return error_response(f"No completed SAT results for {reference_solver}", 400, "insufficient_data")
+
+        evaluation = evaluate_difficulty_model(samples)
+        evaluation["reference_solver"] = reference_solver
+        save_difficulty_evaluation(evaluation)
+
+        logger.info(f"Difficulty model evaluated on {len(samples)} samples across {len(evaluation['families'])} families")
+        return jsonify(evaluation)
+
+    except Exception as e:
+        logger.error(f"Difficulty model evaluation error: {e}")
+        return exception_response(e)
+
+@app.route("/sat/offload-model", methods=["GET"])
+def sat_offload_model():
+    """Describe the hardware offload predictor and policy thresholds"""
+    predictor = offload_policy.predictor
+    return jsonify({
+        "trained": bool(predictor and predictor.trained),
+        "metadata": predictor.metadata if predictor else {},
+        "threshold": offload_policy.threshold,
+        "max_variables": offload_policy.max_variables,
+        "hardware_success_rate": offload_policy.success_rate,
+    })
+
+@app.route("/sat/offload-model/train", methods=["POST"])
+def sat_offload_model_train():
+    """Retrain the offload predictor from stored hardware-vs-software results"""
+    try:
+        data = request.get_json(silent=True) or {}
+        software_solver = data.get("software_solver", "walksat")
+
+        samples = collect_offload_samples(software_solver)
+        model = OffloadPredictor()
+        try:
+            model.fit([(features, won) for features, won, _ in samples])
+        except ValueError as e:
+            return error_response(str(e), 400, "insufficient_data")
+
+        model.metadata["software_solver"] = software_solver
+        save_offload_model(model)
+        offload_policy.predictor = model
+
+        logger.info(f"Offload model retrained on {len(samples)} samples")
+        return jsonify({"message": "Offload model trained", "metadata": model.metadata})
+
+    except Exception as e:
+        logger.error(f"Offload model training error: {e}")
+        return exception_response(e)
+
+@app.route("/sat/sim-correlation", methods=["GET", "POST"])
+def sat_sim_correlation():
+    """Latest simulation-vs-silicon calibration report, or build one from a set of tests"""
+    try:
+        if request.method == "GET":
+            report = load_sim_correlation()
+            if not report:
+                return error_response("No correlation report has been generated", 404)
+            return jsonify(report)
+
+        data = request.get_json(silent=True) or {}
+        test_ids = data.get("test_ids")
+        if not isinstance(test_ids, list) or not test_ids:
+            return error_response("test_ids must be a non-empty list", 400)
+        report = sim_silicon_correlation(
+            test_ids, data.get("simulator", "oscillator"), data.get("hardware", "daedalus")
+        )
+        if not report["paired_instances"]:
+            return error_response("No instances ran on both the simulator and hardware", 400, "insufficient_data",
+                                  {"missing_tests": report["missing_tests"]})
+        save_sim_correlation(report)
+        logger.info(f"Simulation correlation report built from {report['paired_instances']} paired instances")
+        return jsonify(report)
+
+    except Exception as e:
+        logger.error(f"Simulation correlation error: {e}")
+        return exception_response(e)
+
+@app.route("/sat/references", methods=["GET"])
+def sat_references():
+    """List stored per-preset reference results"""
+    try:
+        preset = request.args.get("preset")
+        with get_db() as conn:
+            if preset:
+                cursor = conn.execute("SELECT * FROM sat_references WHERE preset = ? ORDER BY solver", (preset,))
+            else:
+                cursor = conn.execute("SELECT * FROM sat_references ORDER BY preset, solver")
+            references = [dict_from_row(row) for row in cursor]
+        return jsonify({"references": references})
+
+    except Exception as e:
+        logger.error(f"Error listing SAT references: {e}")
+        return exception_response(e)
+
+@app.route("/sat/references/<preset>", methods=["POST", "DELETE"])
+def sat_reference_detail(preset):
+    """Set a preset's reference from a completed batch test or explicit values, or clear it"""
+    try:
+        if request.method == "DELETE":
+            with get_db() as conn:
+                conn.execute("DELETE FROM sat_references WHERE preset = ?", (preset,))
+                conn.commit()
+            return jsonify({"message": f"References for {preset} cleared"})
+
+        data = request.get_json(silent=True) or {}
+        source_test_id = data.get("from_test_id")
+        if source_test_id:
+            scope, params = tenant_scope_sql("t.config")
+            with get_db() as conn:
+                row = conn.execute(
+                    f"""
+                    SELECT t.status, t.config, r.results FROM tests t
+                    JOIN test_results r ON r.test_id = t.id
+                    WHERE t.id = ? AND t.chip_type = 'SAT' AND {scope}
+                """,
+                    [source_test_id] + params,
+                ).fetchone()
+            if not row or row["status"] != "completed":
+                return error_response("Completed SAT test not found", 404)
+            config = json.loads(row["config"] or "{}")
+            if config.get("satlib_benchmark") != preset:
+                return error_response(
+                    f"Test {source_test_id} ran {config.get('satlib_benchmark')}, not {preset}", 400
+                )
+            references = reference_from_results(json.loads(row["results"] or "{}"))
+        elif data.get("solvers"):
+            references = data["solvers"]
+            for solver, values in references.items():
+                if "success_rate" not in values or "tts_mean_ms" not in values:
+                    return error_response(
+                        f"Reference for {solver} needs success_rate and tts_mean_ms", 400, "missing_field"
+                    )
+        else:
+            return error_response("Provide from_test_id or solvers", 400, "missing_field")
+
+        with get_db() as conn:
+            for solver, values in references.items():
+                conn.execute(
+                    """
+                    INSERT INTO sat_references
+                        (id, preset, solver, success_rate, tts_mean_ms, tts_p95_ms, total_runs, source_test_id, created)
+                    VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+                    ON CONFLICT (preset, solver) DO UPDATE SET
+                        success_rate = excluded.success_rate,
+                        tts_mean_ms = excluded.tts_mean_ms,
+                        tts_p95_ms = excluded.tts_p95_ms,
+                        total_runs = excluded.total_runs,
+                        source_test_id = excluded.source_test_id,
+                        created = excluded.created
+                """,
+                    (generate_id(), preset, solver, values["success_rate"], values["tts_mean_ms"],
+                     values.get("tts_p95_ms"), values.get("total_runs"), source_test_id, utc_now()),
+                )
+            conn.commit()
+
+        logger.info(f"Stored references for {preset}: {', '.join(references)}")
+        return jsonify({"preset": preset, "references": get_preset_references(preset)})
+
+    except Exception as e:
+        logger.error(f"Error storing SAT reference for {preset}: {e}")
+        return exception_response(e)
+
+@app.route("/sat/known-answers", methods=["GET"])
+def sat_known_answers():
+    """Counts of known instance answers, or a single lookup by ?instance_hash="""
+    try:
+        hash_value = request.args.get("instance_hash")
+        if hash_value:
+            known = lookup_known_answer(hash_value)
+            if not known:
+                return error_response("No known answer for this instance", 404)
+            return jsonify(known)
+
+        with get_db() as conn:
+            rows = conn.execute(
+                "SELECT source, status, COUNT(*) AS count FROM sat_known_answers GROUP BY source, status ORDER BY source, status"
+            ).fetchall()
+        counts = [dict_from_row(row) for row in rows]
+        return jsonify({"counts": counts, "total_count": sum(c["count"] for c in counts)})
+
+    except Exception as e:
+        logger.error(f"Error listing known answers: {e}")
+        return exception_response(e)
+
+@app.route("/sat/known-answers/import", methods=["POST"])
+def sat_known_answers_import():
+    """Import known answers from preset families or from explicit entries (e.g. SAT Competition metadata)"""
+    try:
+        data = request.get_json(silent=True) or {}
+        if "entries" in data:
+            entries = []
+            for i, entry in enumerate(data["entries"]):
+                status = str(entry.get("status", "")).upper()
+                if status not in ("SAT", "UNSAT"):
+                    return error_response(f"Entry {i}: status must be SAT or UNSAT", 400)
+                if entry.get("dimacs"):
+                    hash_value = instance_hash(entry["dimacs"])
+                elif entry.get("instance_hash"):
+                    hash_value = entry["instance_hash"]
+                else:
+                    return error_response(f"Entry {i}: provide dimacs or instance_hash", 400, "missing_field")
+                entries.append((hash_value, status, entry.get("source", "manual"), entry.get("label")))
+            imported = {"entries": store_known_answers(entries)}
+        else:
+            presets = data.get("presets")
+            unknown = [p for p in presets or [] if not (valid_preset_name(p) and (SAT_PRESETS_DIR / p).is_dir())]
+            if unknown:
+                return error_response(f"Unknown presets: {', '.join(unknown)}", 404, "preset_not_found", {"presets": unknown})
+            imported = import_preset_known_answers(presets)
+
+        logger.info(f"Imported known answers: {imported}")
+        return jsonify({"imported": imported, "total_imported": sum(imported.values())})
+
+    except Exception as e:
+        logger.error(f"Error importing known answers: {e}")
+        return exception_response(e)
 
 @app.route("/sat/command", methods=["POST"])
 def sat_command():
@@ -3415,34 +11326,229 @@ def sat_command():
     try:
         cmd = request.get_json().get("command", "").strip()
         if not cmd:
-            return jsonify({"error": "command cannot be empty"}), 400
+            return error_response("command cannot be empty", 400)
             
         sat_hw = sat_pool.get_connection()
-        output = sat_hw.execute_command(cmd)
+        with device_queue(sat_hw.port).exclusive(f"command:{g.request_id}"):
+            output = sat_hw.execute_command(cmd)
         return jsonify({"output": output})
         
     except Exception as e:
         logger.error(f"SAT command error: {e}")
-        return jsonify({"error": str(e)}), 500
+        return exception_response(e)
+
+@app.route("/sat/serial-history", methods=["GET"])
+def sat_serial_history():
+    """Get DAEDALUS serial communication history"""
+    try:
+        sat_hw = sat_pool.get_connection()
+        history = sat_hw.serial_history
+        return jsonify({
+            "history": [f"[{h['timestamp']}] {h['message']}" for h in history],
+            "connected": sat_hw.connected,
+            "last_heartbeat": sat_hw.last_heartbeat
+        })
+    except Exception as e:
+        logger.error(f"SAT serial history error: {e}")
+        return jsonify({
+            "history": [],
+            "connected": False,
+            "error": str(e)
+        }), 500
+
+@app.route("/sat/tests/<test_id>/events", methods=["GET"])
+def sat_test_events(test_id):
+    """Long-poll for progress events after a cursor"""
+    try:
+        cursor = request.args.get("cursor", 0, type=int)
+        timeout = min(max(request.args.get("timeout", 25, type=float), 0), 60)
+
+        with get_db() as conn:
+            row = conn.execute(
+                "SELECT status FROM tests WHERE id = ? AND chip_type = 'SAT'", (test_id,)
+            ).fetchone()
+        if not row:
+            return error_response("Test not found", 404)
+
+        # Finished tests have nothing more to wait for
+        if row["status"] != "running":
+            timeout = 0
+
+        events, next_cursor, truncated = test_events.events_since(test_id, cursor, timeout)
+        return jsonify({
+            "test_id": test_id,
+            "status": row["status"],
+            "events": events,
+            "cursor": next_cursor,
+            "truncated": truncated,
+        })
+
+    except Exception as e:
+        logger.error(f"Error polling events for SAT test {test_id}: {e}")
+        return exception_response(e)
+
+@app.route("/sat/tests/<test_id>/resume", methods=["POST"])
+def sat_test_resume(test_id):
+    """Resume an interrupted batch test from its last checkpoint"""
+    try:
+        with get_db() as conn:
+            row = conn.execute(
+                "SELECT * FROM tests WHERE id = ? AND chip_type = 'SAT'", (test_id,)
+            ).fetchone()
+        if not row:
+            return error_response("Test not found", 404)
+
+        test = dict_from_row(row)
+        thread = active_test_threads.get(test_id)
+        if thread and thread.is_alive():
+            return error_response("Test is still running", 409)
+        if test["status"] == "completed":
+            return error_response("Test already completed", 409)
+
+        checkpoint = load_batch_checkpoint(test_id)
+        if not checkpoint:
+            return error_response("No checkpoint available for this test", 409, "no_checkpoint")
+
+        config = json.loads(test["config"] or "{}")
+        algorithms = config.get("algorithms", {})
+        stored_config = config.get("solver_config", {})
+        solver_config = resolve_solver_config({k: v for k, v in stored_config.items() if k in SOLVER_CONFIG_FIELDS})[0]
+        solver_config["device_id"] = stored_config.get("device_id")
+        if stored_config.get("simulator"):
+            # Resume against the profile the test started with, not the live one
+            solver_config["simulator"] = stored_config["simulator"]
+        data = {
+            "name": test["name"],
+            "batch_mode": True,
+            "satlib_benchmark": config["satlib_benchmark"],
+            "problem_indices": config["problem_indices"],
+            "time_budget_seconds": config.get("time_budget_seconds"),
+            "order_by": config.get("order_by", "index"),
+            "enable_cube_and_conquer": algorithms.get("cube_and_conquer", False),
+            "enable_oscillator": algorithms.get("oscillator", False),
+            "enable_ising": algorithms.get("ising", False),
+            "race_software_solver": algorithms.get("race"),
+            "solver_config": solver_config,
+            "user": config.get("user"),
+            "reservation_fallback": config.get("reservation_fallback", RESERVATION_FALLBACK),
+            "weights": config.get("weights"),
+            "bypass_cache": config.get("bypass_cache", False),
+            "reuse_cached_timings": config.get("reuse_cached_timings", False),
+            "tenant": config.get("tenant"),
+        }
+        tenant = current_tenant()
+        if tenant:
+            budget_error = check_solve_budget(tenant)
+            if budget_error:
+                return budget_error
+
+        with get_db() as conn:
+            conn.execute("UPDATE tests SET status = 'running' WHERE id = ?", (test_id,))
+            conn.commit()
+
+        test_thread = threading.Thread(
+            target=run_test_async,
+            args=(test_id, True, data, algorithms.get("minisat", False), algorithms.get("walksat", False),
+                  algorithms.get("daedalus", False), config.get("iterations", 1), checkpoint),
+            daemon=True,
+            name=test_id
+        )
+        active_test_threads[test_id] = test_thread
+        test_thread.start()
+
+        logger.info(f"Resumed test {test_id} from problem {checkpoint['position'] + 1}")
+        return jsonify({
+            "test_id": test_id,
+            "status": "running",
+            "resumed_from": checkpoint["position"],
+            "checkpoint_saved_at": checkpoint["saved_at"],
+        })
+
+    except Exception as e:
+        logger.error(f"Error resuming SAT test {test_id}: {e}")
+        return exception_response(e)
+
+def recompute_summary(all_results, test_id=None):
+    """Re-derive a stored summary from its raw per-run records with the current statistics"""
+    summary = dict(all_results.get("summary", {}))
+    summary["solver_comparison"] = summarize_solver_results(all_results.get("solver_results", {}))
+    summary["energy_breakdown"] = summarize_energy(all_results.get("solver_results", {}))
+
+    batch_results = all_results.get("batch_results")
+    if batch_results is not None:
+        problems_solved = all_results.get("problems_completed", len(batch_results))
+        instance_tts = summarize_instance_tts(batch_results)
+        for solver_name, stats in summary["solver_comparison"].items():
+            stats["problems_solved"] = problems_solved
+            stats["instance_tts"] = instance_tts.get(solver_name)
+        summary["problem_count"] = problems_solved
+        summary["total_runs"] = sum(len(results) for results in all_results.get("solver_results", {}).values())
+        if any("offload_decision" in p for p in batch_results):
+            summary["hardware_offload"] = summarize_offload(batch_results)
+        summary["known_answer_check"] = summarize_known_answers([
+            (p["problem_index"], p["known_answer"]) for p in batch_results if "known_answer" in p
+        ])
+        if summary.get("weighted"):
+            summary["weighted"] = summarize_weighted(batch_results, summary["weighted"]["weights"])
+        if summary.get("fault_injection"):
+            summary["fault_injection"] = summarize_fault_injection(batch_results, summary["fault_injection"]["config"])
+        if summary.get("satlib_benchmark"):
+            summary["anomalies"] = detect_batch_anomalies(
+                summary["satlib_benchmark"], all_results.get("solver_results", {}), summary["solver_comparison"], test_id
+            )
+    elif "known_answer" in all_results:
+        summary["known_answer_check"] = summarize_known_answers([(None, all_results["known_answer"])])
+        if summary.get("fault_injection"):
+            summary["fault_injection"] = summarize_fault_injection([all_results], summary["fault_injection"]["config"])
+
+    summary["summary_version"] = SUMMARY_VERSION
+    summary["recomputed_at"] = utc_now()
+    return summary
+
+@app.route("/sat/tests/<test_id>/recompute", methods=["POST"])
+def sat_test_recompute(test_id):
+    """Recompute a completed test's summary from its stored runs, keeping the old one for reference"""
+    try:
+        with get_db() as conn:
+            test = conn.execute(
+                "SELECT * FROM tests WHERE id = ? AND chip_type = 'SAT'", (test_id,)
+            ).fetchone()
+            if not test:
+                return error_response("Test not found", 404)
+            row = conn.execute(
+                "SELECT * FROM test_results WHERE test_id = ? ORDER BY timestamp DESC LIMIT 1", (test_id,)
+            ).fetchone()
+            if not row:
+                return error_response("Test has no stored results", 409, "no_results")
+
+            all_results = json.loads(row["results"] or "{}")
+            previous = all_results.get("summary", {})
+            summary = recompute_summary(all_results, test_id)
+            all_results["summary"] = summary
+
+            metadata = json.loads(test["metadata"] or "{}")
+            metadata["summary"] = summary
+            metadata.setdefault("summary_history", []).append({
+                "summary_version": previous.get("summary_version", 1),
+                "replaced_at": summary["recomputed_at"],
+                "summary": previous,
+            })
+
+            conn.execute("UPDATE test_results SET results = ? WHERE id = ?", (json.dumps(all_results), row["id"]))
+            conn.execute("UPDATE tests SET metadata = ? WHERE id = ?", (json.dumps(metadata), test_id))
+            conn.commit()
 
-@app.route("/sat/serial-history", methods=["GET"])
-def sat_serial_history():
-    """Get DAEDALUS serial communication history"""
-    try:
-        sat_hw = sat_pool.get_connection()
-        history = sat_hw.serial_history
+        logger.info(f"Recomputed summary of {test_id} (v{previous.get('summary_version', 1)} -> v{SUMMARY_VERSION})")
         return jsonify({
-            "history": [f"[{h['timestamp']}] {h['message']}" for h in history],
-            "connected": sat_hw.connected,
-            "last_heartbeat": sat_hw.last_heartbeat
+            "test_id": test_id,
+            "summary_version": SUMMARY_VERSION,
+            "previous_version": previous.get("summary_version", 1),
+            "summary": summary,
         })
+
     except Exception as e:
-        logger.error(f"SAT serial history error: {e}")
-        return jsonify({
-            "history": [],
-            "connected": False,
-            "error": str(e)
-        }), 500
+        logger.error(f"Error recomputing summary for {test_id}: {e}")
+        return exception_response(e)
 
 @app.route("/sat/tests/<test_id>/stop", methods=["POST"])
 def sat_test_stop(test_id):
@@ -3454,7 +11560,7 @@ def sat_test_stop(test_id):
             test = cursor.fetchone()
 
             if not test:
-                return jsonify({"error": "Test not found"}), 404
+                return error_response("Test not found", 404)
 
             test_data = dict_from_row(test)
 
@@ -3499,17 +11605,2768 @@ def sat_test_stop(test_id):
 
     except Exception as e:
         logger.error(f"Error getting SAT test {test_id}: {e}")
-        return jsonify({"error": str(e)}), 500
+        return exception_response(e)
+
+# ------------------------------ Results Store --------------------------------
+# Every solver run is kept as a row, so results outlive the job blobs in test_results and can be queried
+RESULTS_STORE = os.getenv("RESULTS_STORE", "sqlite")  # or "postgres" to share one store between API instances
+RESULTS_DB_PATH = Path(os.getenv("RESULTS_DB_PATH", DB_PATH))
+# Run fields with a column of their own; the rest of the run is kept in metrics
+RUN_COLUMNS = ("solve_time_ms", "simulated_time_ns", "energy_nj", "power_mw")
+RUN_KEYS = RUN_COLUMNS + ("run_id", "solver", "iteration", "seed")
+# Solvers whose runs touched a board
+HARDWARE_RUN_SOLVERS = ("daedalus", "race")
+
+def run_status(solver, run):
+    """sat, unsat, timeout, error or unknown; incomplete solvers never prove unsat"""
+    if run.get("error"):
+        return "error"
+    if run.get("satisfiable"):
+        return "sat"
+    if run.get("cutoff_reached") or run.get("cancelled"):
+        return "timeout"
+    return "unsat" if solver in COMPLETE_SOLVERS else "unknown"
+
+def run_records(job_id, instance, params, results, tenant=None, preset=None, problem_index=None):
+    """Store rows for each run in one problem's results, tagging the runs with their new run_id"""
+    hash_value = (results.get("known_answer") or {}).get("instance_hash")
+    cached = bool((results.get("cache") or {}).get("hit"))
+    records = []
+    for solver, runs in results.get("solver_results", {}).items():
+        for run in runs:
+            run["run_id"] = generate_id()
+            records.append({
+                "id": run["run_id"],
+                "job_id": job_id,
+                "tenant": tenant,
+                "instance": instance,
+                "instance_hash": hash_value,
+                "preset": preset,
+                "problem_index": problem_index,
+                "solver": solver,
+                "hardware": solver in HARDWARE_RUN_SOLVERS,
+                "iteration": run.get("iteration"),
+                "seed": run.get("seed"),
+                "params": params,
+                "status": run_status(solver, run),
+                "cached": cached,
+                **{column: run.get(column) for column in RUN_COLUMNS},
+                "metrics": {k: v for k, v in run.items() if k not in RUN_KEYS},
+                "created": utc_now(),
+            })
+    return records
+
+class ResultStore:
+    """Storage interface for runs. Backends supply query/execute; the SQL here is portable between them."""
+
+    JSON_FIELDS = ("params", "metrics")
+    COLUMNS = ("id", "job_id", "tenant", "instance", "instance_hash", "preset", "problem_index", "solver", "hardware",
+               "iteration", "seed", "params", "status", "cached", *RUN_COLUMNS, "metrics", "created")
+    placeholder = "?"
+
+    def migrate(self):
+        raise NotImplementedError
+
+    def query(self, sql, params=()):
+        """Rows as dicts"""
+        raise NotImplementedError
+
+    def execute(self, sql, params=(), many=False):
+        """Row count"""
+        raise NotImplementedError
+
+    def sql(self, text):
+        return text.replace("?", self.placeholder)
+
+    def record_runs(self, records):
+        if not records:
+            return
+        columns = list(records[0])
+        self.execute(
+            self.sql(f"INSERT INTO sat_runs ({', '.join(columns)}) VALUES ({', '.join('?' * len(columns))})"),
+            [
+                tuple(json.dumps(r[c], default=str) if c in self.JSON_FIELDS else r[c] for c in columns)
+                for r in records
+            ],
+            many=True,
+        )
+
+    def import_runs(self, runs):
+        """Insert runs exported from another store, skipping IDs already present; returns how many were new"""
+        runs = {run["id"]: run for run in runs}
+        if not runs:
+            return 0
+        existing = {
+            row["id"] for row in self.query(
+                self.sql(f"SELECT id FROM sat_runs WHERE id IN ({', '.join('?' * len(runs))})"), list(runs)
+            )
+        }
+        fresh = [{column: run.get(column) for column in self.COLUMNS} for run in runs.values() if run["id"] not in existing]
+        self.record_runs(fresh)
+        return len(fresh)
+
+    def _run(self, row):
+        run = dict(row)
+        for field in self.JSON_FIELDS:
+            if field in run:
+                value = run[field]
+                run[field] = json.loads(value) if isinstance(value, str) else value or {}
+        for field in ("cached", "hardware"):
+            if field in run:
+                run[field] = bool(run[field])
+        return run
+
+    def get_run(self, run_id):
+        rows = self.query(self.sql("SELECT * FROM sat_runs WHERE id = ?"), (run_id,))
+        return self._run(rows[0]) if rows else None
+
+    def runs_for_job(self, job_id):
+        rows = self.query(self.sql("SELECT * FROM sat_runs WHERE job_id = ? ORDER BY created, instance, solver, iteration"), (job_id,))
+        return [self._run(row) for row in rows]
+
+    def delete_job(self, job_id):
+        return self.execute(self.sql("DELETE FROM sat_runs WHERE job_id = ?"), (job_id,))
+
+    def _where(self, query):
+        """WHERE clause and its parameters for the filters in a parse_run_query query"""
+        conditions, params = [], []
+        for column in ("tenant", "job_id", "instance_hash", "problem_index"):
+            if query.get(column) is not None:
+                conditions.append(f"{column} = ?")
+                params.append(query[column])
+        for column in ("preset", "solver", "status"):
+            if query.get(column):
+                conditions.append(f"{column} IN ({', '.join('?' * len(query[column]))})")
+                params.extend(query[column])
+        if query.get("solved") is not None:
+            conditions.append("status = 'sat'" if query["solved"] else "status != 'sat'")
+        for column in ("hardware", "cached"):
+            if query.get(column) is not None:
+                conditions.append(f"{column} = ?")
+                params.append(query[column])
+        if query.get("since"):
+            conditions.append("created >= ?")
+            params.append(query["since"])
+        if query.get("until"):
+            conditions.append("created < ?")
+            params.append(query["until"])
+        return (f" WHERE {' AND '.join(conditions)}" if conditions else ""), params
+
+    def runs_matching(self, query, columns=("*",)):
+        """Every matching run, unpaged; pass only the columns needed when the match may be large"""
+        where, params = self._where(query)
+        rows = self.query(self.sql(f"SELECT {', '.join(columns)} FROM sat_runs{where}"), params)
+        return [self._run(row) for row in rows]
+
+    def list_runs(self, query):
+        """(page of runs, total matching, per-solver aggregates) for a parse_run_query query"""
+        where, params = self._where(query)
+        field, descending = query["sort"]
+        rows = self.query(
+            self.sql(f"SELECT * FROM sat_runs{where} ORDER BY {field} {'DESC' if descending else 'ASC'}, id "
+                     f"LIMIT ? OFFSET ?"),
+            params + [query["limit"], query["offset"]],
+        )
+        aggregates = self.query(
+            self.sql(
+                f"""
+                SELECT solver, COUNT(*) AS runs,
+                    SUM(CASE WHEN status = 'sat' THEN 1 ELSE 0 END) AS solved,
+                    AVG(solve_time_ms) AS mean_solve_time_ms,
+                    AVG(CASE WHEN status = 'sat' THEN solve_time_ms END) AS mean_solved_time_ms,
+                    MIN(solve_time_ms) AS min_solve_time_ms,
+                    MAX(solve_time_ms) AS max_solve_time_ms,
+                    AVG(energy_nj) AS mean_energy_nj,
+                    COUNT(DISTINCT instance_hash) AS instances
+                FROM sat_runs{where} GROUP BY solver ORDER BY solver
+            """
+            ),
+            params,
+        )
+        for aggregate in aggregates:
+            aggregate["solve_rate"] = aggregate["solved"] / aggregate["runs"] if aggregate["runs"] else None
+        total = sum(aggregate["runs"] for aggregate in aggregates)
+        return [self._run(row) for row in rows], total, aggregates
+
+    def instance_names(self, instance_hash, tenant=None):
+        """Every name runs of one instance were recorded under, with run counts"""
+        where, params = self._where({"instance_hash": instance_hash, "tenant": tenant})
+        return self.query(
+            self.sql(
+                f"""
+                SELECT instance, preset, COUNT(*) AS runs, COUNT(DISTINCT job_id) AS jobs,
+                    MIN(created) AS first_run, MAX(created) AS last_run
+                FROM sat_runs{where} GROUP BY instance, preset ORDER BY instance, preset
+            """
+            ),
+            params,
+        )
+
+    def duplicate_instances(self, tenant=None):
+        """Instances whose runs were recorded under more than one name, e.g. the same file in two presets"""
+        where, params = self._where({"tenant": tenant})
+        where += " AND instance_hash IS NOT NULL" if where else " WHERE instance_hash IS NOT NULL"
+        return self.query(
+            self.sql(
+                f"""
+                SELECT instance_hash, COUNT(DISTINCT instance) AS names, COUNT(*) AS runs
+                FROM sat_runs{where} GROUP BY instance_hash HAVING COUNT(DISTINCT instance) > 1
+                ORDER BY COUNT(DISTINCT instance) DESC, instance_hash
+            """
+            ),
+            params,
+        )
+
+class SQLiteResultStore(ResultStore):
+    """Runs in a SQLite file, by default the API's own database"""
+
+    def __init__(self, path):
+        self.path = Path(path)
+
+    @contextmanager
+    def connect(self):
+        conn = sqlite3.connect(str(self.path))
+        conn.row_factory = sqlite3.Row
+        try:
+            yield conn
+        finally:
+            conn.close()
+
+    def query(self, sql, params=()):
+        with self.connect() as conn:
+            return [dict_from_row(row) for row in conn.execute(sql, params)]
+
+    def execute(self, sql, params=(), many=False):
+        with self.connect() as conn:
+            cursor = conn.executemany(sql, params) if many else conn.execute(sql, params)
+            conn.commit()
+            return cursor.rowcount
+
+    def migrate(self):
+        self.path.parent.mkdir(parents=True, exist_ok=True)
+        with self.connect() as conn:
+            conn.executescript(
+                """
+                CREATE TABLE IF NOT EXISTS sat_runs (
+                    id TEXT PRIMARY KEY,
+                    job_id TEXT,
+                    tenant TEXT,
+                    instance TEXT,
+                    instance_hash TEXT,
+                    solver TEXT NOT NULL,
+                    iteration INTEGER,
+                    seed INTEGER,
+                    params TEXT,
+                    status TEXT NOT NULL,
+                    cached INTEGER NOT NULL DEFAULT 0,
+                    solve_time_ms REAL,
+                    simulated_time_ns REAL,
+                    energy_nj REAL,
+                    power_mw REAL,
+                    metrics TEXT,
+                    created TEXT NOT NULL
+                );
+                CREATE INDEX IF NOT EXISTS idx_sat_runs_job ON sat_runs(job_id);
+                CREATE INDEX IF NOT EXISTS idx_sat_runs_instance ON sat_runs(instance_hash, solver);
+                CREATE INDEX IF NOT EXISTS idx_sat_runs_created ON sat_runs(created);
+            """
+            )
+            existing = {row["name"] for row in conn.execute("PRAGMA table_info(sat_runs)")}
+            if "preset" not in existing:
+                conn.executescript(
+                    """
+                    ALTER TABLE sat_runs ADD COLUMN preset TEXT;
+                    ALTER TABLE sat_runs ADD COLUMN problem_index INTEGER;
+                    ALTER TABLE sat_runs ADD COLUMN hardware INTEGER NOT NULL DEFAULT 0;
+                    UPDATE sat_runs SET hardware = solver IN ('daedalus', 'race');
+                    -- Batch runs were labelled <preset>/<index>
+                    UPDATE sat_runs SET preset = substr(instance, 1, instr(instance, '/') - 1),
+                        problem_index = CAST(substr(instance, instr(instance, '/') + 1) AS INTEGER)
+                        WHERE job_id IS NOT NULL AND instance GLOB '?*/[0-9]*' AND instance NOT GLOB '*/*[^0-9]*';
+                    CREATE INDEX idx_sat_runs_preset ON sat_runs(preset, solver);
+                """
+                )
+            conn.commit()
+
+# Applied in order and recorded in schema_migrations; append new steps, never edit applied ones
+POSTGRES_MIGRATIONS = [
+    """
+    CREATE TABLE sat_runs (
+        id TEXT PRIMARY KEY,
+        job_id TEXT,
+        tenant TEXT,
+        instance TEXT,
+        instance_hash TEXT,
+        solver TEXT NOT NULL,
+        iteration INTEGER,
+        seed BIGINT,
+        params JSONB,
+        status TEXT NOT NULL,
+        cached BOOLEAN NOT NULL DEFAULT FALSE,
+        solve_time_ms DOUBLE PRECISION,
+        simulated_time_ns DOUBLE PRECISION,
+        energy_nj DOUBLE PRECISION,
+        power_mw DOUBLE PRECISION,
+        metrics JSONB,
+        created TEXT NOT NULL
+    );
+    CREATE INDEX idx_sat_runs_job ON sat_runs(job_id);
+    CREATE INDEX idx_sat_runs_instance ON sat_runs(instance_hash, solver);
+    CREATE INDEX idx_sat_runs_created ON sat_runs(created);
+    """,
+    """
+    ALTER TABLE sat_runs ADD COLUMN preset TEXT, ADD COLUMN problem_index INTEGER,
+        ADD COLUMN hardware BOOLEAN NOT NULL DEFAULT FALSE;
+    UPDATE sat_runs SET hardware = solver IN ('daedalus', 'race');
+    UPDATE sat_runs SET preset = split_part(instance, '/', 1), problem_index = split_part(instance, '/', 2)::integer
+        WHERE job_id IS NOT NULL AND instance ~ '^[^/]+/[0-9]+$';
+    CREATE INDEX idx_sat_runs_preset ON sat_runs(preset, solver);
+    """,
+]
+RESULTS_POSTGRES_DSN = os.getenv("RESULTS_POSTGRES_DSN", "")
+RESULTS_POSTGRES_POOL_MIN = int(os.getenv("RESULTS_POSTGRES_POOL_MIN", 1))
+RESULTS_POSTGRES_POOL_MAX = int(os.getenv("RESULTS_POSTGRES_POOL_MAX", 10))
+# Any fixed key shared by every API instance; serialises their migrations
+POSTGRES_MIGRATION_LOCK = 0x646163726F71
+
+class PostgresResultStore(ResultStore):
+    """Runs in PostgreSQL, so several API instances can share one store; needs psycopg2"""
+
+    placeholder = "%s"
+
+    def __init__(self, dsn, min_connections, max_connections):
+        import psycopg2.extras
+        import psycopg2.pool
+
+        self.extras = psycopg2.extras
+        self.pool = psycopg2.pool.ThreadedConnectionPool(min_connections, max_connections, dsn)
+
+    @contextmanager
+    def connect(self):
+        conn = self.pool.getconn()
+        try:
+            with conn:  # commits on success, rolls back on error
+                yield conn
+        finally:
+            self.pool.putconn(conn)
+
+    def query(self, sql, params=()):
+        with self.connect() as conn, conn.cursor(cursor_factory=self.extras.RealDictCursor) as cursor:
+            cursor.execute(sql, params)
+            return [dict(row) for row in cursor.fetchall()]
+
+    def execute(self, sql, params=(), many=False):
+        with self.connect() as conn, conn.cursor() as cursor:
+            if many:
+                self.extras.execute_batch(cursor, sql, params)
+            else:
+                cursor.execute(sql, params)
+            return cursor.rowcount
+
+    def migrate(self):
+        with self.connect() as conn, conn.cursor() as cursor:
+            cursor.execute("SELECT pg_advisory_xact_lock(%s)", (POSTGRES_MIGRATION_LOCK,))
+            cursor.execute(
+                "CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, applied TEXT NOT NULL)"
+            )
+            cursor.execute("SELECT COALESCE(MAX(version), 0) FROM schema_migrations")
+            current = cursor.fetchone()[0]
+            for version, statement in enumerate(POSTGRES_MIGRATIONS[current:], current + 1):
+                cursor.execute(statement)
+                cursor.execute("INSERT INTO schema_migrations (version, applied) VALUES (%s, %s)", (version, utc_now()))
+                logger.info(f"Results store: applied Postgres migration {version}")
+
+RESULT_STORES = {
+    "sqlite": lambda: SQLiteResultStore(RESULTS_DB_PATH),
+    "postgres": lambda: PostgresResultStore(
+        RESULTS_POSTGRES_DSN, RESULTS_POSTGRES_POOL_MIN, RESULTS_POSTGRES_POOL_MAX
+    ),
+}
+
+def make_result_store():
+    if RESULTS_STORE not in RESULT_STORES:
+        raise RuntimeError(f"RESULTS_STORE must be one of: {', '.join(RESULT_STORES)}")
+    if RESULTS_STORE == "postgres" and not RESULTS_POSTGRES_DSN:
+        raise RuntimeError("RESULTS_STORE=postgres needs RESULTS_POSTGRES_DSN")
+    return RESULT_STORES[RESULTS_STORE]()
+
+result_store = make_result_store()
+
+def record_job_runs(job_id, data, all_results, batch_mode):
+    """Persist every run of a finished job; failures are logged rather than failing the job"""
+    params = data.get("solver_config") or {}
+    records = []
+    if batch_mode:
+        for problem in all_results.get("batch_results", []):
+            preset, index = problem.get("satlib_benchmark"), problem.get("problem_index")
+            records.extend(run_records(job_id, f"{preset}/{index}", params, problem, data.get("tenant"), preset, index))
+    else:
+        source = data.get("dimacs_source") or {}
+        instance = source.get("upload") or source.get("url") or data.get("name")
+        records = run_records(job_id, instance, params, all_results, data.get("tenant"))
+    try:
+        result_store.record_runs(records)
+    except Exception as e:
+        logger.error(f"Could not store runs of {job_id}: {e}")
+        return 0
+    return len(records)
+
+def run_visible(run):
+    """Tenant keys see only their own runs; the main key sees every run"""
+    tenant = current_tenant()
+    return bool(run) and (not tenant or run.get("tenant") == tenant["name"])
+
+RUNS_DEFAULT_LIMIT = 100
+RUNS_MAX_LIMIT = 1000
+RUN_SORT_FIELDS = ("created", "solve_time_ms", "energy_nj", "solver", "preset", "problem_index", "status")
+RUN_STATUSES = ("sat", "unsat", "timeout", "error", "unknown")
+BOOLEAN_ARGS = {"true": True, "1": True, "false": False, "0": False}
+
+def parse_run_query(args):
+    """Filters, sort and page bounds for /runs; returns (query, errors)"""
+    query = {
+        "job_id": args.get("job_id"),
+        "instance_hash": args.get("instance_hash"),
+        "problem_index": None,
+        "limit": RUNS_DEFAULT_LIMIT,
+        "offset": 0,
+        "sort": ("created", True),
+    }
+    errors = []
+    for name in ("preset", "solver", "status"):
+        if args.get(name):
+            query[name] = [v.strip() for v in args.get(name).split(",") if v.strip()]
+    if set(query.get("status") or ()) - set(RUN_STATUSES):
+        errors.append(f"status must be one of: {', '.join(RUN_STATUSES)}")
+    for name in ("solved", "hardware", "cached"):
+        if args.get(name) is not None:
+            if args.get(name).lower() not in BOOLEAN_ARGS:
+                errors.append(f"{name} must be true or false")
+            else:
+                query[name] = BOOLEAN_ARGS[args.get(name).lower()]
+    for name in ("since", "until"):
+        if args.get(name):
+            try:
+                moment = datetime.fromisoformat(args.get(name))
+            except ValueError:
+                errors.append(f"{name} must be an ISO 8601 date or timestamp")
+                continue
+            # Stored timestamps are UTC ISO strings, which compare correctly as text
+            if not moment.tzinfo:
+                moment = moment.replace(tzinfo=timezone.utc)
+            query[name] = moment.astimezone(timezone.utc).isoformat()
+    for name, low, high in (("problem_index", 0, None), ("limit", 1, RUNS_MAX_LIMIT), ("offset", 0, None)):
+        if args.get(name) is not None:
+            try:
+                value = int(args.get(name))
+            except ValueError:
+                value = None
+            if value is None or value < low or (high is not None and value > high):
+                errors.append(f"{name} must be an integer between {low} and {high}" if high
+                              else f"{name} must be a non-negative integer")
+            else:
+                query[name] = value
+    if args.get("sort"):
+        field = args.get("sort").lstrip("-")
+        if field not in RUN_SORT_FIELDS:
+            errors.append(f"sort must be one of: {', '.join(RUN_SORT_FIELDS)} (prefix - for descending)")
+        else:
+            query["sort"] = (field, args.get("sort").startswith("-"))
+    tenant = current_tenant()
+    if tenant:
+        query["tenant"] = tenant["name"]
+    return query, errors
+
+@app.route("/runs", methods=["GET"])
+def runs_list():
+    """Stored runs filtered by preset, solver, status, date range, problem index or hardware, with aggregates"""
+    try:
+        query, errors = parse_run_query(request.args)
+        if errors:
+            return error_response("Invalid query", 400, details={"errors": errors})
+        runs, total, aggregates = result_store.list_runs(query)
+        return jsonify({
+            "runs": runs,
+            "total_count": total,
+            "offset": query["offset"],
+            "limit": query["limit"],
+            "sort": ("-" if query["sort"][1] else "") + query["sort"][0],
+            "aggregates": {
+                "by_solver": aggregates,
+                "runs": total,
+                "solved": sum(a["solved"] for a in aggregates),
+            },
+        })
+    except Exception as e:
+        logger.error(f"Error listing runs: {e}")
+        return exception_response(e)
+
+import statistics
+
+# Unsolved runs score twice the cutoff under PAR-2; runs made without a cutoff use this one
+LEADERBOARD_DEFAULT_CUTOFF_SECONDS = float(os.getenv("LEADERBOARD_DEFAULT_CUTOFF_SECONDS", 60))
+LEADERBOARD_METRICS = ("par2", "median_tts", "energy")
+LEADERBOARD_COLUMNS = ("solver", "params", "status", "solve_time_ms", "energy_nj")
+
+def parse_window(window):
+    """since-timestamp for "all" (None) or "<days>d"; raises ValueError"""
+    if window == "all":
+        return None
+    match = re.fullmatch(r"(\d+)d", window)
+    if not match or not int(match.group(1)):
+        raise ValueError(window)
+    return (datetime.now(timezone.utc) - timedelta(days=int(match.group(1)))).isoformat()
+
+def leaderboard_entries(runs):
+    """Score each solver and board configuration: PAR-2, median time-to-solution and energy-to-solution"""
+    groups = defaultdict(list)
+    for run in runs:
+        groups[(run["solver"], run["params"].get("device_id"))].append(run)
+    entries = []
+    for (solver, device_id), group in groups.items():
+        solved, penalties = [], []
+        for run in group:
+            # A complete solver proving UNSAT has solved the instance as much as one finding a model
+            if run["status"] in ("sat", "unsat") and run["solve_time_ms"] is not None:
+                solved.append(run)
+                penalties.append(run["solve_time_ms"] / 1000)
+            else:
+                penalties.append(2 * (run["params"].get("cutoff_seconds") or LEADERBOARD_DEFAULT_CUTOFF_SECONDS))
+        energies = [r["energy_nj"] for r in solved if r["energy_nj"] is not None]
+        entries.append({
+            "solver": solver,
+            "device_id": device_id,
+            "configuration": f"{solver}@{device_id}" if device_id else solver,
+            "runs": len(group),
+            "solved": len(solved),
+            "solve_rate": len(solved) / len(group),
+            "par2_seconds": sum(penalties) / len(penalties),
+            "median_tts_ms": statistics.median(r["solve_time_ms"] for r in solved) if solved else None,
+            "median_energy_nj": statistics.median(energies) if energies else None,
+        })
+    return entries
+
+@app.route("/leaderboard", methods=["GET"])
+def leaderboard():
+    """Rank solvers and board configurations on a preset by PAR-2, median TTS or energy-to-solution"""
+    try:
+        preset = request.args.get("preset")
+        if not preset:
+            return error_response("Missing required field: preset", 400, "missing_field", {"field": "preset"})
+        metric = request.args.get("metric", "par2")
+        if metric not in LEADERBOARD_METRICS:
+            return error_response(f"metric must be one of: {', '.join(LEADERBOARD_METRICS)}", 400)
+        window = request.args.get("window", "all")
+        try:
+            since = parse_window(window)
+        except ValueError:
+            return error_response('window must be "all" or a number of days such as "30d"', 400)
+
+        tenant = current_tenant()
+        query = {"preset": [preset], "since": since, "cached": False, "tenant": tenant["name"] if tenant else None}
+        entries = leaderboard_entries(result_store.runs_matching(query, LEADERBOARD_COLUMNS))
+        key = {"par2": "par2_seconds", "median_tts": "median_tts_ms", "energy": "median_energy_nj"}[metric]
+        # Configurations that never solved anything have no TTS or energy and rank last
+        entries.sort(key=lambda e: (e[key] is None, e[key] if e[key] is not None else 0, -e["solve_rate"]))
+        for rank, entry in enumerate(entries, 1):
+            entry["rank"] = rank
+        return jsonify({
+            "preset": preset,
+            "metric": metric,
+            "window": window,
+            "since": since,
+            "default_cutoff_seconds": LEADERBOARD_DEFAULT_CUTOFF_SECONDS,
+            "entries": entries,
+        })
+    except Exception as e:
+        logger.error(f"Error building leaderboard: {e}")
+        return exception_response(e)
+
+# ------------------------------ Analysis ---------------------------------------
+ANALYSIS_COLUMNS = ("solver", "instance_hash", "preset", "instance", "problem_index", "status", "solve_time_ms")
+# As on the leaderboard, proving UNSAT solves an instance
+SOLVED_STATUSES = ("sat", "unsat")
+
+def instance_key(run):
+    """Runs of one instance share a key: its canonical hash where known, else where it came from"""
+    return run["instance_hash"] or f"{run['preset']}/{run['instance']}/{run['problem_index']}"
+
+def instance_times(runs):
+    """{solver: {instance key: [solve_time_ms, or inf for a run that didn't solve it]}}"""
+    times = defaultdict(lambda: defaultdict(list))
+    for run in runs:
+        solved = run["status"] in SOLVED_STATUSES and run["solve_time_ms"] is not None
+        times[run["solver"]][instance_key(run)].append(run["solve_time_ms"] if solved else math.inf)
+    return times
+
+def cactus_curves(runs):
+    """Per solver, the sorted solve times of the instances it solved: instances solved within each time budget
+
+    An instance run several times counts at its lower median, so it is solved only when at
+    least half of its runs were.
+    """
+    curves = {}
+    for solver, instances in instance_times(runs).items():
+        medians = [statistics.median_low(times) for times in instances.values()]
+        solved = sorted(t for t in medians if t != math.inf)
+        curves[solver] = {
+            "instances": len(instances),
+            "solved": len(solved),
+            "points": [
+                {"time_ms": t, "solved": i, "solved_fraction": i / len(instances)}
+                for i, t in enumerate(solved, 1)
+            ],
+        }
+    return curves
+
+def parse_list_arg(args, name):
+    return [v.strip() for v in args.get(name, "").split(",") if v.strip()]
+
+@app.route("/analysis/cactus", methods=["GET"])
+def analysis_cactus():
+    """Cactus plot (instances solved against time budget) per solver on one or more presets, from stored runs"""
+    try:
+        presets = parse_list_arg(request.args, "presets")
+        if not presets:
+            return error_response("Missing required field: presets", 400, "missing_field", {"field": "presets"})
+        solvers = parse_list_arg(request.args, "solvers")
+        tenant = current_tenant()
+        query = {"preset": presets, "solver": solvers, "cached": False, "tenant": tenant["name"] if tenant else None}
+        runs = result_store.runs_matching(query, ANALYSIS_COLUMNS)
+        return jsonify({
+            "presets": presets,
+            "solvers": solvers or sorted({run["solver"] for run in runs}),
+            # Solvers may not have attempted every instance; this is the union, for a common y-axis
+            "instances": len({instance_key(run) for run in runs}),
+            "curves": cactus_curves(runs),
+        })
+    except Exception as e:
+        logger.error(f"Error building cactus plot: {e}")
+        return exception_response(e)
+
+# Paired comparison of two solver configurations
+COMPARE_MAX_RUNS = int(os.getenv("COMPARE_MAX_RUNS", 50))
+COMPARE_BOOTSTRAP_SAMPLES = 2000
+COMPARE_MAX_BOOTSTRAP_SAMPLES = 20000
+COMPARE_DEFAULT_TIE_TOLERANCE = 0.05
+COMPARE_COLUMNS = ANALYSIS_COLUMNS + ("params",)
+# Settings that change neither a run's outcome nor its time; runs differing only in these are paired
+COMPARE_IGNORED_FIELDS = {"device_id", "host_active_power_w", "host_idle_power_w"}
+# Exact signed-rank distribution up to this many nonzero differences; normal approximation above
+WILCOXON_EXACT_MAX_N = 25
+# Floor for speedup ratios, so a 0 ms run doesn't divide by zero
+COMPARE_MIN_TIME_MS = 1e-3
+
+def parse_configuration(value, name):
+    """{"solver", "solver_config"} for one side of a comparison; returns (configuration, errors)"""
+    if isinstance(value, str):
+        value = {"solver": value}
+    if not isinstance(value, dict) or not isinstance(value.get("solver"), str):
+        return None, [f"{name} must be a solver name or an object with solver and optional solver_config"]
+    if value["solver"] not in SOLVER_TYPE_FLAGS:
+        return None, [f"{name}.solver must be one of: {', '.join(SOLVER_TYPE_FLAGS)}"]
+    overrides = value.get("solver_config") or {}
+    resolved, errors = resolve_solver_config(overrides)
+    if errors:
+        return None, [f"{name}.solver_config: {error}" for error in errors]
+    # Stored runs are selected on every setting that affects results, defaults included
+    return {
+        "solver": value["solver"],
+        "solver_config": {field: resolved[field] for field in overrides},
+        "resolved_config": resolved,
+        "match_config": {field: v for field, v in resolved.items() if field not in COMPARE_IGNORED_FIELDS},
+    }, []
+
+def configuration_runs(runs, configuration):
+    """Runs made with exactly this configuration; settings added since a run was stored count as their default"""
+    return [
+        run for run in runs
+        if run["solver"] == configuration["solver"]
+        and all(run["params"].get(field, SOLVER_CONFIG_FIELDS[field][3]) == v
+                for field, v in configuration["match_config"].items())
+    ]
+
+def penalized_times(runs):
+    """{instance key: lower-median solve time}, unsolved runs scoring PAR-2 (twice their cutoff)"""
+    times = defaultdict(list)
+    for run in runs:
+        if run["status"] in SOLVED_STATUSES and run["solve_time_ms"] is not None:
+            times[instance_key(run)].append((run["solve_time_ms"], True))
+        else:
+            cutoff = run["params"].get("cutoff_seconds") or LEADERBOARD_DEFAULT_CUTOFF_SECONDS
+            times[instance_key(run)].append((2 * cutoff * 1000, False))
+    return {key: statistics.median_low(values) for key, values in times.items()}
+
+def _signed_rank_counts(n):
+    """Number of subsets of ranks 1..n summing to each total"""
+    counts = [1] + [0] * (n * (n + 1) // 2)
+    for rank in range(1, n + 1):
+        for total in range(len(counts) - 1, rank - 1, -1):
+            counts[total] += counts[total - rank]
+    return counts
+
+def wilcoxon_signed_rank(differences):
+    """Two-sided Wilcoxon signed-rank test; zero differences are dropped (Wilcoxon's method)
+
+    Exact for small samples without tied magnitudes, else the normal approximation with tie
+    and continuity corrections.
+    """
+    nonzero = sorted((d for d in differences if d != 0), key=abs)
+    n = len(nonzero)
+    if not n:
+        return {"statistic": None, "n": 0, "p_value": None, "method": None}
+    # Average ranks over runs of equal magnitude
+    ranks, ties, i = [], [], 0
+    while i < n:
+        j = i
+        while j + 1 < n and abs(nonzero[j + 1]) == abs(nonzero[i]):
+            j += 1
+        ranks.extend([(i + j + 2) / 2] * (j - i + 1))
+        ties.append(j - i + 1)
+        i = j + 1
+    w_plus = sum(rank for rank, d in zip(ranks, nonzero) if d > 0)
+    mean = n * (n + 1) / 4
+    if n <= WILCOXON_EXACT_MAX_N and all(t == 1 for t in ties):
+        counts = _signed_rank_counts(n)
+        total = 2 ** n
+        w = int(w_plus)
+        tail = min(sum(counts[:w + 1]), sum(counts[w:])) / total
+        return {"statistic": w_plus, "n": n, "p_value": min(1.0, 2 * tail), "method": "exact"}
+    variance = n * (n + 1) * (2 * n + 1) / 24 - sum(t ** 3 - t for t in ties) / 48
+    if variance <= 0:
+        return {"statistic": w_plus, "n": n, "p_value": 1.0, "method": "normal"}
+    z = (abs(w_plus - mean) - 0.5) / math.sqrt(variance)
+    return {"statistic": w_plus, "n": n, "p_value": min(1.0, math.erfc(max(z, 0.0) / math.sqrt(2))), "method": "normal"}
+
+def bootstrap_median_ci(values, samples, seed, confidence=TTS_CONFIDENCE):
+    """Percentile bootstrap interval for the median, resampling instances"""
+    rng = random.Random(seed)
+    medians = sorted(statistics.median(rng.choices(values, k=len(values))) for _ in range(samples))
+    alpha = (1 - confidence) / 2
+    return [medians[int(alpha * (samples - 1))], medians[int(round((1 - alpha) * (samples - 1)))]]
+
+def compare_configurations(a_times, b_times, tie_tolerance, bootstrap_samples, seed):
+    """Paired statistics over the instances both configurations ran"""
+    paired = sorted(set(a_times) & set(b_times))
+    instances, wins = [], {"a": 0, "b": 0, "tie": 0}
+    for key in paired:
+        (a_ms, a_solved), (b_ms, b_solved) = a_times[key], b_times[key]
+        if not a_solved and not b_solved or abs(a_ms - b_ms) <= tie_tolerance * max(a_ms, b_ms):
+            winner = "tie"
+        else:
+            winner = "a" if a_ms < b_ms else "b"
+        wins[winner] += 1
+        instances.append({"instance": key, "a_ms": a_ms, "a_solved": a_solved,
+                          "b_ms": b_ms, "b_solved": b_solved, "winner": winner})
+
+    speedups = [max(i["b_ms"], COMPARE_MIN_TIME_MS) / max(i["a_ms"], COMPARE_MIN_TIME_MS) for i in instances]
+    return {
+        "paired_instances": len(paired),
+        "unpaired": {"a_only": len(set(a_times) - set(b_times)), "b_only": len(set(b_times) - set(a_times))},
+        "wins": wins,
+        "tie_tolerance": tie_tolerance,
+        "wilcoxon": dict(wilcoxon_signed_rank([i["a_ms"] - i["b_ms"] for i in instances]), alternative="two-sided"),
+        "median_speedup": {
+            "value": statistics.median(speedups) if speedups else None,
+            "ci": bootstrap_median_ci(speedups, bootstrap_samples, seed) if speedups else [None, None],
+            "confidence": TTS_CONFIDENCE,
+            "bootstrap_samples": bootstrap_samples,
+            "seed": seed,
+        },
+        "instances": instances,
+    }
+
+def missing_preset_runs(presets, configurations, runs):
+    """(preset, file entry, side) for each preset file a configuration has no stored run of"""
+    have = {side: {run["instance_hash"] for run in configuration_runs(runs, configuration)}
+            for side, configuration in configurations.items()}
+    missing = []
+    for preset in presets:
+        for entry in preset_index_for(preset).entries(preset):
+            for side in configurations:
+                if entry.get("instance_hash") and entry["instance_hash"] not in have[side]:
+                    missing.append((preset, entry, side))
+    return missing
+
+def run_comparison_instance(preset, entry, configuration, tenant_name):
+    """Solve one preset file with one configuration in the request and store its run"""
+    solver = configuration["solver"]
+    flags = SOLVER_TYPE_FLAGS[solver]
+    results = cached_single_sat_test(
+        resolve_preset_file(entry["id"]).read_text(), flags.get("enable_minisat", False),
+        flags.get("enable_walksat", False), False, 1,
+        enable_cube=flags.get("enable_cube_and_conquer", False),
+        enable_oscillator=flags.get("enable_oscillator", False),
+        solver_config=configuration["resolved_config"],
+        enable_ising=flags.get("enable_ising", False),
+        use_cache=False,
+    )
+    result_store.record_runs(run_records(
+        None, entry["id"], configuration["resolved_config"], results, tenant_name, preset=preset
+    ))
+
+@app.route("/analysis/compare", methods=["POST"])
+def analysis_compare():
+    """Paired comparison of two solver configurations on the same presets: Wilcoxon test, speedup CI, wins"""
+    data = request.get_json(silent=True) or {}
+    errors = []
+    configurations = {}
+    for side in ("a", "b"):
+        configuration, side_errors = parse_configuration(data.get(side), side)
+        errors.extend(side_errors)
+        if configuration:
+            configurations[side] = configuration
+    presets = data.get("presets")
+    if not isinstance(presets, list) or not presets or not all(isinstance(p, str) for p in presets):
+        errors.append("presets must be a non-empty list of preset names")
+    run_missing = data.get("run_missing", False)
+    if not isinstance(run_missing, bool):
+        errors.append("run_missing must be true or false")
+    tie_tolerance = data.get("tie_tolerance", COMPARE_DEFAULT_TIE_TOLERANCE)
+    if isinstance(tie_tolerance, bool) or not isinstance(tie_tolerance, (int, float)) or not 0 <= tie_tolerance < 1:
+        errors.append("tie_tolerance must be a number from 0 to below 1")
+    samples = data.get("bootstrap_samples", COMPARE_BOOTSTRAP_SAMPLES)
+    if isinstance(samples, bool) or not isinstance(samples, int) or not 100 <= samples <= COMPARE_MAX_BOOTSTRAP_SAMPLES:
+        errors.append(f"bootstrap_samples must be an integer from 100 to {COMPARE_MAX_BOOTSTRAP_SAMPLES}")
+    seed = data.get("seed", 0)
+    if isinstance(seed, bool) or not isinstance(seed, int):
+        errors.append("seed must be an integer")
+    if errors:
+        return error_response("Invalid comparison", 400, details={"errors": errors})
+    if configurations["a"]["solver"] == configurations["b"]["solver"] and \
+            configurations["a"]["match_config"] == configurations["b"]["match_config"]:
+        return error_response("a and b are the same configuration", 400)
+
+    try:
+        tenant = current_tenant()
+        tenant_name = tenant["name"] if tenant else None
+        query = {"preset": presets, "solver": sorted({c["solver"] for c in configurations.values()}),
+                 "cached": False, "tenant": tenant_name}
+        runs = result_store.runs_matching(query, COMPARE_COLUMNS)
+
+        ran = {"a": 0, "b": 0}
+        if run_missing:
+            unknown = [p for p in presets if not preset_index_for(p)]
+            if unknown:
+                return error_response("Preset not found", 404, details={"presets": unknown})
+            missing = missing_preset_runs(presets, configurations, runs)
+            not_runnable = sorted({configurations[side]["solver"] for _, _, side in missing} - set(SOLVE_ONE_SOLVERS))
+            if not_runnable:
+                return error_response(
+                    "Only software solvers can be run here; submit hardware runs through /jobs",
+                    400, details={"solvers": not_runnable},
+                )
+            if len(missing) > COMPARE_MAX_RUNS:
+                return error_response(
+                    f"{len(missing)} runs are missing; at most {COMPARE_MAX_RUNS} are run per request",
+                    400, details={"missing_runs": len(missing), "max_runs": COMPARE_MAX_RUNS},
+                )
+            if missing and tenant:
+                budget_error = check_solve_budget(tenant)
+                if budget_error:
+                    return budget_error
+            started = time.time()
+            try:
+                for preset, entry, side in missing:
+                    run_comparison_instance(preset, entry, configurations[side], tenant_name)
+                    ran[side] += 1
+            finally:
+                if missing and tenant:
+                    charge_solve_seconds(tenant_name, time.time() - started)
+            if missing:
+                runs = result_store.runs_matching(query, COMPARE_COLUMNS)
+
+        times = {side: penalized_times(configuration_runs(runs, c)) for side, c in configurations.items()}
+        result = compare_configurations(times["a"], times["b"], tie_tolerance, samples, seed)
+        return jsonify({
+            "presets": presets,
+            **{side: {
+                "solver": c["solver"],
+                "solver_config": c["solver_config"],
+                "instances": len(times[side]),
+                "solved": sum(1 for _, solved in times[side].values() if solved),
+                "ran": ran[side],
+            } for side, c in configurations.items()},
+            # Speedup is b's time over a's: above 1 means a is faster
+            **result,
+        })
+    except Exception as e:
+        logger.error(f"Error comparing configurations: {e}")
+        return exception_response(e)
+
+@app.route("/runs/<run_id>", methods=["GET"])
+def run_detail(run_id):
+    """One stored solver run"""
+    try:
+        run = result_store.get_run(run_id)
+        if not run_visible(run):
+            return error_response("Run not found", 404)
+        return jsonify(run)
+    except Exception as e:
+        logger.error(f"Error getting run {run_id}: {e}")
+        return exception_response(e)
+
+# ------------------------------ Instances ------------------------------------
+# An instance is identified by instance_hash, the hash of its normalized clause set, so the same
+# formula reached through different presets, uploads or URLs shares one identity and its runs join up.
+def preset_files_by_hash():
+    """instance_hash -> preset file ids across the presets the caller can see"""
+    files = defaultdict(list)
+    for index in visible_preset_indexes():
+        for preset in index.preset_names():
+            for entry in index.entries(preset):
+                if entry.get("instance_hash"):
+                    files[entry["instance_hash"]].append(entry["id"])
+    return files
+
+def upload_files_by_hash():
+    """instance_hash -> "<upload_id>/<filename>" references among the caller's uploads"""
+    files = defaultdict(list)
+    for meta in sorted(uploads_root(current_tenant()).glob("*/upload.json")):
+        upload = json.loads(meta.read_text())
+        for f in upload["files"]:
+            if f.get("instance_hash"):
+                files[f["instance_hash"]].append(f"{upload['upload_id']}/{f['filename']}")
+    return files
+
+@app.route("/instances/<instance_hash>", methods=["GET"])
+def instance_detail(instance_hash):
+    """Every preset file, upload and stored run that is this instance, with per-solver aggregates"""
+    try:
+        if not re.fullmatch(r"[0-9a-f]{64}", instance_hash):
+            return error_response("instance_hash must be 64 lowercase hex characters", 400)
+        tenant = current_tenant()
+        tenant_name = tenant["name"] if tenant else None
+        names = result_store.instance_names(instance_hash, tenant_name)
+        _, total, aggregates = result_store.list_runs({
+            "instance_hash": instance_hash, "tenant": tenant_name, "sort": ("created", True), "limit": 0, "offset": 0,
+        })
+        presets, uploads = preset_files_by_hash()[instance_hash], upload_files_by_hash()[instance_hash]
+        if not (names or presets or uploads):
+            return error_response("Instance not found", 404)
+        return jsonify({
+            "instance_hash": instance_hash,
+            "preset_files": presets,
+            "uploads": uploads,
+            "run_names": names,
+            "known_answer": lookup_known_answer(instance_hash),
+            "total_runs": total,
+            "aggregates": aggregates,
+            "runs": api_path(f"/runs?instance_hash={instance_hash}"),
+        })
+    except Exception as e:
+        logger.error(f"Error describing instance {instance_hash}: {e}")
+        return exception_response(e)
+
+@app.route("/instances/duplicates", methods=["GET"])
+def instance_duplicates():
+    """Instances that appear under more than one name among presets, uploads or stored runs"""
+    try:
+        tenant = current_tenant()
+        presets, uploads = preset_files_by_hash(), upload_files_by_hash()
+        stored = {row["instance_hash"]: row for row in result_store.duplicate_instances(tenant["name"] if tenant else None)}
+        duplicates = []
+        for hash_value in sorted(set(presets) | set(uploads) | set(stored)):
+            files = presets.get(hash_value, []) + uploads.get(hash_value, [])
+            if len(files) > 1 or hash_value in stored:
+                duplicates.append({
+                    "instance_hash": hash_value,
+                    "preset_files": presets.get(hash_value, []),
+                    "uploads": uploads.get(hash_value, []),
+                    "run_name_count": stored[hash_value]["names"] if hash_value in stored else 0,
+                    "url": api_path(f"/instances/{hash_value}"),
+                })
+        return jsonify({"duplicates": duplicates, "total_count": len(duplicates)})
+    except Exception as e:
+        logger.error(f"Error listing duplicate instances: {e}")
+        return exception_response(e)
+
+# ------------------------------ Results Archive ------------------------------
+# A results archive is gzipped JSON lines: a header, then each job's test bundle, then its runs. It moves
+# benchmark history between instances, e.g. from the public server to an offline analysis machine.
+RESULTS_ARCHIVE_FORMAT = "dacroq-results"
+RESULTS_ARCHIVE_VERSION = 1
+RESULTS_IMPORT_MAX_BYTES = int(os.getenv("RESULTS_IMPORT_MAX_BYTES", 1024 * 1024 * 1024))
+RESULTS_IMPORT_BATCH = 500
+
+class ResultsArchiveError(ValueError):
+    pass
+
+def export_results(query, include_jobs=True):
+    """Yield the records of an archive of the runs matching a parse_run_query query (limit and offset ignored)"""
+    runs = result_store.runs_matching(query)
+    job_ids = sorted({run["job_id"] for run in runs if run["job_id"]}) if include_jobs else []
+    yield {
+        "format": RESULTS_ARCHIVE_FORMAT,
+        "version": RESULTS_ARCHIVE_VERSION,
+        "exported_at": utc_now(),
+        "source": socket.gethostname(),
+        "filters": {k: v for k, v in query.items() if k not in ("limit", "offset", "sort") and v is not None},
+        "runs": len(runs),
+        "jobs": len(job_ids),
+    }
+    for job_id in job_ids:
+        bundle = load_result_bundle(job_id)
+        if bundle:
+            yield {"type": "job", **bundle}
+    for run in runs:
+        yield {"type": "run", "run": run}
+
+def gzip_json_lines(records):
+    """Stream records as gzip-compressed JSON lines"""
+    compressor = zlib.compressobj(wbits=31)  # 31: gzip container
+    for record in records:
+        chunk = compressor.compress((json.dumps(record, default=str) + "\n").encode())
+        if chunk:
+            yield chunk
+    yield compressor.flush()
+
+def import_job(bundle):
+    """Add an exported test and its results unless a test with that ID exists; returns whether it was added"""
+    test = bundle["test"]
+    with get_db() as conn:
+        if conn.execute("SELECT 1 FROM tests WHERE id = ?", (test["id"],)).fetchone():
+            return False
+        conn.execute(
+            """
+            INSERT INTO tests (id, name, chip_type, test_mode, environment, config, status, created, metadata)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+        """,
+            (test["id"], test["name"], test["chip_type"], test.get("test_mode"), test.get("environment"),
+             json.dumps(test.get("config") or {}), test["status"], test["created"], json.dumps(test.get("metadata") or {})),
+        )
+        conn.executemany(
+            "INSERT INTO test_results (id, test_id, iteration, timestamp, results) VALUES (?, ?, ?, ?, ?)",
+            [(r["id"], test["id"], r["iteration"], r["timestamp"], json.dumps(r.get("results") or {}))
+             for r in bundle.get("results", [])],
+        )
+        conn.commit()
+    return True
+
+def import_results(lines):
+    """Load an archive from an iterable of JSON lines; jobs and runs already present are skipped"""
+    lines = iter(lines)
+    try:
+        header = json.loads(next(lines))
+    except (StopIteration, ValueError):
+        raise ResultsArchiveError("Not a results archive: the first line must be its JSON header")
+    if header.get("format") != RESULTS_ARCHIVE_FORMAT or header.get("version") != RESULTS_ARCHIVE_VERSION:
+        raise ResultsArchiveError(
+            f"Unsupported archive: expected {RESULTS_ARCHIVE_FORMAT} version {RESULTS_ARCHIVE_VERSION}, "
+            f"got {header.get('format')} version {header.get('version')}"
+        )
+
+    counts = {"jobs": 0, "jobs_skipped": 0, "runs": 0, "runs_skipped": 0}
+    batch = []
+
+    def flush():
+        added = result_store.import_runs(batch)
+        counts["runs"] += added
+        counts["runs_skipped"] += len(batch) - added
+        batch.clear()
+
+    for number, line in enumerate(lines, 2):
+        if not line.strip():
+            continue
+        try:
+            record = json.loads(line)
+            if record.get("type") == "job":
+                counts["jobs" if import_job(record) else "jobs_skipped"] += 1
+            elif record.get("type") == "run":
+                if not record["run"].get("id"):
+                    raise KeyError("id")
+                batch.append(record["run"])
+                if len(batch) >= RESULTS_IMPORT_BATCH:
+                    flush()
+            else:
+                raise ResultsArchiveError(f"Line {number}: unknown record type {record.get('type')!r}")
+        except (ValueError, KeyError, TypeError) as e:
+            if isinstance(e, ResultsArchiveError):
+                raise
+            raise ResultsArchiveError(f"Line {number}: malformed record ({e})")
+    flush()
+    return {"source": header.get("source"), "exported_at": header.get("exported_at"), **counts}
+
+@app.route("/runs/export", methods=["GET"])
+def runs_export():
+    """Download the runs matching the /runs filters, and the jobs they belong to, as a results archive"""
+    query, errors = parse_run_query(request.args)
+    if request.args.get("jobs", "true").lower() not in BOOLEAN_ARGS:
+        errors.append("jobs must be true or false")
+    if errors:
+        return error_response("Invalid query", 400, details={"errors": errors})
+    include_jobs = BOOLEAN_ARGS[request.args.get("jobs", "true").lower()]
+    filename = f"dacroq-results-{datetime.now(timezone.utc):%Y%m%dT%H%M%SZ}.jsonl.gz"
+    return Response(
+        stream_with_context(gzip_json_lines(export_results(query, include_jobs))),
+        mimetype="application/gzip",
+        headers={"Content-Disposition": f'attachment; filename="{filename}"'},
+    )
+
+@app.route("/runs/import", methods=["POST"])
+def runs_import():
+    """Load a results archive from /runs/export or export-results; existing jobs and runs are kept"""
+    if current_tenant():
+        return error_response("Importing results needs the main API key", 403, "forbidden")
+    if request.content_length is not None and request.content_length > RESULTS_IMPORT_MAX_BYTES:
+        return error_response(f"Archive is larger than {RESULTS_IMPORT_MAX_BYTES} bytes", 413,
+                              details={"limit_bytes": RESULTS_IMPORT_MAX_BYTES})
+    try:
+        stream = get_input_stream(request.environ, safe_fallback=False)
+        with gzip.open(stream, "rt", encoding="utf-8") as lines:
+            counts = import_results(lines)
+    except ResultsArchiveError as e:
+        return error_response(str(e), 400, "parse_error")
+    except (OSError, EOFError, UnicodeDecodeError) as e:
+        return error_response(f"Archive is not valid gzip: {e}", 400, "parse_error")
+    except Exception as e:
+        logger.error(f"Results import error: {e}")
+        return exception_response(e)
+    logger.info(f"Imported results from {counts['source']}: {counts['jobs']} jobs, {counts['runs']} runs "
+                f"({counts['jobs_skipped']} jobs and {counts['runs_skipped']} runs already present)")
+    return jsonify(counts)
+
+RESULTS_COMMANDS = ("export-results", "import-results")
+
+def results_command(argv):
+    """python main.py export-results|import-results ...: move results without running the server"""
+    import argparse
+
+    parser = argparse.ArgumentParser(prog="main.py")
+    commands = parser.add_subparsers(dest="command", required=True)
+    export = commands.add_parser("export-results", help="Write a results archive")
+    export.add_argument("output", help="Archive path, or - for stdout")
+    export.add_argument("--filter", action="append", default=[], metavar="NAME=VALUE",
+                        help="A /runs filter such as preset=uf20-91 or since=2025-01-01; repeatable")
+    export.add_argument("--no-jobs", action="store_true", help="Runs only, without their jobs' test bundles")
+    load = commands.add_parser("import-results", help="Load a results archive")
+    load.add_argument("input", help="Archive path, or - for stdin")
+    args = parser.parse_args(argv)
+
+    init_db()
+    result_store.migrate()
+    if args.command == "export-results":
+        query, errors = parse_run_query(dict(f.partition("=")[::2] for f in args.filter))
+        if errors:
+            parser.error("; ".join(errors))
+        output = sys.stdout.buffer if args.output == "-" else open(args.output, "wb")
+        with output:
+            for chunk in gzip_json_lines(export_results(query, not args.no_jobs)):
+                output.write(chunk)
+        return 0
+
+    source = sys.stdin.buffer if args.input == "-" else open(args.input, "rb")
+    try:
+        with gzip.open(source, "rt", encoding="utf-8") as lines:
+            counts = import_results(lines)
+    except (ResultsArchiveError, OSError, EOFError) as e:
+        logger.error(f"Import failed: {e}")
+        return 1
+    print(json.dumps(counts, indent=2))
+    return 0
+
+# ------------------------------ Jobs -----------------------------------------
+from flask import Response, stream_with_context
+
+JOB_EVENTS_KEEPALIVE_SECONDS = float(os.getenv("JOB_EVENTS_KEEPALIVE_SECONDS", 15))
+
+# A job is a SAT test seen through a submit/status/result API; the tests table is its store
+def job_links(job_id):
+    return {
+        "self": api_path(f"/jobs/{job_id}"),
+        "results": api_path(f"/jobs/{job_id}/results"),
+        "events": api_path(f"/jobs/{job_id}/events"),
+        "download": api_path(f"/jobs/{job_id}/download"),
+        "runs": api_path(f"/jobs/{job_id}/runs"),
+    }
+
+def load_job(job_id):
+    with get_db() as conn:
+        row = conn.execute("SELECT * FROM tests WHERE id = ? AND chip_type = 'SAT'", (job_id,)).fetchone()
+    if not row:
+        return None
+    job = dict_from_row(row)
+    for field in ("config", "metadata"):
+        job[field] = json.loads(job[field]) if job.get(field) else {}
+    return job
+
+def job_progress(job):
+    """Files completed, current file and an ETA extrapolated from the pace so far"""
+    config, metadata = job["config"], job["metadata"]
+    summary = metadata.get("summary") or {}
+    total = metadata.get("total_problems") or len(config.get("problem_indices") or []) or 1
+    completed = metadata.get("problems_completed", summary.get("problem_count", 0))
+    if job["status"] == "completed":
+        completed = summary.get("problem_count", total)
+
+    current_index = metadata.get("current_problem_index")
+    current_file = None
+    if job["status"] == "running" and current_index is not None:
+        current_file = f"{config.get('satlib_benchmark')}/{current_index}" if config.get("satlib_benchmark") else None
+
+    elapsed = (datetime.now(timezone.utc) - datetime.fromisoformat(job["created"])).total_seconds()
+    eta = None
+    if job["status"] == "running" and completed:
+        eta = elapsed / completed * max(total - completed, 0)
+    return {
+        "files_completed": completed,
+        "total_files": total,
+        "current_file": current_file,
+        "percent": 100.0 if job["status"] == "completed" else metadata.get("progress_percent", 0),
+        "elapsed_seconds": elapsed if job["status"] == "running" else None,
+        "eta_seconds": eta,
+        "hardware_queue": hardware_queue_position(job["id"]) if job["status"] == "running" else None,
+    }
+
+NDJSON_MIMETYPE = "application/x-ndjson"
+
+def wants_ndjson():
+    return NDJSON_MIMETYPE in request.headers.get("Accept", "")
+
+def stream_job_ndjson(job_id):
+    """One line per problem result as it completes, then a summary line"""
+    sent, cursor = 0, 0
+    while True:
+        live = active_batch_results.get(job_id)
+        if live is not None:
+            entries = live["batch_results"]
+            while sent < len(entries):
+                yield json.dumps({"type": "entry", "entry": entries[sent]}, default=str) + "\n"
+                sent += 1
+        status = load_job(job_id)["status"]
+        if status != "running":
+            break
+        # Any event means progress; otherwise re-check the status after the wait
+        _, cursor, _ = test_events.events_since(job_id, cursor, JOB_EVENTS_KEEPALIVE_SECONDS)
+
+    # The batch has left memory; finish from the stored copy
+    with get_db() as conn:
+        row = conn.execute(
+            "SELECT results FROM test_results WHERE test_id = ? ORDER BY timestamp DESC LIMIT 1", (job_id,)
+        ).fetchone()
+    results = json.loads(row["results"]) if row else None
+    if results:
+        for entry in results.get("batch_results", [results])[sent:]:
+            yield json.dumps({"type": "entry", "entry": entry}, default=str) + "\n"
+    yield json.dumps({"type": "summary", "status": status, "summary": results.get("summary") if results else None}) + "\n"
+
+def ndjson_response(job_id):
+    return Response(stream_with_context(stream_job_ndjson(job_id)), mimetype=NDJSON_MIMETYPE,
+                    headers={"X-Job-ID": job_id, "X-Accel-Buffering": "no"})
+
+@app.route("/jobs", methods=["POST"])
+def jobs_submit():
+    """Enqueue a solve job; takes the /sat/solve body and defaults to batch mode unless an instance is given.
+    With Accept: application/x-ndjson the response streams the results instead."""
+    data = request.get_json(silent=True)
+    if not isinstance(data, dict):
+        return error_response("Request body must be a JSON object", 400)
+    data = dict(data)
+    data.setdefault("batch_mode", not (data.get("dimacs") or data.get("dimacs_url") or data.get("dimacs_upload")))
+    response = start_sat_test(data)
+    body, status = response if isinstance(response, tuple) else (response, response.status_code)
+    if status != 201:
+        return body, status
+    job_id = body.get_json()["test_id"]
+    if wants_ndjson():
+        return ndjson_response(job_id)
+    return jsonify({"job_id": job_id, "status": "running", "links": job_links(job_id)}), 202
+
+@app.route("/jobs/<job_id>", methods=["GET"])
+def job_status(job_id):
+    """Status and progress of a job"""
+    try:
+        job = load_job(job_id)
+        if not job:
+            return error_response("Job not found", 404)
+        return jsonify({
+            "job_id": job_id,
+            "name": job["name"],
+            "status": job["status"],
+            "created": job["created"],
+            "progress": job_progress(job),
+            "links": job_links(job_id),
+        })
+    except Exception as e:
+        logger.error(f"Error getting job {job_id}: {e}")
+        return exception_response(e)
+
+@app.route("/jobs/<job_id>/results", methods=["GET"])
+def job_results(job_id):
+    """Final per-problem results and summary of a finished job"""
+    try:
+        job = load_job(job_id)
+        if not job:
+            return error_response("Job not found", 404)
+        if wants_ndjson():
+            # Streaming follows a running job to the end instead of refusing it
+            return ndjson_response(job_id)
+        if job["status"] != "completed":
+            return error_response(f"Job is {job['status']}", 409, "job_not_finished", {"status": job["status"]})
+        with get_db() as conn:
+            row = conn.execute(
+                "SELECT results FROM test_results WHERE test_id = ? ORDER BY timestamp DESC LIMIT 1", (job_id,)
+            ).fetchone()
+        if not row:
+            return error_response("Job has no stored results", 409, "no_results")
+        return jsonify({"job_id": job_id, "status": job["status"], "results": json.loads(row["results"])})
+    except Exception as e:
+        logger.error(f"Error getting results of job {job_id}: {e}")
+        return exception_response(e)
+
+@app.route("/jobs/<job_id>/runs", methods=["GET"])
+def job_runs(job_id):
+    """Every stored run of a job, one row per solver iteration"""
+    try:
+        job = load_job(job_id)
+        if not job:
+            return error_response("Job not found", 404)
+        runs = [run for run in result_store.runs_for_job(job_id) if run_visible(run)]
+        return jsonify({"job_id": job_id, "status": job["status"], "runs": runs, "total_count": len(runs)})
+    except Exception as e:
+        logger.error(f"Error getting runs of job {job_id}: {e}")
+        return exception_response(e)
+
+import io
+import tarfile
+import zipfile
+
+ARCHIVE_FORMATS = {"zip": "application/zip", "tar.gz": "application/gzip"}
+
+def job_archive_files(job):
+    """(archive name, bytes or path) for everything a finished job left behind"""
+    files = [("config.json", json.dumps(job["config"], indent=2, default=str).encode())]
+    artifacts = collect_test_artifacts(job["id"])
+    if "results.json" not in artifacts:
+        with get_db() as conn:
+            row = conn.execute(
+                "SELECT results FROM test_results WHERE test_id = ? ORDER BY timestamp DESC LIMIT 1", (job["id"],)
+            ).fetchone()
+        if row:
+            files.append(("results.json", json.dumps(json.loads(row["results"]), indent=2).encode()))
+    if "events.ndjson" not in artifacts:
+        events, _, _ = test_events.events_since(job["id"])
+        files.append(("events.ndjson", "".join(json.dumps(e, default=str) + "\n" for e in events).encode()))
+    for name, artifact in artifacts.items():
+        path = artifact_file(artifact)
+        if path:  # removed since it was listed
+            files.append((name, path))
+    return files
+
+def build_job_archive(job, archive_format):
+    """Package a job into a spooled zip or tar.gz under a top-level directory named after it"""
+    root = re.sub(r"[^A-Za-z0-9._-]+", "_", job["name"] or "job").strip("_") + f"-{job['id'][:8]}"
+    archive = tempfile.SpooledTemporaryFile(max_size=16 * 1024 * 1024)
+    if archive_format == "zip":
+        with zipfile.ZipFile(archive, "w", zipfile.ZIP_DEFLATED) as zf:
+            for name, content in job_archive_files(job):
+                if isinstance(content, bytes):
+                    zf.writestr(f"{root}/{name}", content)
+                else:
+                    zf.write(content, f"{root}/{name}")
+    else:
+        with tarfile.open(fileobj=archive, mode="w:gz") as tf:
+            for name, content in job_archive_files(job):
+                if isinstance(content, bytes):
+                    info = tarfile.TarInfo(f"{root}/{name}")
+                    info.size, info.mtime = len(content), time.time()
+                    tf.addfile(info, io.BytesIO(content))
+                else:
+                    tf.add(content, f"{root}/{name}")
+    archive.seek(0)
+    return archive, f"{root}.{archive_format}"
+
+@app.route("/jobs/<job_id>/download", methods=["GET"])
+def job_download(job_id):
+    """Archive of a finished job: config, results, solution files and event log (?format=zip|tar.gz)"""
+    try:
+        job = load_job(job_id)
+        if not job:
+            return error_response("Job not found", 404)
+        archive_format = request.args.get("format", "zip")
+        if archive_format not in ARCHIVE_FORMATS:
+            return error_response(f"format must be one of: {', '.join(ARCHIVE_FORMATS)}", 400)
+        if job["status"] == "running":
+            return error_response("Job is running", 409, "job_not_finished", {"status": job["status"]})
+
+        archive, filename = build_job_archive(job, archive_format)
+        return send_file(archive, mimetype=ARCHIVE_FORMATS[archive_format], as_attachment=True, download_name=filename)
+    except Exception as e:
+        logger.error(f"Error packaging job {job_id}: {e}")
+        return exception_response(e)
+
+def sse_message(event_type, data, event_id=None):
+    lines = [f"id: {event_id}"] if event_id is not None else []
+    lines += [f"event: {event_type}", f"data: {json.dumps(data, default=str)}"]
+    return "\n".join(lines) + "\n\n"
+
+@app.route("/jobs/<job_id>/events", methods=["GET"])
+def job_events_stream(job_id):
+    """Stream a job's progress as Server-Sent Events (problem_completed per file) until it finishes"""
+    job = load_job(job_id)
+    if not job:
+        return error_response("Job not found", 404)
+    # Reconnecting EventSource clients resume after the last event they saw
+    cursor = request.headers.get("Last-Event-ID") or request.args.get("cursor") or 0
+    try:
+        cursor = int(cursor)
+    except ValueError:
+        return error_response("Invalid event cursor", 400)
+
+    def stream(cursor):
+        yield "retry: 3000\n\n"
+        while True:
+            events, cursor, _ = test_events.events_since(job_id, cursor, JOB_EVENTS_KEEPALIVE_SECONDS)
+            for event in events:
+                yield sse_message(event["type"], event["data"], event["seq"])
+                if event["type"] in ("completed", "failed", "interrupted"):
+                    return
+            if not events:
+                status = load_job(job_id)["status"]
+                if status != "running":
+                    # Finished before this client connected, or its events have expired
+                    yield sse_message("status", {"status": status})
+                    return
+                yield ": keep-alive\n\n"
+
+    return Response(
+        stream_with_context(stream(cursor)),
+        mimetype="text/event-stream",
+        headers={"Cache-Control": "no-cache", "X-Accel-Buffering": "no"},
+    )
+
+# ------------------------------ Admin ----------------------------------------
+import gc
+
+# Whether /admin/drain has stopped new solve/upload work; cleared by DELETE /admin/drain
+admin_drain = {"active": False, "since": None, "checkpoint": False}
+
+def directory_usage(path):
+    """File count and total bytes under a directory"""
+    files = [p for p in path.rglob("*") if p.is_file()] if path.is_dir() else []
+    return {"path": str(path), "files": len(files), "bytes": sum(p.stat().st_size for p in files)}
+
+def in_flight_jobs():
+    """Running tests of this process with per-file progress"""
+    jobs = []
+    for test_id, thread in list(active_test_threads.items()):
+        if not thread.is_alive():
+            continue
+        job = load_job(test_id)
+        if not job:
+            continue
+        live = active_batch_results.get(test_id)
+        jobs.append({
+            "id": test_id,
+            "name": job.get("name"),
+            "status": job["status"],
+            "created": job["created"],
+            "progress": job_progress(job),
+            "buffered_results": len(live["batch_results"]) if live else None,
+        })
+    return jobs
+
+def process_stats():
+    process = psutil.Process()
+    memory = process.memory_info()
+    return {
+        "pid": process.pid,
+        "uptime_seconds": time.time() - getattr(app, "start_time", process.create_time()),
+        "threads": threading.active_count(),
+        "thread_names": sorted(t.name for t in threading.enumerate()),
+        "rss_bytes": memory.rss,
+        "vms_bytes": memory.vms,
+        "cpu_percent": process.cpu_percent(interval=None),
+        "open_files": len(process.open_files()),
+        "gc_counts": gc.get_count(),
+    }
+
+def hardware_holders():
+    """Who holds each board's work queue and the current reservation slot"""
+    with device_queues_lock:
+        queues = list(device_queues.values())
+    return {
+        "queues": [queue.status() for queue in queues],
+        "reservation": current_reservation(),
+    }
+
+def cache_sizes():
+    with cnf_index.lock:
+        indexed = {preset: len(cached["entries"]) for preset, cached in cnf_index.presets.items()}
+    with test_events.condition:
+        event_buffers = len(test_events.buffers)
+    return {
+        "result_cache": result_cache.stats(),
+        "cnf_features": len(_cnf_feature_cache),
+        "cnf_index": {"version": cnf_index.version, "presets": indexed},
+        "event_buffers": event_buffers,
+        "batch_results": len(active_batch_results),
+    }
+
+@app.route("/admin/status", methods=["GET"])
+def admin_status():
+    """In-flight jobs, process stats, hardware holders, disk usage and cache sizes"""
+    try:
+        return jsonify({
+            "timestamp": utc_now(),
+            "shutting_down": shutdown_requested.is_set(),
+            "drain": admin_drain,
+            "jobs": in_flight_jobs(),
+            "process": process_stats(),
+            "hardware": hardware_holders(),
+            "storage": {
+                name: directory_usage(path)
+                for name, path in (("firmware", FIRMWARE_DIR), ("artifacts", ARTIFACTS_DIR),
+                                   ("checkpoints", CHECKPOINT_DIR), ("presets", SAT_PRESETS_DIR),
+                                   ("tenants", TENANTS_DIR))
+            },
+            "object_storage": {
+                "backend": STORAGE_BACKEND,
+                "bucket": STORAGE_S3_BUCKET or None,
+                "cache": directory_usage(STORAGE_CACHE_DIR) if STORAGE_BACKEND != "local" else None,
+            },
+            "host_energy": host_energy_status(),
+            "caches": cache_sizes(),
+        })
+    except Exception as e:
+        logger.error(f"Admin status error: {e}")
+        return exception_response(e)
+
+@app.route("/admin/drain", methods=["GET", "POST", "DELETE"])
+def admin_drain_control():
+    """Stop taking new solve/upload work (POST), optionally checkpointing running batches, or resume (DELETE)"""
+    if request.method == "POST":
+        data = request.get_json(silent=True) or {}
+        checkpoint = bool(data.get("checkpoint"))
+        admin_drain.update(active=True, since=admin_drain["since"] or utc_now(), checkpoint=checkpoint)
+        if checkpoint:
+            # Running batches stop at their next problem and can be resumed later
+            checkpoint_requested.set()
+        logger.warning(f"Admin drain started (checkpoint running batches: {checkpoint})")
+    elif request.method == "DELETE":
+        admin_drain.update(active=False, since=None, checkpoint=False)
+        checkpoint_requested.clear()
+        logger.info("Admin drain ended; accepting new work")
+
+    running = [test_id for test_id, thread in active_test_threads.items() if thread.is_alive()]
+    return jsonify(dict(admin_drain, running=running))
+
+# ------------------------------ Retention ------------------------------------
+# Seconds after which each category of leftovers is removed; 0 keeps it forever. Uploads and artifacts are
+# kept by default since they are user data; temp covers staging directories, interrupted multipart uploads,
+# progress files of finished tests and the object storage read cache.
+RETENTION_TTLS = {
+    "uploads": float(os.getenv("RETENTION_UPLOADS_SECONDS", 0)),
+    "partial_uploads": RESUMABLE_UPLOAD_TTL_SECONDS,
+    "temp": float(os.getenv("RETENTION_TEMP_SECONDS", 24 * 3600)),
+    "artifacts": float(os.getenv("RETENTION_ARTIFACTS_SECONDS", 0)),
+}
+RETENTION_INTERVAL_SECONDS = float(os.getenv("RETENTION_INTERVAL_SECONDS", 3600))  # 0 turns the sweeper off
+retention_lock = threading.Lock()
+retention_status = {"last_run": None, "last_report": None, "running": False}
+
+def upload_roots():
+    return [UPLOADS_DIR] + sorted(TENANTS_DIR.glob("*/uploads"))
+
+def test_running(test_id):
+    thread = active_test_threads.get(test_id)
+    return bool(thread and thread.is_alive())
+
+def path_item(path):
+    """(size, newest mtime) of a file or directory tree"""
+    files = [p for p in path.rglob("*") if p.is_file()] if path.is_dir() else [path]
+    stats = [p.stat() for p in files if p.exists()]
+    return {
+        "path": str(path),
+        "bytes": sum(s.st_size for s in stats),
+        "modified": max((s.st_mtime for s in stats), default=path.stat().st_mtime),
+    }
+
+def remove_path(path):
+    if path.is_dir():
+        shutil.rmtree(path, ignore_errors=True)
+    else:
+        path.unlink(missing_ok=True)
+
+def expired_uploads(cutoff):
+    for root in upload_roots():
+        for meta in sorted(root.glob("*/upload.json")):
+            upload = json.loads(meta.read_text())
+            created = datetime.fromisoformat(upload["created"]).timestamp()
+            if created < cutoff:
+                item = {"path": str(meta.parent), "bytes": upload["stored_bytes"], "modified": created}
+                yield item, lambda root=root, upload=upload: delete_upload(root, upload["upload_id"], upload["files"])
+
+def expired_partial_uploads(cutoff):
+    for root in upload_roots():
+        for directory in expired_resumable_sessions(root, cutoff):
+            yield path_item(directory), lambda directory=directory: remove_resumable_session(directory)
+
+def expired_temp_files(cutoff):
+    candidates = [p for parent in [DATA_DIR, SAT_PRESETS_DIR.parent, *TENANTS_DIR.glob("*")]
+                  for p in parent.glob(f"{TEMP_PREFIX}*")]
+    # Multipart uploads write into their upload directory and only add upload.json once complete
+    candidates += [p for root in upload_roots() for p in root.glob("*")
+                   if p.is_dir() and p.name not in ("objects", "partial") and not (p / "upload.json").exists()]
+    candidates += [p for p in Path(".").glob("sat_progress_*.json")
+                   if not test_running(p.stem.removeprefix("sat_progress_"))]
+    if STORAGE_BACKEND != "local" and STORAGE_CACHE_DIR.is_dir():
+        candidates += [p for p in STORAGE_CACHE_DIR.rglob("*") if p.is_file()]
+    for path in sorted(candidates):
+        item = path_item(path)
+        if item["modified"] < cutoff:
+            yield item, lambda path=path: remove_path(path)
+
+def expired_artifacts(cutoff):
+    tests = defaultdict(list)
+    root = storage_key(ARTIFACTS_DIR)
+    for key, info in object_storage.list(root).items():
+        tests[key[len(root) + 1:].split("/")[0]].append(info)
+    for test_id, objects in sorted(tests.items()):
+        newest = max(info["modified"] for info in objects)
+        if newest < cutoff and not test_running(test_id):
+            item = {"path": f"{root}/{test_id}", "bytes": sum(info["size_bytes"] for info in objects), "modified": newest}
+            yield item, lambda test_id=test_id: object_storage.delete_prefix(storage_key(test_artifacts_dir(test_id)))
+
+RETENTION_SWEEPS = {
+    "uploads": expired_uploads,
+    "partial_uploads": expired_partial_uploads,
+    "temp": expired_temp_files,
+    "artifacts": expired_artifacts,
+}
+
+def run_retention(categories=None, dry_run=False):
+    """Remove (or with dry_run, list) whatever has outlived its category's TTL"""
+    now = time.time()
+    report = {}
+    with retention_lock:
+        retention_status["running"] = True
+        try:
+            for category in categories or RETENTION_TTLS:
+                ttl = RETENTION_TTLS[category]
+                items = []
+                if ttl > 0:
+                    for item, remove in RETENTION_SWEEPS[category](now - ttl):
+                        if not dry_run:
+                            try:
+                                remove()
+                            except OSError as e:
+                                logger.warning(f"Retention: could not remove {item['path']}: {e}")
+                                continue
+                        item["modified"] = datetime.fromtimestamp(item["modified"], timezone.utc).isoformat()
+                        items.append(item)
+                report[category] = {
+                    "ttl_seconds": ttl or None,
+                    "count": len(items),
+                    "bytes": sum(item["bytes"] for item in items),
+                    "items": items,
+                }
+        finally:
+            retention_status["running"] = False
+        if not dry_run:
+            retention_status.update(last_run=utc_now(), last_report=report)
+    removed = {category: entry["count"] for category, entry in report.items() if entry["count"]}
+    if removed and not dry_run:
+        logger.info(f"Retention: removed {removed}")
+    return report
+
+def start_retention_sweeper():
+    """Run every category's cleanup on RETENTION_INTERVAL_SECONDS"""
+    if RETENTION_INTERVAL_SECONDS <= 0:
+        return None
+
+    def run():
+        while not shutdown_requested.is_set():
+            try:
+                run_retention()
+            except Exception as e:
+                logger.error(f"Retention sweep failed: {e}")
+            shutdown_requested.wait(RETENTION_INTERVAL_SECONDS)
+
+    thread = threading.Thread(target=run, daemon=True, name="retention-sweeper")
+    thread.start()
+    return thread
+
+@app.route("/admin/retention", methods=["GET", "POST"])
+def admin_retention():
+    """Policies, the last sweep and what is due now (GET), or sweep immediately (POST; categories, dry_run)"""
+    data = (request.get_json(silent=True) or {}) if request.method == "POST" else {}
+    categories = data.get("categories")
+    if categories is not None and (not isinstance(categories, list) or set(categories) - set(RETENTION_TTLS)):
+        return error_response("categories must be a list drawn from the retention categories", 400,
+                              details={"allowed": list(RETENTION_TTLS)})
+    dry_run = request.method == "GET" or bool(data.get("dry_run"))
+    try:
+        report = run_retention(categories, dry_run=dry_run)
+    except Exception as e:
+        logger.error(f"Retention error: {e}")
+        return exception_response(e)
+    return jsonify({
+        "policies": {category: ttl or None for category, ttl in RETENTION_TTLS.items()},
+        "interval_seconds": RETENTION_INTERVAL_SECONDS or None,
+        "last_run": retention_status["last_run"],
+        "dry_run": dry_run,
+        "due" if dry_run else "removed": report,
+    })
+
+# ------------------------------ OpenAPI ---------------------------------------
+def ref(name):
+    return {"$ref": f"#/components/schemas/{name}"}
+
+def config_fields_schema(fields):
+    """Object schema for a (type, min, max, default) field table"""
+    return {
+        "type": "object",
+        "additionalProperties": False,
+        "properties": {
+            field: {"type": "integer" if kind is int else "number", "minimum": low, "maximum": high, "default": default}
+            for field, (kind, low, high, default) in fields.items()
+        },
+    }
+
+def openapi_schemas():
+    """Component schemas for the request and response bodies clients bind against"""
+    return {
+        "Error": {
+            "type": "object",
+            "required": ["code", "message", "details", "request_id"],
+            "properties": {
+                "code": {"type": "string", "enum": sorted(ERROR_CODE_TABLE),
+                         "description": "; ".join(f"{code}: {text}" for code, text in sorted(ERROR_CODE_TABLE.items()))},
+                "message": {"type": "string"},
+                "details": {"type": "object", "additionalProperties": True},
+                "request_id": {"type": "string", "nullable": True},
+                "error": {"type": "string", "deprecated": True, "description": "Same as message"},
+            },
+        },
+        "SolverConfig": config_fields_schema(SOLVER_CONFIG_FIELDS),
+        "SolveRequest": {
+            "type": "object",
+            "required": ["name"],
+            "properties": {
+                "name": {"type": "string"},
+                "batch_mode": {"type": "boolean", "default": False},
+                "dimacs": {"type": "string", "description": "Required unless batch_mode, dimacs_url or dimacs_upload is set"},
+                "dimacs_url": {"type": "string", "format": "uri", "description": "http(s) URL of the instance, "
+                               "optionally gzipped; fetched when the request is accepted"},
+                "dimacs_sha256": {"type": "string", "pattern": "^[0-9a-fA-F]{64}$",
+                                  "description": "Expected SHA-256 of the downloaded bytes"},
+                "dimacs_upload": {"type": "string", "description": "\"<upload_id>/<filename>\" of a file sent to /uploads"},
+                "satlib_benchmark": {"type": "string", "description": "Preset name for batch mode"},
+                "problem_indices": {"type": "array", "items": {"type": "integer"}},
+                "exclude_indices": {"type": "array", "items": {"type": "integer"}},
+                "time_budget_seconds": {"type": "number", "exclusiveMinimum": 0},
+                "order_by": {"type": "string", "enum": ["index", "difficulty", "difficulty_desc"], "default": "index"},
+                "solver_type": {"type": "string", "enum": list(SOLVER_TYPE_FLAGS), "default": "minisat"},
+                **{field: {"type": "boolean"} for field in SOLVER_ENABLE_FIELDS},
+                "race_software_solver": {"type": "string", "enum": list(RACE_SOFTWARE_SOLVERS)},
+                "iterations": {"type": "integer", "minimum": 1, "default": 1},
+                "device_id": {"type": "string"},
+                "solver_config": ref("SolverConfig"),
+                "weights": {
+                    "type": "object",
+                    "properties": {
+                        "families": {"type": "object", "additionalProperties": {"type": "number", "minimum": 0}},
+                        # Keyed family#problem_index, e.g. uf20-91#3
+                        "instances": {"type": "object", "additionalProperties": {"type": "number", "minimum": 0}},
+                    },
+                    "additionalProperties": False,
+                },
+                "reservation_fallback": {"type": "string", "enum": list(RESERVATION_FALLBACKS)},
+                "bypass_cache": {"type": "boolean", "default": False},
+                # Batches re-measure cache hits unless this is set
+                "reuse_cached_timings": {"type": "boolean", "default": False},
+                "user": {"type": "string"},
+            },
+        },
+        "SolveAccepted": {
+            "type": "object",
+            "required": ["test_id", "status"],
+            "properties": {
+                "test_id": {"type": "string"},
+                "status": {"type": "string", "enum": ["running"]},
+                "message": {"type": "string"},
+            },
+        },
+        "SolveResult": {
+            "type": "object",
+            "required": ["solver", "satisfiable", "solve_time_ms"],
+            "additionalProperties": True,
+            "properties": {
+                "solver": {"type": "string", "enum": list(SOLVE_ONE_SOLVERS)},
+                "satisfiable": {"type": "boolean"},
+                "assignment": {"type": "array", "items": {"type": "integer"}, "nullable": True,
+                               "description": "DIMACS literals ordered by variable"},
+                "solve_time_ms": {"type": "number"},
+                "cutoff_reached": {"type": "boolean"},
+                "energy_nj": {"type": "number"},
+                "instance_hash": {"type": "string"},
+                "variables": {"type": "integer"},
+                "clauses": {"type": "integer"},
+                "known_answer": {"type": "object", "additionalProperties": True},
+                "solver_config": ref("SolverConfig"),
+                "cache": {"type": "object", "nullable": True, "additionalProperties": True},
+            },
+        },
+        "JobLinks": {
+            "type": "object",
+            "properties": {name: {"type": "string"} for name in ("self", "results", "events", "download", "runs")},
+        },
+        "JobAccepted": {
+            "type": "object",
+            "required": ["job_id", "status", "links"],
+            "properties": {
+                "job_id": {"type": "string"},
+                "status": {"type": "string", "enum": ["running"]},
+                "links": ref("JobLinks"),
+            },
+        },
+        "JobProgress": {
+            "type": "object",
+            "properties": {
+                "files_completed": {"type": "integer"},
+                "total_files": {"type": "integer"},
+                "current_file": {"type": "string", "nullable": True},
+                "percent": {"type": "number"},
+                "elapsed_seconds": {"type": "number", "nullable": True},
+                "eta_seconds": {"type": "number", "nullable": True},
+                "hardware_queue": {"type": "object", "nullable": True, "additionalProperties": True},
+            },
+        },
+        "Job": {
+            "type": "object",
+            "required": ["job_id", "status"],
+            "properties": {
+                "job_id": {"type": "string"},
+                "name": {"type": "string"},
+                "status": {"type": "string", "enum": ["running", "completed", "failed", "interrupted"]},
+                "created": {"type": "string", "format": "date-time"},
+                "progress": ref("JobProgress"),
+                "links": ref("JobLinks"),
+            },
+        },
+        "Run": {
+            "type": "object",
+            "required": ["id", "solver", "status"],
+            "properties": {
+                "id": {"type": "string"},
+                "job_id": {"type": "string", "nullable": True, "description": "Null for /solve-one runs"},
+                "tenant": {"type": "string", "nullable": True},
+                "instance": {"type": "string", "nullable": True, "description": "Preset file, URL, upload or job name"},
+                "instance_hash": {"type": "string", "nullable": True},
+                "preset": {"type": "string", "nullable": True},
+                "problem_index": {"type": "integer", "nullable": True},
+                "solver": {"type": "string"},
+                "hardware": {"type": "boolean", "description": "The run touched a board"},
+                "iteration": {"type": "integer", "nullable": True},
+                "seed": {"type": "integer", "nullable": True},
+                "params": {"type": "object", "additionalProperties": True, "description": "Effective solver_config"},
+                "status": {"type": "string", "enum": list(RUN_STATUSES)},
+                "cached": {"type": "boolean", "description": "Served from the result cache rather than measured"},
+                "solve_time_ms": {"type": "number", "nullable": True},
+                "simulated_time_ns": {"type": "number", "nullable": True},
+                "energy_nj": {"type": "number", "nullable": True},
+                "power_mw": {"type": "number", "nullable": True},
+                "metrics": {"type": "object", "additionalProperties": True, "description": "Solver-specific counters"},
+                "created": {"type": "string", "format": "date-time"},
+            },
+        },
+        "CnfFile": {
+            "type": "object",
+            "required": ["id", "preset", "filename"],
+            "properties": {
+                "id": {"type": "string", "description": "preset/filename"},
+                "preset": {"type": "string"},
+                "filename": {"type": "string"},
+                "instance_hash": {"type": "string", "nullable": True,
+                                  "description": "Hash of the normalized clause set; equal across copies of the instance"},
+                "variables": {"type": "integer"},
+                "clauses": {"type": "integer"},
+                "ratio": {"type": "number"},
+                "size_bytes": {"type": "integer"},
+                "features": {"type": "object", "additionalProperties": True},
+                "difficulty": {"type": "string", "nullable": True},
+                "difficulty_confidence": {"type": "number", "nullable": True},
+                "widths": {"type": "object", "additionalProperties": True, "description": "Detail route only"},
+                "provenance": dict(ref("PresetProvenance"), description="Detail route only"),
+            },
+        },
+        "CnfFileList": {
+            "type": "object",
+            "properties": {
+                "files": {"type": "array", "items": ref("CnfFile")},
+                "total_count": {"type": "integer", "description": "Matches before limit/offset"},
+                "offset": {"type": "integer"},
+                "limit": {"type": "integer", "nullable": True},
+                "provenance": {"type": "object", "additionalProperties": ref("PresetProvenance")},
+            },
+        },
+        "Preset": {
+            "type": "object",
+            "properties": {
+                "preset": {"type": "string"},
+                "file_count": {"type": "integer"},
+                "locked": {"type": "boolean"},
+                "drifted": {"type": "boolean"},
+                "snapshots": {"type": "array", "items": {"type": "string"}},
+                "provenance": ref("PresetProvenance"),
+            },
+        },
+        "PresetProvenance": {
+            "type": "object",
+            "nullable": True,
+            "properties": {
+                "source": {"type": "string"},
+                "description": {"type": "string"},
+                "generator": {"type": "object", "additionalProperties": True},
+                "expected": {"type": "string", "enum": list(PRESET_EXPECTED_VALUES)},
+                "citation": {"type": "string"},
+                "created": {"type": "string"},
+            },
+        },
+        "PresetList": {
+            "type": "object",
+            "properties": {"presets": {"type": "array", "items": ref("Preset")}},
+        },
+        "AcceleratorCapabilities": {
+            "type": "object",
+            "properties": {
+                "max_variables": {"type": "integer"},
+                "max_clauses": {"type": "integer"},
+                "supports_offload": {"type": "boolean"},
+                "supports_partial_assignments": {"type": "boolean"},
+                "power_budget_mw": {"type": "number", "nullable": True},
+            },
+        },
+        "HardwareDevice": {
+            "type": "object",
+            "required": ["id", "device_type"],
+            "additionalProperties": True,
+            "properties": {
+                "id": {"type": "string"},
+                "device_type": {"type": "string"},
+                "port": {"type": "string", "nullable": True},
+                "firmware_version": {"type": "string", "nullable": True},
+                "firmware_supported": {"type": "boolean", "nullable": True},
+                "connected": {"type": "boolean"},
+                "capabilities": ref("AcceleratorCapabilities"),
+                "calibration": {"type": "object", "nullable": True, "additionalProperties": True},
+            },
+        },
+        "HardwareDeviceList": {
+            "type": "object",
+            "properties": {"devices": {"type": "array", "items": ref("HardwareDevice")}, "total_count": {"type": "integer"}},
+        },
+        "FirmwareUpload": {
+            "type": "object",
+            "required": ["firmware", "sha256"],
+            "properties": {
+                "firmware": {"type": "string", "format": "binary", "description": "Intel HEX image"},
+                "sha256": {"type": "string", "pattern": "^[0-9a-fA-F]{64}$"},
+            },
+        },
+        "UploadFile": {
+            "type": "object",
+            "properties": {
+                "field": {"type": "string"},
+                "filename": {"type": "string"},
+                "size_bytes": {"type": "integer"},
+                "sha256": {"type": "string"},
+                "verified": {"type": "boolean", "description": "Matched a client-supplied checksum"},
+                "deduplicated": {"type": "boolean", "description": "Identical bytes were already stored; this file refers to them"},
+                "instance_hash": {"type": "string", "nullable": True,
+                                  "description": "Canonical instance hash for CNF files; matches preset files of the same formula"},
+            },
+        },
+        "Upload": {
+            "type": "object",
+            "properties": {
+                "upload_id": {"type": "string"},
+                "created": {"type": "string", "format": "date-time"},
+                "tenant": {"type": "string", "nullable": True},
+                "fields": {"type": "object", "additionalProperties": {"type": "string"}},
+                "files": {"type": "array", "items": ref("UploadFile")},
+                "total_bytes": {"type": "integer"},
+                "stored_bytes": {"type": "integer", "description": "Bytes not already held from earlier uploads"},
+            },
+        },
+        "ResumableUpload": {
+            "type": "object",
+            "properties": {
+                "session_id": {"type": "string"},
+                "created": {"type": "string", "format": "date-time"},
+                "filename": {"type": "string"},
+                "size_bytes": {"type": "integer"},
+                "sha256": {"type": "string", "nullable": True},
+                "fields": {"type": "object", "additionalProperties": {"type": "string"}},
+                "offset": {"type": "integer", "description": "Bytes received; the next PATCH starts here"},
+                "expires": {"type": "string", "format": "date-time"},
+                "upload": ref("Upload"),
+            },
+        },
+        "FirmwareUpdate": {
+            "type": "object",
+            "required": ["status"],
+            "properties": {
+                "status": {"type": "string", "enum": ["updated", "rolled_back", "failed"]},
+                "sha256": {"type": "string"},
+                "device": ref("HardwareDevice"),
+                "loader_output": {"type": "string"},
+                "error": {"type": "string"},
+            },
+        },
+    }
+
+def json_body(schema):
+    return {"content": {"application/json": {"schema": schema}}}
+
+def run_filter_parameters():
+    """Query parameters parse_run_query understands, bar sorting and paging"""
+    return [
+        *({"name": name, "in": "query", "description": "Comma-separated", "schema": {"type": "string"}}
+          for name in ("preset", "solver", "status")),
+        *({"name": name, "in": "query", "schema": {"type": "string"}} for name in ("job_id", "instance_hash")),
+        *({"name": name, "in": "query", "schema": {"type": "boolean"}} for name in ("solved", "hardware", "cached")),
+        *({"name": name, "in": "query", "schema": {"type": "string", "format": "date-time"}}
+          for name in ("since", "until")),
+        {"name": "problem_index", "in": "query", "schema": {"type": "integer", "minimum": 0}},
+    ]
+
+def error_responses(*statuses):
+    return {str(status): {"description": ERROR_CODES[status], **json_body(ref("Error"))} for status in statuses}
+
+# Conditional GETs answer 304 to a matching If-None-Match or If-Modified-Since
+NOT_MODIFIED = {"304": {"description": "Not modified since the ETag/Last-Modified the client sent"}}
+
+# Typed operations by (method, URL rule); every other route is listed with its docstring only
+OPENAPI_OPERATIONS = {
+    ("POST", "/sat/solve"): {
+        "tags": ["solve"],
+        "requestBody": {"required": True, **json_body(ref("SolveRequest"))},
+        "responses": {"201": {"description": "Test started", **json_body(ref("SolveAccepted"))},
+                      **error_responses(400, 403, 404, 409, 413, 429, 502, 504)},
+    },
+    ("POST", "/jobs"): {
+        "tags": ["solve"],
+        "requestBody": {"required": True, **json_body(ref("SolveRequest"))},
+        "responses": {
+            "202": {"description": "Job queued", **json_body(ref("JobAccepted"))},
+            "200": {"description": "Streamed results (Accept: application/x-ndjson)",
+                    "content": {NDJSON_MIMETYPE: {"schema": {"type": "string"}}}},
+            **error_responses(400, 403, 404, 409, 413, 429, 502, 504),
+        },
+    },
+    ("POST", "/solve-one"): {
+        "tags": ["solve"],
+        "parameters": [
+            {"name": "solver", "in": "query", "schema": {"type": "string", "enum": list(SOLVE_ONE_SOLVERS),
+                                                          "default": "minisat"}},
+            {"name": "bypass_cache", "in": "query", "schema": {"type": "boolean", "default": False}},
+            *({"name": field, "in": "query", "schema": {"type": "integer" if kind is int else "number"}}
+              for field, (kind, _, _, _) in SOLVER_CONFIG_FIELDS.items()),
+        ],
+        "requestBody": {"required": True, "content": {mimetype: {"schema": {"type": "string"}}
+                                                      for mimetype in DIMACS_MIMETYPES}},
+        "responses": {"200": {"description": "Result of one run", **json_body(ref("SolveResult"))},
+                      **error_responses(400, 413, 415, 429)},
+    },
+    ("GET", "/jobs/<job_id>"): {
+        "tags": ["solve"],
+        "responses": {"200": {"description": "Job status", **json_body(ref("Job"))}, **error_responses(404)},
+    },
+    ("GET", "/jobs/<job_id>/runs"): {
+        "tags": ["solve"],
+        "responses": {
+            "200": {"description": "Stored runs", **json_body({
+                "type": "object",
+                "properties": {"job_id": {"type": "string"}, "status": {"type": "string"},
+                               "runs": {"type": "array", "items": ref("Run")}, "total_count": {"type": "integer"}},
+            })},
+            **error_responses(404),
+        },
+    },
+    ("GET", "/runs"): {
+        "tags": ["solve"],
+        "parameters": [
+            *run_filter_parameters(),
+            {"name": "sort", "in": "query", "description": "Field, prefixed with - for descending",
+             "schema": {"type": "string", "enum": [p + f for f in RUN_SORT_FIELDS for p in ("", "-")],
+                        "default": "-created"}},
+            {"name": "limit", "in": "query",
+             "schema": {"type": "integer", "minimum": 1, "maximum": RUNS_MAX_LIMIT, "default": RUNS_DEFAULT_LIMIT}},
+            {"name": "offset", "in": "query", "schema": {"type": "integer", "minimum": 0}},
+        ],
+        "responses": {
+            "200": {"description": "Runs and per-solver aggregates", **json_body({
+                "type": "object",
+                "properties": {
+                    "runs": {"type": "array", "items": ref("Run")},
+                    "total_count": {"type": "integer"},
+                    "offset": {"type": "integer"},
+                    "limit": {"type": "integer"},
+                    "sort": {"type": "string"},
+                    "aggregates": {"type": "object", "additionalProperties": True},
+                },
+            })},
+            **error_responses(400),
+        },
+    },
+    ("GET", "/runs/export"): {
+        "tags": ["solve"],
+        "parameters": [
+            *run_filter_parameters(),
+            {"name": "jobs", "in": "query", "description": "Include the test bundles of the runs' jobs",
+             "schema": {"type": "boolean", "default": True}},
+        ],
+        "responses": {
+            "200": {"description": "Gzipped JSON lines: a header, then job and run records",
+                    "content": {"application/gzip": {"schema": {"type": "string", "format": "binary"}}}},
+            **error_responses(400),
+        },
+    },
+    ("POST", "/runs/import"): {
+        "tags": ["solve"],
+        "requestBody": {"required": True, "content": {"application/gzip": {"schema": {"type": "string", "format": "binary"}}}},
+        "responses": {
+            "200": {"description": "What was added and what was already present", **json_body({
+                "type": "object",
+                "properties": {
+                    "source": {"type": "string", "nullable": True},
+                    "exported_at": {"type": "string", "format": "date-time", "nullable": True},
+                    **{name: {"type": "integer"} for name in ("jobs", "jobs_skipped", "runs", "runs_skipped")},
+                },
+            })},
+            **error_responses(400, 403, 413),
+        },
+    },
+    ("GET", "/leaderboard"): {
+        "tags": ["solve"],
+        "parameters": [
+            {"name": "preset", "in": "query", "required": True, "schema": {"type": "string"}},
+            {"name": "metric", "in": "query",
+             "schema": {"type": "string", "enum": list(LEADERBOARD_METRICS), "default": "par2"}},
+            {"name": "window", "in": "query", "description": '"all" or a number of days, e.g. "30d"',
+             "schema": {"type": "string", "default": "all"}},
+        ],
+        "responses": {
+            "200": {"description": "Ranked configurations", **json_body({
+                "type": "object",
+                "properties": {
+                    "preset": {"type": "string"},
+                    "metric": {"type": "string"},
+                    "window": {"type": "string"},
+                    "since": {"type": "string", "format": "date-time", "nullable": True},
+                    "default_cutoff_seconds": {"type": "number"},
+                    "entries": {"type": "array", "items": {"type": "object", "properties": {
+                        "rank": {"type": "integer"},
+                        "solver": {"type": "string"},
+                        "device_id": {"type": "string", "nullable": True},
+                        "configuration": {"type": "string"},
+                        "runs": {"type": "integer"},
+                        "solved": {"type": "integer"},
+                        "solve_rate": {"type": "number"},
+                        "par2_seconds": {"type": "number"},
+                        "median_tts_ms": {"type": "number", "nullable": True},
+                        "median_energy_nj": {"type": "number", "nullable": True},
+                    }}},
+                },
+            })},
+            **error_responses(400),
+        },
+    },
+    ("GET", "/analysis/cactus"): {
+        "tags": ["solve"],
+        "parameters": [
+            {"name": "presets", "in": "query", "required": True, "description": "Comma-separated",
+             "schema": {"type": "string"}},
+            {"name": "solvers", "in": "query", "description": "Comma-separated; all by default",
+             "schema": {"type": "string"}},
+        ],
+        "responses": {
+            "200": {"description": "Per-solver cactus curves", **json_body({
+                "type": "object",
+                "properties": {
+                    "presets": {"type": "array", "items": {"type": "string"}},
+                    "solvers": {"type": "array", "items": {"type": "string"}},
+                    "instances": {"type": "integer", "description": "Distinct instances any solver ran"},
+                    "curves": {"type": "object", "additionalProperties": {"type": "object", "properties": {
+                        "instances": {"type": "integer"},
+                        "solved": {"type": "integer"},
+                        "points": {"type": "array", "items": {"type": "object", "properties": {
+                            "time_ms": {"type": "number"},
+                            "solved": {"type": "integer"},
+                            "solved_fraction": {"type": "number"},
+                        }}},
+                    }}},
+                },
+            })},
+            **error_responses(400),
+        },
+    },
+    ("POST", "/analysis/compare"): {
+        "tags": ["solve"],
+        "requestBody": {"required": True, **json_body({
+            "type": "object",
+            "required": ["a", "b", "presets"],
+            "properties": {
+                "a": {"oneOf": [
+                        {"type": "string"},
+                        {"type": "object", "required": ["solver"], "properties": {
+                            "solver": {"type": "string", "enum": list(SOLVER_TYPE_FLAGS)},
+                            "solver_config": {"type": "object", "additionalProperties": True,
+                                              "description": "Fields that select stored runs and configure new ones"},
+                        }},
+                    ]},
+                "b": {"oneOf": [
+                        {"type": "string"},
+                        {"type": "object", "required": ["solver"], "properties": {
+                            "solver": {"type": "string", "enum": list(SOLVER_TYPE_FLAGS)},
+                            "solver_config": {"type": "object", "additionalProperties": True,
+                                              "description": "Fields that select stored runs and configure new ones"},
+                        }},
+                    ]},
+                "presets": {"type": "array", "items": {"type": "string"}},
+                "run_missing": {"type": "boolean", "default": False,
+                                "description": "Solve preset files a side has no stored run of (software solvers only)"},
+                "tie_tolerance": {"type": "number", "default": COMPARE_DEFAULT_TIE_TOLERANCE,
+                                  "description": "Relative time difference still counted as a tie"},
+                "bootstrap_samples": {"type": "integer", "default": COMPARE_BOOTSTRAP_SAMPLES},
+                "seed": {"type": "integer", "default": 0},
+            },
+        })},
+        "responses": {
+            "200": {"description": "Paired comparison", **json_body({
+                "type": "object",
+                "properties": {
+                    "presets": {"type": "array", "items": {"type": "string"}},
+                    "a": {"type": "object", "properties": {
+                        "solver": {"type": "string"},
+                        "solver_config": {"type": "object", "additionalProperties": True},
+                        "instances": {"type": "integer"},
+                        "solved": {"type": "integer"},
+                        "ran": {"type": "integer", "description": "Runs made by this request"},
+                    }},
+                    "b": {"type": "object", "properties": {
+                        "solver": {"type": "string"},
+                        "solver_config": {"type": "object", "additionalProperties": True},
+                        "instances": {"type": "integer"},
+                        "solved": {"type": "integer"},
+                        "ran": {"type": "integer", "description": "Runs made by this request"},
+                    }},
+                    "paired_instances": {"type": "integer"},
+                    "unpaired": {"type": "object", "properties": {
+                        "a_only": {"type": "integer"}, "b_only": {"type": "integer"},
+                    }},
+                    "wins": {"type": "object", "properties": {
+                        name: {"type": "integer"} for name in ("a", "b", "tie")
+                    }},
+                    "tie_tolerance": {"type": "number"},
+                    "wilcoxon": {"type": "object", "properties": {
+                        "statistic": {"type": "number", "nullable": True, "description": "Rank sum of positive a - b"},
+                        "n": {"type": "integer"},
+                        "p_value": {"type": "number", "nullable": True},
+                        "method": {"type": "string", "enum": ["exact", "normal"], "nullable": True},
+                        "alternative": {"type": "string"},
+                    }},
+                    "median_speedup": {"type": "object", "description": "b's time over a's; above 1 means a is faster",
+                                       "properties": {
+                        "value": {"type": "number", "nullable": True},
+                        "ci": {"type": "array", "items": {"type": "number", "nullable": True}},
+                        "confidence": {"type": "number"},
+                        "bootstrap_samples": {"type": "integer"},
+                        "seed": {"type": "integer"},
+                    }},
+                    "instances": {"type": "array", "items": {"type": "object", "properties": {
+                        "instance": {"type": "string"},
+                        "a_ms": {"type": "number"},
+                        "a_solved": {"type": "boolean"},
+                        "b_ms": {"type": "number"},
+                        "b_solved": {"type": "boolean"},
+                        "winner": {"type": "string", "enum": ["a", "b", "tie"]},
+                    }}},
+                },
+            })},
+            **error_responses(400, 404, 429),
+        },
+    },
+    ("GET", "/instances/<instance_hash>"): {
+        "tags": ["solve"],
+        "responses": {
+            "200": {"description": "Everything known under this instance hash", **json_body({
+                "type": "object",
+                "properties": {
+                    "instance_hash": {"type": "string"},
+                    "preset_files": {"type": "array", "items": {"type": "string"}},
+                    "uploads": {"type": "array", "items": {"type": "string"}},
+                    "run_names": {"type": "array", "items": {"type": "object", "properties": {
+                        "instance": {"type": "string", "nullable": True},
+                        "preset": {"type": "string", "nullable": True},
+                        "runs": {"type": "integer"},
+                        "jobs": {"type": "integer"},
+                        "first_run": {"type": "string", "format": "date-time"},
+                        "last_run": {"type": "string", "format": "date-time"},
+                    }}},
+                    "known_answer": {"type": "object", "nullable": True, "additionalProperties": True},
+                    "total_runs": {"type": "integer"},
+                    "aggregates": {"type": "array", "items": {"type": "object", "additionalProperties": True}},
+                    "runs": {"type": "string", "description": "/runs query for this instance"},
+                },
+            })},
+            **error_responses(400, 404),
+        },
+    },
+    ("GET", "/instances/duplicates"): {
+        "tags": ["solve"],
+        "responses": {
+            "200": {"description": "Instances known under more than one name", **json_body({
+                "type": "object",
+                "properties": {
+                    "duplicates": {"type": "array", "items": {"type": "object", "properties": {
+                        "instance_hash": {"type": "string"},
+                        "preset_files": {"type": "array", "items": {"type": "string"}},
+                        "uploads": {"type": "array", "items": {"type": "string"}},
+                        "run_name_count": {"type": "integer"},
+                        "url": {"type": "string"},
+                    }}},
+                    "total_count": {"type": "integer"},
+                },
+            })},
+        },
+    },
+    ("GET", "/runs/<run_id>"): {
+        "tags": ["solve"],
+        "responses": {"200": {"description": "Run", **json_body(ref("Run"))}, **error_responses(404)},
+    },
+    ("GET", "/jobs/<job_id>/events"): {
+        "tags": ["solve"],
+        "responses": {"200": {"description": "Server-Sent Events",
+                              "content": {"text/event-stream": {"schema": {"type": "string"}}}},
+                      **error_responses(400, 404)},
+    },
+    ("GET", "/sat/presets"): {
+        "tags": ["presets"],
+        "responses": {"200": {"description": "Presets", **json_body(ref("PresetList"))}, **NOT_MODIFIED},
+    },
+    ("GET", "/sat/cnf-files"): {
+        "tags": ["presets"],
+        "parameters": [
+            {"name": "preset", "in": "query", "schema": {"type": "string"}},
+            {"name": "difficulty", "in": "query", "description": "Comma-separated difficulty classes",
+             "schema": {"type": "string"}},
+            *({"name": name, "in": "query", "schema": {"type": "integer" if kind is int else "number"}}
+              for name, (kind, _, _) in CNF_FILE_RANGE_FILTERS.items()),
+            {"name": "limit", "in": "query", "schema": {"type": "integer", "minimum": 1, "maximum": CNF_FILES_MAX_LIMIT}},
+            {"name": "offset", "in": "query", "schema": {"type": "integer", "minimum": 0}},
+        ],
+        "responses": {"200": {"description": "Preset CNF files", **json_body(ref("CnfFileList"))},
+                      **NOT_MODIFIED, **error_responses(400)},
+    },
+    ("GET", "/sat/cnf-files/<path:file_id>"): {
+        "tags": ["presets"],
+        "responses": {"200": {"description": "CNF file", **json_body(ref("CnfFile"))}, **error_responses(404)},
+    },
+    ("GET", "/sat/cnf-files/<path:file_id>/content"): {
+        "tags": ["presets"],
+        "responses": {"200": {"description": "DIMACS text", "content": {"text/plain": {"schema": {"type": "string"}}}},
+                      **NOT_MODIFIED, **error_responses(404)},
+    },
+    ("GET", "/hardware"): {
+        "tags": ["daedalus"],
+        "responses": {"200": {"description": "Devices", **json_body(ref("HardwareDeviceList"))}},
+    },
+    ("POST", "/uploads"): {
+        "tags": ["upload"],
+        "requestBody": {"required": True, "content": {"multipart/form-data": {"schema": {
+            "type": "object",
+            "properties": {
+                "file": {"type": "array", "items": {"type": "string", "format": "binary"},
+                         "description": "Any number of " + ", ".join(UPLOAD_EXTENSIONS) + " parts"},
+                "checksums": {"type": "string", "description": "JSON object of filename -> expected sha256"},
+            },
+        }}}},
+        "responses": {"201": {"description": "Stored", **json_body(ref("Upload"))}, **error_responses(400, 413, 415, 429)},
+    },
+    ("POST", "/uploads/resumable"): {
+        "tags": ["upload"],
+        "requestBody": {"required": True, **json_body({
+            "type": "object",
+            "required": ["filename", "size_bytes"],
+            "properties": {
+                "filename": {"type": "string"},
+                "size_bytes": {"type": "integer", "minimum": 1},
+                "sha256": {"type": "string", "pattern": "^[0-9a-fA-F]{64}$"},
+                "fields": {"type": "object", "additionalProperties": {"type": "string"}},
+            },
+        })},
+        "responses": {"201": {"description": "Session created", **json_body(ref("ResumableUpload"))},
+                      **error_responses(400, 413, 415, 429)},
+    },
+    ("PATCH", "/uploads/resumable/<session_id>"): {
+        "tags": ["upload"],
+        "parameters": [{"name": "Upload-Offset", "in": "header", "required": True, "schema": {"type": "integer"}}],
+        "requestBody": {"required": True, "content": {RESUMABLE_CONTENT_TYPE: {"schema": {"type": "string", "format": "binary"}}}},
+        "responses": {
+            "200": {"description": "Bytes appended; upload is set once the last byte arrives", **json_body(ref("ResumableUpload"))},
+            **error_responses(400, 404, 409, 413, 415),
+        },
+    },
+    ("GET", "/uploads/<upload_id>"): {
+        "tags": ["upload"],
+        "responses": {"200": {"description": "Upload", **json_body(ref("Upload"))}, **error_responses(404)},
+    },
+    ("GET", "/hardware/<device_id>"): {
+        "tags": ["daedalus"],
+        "responses": {"200": {"description": "Device", **json_body(ref("HardwareDevice"))}, **error_responses(404)},
+    },
+    ("POST", "/admin/hardware/<device_id>/firmware"): {
+        "tags": ["daedalus", "upload"],
+        "requestBody": {"required": True, "content": {"multipart/form-data": {"schema": ref("FirmwareUpload")}}},
+        "responses": {
+            "200": {"description": "Board flashed", **json_body(ref("FirmwareUpdate"))},
+            "502": {"description": "Flash failed or rolled back", **json_body(ref("FirmwareUpdate"))},
+            **error_responses(400, 401, 403, 404, 429),
+        },
+    },
+}
+
+def openapi_path(rule):
+    """Flask URL rule to an OpenAPI path template plus its path parameters"""
+    names = re.findall(r"<(?:[^:<>]+:)?([^<>]+)>", rule)
+    path = re.sub(r"<(?:[^:<>]+:)?([^<>]+)>", r"{\1}", rule)
+    return path, [{"name": name, "in": "path", "required": True, "schema": {"type": "string"}} for name in names]
+
+def build_openapi_spec():
+    """OpenAPI 3 document generated from the registered routes"""
+    paths = {}
+    for rule in sorted(app.url_map.iter_rules(), key=lambda r: r.rule):
+        if rule.endpoint == "static":
+            continue
+        path, parameters = openapi_path(rule.rule)
+        doc = (app.view_functions[rule.endpoint].__doc__ or "").strip()
+        for method in sorted(rule.methods - {"HEAD", "OPTIONS"}):
+            operation = {
+                "operationId": f"{rule.endpoint}_{method.lower()}",
+                "summary": doc.splitlines()[0] if doc else rule.endpoint,
+                "responses": {"default": {"description": "JSON response"}},
+            }
+            if rule.rule in DEPRECATED_ROUTES:
+                operation["deprecated"] = True
+            operation.update(copy.deepcopy(OPENAPI_OPERATIONS.get((method, rule.rule), {})))
+            if parameters:
+                operation["parameters"] = parameters + operation.get("parameters", [])
+            paths.setdefault(path, {})[method.lower()] = operation
+
+    spec = {
+        "openapi": "3.0.3",
+        "info": {"title": "Dacroq API", "version": API_VERSION},
+        # Paths below are relative to the versioned prefix; the unprefixed aliases are deprecated
+        "servers": [{"url": API_PREFIX}],
+        "paths": paths,
+        "components": {"schemas": openapi_schemas()},
+    }
+    if API_KEY:
+        spec["components"]["securitySchemes"] = {"apiKey": {"type": "apiKey", "in": "header", "name": "X-API-Key"}}
+        spec["security"] = [{"apiKey": []}]
+    return spec
+
+@app.route("/openapi.json", methods=["GET"])
+def openapi_spec():
+    """OpenAPI 3 description of this API"""
+    return jsonify(build_openapi_spec())
+
+# ------------------------------ Server Lifecycle -----------------------------
+import signal
+from werkzeug.serving import WSGIRequestHandler
+
+# Socket timeout for reading a request and writing its response; also closes idle keep-alive connections
+HTTP_TIMEOUT_SECONDS = float(os.getenv("HTTP_TIMEOUT_SECONDS", 60))
+MAX_HEADER_BYTES = int(os.getenv("MAX_HEADER_BYTES", 16 * 1024))
+# How long SIGTERM waits for running tests before exiting; batches checkpoint well within this
+SHUTDOWN_DRAIN_SECONDS = float(os.getenv("SHUTDOWN_DRAIN_SECONDS", 30))
+
+class TimeoutRequestHandler(WSGIRequestHandler):
+    timeout = HTTP_TIMEOUT_SECONDS
+
+@app.before_request
+def enforce_request_limits():
+    """Refuse oversized headers, and new work while the server drains for shutdown"""
+    header_bytes = sum(len(name) + len(value) + 4 for name, value in request.headers.items())
+    if header_bytes > MAX_HEADER_BYTES:
+        return error_response("Request headers too large", 431, details={"limit_bytes": MAX_HEADER_BYTES})
+    rule = request.url_rule.rule if request.url_rule else None
+    if shutdown_requested.is_set() and (request.method, rule) in RATE_LIMITED_ROUTES:
+        response, status = error_response("Server is shutting down", 503, "shutting_down")
+        response.headers["Retry-After"] = str(math.ceil(SHUTDOWN_DRAIN_SECONDS))
+        return response, status
+    if admin_drain["active"] and (request.method, rule) in RATE_LIMITED_ROUTES:
+        return error_response("Server is draining and not accepting new work", 503, "draining",
+                              {"since": admin_drain["since"]})
+    return None
+
+def drain_active_tests(timeout):
+    """Wait for running tests to finish or checkpoint; returns the IDs still running"""
+    deadline = time.time() + timeout
+    for test_id, thread in list(active_test_threads.items()):
+        thread.join(max(deadline - time.time(), 0))
+    return [test_id for test_id, thread in active_test_threads.items() if thread.is_alive()]
+
+def handle_shutdown_signal(signum, frame):
+    """SIGTERM/SIGINT: stop taking work, let batches checkpoint, then exit"""
+    if shutdown_requested.is_set():
+        # A second signal skips the drain
+        raise SystemExit(1)
+    shutdown_requested.set()
+    running = [test_id for test_id, thread in active_test_threads.items() if thread.is_alive()]
+    logger.info(f"Shutting down; draining {len(running)} running tests for up to {SHUTDOWN_DRAIN_SECONDS:.0f}s")
+    remaining = drain_active_tests(SHUTDOWN_DRAIN_SECONDS)
+    if remaining:
+        logger.warning(f"Exiting with {len(remaining)} tests still running: {', '.join(remaining)}")
+        mark_interrupted_tests()
+    raise SystemExit(0)
+
+# ------------------------------ TLS ------------------------------------------
+import ssl
+from urllib.parse import quote
+from werkzeug.serving import make_server
+
+# HTTPS from provided certificate files, or from Let's Encrypt through certbot for TLS_ACME_DOMAINS
+TLS_CERT_FILE = os.getenv("TLS_CERT_FILE")
+TLS_KEY_FILE = os.getenv("TLS_KEY_FILE")
+TLS_ACME_DOMAINS = [d.strip() for d in os.getenv("TLS_ACME_DOMAINS", "").split(",") if d.strip()]
+TLS_ACME_EMAIL = os.getenv("TLS_ACME_EMAIL")
+TLS_ACME_DIR = Path(os.getenv("TLS_ACME_DIR", DATA_DIR / "acme"))  # certbot config, work dir and challenge webroot
+TLS_ACME_STAGING = os.getenv("TLS_ACME_STAGING", "false").lower() == "true"
+# How often to ask certbot to renew and to pick up replaced certificate files
+TLS_RENEW_INTERVAL_SECONDS = float(os.getenv("TLS_RENEW_INTERVAL_SECONDS", 12 * 3600))
+# Plain-HTTP port that redirects to HTTPS and answers ACME challenges (80 for Let's Encrypt); 0 disables it
+HTTP_REDIRECT_PORT = int(os.getenv("HTTP_REDIRECT_PORT", 0))
+HSTS_MAX_AGE_SECONDS = int(os.getenv("HSTS_MAX_AGE_SECONDS", 0))
+ACME_TOKEN_PATTERN = re.compile(r"^[A-Za-z0-9_-]+$")
+
+def tls_enabled():
+    return bool(TLS_ACME_DOMAINS or TLS_CERT_FILE)
+
+def acme_webroot():
+    return TLS_ACME_DIR / "webroot"
+
+def tls_certificate_paths():
+    if TLS_ACME_DOMAINS:
+        live = TLS_ACME_DIR / "config" / "live" / TLS_ACME_DOMAINS[0]
+        return live / "fullchain.pem", live / "privkey.pem"
+    return Path(TLS_CERT_FILE), Path(TLS_KEY_FILE)
+
+def run_certbot():
+    """Obtain the certificate, or renew it once it is close to expiry"""
+    command = [
+        "certbot", "certonly", "--webroot", "-w", str(acme_webroot()), "--non-interactive", "--agree-tos",
+        "--keep-until-expiring", "--config-dir", str(TLS_ACME_DIR / "config"),
+        "--work-dir", str(TLS_ACME_DIR / "work"), "--logs-dir", str(TLS_ACME_DIR / "logs"),
+    ]
+    command += ["-m", TLS_ACME_EMAIL] if TLS_ACME_EMAIL else ["--register-unsafely-without-email"]
+    for domain in TLS_ACME_DOMAINS:
+        command += ["-d", domain]
+    if TLS_ACME_STAGING:
+        command.append("--staging")
+    acme_webroot().mkdir(parents=True, exist_ok=True)
+    try:
+        result = subprocess.run(command, capture_output=True, text=True, timeout=600)
+    except FileNotFoundError:
+        raise RuntimeError("TLS_ACME_DOMAINS is set but certbot is not installed")
+    if result.returncode != 0:
+        raise RuntimeError(f"certbot failed: {(result.stderr or result.stdout).strip()[-500:]}")
+
+def build_tls_context():
+    """Server SSLContext, or None when TLS is not configured"""
+    if not tls_enabled():
+        return None
+    if TLS_ACME_DOMAINS:
+        run_certbot()
+    cert, key = tls_certificate_paths()
+    context = ssl.create_default_context(ssl.Purpose.CLIENT_AUTH)
+    context.minimum_version = ssl.TLSVersion.TLSv1_2
+    context.load_cert_chain(cert, key)
+    logger.info(f"TLS enabled with {cert}")
+    return context
+
+def start_tls_renewal(context):
+    """Renew through certbot and reload the chain into the live context; new handshakes use the new certificate"""
+    cert, key = tls_certificate_paths()
+
+    def run():
+        loaded = cert.stat().st_mtime_ns
+        while True:
+            time.sleep(TLS_RENEW_INTERVAL_SECONDS)
+            try:
+                if TLS_ACME_DOMAINS:
+                    run_certbot()
+                if cert.stat().st_mtime_ns != loaded:
+                    context.load_cert_chain(cert, key)
+                    loaded = cert.stat().st_mtime_ns
+                    logger.info(f"Reloaded TLS certificate {cert}")
+            except Exception as e:
+                logger.error(f"TLS certificate renewal failed: {e}")
+
+    thread = threading.Thread(target=run, daemon=True, name="tls-renewal")
+    thread.start()
+    return thread
+
+def https_redirect_app(https_port):
+    """Plain-HTTP app: serve ACME challenge files, redirect everything else to HTTPS"""
+    def application(environ, start_response):
+        path = environ.get("PATH_INFO", "")
+        prefix = "/.well-known/acme-challenge/"
+        if path.startswith(prefix):
+            token = path[len(prefix):]
+            challenge = acme_webroot() / ".well-known" / "acme-challenge" / token
+            if ACME_TOKEN_PATTERN.match(token) and challenge.is_file():
+                body = challenge.read_bytes()
+                start_response("200 OK", [("Content-Type", "text/plain"), ("Content-Length", str(len(body)))])
+                return [body]
+            start_response("404 Not Found", [("Content-Length", "0")])
+            return [b""]
+
+        host = environ.get("HTTP_HOST", "").rsplit(":", 1)[0]
+        if TLS_ACME_DOMAINS and host not in TLS_ACME_DOMAINS:
+            # Never redirect to a host the certificate doesn't cover
+            host = TLS_ACME_DOMAINS[0]
+        netloc = host if https_port == 443 else f"{host}:{https_port}"
+        location = f"https://{netloc}{quote(environ.get('SCRIPT_NAME', '') + path)}"
+        if environ.get("QUERY_STRING"):
+            location += "?" + environ["QUERY_STRING"]
+        # 308 keeps the method and body, so API clients' POSTs survive the redirect
+        start_response("308 Permanent Redirect", [("Location", location), ("Content-Length", "0")])
+        return [b""]
+
+    return application
+
+def start_https_redirect(https_port):
+    server = make_server("0.0.0.0", HTTP_REDIRECT_PORT, https_redirect_app(https_port), threaded=True)
+    thread = threading.Thread(target=server.serve_forever, daemon=True, name="https-redirect")
+    thread.start()
+    logger.info(f"Redirecting http://:{HTTP_REDIRECT_PORT} to HTTPS port {https_port}")
+    return server
+
+@app.after_request
+def add_hsts_header(response):
+    if HSTS_MAX_AGE_SECONDS and request.is_secure:
+        response.headers["Strict-Transport-Security"] = f"max-age={HSTS_MAX_AGE_SECONDS}"
+    return response
+
+def validate_tls_config():
+    """Refuse to start with a half-configured TLS setup rather than silently serving plain HTTP"""
+    if bool(TLS_CERT_FILE) != bool(TLS_KEY_FILE):
+        raise SystemExit("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+    if TLS_CERT_FILE and TLS_ACME_DOMAINS:
+        raise SystemExit("Set either TLS_CERT_FILE/TLS_KEY_FILE or TLS_ACME_DOMAINS, not both")
+    if TLS_ACME_DOMAINS and not HTTP_REDIRECT_PORT:
+        raise SystemExit("TLS_ACME_DOMAINS needs HTTP_REDIRECT_PORT (normally 80) to answer ACME challenges")
+
+# ------------------------------ Listeners ------------------------------------
+# Unset for TCP on PORT, "unix:/path/to/api.sock" behind nginx, or "systemd" for a socket-activated listener
+API_LISTEN = os.getenv("API_LISTEN", "")
+UNIX_SOCKET_MODE = int(os.getenv("UNIX_SOCKET_MODE", "660"), 8)
+SD_LISTEN_FDS_START = 3  # first inherited descriptor under systemd socket activation
+
+def systemd_listen_fd():
+    """The first socket passed by systemd, or None when the process wasn't socket-activated"""
+    if os.getenv("LISTEN_PID") != str(os.getpid()):
+        return None
+    count = int(os.getenv("LISTEN_FDS") or 0)
+    if count < 1:
+        return None
+    if count > 1:
+        logger.warning(f"systemd passed {count} sockets; serving only the first")
+    # Child processes (certbot, avrdude) must not think the sockets are theirs
+    for name in ("LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"):
+        os.environ.pop(name, None)
+    return SD_LISTEN_FDS_START
+
+def unix_socket_path(spec):
+    path = spec.split(":", 1)[1]
+    return Path(path[2:] if path.startswith("//") else path)
+
+def check_unix_socket_free(path):
+    """A socket file nobody answers on is left over from a crash; one that answers means another server"""
+    if not path.exists():
+        return
+    probe = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
+    try:
+        probe.connect(str(path))
+    except OSError:
+        return  # stale; werkzeug removes it when binding
+    finally:
+        probe.close()
+    raise SystemExit(f"Another server is already listening on {path}")
+
+def listener_address(port):
+    """(host, port, fd) for make_server from API_LISTEN"""
+    if API_LISTEN == "systemd":
+        fd = systemd_listen_fd()
+        if fd is None:
+            raise SystemExit("API_LISTEN=systemd but no socket was passed (LISTEN_PID/LISTEN_FDS)")
+        probe = socket.socket(fileno=os.dup(fd))
+        family, name = probe.family, probe.getsockname()
+        probe.close()
+        if family == socket.AF_UNIX:
+            return f"unix://{name}", 0, fd
+        return name[0], name[1], fd
+    if API_LISTEN.startswith("unix:"):
+        path = unix_socket_path(API_LISTEN)
+        path.parent.mkdir(parents=True, exist_ok=True)
+        check_unix_socket_free(path)
+        return f"unix://{path}", 0, None
+    raise SystemExit(f"API_LISTEN must be unix:<path> or systemd, not {API_LISTEN!r}")
+
+def serve(port, ssl_context):
+    """Serve on the configured unix socket or inherited descriptor until shutdown"""
+    host, port, fd = listener_address(port)
+    server = make_server(host, port, app, threaded=True, request_handler=TimeoutRequestHandler,
+                         ssl_context=ssl_context, fd=fd)
+    if host.startswith("unix://") and fd is None:
+        os.chmod(host[len("unix://"):], UNIX_SOCKET_MODE)
+    logger.info(f"Listening on {host}{f':{port}' if port else ''}{' (systemd socket)' if fd is not None else ''}")
+    server.serve_forever()
 
 # ------------------------------ Main -----------------------------------------
 if __name__ == "__main__":
+    if len(sys.argv) > 1 and sys.argv[1] in RESULTS_COMMANDS:
+        raise SystemExit(results_command(sys.argv[1:]))
+    validate_tls_config()
+    validate_startup()
     init_db()
+    result_store.migrate()
+    if STORAGE_BACKEND != "local":
+        logger.info(f"Object storage: mirrored {sync_presets_from_storage()} preset files from {STORAGE_S3_BUCKET}")
+    mark_interrupted_tests()
+    load_difficulty_model()
+    load_offload_model()
+    if os.getenv("HARDWARE_DISCOVERY_ON_STARTUP", "true").lower() == "true":
+        hardware_manager.discover_all_devices()
+    start_preset_preloader()
+    start_retention_sweeper()
     app.start_time = time.time()
     logger.info("Dacroq API starting…")
     logger.info(f"Database: {DB_PATH}")
+    logger.info(f"Results store: {RESULTS_STORE}")
+    logger.info(f"Object storage: {STORAGE_BACKEND}")
     logger.info(f"Data directory: {DATA_DIR}")
+    signal.signal(signal.SIGTERM, handle_shutdown_signal)
+    signal.signal(signal.SIGINT, handle_shutdown_signal)
+    port = int(os.getenv("PORT", 8000))
+    if HTTP_REDIRECT_PORT and tls_enabled():
+        # Up before certbot runs, since Let's Encrypt fetches its challenge over plain HTTP
+        start_https_redirect(port)
+    ssl_context = build_tls_context()
+    if ssl_context:
+        start_tls_renewal(ssl_context)
+    if API_LISTEN:
+        serve(port, ssl_context)
+        raise SystemExit(0)
     app.run(
         host="0.0.0.0",
-        port=int(os.getenv("PORT", 8000)),
+        port=port,
         debug=os.getenv("FLASK_ENV") == "development",
+        threaded=True,
+        request_handler=TimeoutRequestHandler,
+        ssl_context=ssl_context,
     )
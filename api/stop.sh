@@ -6,7 +6,13 @@ SESSIONS=(api)
 for S in "${SESSIONS[@]}"; do
     if tmux has-session -t "$S" 2>/dev/null; then
         echo "Stopping tmux session $S"
-        tmux kill-session -t "$S"
+        # Ctrl-C lets the API checkpoint running batches before it exits
+        tmux send-keys -t "$S" C-c
+        for _ in $(seq 1 "${SHUTDOWN_DRAIN_SECONDS:-30}"); do
+            tmux has-session -t "$S" 2>/dev/null || break
+            sleep 1
+        done
+        tmux kill-session -t "$S" 2>/dev/null || true
     else
         echo "Session $S not running – skipping"
     fi
@@ -0,0 +1,90 @@
+#!/usr/bin/env python3
+"""BoardScheduler moving batch problems off failed boards
+
+Run with: pytest api/test_board_scheduler.py
+"""
+
+import pytest
+
+import main
+
+TIMEOUT = 5
+
+
+class FakeBoards:
+    """Board "a" always reports a board failure; board "b" solves, except that problem 2 raises on it"""
+
+    def __init__(self):
+        self.calls = []
+
+    def run(self, problem, device_id):
+        self.calls.append((problem, device_id))
+        if device_id == "a":
+            return {"offload_decision": {"board_failure": True}}
+        if problem == 2:
+            raise RuntimeError("instance could not be generated")
+        return {"problem": problem, "offload_decision": {"use_hardware": True}}
+
+
+@pytest.fixture
+def scheduler():
+    scheduler = main.BoardScheduler(["a", "b"], name="test-boards")
+    yield scheduler
+    # Release any worker still waiting for a board, so a leak fails the test instead of hanging it
+    scheduler.free_boards.put(None)
+    scheduler.shutdown()
+
+
+def submit(scheduler, boards, positions):
+    for position in positions:
+        scheduler.submit(position, lambda device_id, p=position: boards.run(p, device_id))
+
+
+def collect(scheduler, position):
+    # Times out, rather than blocking forever, if a board leaked and the problem never got one
+    scheduler.futures[position].exception(timeout=TIMEOUT)
+    return scheduler.result(position)
+
+
+def test_work_moves_off_failed_and_raising_boards(scheduler):
+    boards = FakeBoards()
+
+    submit(scheduler, boards, [0, 1])
+    first = [collect(scheduler, position) for position in (0, 1)]
+    assert [r["problem"] for r in first] == [0, 1]
+    assert all(r["device_id"] == "b" for r in first)
+    # Whichever problem drew board "a" first was moved to "b"
+    assert [r.get("reassigned_from") for r in first].count(["a"]) == 1
+
+    submit(scheduler, boards, [2])
+    with pytest.raises(RuntimeError):
+        collect(scheduler, 2)
+
+    # The raising problem handed "b" back, so later problems still get a board
+    submit(scheduler, boards, [3, 4])
+    later = [collect(scheduler, position) for position in (3, 4)]
+    assert [r["problem"] for r in later] == [3, 4]
+    assert all(r["device_id"] == "b" for r in later)
+
+    summary = scheduler.summary()
+    assert summary["failed_boards"] == ["a"]
+    assert summary["problems_per_board"] == {"a": 0, "b": 4}
+
+
+def test_every_board_failing_runs_without_a_board(scheduler):
+    ran = []
+
+    def run(device_id, position):
+        ran.append((position, device_id))
+        if device_id:
+            return {"offload_decision": {"board_failure": True}}
+        return {"position": position}
+
+    for position in range(4):
+        scheduler.submit(position, lambda device_id, p=position: run(device_id, p))
+    results = [collect(scheduler, position) for position in range(4)]
+
+    assert [r["position"] for r in results] == list(range(4))
+    assert "device_id" not in results[0]
+    assert sorted(scheduler.summary()["failed_boards"]) == ["a", "b"]
+    assert sorted(board for r in results for board in r.get("reassigned_from", [])) == ["a", "b"]
@@ -0,0 +1,135 @@
+#!/usr/bin/env python3
+"""Path handling for GET /sat/cnf-files/<file_id>/content
+
+Run with: pytest api/test_cnf_file_content.py
+"""
+
+import os
+
+import pytest
+
+import main
+
+DIMACS = "p cnf 3 2\n1 -2 0\n2 3 0\n"
+SECRET = "p cnf 1 1\n1 0\n"
+
+
+@pytest.fixture
+def roots(tmp_path, monkeypatch):
+    """Presets and snapshots under a scratch directory, with a secret CNF file next to them"""
+    presets = tmp_path / "presets"
+    snapshots = tmp_path / "snapshots"
+    outside = tmp_path / "outside"
+    for directory in (presets / "uf20", snapshots / "uf20" / "v1", outside):
+        directory.mkdir(parents=True)
+
+    (presets / "uf20" / "uf20-01.cnf").write_text(DIMACS)
+    (presets / "uf20" / "UF20-02.CNF").write_text(DIMACS)
+    (presets / "uf20" / ".hidden.cnf").write_text(SECRET)
+    (presets / "uf20" / "notes.txt").write_text(SECRET)
+    (presets / "uf20" / "uf20-01.cnf.bak").write_text(SECRET)
+    (snapshots / "uf20" / "v1" / "uf20-01.cnf").write_text(DIMACS)
+    (outside / "secret.cnf").write_text(SECRET)
+
+    # A hidden preset and an unfinished snapshot staging directory
+    (presets / ".private").mkdir()
+    (presets / ".private" / "a.cnf").write_text(SECRET)
+    (snapshots / "uf20" / f"{main.TEMP_PREFIX}v2.abc").mkdir()
+    (snapshots / "uf20" / f"{main.TEMP_PREFIX}v2.abc" / "uf20-01.cnf").write_text(SECRET)
+
+    # Symlinks that lead out of the presets root: one file, one whole preset
+    os.symlink(outside / "secret.cnf", presets / "uf20" / "link.cnf")
+    os.symlink(outside, presets / "escape")
+    os.symlink(outside, snapshots / "uf20" / "escape")
+
+    monkeypatch.setattr(main, "SAT_PRESETS_DIR", presets)
+    monkeypatch.setattr(main, "PRESET_SNAPSHOTS_DIR", snapshots)
+    monkeypatch.setattr(main.cnf_index, "root", presets)
+    return {"presets": presets, "snapshots": snapshots, "outside": outside}
+
+
+@pytest.fixture
+def client(roots, monkeypatch):
+    monkeypatch.setattr(main, "API_KEY", None)
+    main.app.config["TESTING"] = True
+    with main.app.test_client() as client:
+        yield client
+
+
+@pytest.mark.parametrize("file_id", ["uf20/uf20-01.cnf", "uf20/UF20-02.CNF", "uf20@v1/uf20-01.cnf"])
+def test_resolves_files_inside_the_root(roots, file_id):
+    path = main.resolve_preset_file(file_id)
+    assert path is not None
+    assert path.read_text() == DIMACS
+
+
+@pytest.mark.parametrize("file_id", [
+    # Parent directory references
+    "../outside/secret.cnf",
+    "uf20/../../outside/secret.cnf",
+    "uf20/..",
+    "../secret.cnf",
+    "uf20@../secret.cnf",
+    "uf20@v1/../uf20-01.cnf",
+    ".././secret.cnf",
+    # Absolute paths
+    "/etc/passwd",
+    "/outside/secret.cnf",
+    "uf20//secret.cnf",
+    # Backslashes and NUL bytes
+    "uf20\\..\\secret.cnf",
+    "uf20/..\\secret.cnf",
+    "uf20/uf20-01.cnf\0.txt",
+    "uf20\0/uf20-01.cnf",
+    # Symlinks pointing out of the root
+    "uf20/link.cnf",
+    "escape/secret.cnf",
+    "uf20@escape/secret.cnf",
+    # Hidden files and directories, snapshot staging areas included
+    "uf20/.hidden.cnf",
+    ".private/a.cnf",
+    f"uf20@{main.TEMP_PREFIX}v2.abc/uf20-01.cnf",
+    # Anything that is not a CNF file
+    "uf20/notes.txt",
+    "uf20/uf20-01.cnf.bak",
+    "uf20/uf20-01",
+    # Missing files and malformed ids
+    "uf20/missing.cnf",
+    "uf20",
+    "uf20/sub/uf20-01.cnf",
+    "",
+])
+def test_rejects_ids_outside_the_root(roots, file_id):
+    assert main.resolve_preset_file(file_id) is None
+
+
+def test_serves_content(client):
+    response = client.get("/sat/cnf-files/uf20/uf20-01.cnf/content")
+    assert response.status_code == 200
+    assert response.get_data(as_text=True) == DIMACS
+
+
+def test_serves_snapshot_content(client):
+    response = client.get("/sat/cnf-files/uf20@v1/uf20-01.cnf/content")
+    assert response.status_code == 200
+    assert response.get_data(as_text=True) == DIMACS
+
+
+@pytest.mark.parametrize("url", [
+    "/sat/cnf-files/../outside/secret.cnf/content",
+    "/sat/cnf-files/%2e%2e/outside/secret.cnf/content",
+    "/sat/cnf-files/uf20/%2e%2e%2f%2e%2e%2foutside%2fsecret.cnf/content",
+    "/sat/cnf-files//etc/passwd/content",
+    "/sat/cnf-files/%2fetc/passwd/content",
+    "/sat/cnf-files/uf20/uf20-01.cnf%00.txt/content",
+    "/sat/cnf-files/uf20/link.cnf/content",
+    "/sat/cnf-files/escape/secret.cnf/content",
+    "/sat/cnf-files/uf20/.hidden.cnf/content",
+    "/sat/cnf-files/.private/a.cnf/content",
+    "/sat/cnf-files/uf20/notes.txt/content",
+])
+def test_content_route_never_leaves_the_root(client, url):
+    # Merged double slashes come back as a redirect to the merged path first
+    response = client.get(url, follow_redirects=True)
+    assert response.status_code == 404
+    assert SECRET not in response.get_data(as_text=True)
@@ -0,0 +1,98 @@
+#!/usr/bin/env python3
+"""Error envelope and the ERROR_CODE_TABLE codes routes report
+
+Run with: pytest api/test_error_envelope.py
+"""
+
+import pytest
+
+import main
+
+DIMACS = "p cnf 3 2\n1 -2 0\n2 3 0\n"
+REQUEST_ID = "test-request-id"
+
+
+@pytest.fixture
+def client(monkeypatch):
+    monkeypatch.setattr(main, "API_KEY", None)
+    main.app.config["TESTING"] = True
+    with main.app.test_client() as client:
+        yield client
+
+
+def envelope(response, status, code):
+    """Check the envelope fields and return its body"""
+    assert response.status_code == status
+    body = response.get_json()
+    assert {"code", "message", "details", "request_id"} <= set(body)
+    assert body["code"] == code
+    assert body["code"] in main.ERROR_CODE_TABLE
+    assert isinstance(body["message"], str) and body["message"]
+    assert isinstance(body["details"], dict)
+    assert body["request_id"] == REQUEST_ID
+    return body
+
+
+def solve_one(client, dimacs=DIMACS):
+    return client.post("/solve-one?solver=minisat", data=dimacs, content_type="text/plain",
+                       headers={"X-Request-ID": REQUEST_ID})
+
+
+def failing_solver(error):
+    def solve(*args, **kwargs):
+        raise error
+    return solve
+
+
+def test_preset_not_found(client):
+    response = client.get("/sat/cnf-files/no-such-preset/a.cnf/content", headers={"X-Request-ID": REQUEST_ID})
+    body = envelope(response, 404, "preset_not_found")
+    assert body["details"]["file_id"] == "no-such-preset/a.cnf"
+
+
+def test_parse_error_reports_the_line(client):
+    body = envelope(solve_one(client, "p cnf 3 2\n1 -2 0\n2 x 0\n"), 400, "parse_error")
+    assert body["details"]["line"] == 3
+
+
+def test_hardware_unavailable(client, monkeypatch):
+    monkeypatch.setattr(main, "cached_single_sat_test",
+                        failing_solver(main.HardwareUnavailableError("No DAEDALUS board connected")))
+    body = envelope(solve_one(client), 503, "hardware_unavailable")
+    assert body["message"] == "No DAEDALUS board connected"
+
+
+def test_timeout(client, monkeypatch):
+    monkeypatch.setattr(main, "cached_single_sat_test", failing_solver(TimeoutError("Board busy")))
+    envelope(solve_one(client), 504, "timeout")
+
+
+@pytest.mark.parametrize("error", [KeyError("solver_results"), RuntimeError("boom")])
+def test_unrecognised_exception_is_an_internal_error(client, monkeypatch, error):
+    monkeypatch.setattr(main, "cached_single_sat_test", failing_solver(error))
+    envelope(solve_one(client), 500, "internal_error")
+
+
+def test_route_value_error_is_an_internal_error(client):
+    # int("abc") inside the route's own try block
+    envelope(client.get("/tests?limit=abc", headers={"X-Request-ID": REQUEST_ID}), 500, "internal_error")
+
+
+def test_exception_response_codes():
+    cases = [
+        (main.DimacsParseError("non-integer literal", 7), 400, "parse_error"),
+        (main.HardwareUnavailableError("gone"), 503, "hardware_unavailable"),
+        (TimeoutError("slow"), 504, "timeout"),
+        (ValueError("bad"), 500, "internal_error"),
+    ]
+    with main.app.test_request_context("/", headers={"X-Request-ID": REQUEST_ID}):
+        main.g.request_id = REQUEST_ID
+        for error, status, code in cases:
+            response, response_status = main.exception_response(error)
+            assert response_status == status
+            body = response.get_json()
+            assert body["code"] == code
+            assert body["request_id"] == REQUEST_ID
+            assert isinstance(body["details"], dict)
+        response, _ = main.exception_response(main.DimacsParseError("non-integer literal", 7))
+        assert response.get_json()["details"] == {"line": 7}